@@ -0,0 +1,172 @@
+package zikade
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// maxAdmissionPeers is the number of remote peers whose token buckets the
+// admission control keeps before it forgets the buckets that are full again.
+const maxAdmissionPeers = 1024
+
+// Reasons for which [pirAdmission] refuses private requests. They are
+// recorded as the reason attribute of the rejected requests metric.
+const (
+	admissionReasonPeerRate   = "peer_rate"
+	admissionReasonGlobalRate = "global_rate"
+	admissionReasonInFlight   = "in_flight"
+)
+
+// tokenBucket is a token bucket that is refilled with rate tokens per second
+// up to burst tokens. It is not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// refill adds the tokens that accrued since the last refill.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// available reports whether a token can be taken at the given time.
+func (b *tokenBucket) available(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= 1
+}
+
+// take takes a token, which must be available.
+func (b *tokenBucket) take() {
+	b.tokens--
+}
+
+// full reports whether the bucket holds burst tokens at the given time, in
+// which case it is equivalent to a new bucket.
+func (b *tokenBucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// pirAdmission limits the private requests that a DHT processes for other
+// peers, as they cost orders of magnitude more computation than other
+// requests. A request is admitted if the token buckets of its remote peer and
+// of all peers hold a token, and fewer than the maximum number of requests are
+// in flight. Limits that are configured with 0 don't apply. It is safe for
+// concurrent use.
+type pirAdmission struct {
+	clk clock.Clock
+
+	peerRate  float64
+	peerBurst int
+
+	mu     sync.Mutex
+	peers  map[peer.ID]*tokenBucket
+	global *tokenBucket // nil if requests of all peers aren't rate limited
+
+	// inFlight holds a token for each request that is processed, nil if the
+	// number of requests in flight isn't bounded
+	inFlight chan struct{}
+}
+
+func newPIRAdmission(cfg *Config) *pirAdmission {
+	a := &pirAdmission{
+		clk:       cfg.Clock,
+		peerRate:  cfg.PIRPeerRateLimit,
+		peerBurst: cfg.PIRPeerBurst,
+		peers:     make(map[peer.ID]*tokenBucket),
+	}
+	if cfg.PIRGlobalRateLimit > 0 {
+		a.global = newTokenBucket(cfg.PIRGlobalRateLimit, cfg.PIRGlobalBurst, cfg.Clock.Now())
+	}
+	if cfg.PIRMaxInFlight > 0 {
+		a.inFlight = make(chan struct{}, cfg.PIRMaxInFlight)
+	}
+	return a
+}
+
+// admit returns whether a private request from the remote peer is processed.
+// If it is, release must be called once the request was processed. Otherwise,
+// reason tells which limit the request exceeded. Refused requests don't take
+// tokens from the buckets.
+func (a *pirAdmission) admit(remote peer.ID) (release func(), reason string, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clk.Now()
+
+	var bucket *tokenBucket
+	if a.peerRate > 0 {
+		bucket = a.peerBucket(remote, now)
+		if !bucket.available(now) {
+			return nil, admissionReasonPeerRate, false
+		}
+	}
+	if a.global != nil && !a.global.available(now) {
+		return nil, admissionReasonGlobalRate, false
+	}
+
+	release = func() {}
+	if a.inFlight != nil {
+		select {
+		case a.inFlight <- struct{}{}:
+			release = func() { <-a.inFlight }
+		default:
+			return nil, admissionReasonInFlight, false
+		}
+	}
+
+	if bucket != nil {
+		bucket.take()
+	}
+	if a.global != nil {
+		a.global.take()
+	}
+
+	return release, "", true
+}
+
+// inFlightRequests returns the number of admitted requests that weren't
+// released yet.
+func (a *pirAdmission) inFlightRequests() int {
+	return len(a.inFlight)
+}
+
+// peerBucket returns the token bucket of the remote peer. If the buckets of
+// too many peers are kept, the buckets that are full are forgotten first.
+func (a *pirAdmission) peerBucket(remote peer.ID, now time.Time) *tokenBucket {
+	if bucket, ok := a.peers[remote]; ok {
+		return bucket
+	}
+
+	if len(a.peers) >= maxAdmissionPeers {
+		for p, bucket := range a.peers {
+			if bucket.full(now) {
+				delete(a.peers, p)
+			}
+		}
+	}
+
+	bucket := newTokenBucket(a.peerRate, a.peerBurst, now)
+	a.peers[remote] = bucket
+	return bucket
+}
@@ -0,0 +1,84 @@
+package zikade
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPIRAdmission_peerRate(t *testing.T) {
+	clk := clock.NewMock()
+	cfg := DefaultConfig()
+	cfg.Clock = clk
+	cfg.PIRPeerRateLimit = 1
+	cfg.PIRPeerBurst = 2
+	cfg.PIRGlobalRateLimit = 0
+	cfg.PIRMaxInFlight = 0
+	a := newPIRAdmission(cfg)
+
+	remote := newPeerID(t)
+	for i := 0; i < 2; i++ {
+		release, _, ok := a.admit(remote)
+		require.True(t, ok)
+		release()
+	}
+
+	_, reason, ok := a.admit(remote)
+	assert.False(t, ok)
+	assert.Equal(t, admissionReasonPeerRate, reason)
+
+	// other peers have their own buckets
+	_, _, ok = a.admit(newPeerID(t))
+	assert.True(t, ok)
+
+	// the bucket is refilled over time
+	clk.Add(time.Second)
+	_, _, ok = a.admit(remote)
+	assert.True(t, ok)
+}
+
+func TestPIRAdmission_globalRate(t *testing.T) {
+	clk := clock.NewMock()
+	cfg := DefaultConfig()
+	cfg.Clock = clk
+	cfg.PIRPeerRateLimit = 0
+	cfg.PIRGlobalRateLimit = 1
+	cfg.PIRGlobalBurst = 1
+	cfg.PIRMaxInFlight = 0
+	a := newPIRAdmission(cfg)
+
+	_, _, ok := a.admit(newPeerID(t))
+	require.True(t, ok)
+
+	_, reason, ok := a.admit(newPeerID(t))
+	assert.False(t, ok)
+	assert.Equal(t, admissionReasonGlobalRate, reason)
+
+	clk.Add(time.Second)
+	_, _, ok = a.admit(newPeerID(t))
+	assert.True(t, ok)
+}
+
+func TestPIRAdmission_inFlight(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PIRPeerRateLimit = 0
+	cfg.PIRGlobalRateLimit = 0
+	cfg.PIRMaxInFlight = 1
+	a := newPIRAdmission(cfg)
+
+	release, _, ok := a.admit(newPeerID(t))
+	require.True(t, ok)
+	assert.Equal(t, 1, a.inFlightRequests())
+
+	_, reason, ok := a.admit(newPeerID(t))
+	assert.False(t, ok)
+	assert.Equal(t, admissionReasonInFlight, reason)
+
+	release()
+	assert.Equal(t, 0, a.inFlightRequests())
+	_, _, ok = a.admit(newPeerID(t))
+	assert.True(t, ok)
+}
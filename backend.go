@@ -9,6 +9,8 @@ import (
 	ds "github.com/ipfs/go-datastore"
 	record "github.com/libp2p/go-libp2p-record"
 	"github.com/libp2p/go-libp2p/core/peerstore"
+
+	"github.com/plprobelab/zikade/private_routing"
 )
 
 // Default namespaces
@@ -80,6 +82,10 @@ func NewBackendIPNS(ds ds.TxnDatastore, kb peerstore.KeyBook, cfg *RecordBackend
 		}
 	}
 
+	if cfg.PIRRowSize < private_routing.RowLengthPrefixSize {
+		return nil, fmt.Errorf("PIR row size must be at least %d bytes, got %d", private_routing.RowLengthPrefixSize, cfg.PIRRowSize)
+	}
+
 	return &RecordBackend{
 		cfg:       cfg,
 		log:       cfg.Logger,
@@ -100,6 +106,10 @@ func NewBackendPublicKey(ds ds.TxnDatastore, cfg *RecordBackendConfig) (be *Reco
 		}
 	}
 
+	if cfg.PIRRowSize < private_routing.RowLengthPrefixSize {
+		return nil, fmt.Errorf("PIR row size must be at least %d bytes, got %d", private_routing.RowLengthPrefixSize, cfg.PIRRowSize)
+	}
+
 	return &RecordBackend{
 		cfg:       cfg,
 		log:       cfg.Logger,
@@ -122,18 +132,23 @@ func NewBackendProvider(pstore peerstore.Peerstore, dstore Datastore, cfg *Provi
 		}
 	}
 
+	if cfg.PIRRowSize < private_routing.RowLengthPrefixSize {
+		return nil, fmt.Errorf("PIR row size must be at least %d bytes, got %d", private_routing.RowLengthPrefixSize, cfg.PIRRowSize)
+	}
+
 	cache, err := lru.New[string, providerSet](cfg.CacheSize)
 	if err != nil {
 		return nil, err
 	}
 
 	p := &ProvidersBackend{
-		cfg:       cfg,
-		log:       cfg.Logger,
-		cache:     cache,
-		namespace: namespaceProviders,
-		addrBook:  pstore,
-		datastore: dstore,
+		cfg:        cfg,
+		log:        cfg.Logger,
+		cache:      cache,
+		namespace:  namespaceProviders,
+		addrBook:   pstore,
+		datastore:  dstore,
+		pirBuckets: &providerBuckets{},
 	}
 
 	return p, nil
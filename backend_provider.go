@@ -5,22 +5,18 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
-	"github.com/plprobelab/zikade/private_routing"
 	"io"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/benbjohnson/clock"
 	lru "github.com/hashicorp/golang-lru/v2"
-	"github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/multiformats/go-base32"
-	"github.com/plprobelab/zikade/pb"
 	"go.opentelemetry.io/otel/metric"
 	"golang.org/x/exp/slog"
 
@@ -63,6 +59,10 @@ type ProvidersBackend struct {
 	gcCancelMu sync.RWMutex
 	gcCancel   context.CancelFunc
 	gcDone     chan struct{}
+
+	// pirBuckets holds the provider records in the buckets of the database
+	// that PIR requests for provider peers are processed over.
+	pirBuckets *providerBuckets
 }
 
 var (
@@ -105,6 +105,15 @@ type ProvidersBackendConfig struct {
 	// If you're manually configuring this backend, make sure to align the
 	// filter with the one configured in [Config.AddressFilter].
 	AddressFilter AddressFilter
+
+	// PIRRowSize is the size in bytes of each row of the database that PIR
+	// requests for provider peers are processed over. All rows are padded to
+	// this size, so that the size of a response doesn't depend on the number
+	// of provider records in a bucket. If the records of a bucket don't fit
+	// into a row, the records of the providers that were stored most recently
+	// are kept and older records are left out of the row. See
+	// [ProvidersBackend.ProviderPeersDatabaseForPIR].
+	PIRRowSize int
 }
 
 // DefaultProviderBackendConfig returns a default [ProvidersBackend]
@@ -126,6 +135,7 @@ func DefaultProviderBackendConfig() (*ProvidersBackendConfig, error) {
 		Logger:          slog.Default(),
 		Tele:            telemetry,
 		AddressFilter:   AddrFilterIdentity, // verify alignment with [Config.AddressFilter]
+		PIRRowSize:      4096,               // MAGIC: the bytes of a single response ciphertext with the default RLWE parameters
 	}, nil
 }
 
@@ -165,6 +175,10 @@ func (p *ProvidersBackend) Store(ctx context.Context, key string, value any) (an
 		return nil, fmt.Errorf("datastore put: %w", err)
 	}
 
+	p.pirBuckets.mu.Lock()
+	p.addToProviderBucket(key, addrInfo.ID, rec.expiry)
+	p.pirBuckets.mu.Unlock()
+
 	return addrInfo, nil
 }
 
@@ -244,111 +258,6 @@ func (p *ProvidersBackend) Validate(ctx context.Context, key string, values ...a
 	return bestIdx, nil
 }
 
-// Returns a map of CIDs to a list of provider peers who advertise that CID.
-// The output map is used to conduct PIR requests in RunPIRforProviderPeersRecords.
-// So internally, this method joins the datastore with the addrBook.
-// Rationale is below:
-// the datastore stores provider advertisements <CIDs, Peer ID providing that CID> --> expiry time.
-// the addrbook (address book) maps peer IDs to their multiaddresses
-// In Fetch, we first lookup the datastore for the peerIDs advertising a given CID key and then
-// we use the peerID as an index to lookup the address book for the multiaddresses.
-// We could lookup the datastore via PIR,
-// but then we cannot use that PIR output as an index to lookup the addressbook privately.
-// So we need to flatten out or join the two data structures for PIR to work.
-func (p *ProvidersBackend) MapCIDBucketsToProviderPeerBytesForPIR(ctx context.Context, bucketIndexLength int) ([][]byte, error) {
-	// get all records from the datastore
-	q, err := p.datastore.Query(ctx, dsq.Query{Prefix: "/"}) // also works with the empty string
-	if err != nil {
-		return nil, err
-	}
-
-	// close the fetch query upon ending the function
-	defer func() {
-		if err = q.Close(); err != nil {
-			p.log.LogAttrs(ctx, slog.LevelWarn, "failed closing fetch query", slog.String("err", err.Error()))
-		}
-	}()
-
-	now := p.cfg.clk.Now()
-	mapCIDtoProviderSet := make(map[string]*providerSet)
-
-	for e := range q.Next() {
-		p.fetchLoopForEachElement(ctx, e, now, mapCIDtoProviderSet)
-	}
-
-	// mapCIDtoProviderPeers := make(map[string]*pb.Message_CIDToProviderMap, len(mapCIDtoProviderSet))
-
-	// bucketing logic
-	if bucketIndexLength < 8 {
-		return nil, fmt.Errorf("bucketIndexLength represents the length of the bucket index, in *bits* --- it must be greater than 8")
-	}
-	if bucketIndexLength%8 != 0 {
-		// TODO: We should get rid of this requirement
-		return nil, fmt.Errorf("bucketIndexLength represents the length of the bucket index, in *bits* --- it must be a multiple of 8")
-	}
-	buckets := make([][]*pb.Message_CIDToProviderMap, 1<<bucketIndexLength)
-
-	// Transforms the set of providers into a PB Message that can be marshalled into a byte array.
-	// This is based on how handleGetProviders processes the output of Fetch
-	// they don't care about the set field of the providerSet (which maps peer IDs to times),
-	// as we've already checked for expired provider advertisements.
-	// There can be multiple providers for a given CID, so we first get a providerSet above and then
-	// transform it into a list of *pb.Message_Peer
-	for givenCID, providerSetForCID := range mapCIDtoProviderSet {
-		addrInfos := make([]*pb.Message_Peer, len(providerSetForCID.providers))
-		for _, provider := range providerSetForCID.providers {
-			messagePeer := pb.FromAddrInfo(provider)
-			addrInfos = append(addrInfos, messagePeer)
-		}
-		mesg := &pb.Message_CIDToProviderMap{
-			Cid:           []byte(givenCID),
-			ProviderPeers: addrInfos,
-		}
-		// marshalledRoutingEntries, err := proto.Marshal(mesg)
-		// if err != nil {
-		// 	return nil, fmt.Errorf("could not marshal peers in RT. Err: %s ", err)
-		// }
-		// mapCIDtoProviderPeers[givenCID] = mesg
-
-		// putting the item in a bucket
-		_, cidObj, err := cid.CidFromBytes([]byte(givenCID))
-		if err != nil {
-			return nil, err
-		}
-		cidHashed := cidObj.Hash()
-		bucketIndexStr := cidHashed[2 : (bucketIndexLength/8)+2].HexString() // skipping first two bytes for hash function code, length
-		bucketIndex, err := strconv.ParseInt(bucketIndexStr, 16, 64)
-		if err != nil {
-			return nil, err
-		}
-
-		if buckets[bucketIndex] == nil {
-			buckets[bucketIndex] = make([]*pb.Message_CIDToProviderMap, 0)
-		}
-		buckets[bucketIndex] = append(buckets[bucketIndex], mesg)
-	}
-
-	bucketsInBytes := make([][]byte, len(buckets))
-	for i, bucket := range buckets {
-		// marshal the bucket
-		plaintext, err := private_routing.MarshallPBToPlaintext(&pb.Message{
-			Buckets: bucket,
-		})
-		if err != nil {
-			return nil, err
-		}
-		bucketsInBytes[i] = plaintext
-	}
-	return bucketsInBytes, err
-}
-
-// // This should be similar to the previous function, but instead of returning a map of CIDs to a list of provider peers,
-// // it should return a list of CID buckets. Each CID bucket is many (cid, provider peer) pairs.
-// // This is essentially the same as the previous function, but each row is marshalled to a byte array.
-// func (p *ProvidersBackend) MapCIDBucketsToProviderPeerBytesForPIR(ctx context.Context, bucketIndexLength int) ([][]byte, error) {
-// 	return nil, fmt.Errorf("not implemented")
-// }
-
 // Close is here to implement the [io.Closer] interface. This will get called
 // when the [DHT] "shuts down"/closes.
 func (p *ProvidersBackend) Close() error {
@@ -479,7 +388,10 @@ func (p *ProvidersBackend) trackCacheQuery(ctx context.Context, hit bool) {
 func (p *ProvidersBackend) delete(ctx context.Context, dsKey ds.Key) {
 	if err := p.datastore.Delete(ctx, dsKey); err != nil {
 		p.log.LogAttrs(ctx, slog.LevelWarn, "failed to remove provider record from disk", slog.String("key", dsKey.String()), slog.String("err", err.Error()))
+		return
 	}
+
+	p.removeFromProviderBucket(dsKey)
 }
 
 // expiryRecord is captures the information that gets written to the datastore
@@ -0,0 +1,579 @@
+package zikade
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-base32"
+	mh "github.com/multiformats/go-multihash"
+	"golang.org/x/exp/slog"
+
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/private_routing"
+)
+
+// providerBuckets holds the provider records of a [ProvidersBackend] in the
+// buckets of the database that PIR requests for provider peers are processed
+// over. It is loaded from the datastore when the database is first requested
+// and then kept up to date by [ProvidersBackend.Store] and the deletion of
+// records, e.g., by the garbage collection. Only the rows of buckets that
+// changed are marshalled again when the database is requested next.
+//
+// The multiaddresses of the providers are looked up in the address book when
+// the row of a bucket is marshalled. A row therefore only picks up new
+// addresses of a provider when its bucket changes.
+type providerBuckets struct {
+	mu sync.Mutex
+
+	// bucketIndexLength is the length in bits of the bucket indices that the
+	// records are bucketed by. It is 0 until the records are loaded.
+	bucketIndexLength int
+
+	// records maps each bucket index to the multihashes in the bucket, which
+	// in turn map to the providers of each multihash and the times at which
+	// the provider records were stored.
+	records []map[string]map[peer.ID]time.Time
+
+	// oldest holds the time of the oldest record in each bucket, so that a
+	// bucket can be marshalled again once the record expired.
+	oldest []time.Time
+
+	// stale holds the indices of the buckets whose rows in db are outdated
+	stale map[int]struct{}
+
+	// db is the database that was last returned by
+	// [ProvidersBackend.ProviderPeersDatabaseForPIR]
+	db *private_routing.Database
+
+	// keywords is the cuckoo table of the records that keyword PIR requests
+	// are processed over, and keywordDB the database of its slots that was
+	// last returned by [ProvidersBackend.ProviderKeywordDatabaseForPIR]. The
+	// table is built from all records when it is first requested, or when
+	// the number of multihashes calls for a table of another length, and
+	// otherwise only the entries of the multihashes in keywordStale are put
+	// into it again. keywordOldest holds the time of the oldest record in the
+	// entry of each multihash, so that the entry is put into the table again
+	// once the record expired.
+	keywords      *private_routing.KeywordTable
+	keywordDB     *private_routing.KeywordDatabase
+	keywordStale  map[string]struct{}
+	keywordOldest map[string]time.Time
+}
+
+// MapCIDBucketsToProviderPeerBytesForPIR returns the rows of the database of
+// provider records that PIR requests for provider peers are processed over,
+// see [ProvidersBackend.ProviderPeersDatabaseForPIR].
+//
+// Deprecated: Use [ProvidersBackend.ProviderPeersDatabaseForPIR] instead, which
+// keeps the encodings of the rows across requests.
+func (p *ProvidersBackend) MapCIDBucketsToProviderPeerBytesForPIR(ctx context.Context, bucketIndexLength int) ([][]byte, error) {
+	db, err := p.ProviderPeersDatabaseForPIR(ctx, bucketIndexLength)
+	if err != nil {
+		return nil, err
+	}
+
+	// copy the rows, as the database is shared with later requests
+	rows := make([][]byte, len(db.Rows()))
+	for i, row := range db.Rows() {
+		rows[i] = append([]byte(nil), row...)
+	}
+	return rows, nil
+}
+
+// ProviderPeersDatabaseForPIR returns the database of provider records that
+// PIR requests for provider peers are processed over, in
+// RunPIRforProviderPeersRecords. The records are placed in 2^bucketIndexLength
+// buckets by [private_routing.ProviderBucketIndex] and each row of the
+// database holds the records of one bucket. So internally, this method joins
+// the datastore with the addrBook. Rationale is below:
+// the datastore stores provider advertisements <CIDs, Peer ID providing that CID> --> expiry time.
+// the addrbook (address book) maps peer IDs to their multiaddresses
+// In Fetch, we first lookup the datastore for the peerIDs advertising a given CID key and then
+// we use the peerID as an index to lookup the address book for the multiaddresses.
+// We could lookup the datastore via PIR,
+// but then we cannot use that PIR output as an index to lookup the addressbook privately.
+// So we need to flatten out or join the two data structures for PIR to work.
+//
+// The database is maintained incrementally, see [providerBuckets]. The
+// datastore is only queried on the first call, or when the bucketIndexLength
+// differs from the previous call.
+func (p *ProvidersBackend) ProviderPeersDatabaseForPIR(ctx context.Context, bucketIndexLength int) (*private_routing.Database, error) {
+	if bucketIndexLength < 1 || bucketIndexLength > private_routing.MaxProviderBucketIndexLength {
+		return nil, fmt.Errorf("bucketIndexLength represents the length of the bucket index, in *bits* --- it must be between 1 and %d", private_routing.MaxProviderBucketIndexLength)
+	}
+
+	b := p.pirBuckets
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.bucketIndexLength != bucketIndexLength {
+		if err := p.loadProviderBuckets(ctx, bucketIndexLength); err != nil {
+			return nil, err
+		}
+	}
+
+	// buckets with expired records need to be marshalled again
+	now := p.cfg.clk.Now()
+	for i, oldest := range b.oldest {
+		if !oldest.IsZero() && now.Sub(oldest) > p.cfg.ProvideValidity {
+			b.stale[i] = struct{}{}
+		}
+	}
+
+	if b.db != nil && len(b.stale) == 0 {
+		return b.db, nil
+	}
+
+	rows := make(map[int][]byte, len(b.stale))
+	for i := range b.stale {
+		row, err := p.marshalProviderBucket(i, now)
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = row
+	}
+
+	if b.db == nil {
+		all := make([][]byte, len(b.records))
+		for i, row := range rows {
+			all[i] = row
+		}
+		b.db = private_routing.NewDatabase(all)
+	} else {
+		b.db = b.db.Update(rows)
+	}
+	b.stale = make(map[int]struct{})
+
+	return b.db, nil
+}
+
+// ProviderKeywordDatabaseForPIR returns the database of provider records that
+// keyword PIR requests for provider peers are processed over. The provider
+// records of each multihash are placed in a slot of a
+// [private_routing.KeywordTable], and each row of the database holds one slot,
+// which is padded to [ProvidersBackendConfig.PIRRowSize]. If the records of a
+// multihash don't fit into a slot, the most recently stored ones are kept, like
+// in [ProvidersBackend.ProviderPeersDatabaseForPIR].
+//
+// The length of the table is derived from the number of multihashes with
+// [private_routing.ProviderKeywordTableLengthFor], and returned along with the
+// stash of the table. The records of multihashes that don't find a slot or a
+// place in the stash are left out of the table, but stay in the datastore.
+//
+// The table is maintained incrementally from the records that are maintained
+// for [ProvidersBackend.ProviderPeersDatabaseForPIR]. Only the entries of the
+// multihashes whose records changed are put into the table again, and only the
+// rows of the slots that changed are updated in the database. The table is
+// only built from all records again once its length changes.
+func (p *ProvidersBackend) ProviderKeywordDatabaseForPIR(ctx context.Context) (*private_routing.KeywordDatabase, error) {
+	b := p.pirBuckets
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.bucketIndexLength == 0 {
+		if err := p.loadProviderBuckets(ctx, private_routing.ProviderBucketIndexLength); err != nil {
+			return nil, err
+		}
+	}
+
+	// entries with expired records need to be put into the table again
+	now := p.cfg.clk.Now()
+	for key, oldest := range b.keywordOldest {
+		if now.Sub(oldest) > p.cfg.ProvideValidity {
+			b.keywordStale[key] = struct{}{}
+		}
+	}
+
+	if b.keywordDB != nil && len(b.keywordStale) == 0 {
+		return b.keywordDB, nil
+	}
+
+	if b.keywords != nil {
+		for key := range b.keywordStale {
+			entry, oldest, found := p.providerKeywordEntry(key, now)
+			if !found {
+				b.keywords.Remove(mh.Multihash(key))
+				delete(b.keywordOldest, key)
+				continue
+			}
+			if err := b.keywords.Put(entry); err != nil {
+				return nil, err
+			}
+			b.keywordOldest[key] = oldest
+		}
+
+		// the table is built again if it's too small or too large for its entries
+		if private_routing.ProviderKeywordTableLengthFor(b.keywords.Len()) != b.keywords.Log2NumSlots() {
+			b.keywords = nil
+		}
+	}
+
+	var rows [][]byte
+	if b.keywords == nil {
+		if err := p.buildProviderKeywordTable(now); err != nil {
+			return nil, err
+		}
+		rows = b.keywords.Rows()
+	}
+	b.keywordStale = make(map[string]struct{})
+
+	if left := b.keywords.LeftOut(); left > 0 {
+		p.log.Debug("Provider records left out of the keyword table", slog.Int("left_out", left))
+	}
+
+	db := &private_routing.KeywordDatabase{
+		Log2NumSlots: b.keywords.Log2NumSlots(),
+		Stash:        b.keywords.Stash(),
+	}
+	if rows != nil {
+		db.Database = private_routing.NewDatabase(rows)
+	} else {
+		db.Database = b.keywordDB.Database.Update(b.keywords.Changed())
+	}
+	b.keywordDB = db
+
+	return b.keywordDB, nil
+}
+
+// buildProviderKeywordTable builds the cuckoo table of all records that didn't
+// expire, with a length that fits the number of multihashes. The records of
+// the multihashes with the most recently stored records are inserted first,
+// so that the records of other multihashes are left out if the table
+// overflows. The caller must hold the lock of p.pirBuckets.
+func (p *ProvidersBackend) buildProviderKeywordTable(now time.Time) error {
+	b := p.pirBuckets
+
+	type keywordRecords struct {
+		entry  private_routing.KeywordEntry
+		oldest time.Time
+		newest time.Time
+	}
+
+	var records []keywordRecords
+	for _, bucket := range b.records {
+		for key := range bucket {
+			entry, oldest, found := p.providerKeywordEntry(key, now)
+			if !found {
+				continue
+			}
+
+			newest := oldest
+			for _, t := range bucket[key] {
+				if t.After(newest) {
+					newest = t
+				}
+			}
+			records = append(records, keywordRecords{entry: entry, oldest: oldest, newest: newest})
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].newest.Equal(records[j].newest) {
+			return records[i].newest.After(records[j].newest)
+		}
+		return string(records[i].entry.Key) < string(records[j].entry.Key)
+	})
+
+	length := private_routing.ProviderKeywordTableLengthFor(len(records))
+	table, err := private_routing.NewKeywordTable(length, p.cfg.PIRRowSize, private_routing.ProviderKeywordStashSize)
+	if err != nil {
+		return err
+	}
+
+	b.keywordOldest = make(map[string]time.Time, len(records))
+	for _, rec := range records {
+		if err := table.Put(rec.entry); err != nil {
+			return err
+		}
+		b.keywordOldest[string(rec.entry.Key)] = rec.oldest
+	}
+	b.keywords = table
+
+	return nil
+}
+
+// providerKeywordEntry returns the entry of the keyword table that holds the
+// records of the given multihash that didn't expire, from the most to the
+// least recently stored one until the next record doesn't fit into a slot
+// anymore. It also returns the time of the oldest record in the entry, and
+// false if there is no such record. The caller must hold the lock of
+// p.pirBuckets.
+func (p *ProvidersBackend) providerKeywordEntry(key string, now time.Time) (private_routing.KeywordEntry, time.Time, bool) {
+	index, err := private_routing.ProviderBucketIndex(mh.Multihash(key), p.pirBuckets.bucketIndexLength)
+	if err != nil {
+		return private_routing.KeywordEntry{}, time.Time{}, false
+	}
+	providers := p.pirBuckets.records[index][key]
+
+	ids := make([]peer.ID, 0, len(providers))
+	for id, t := range providers {
+		if now.Sub(t) <= p.cfg.ProvideValidity {
+			ids = append(ids, id)
+		}
+	}
+
+	// order the providers from the most to the least recently stored one
+	sort.Slice(ids, func(i, j int) bool {
+		ti, tj := providers[ids[i]], providers[ids[j]]
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return ids[i] < ids[j]
+	})
+
+	var oldest time.Time
+	entry := &pb.Message_CIDToProviderMap{Cid: []byte(key)}
+	mesg := &pb.Message{Buckets: []*pb.Message_CIDToProviderMap{entry}}
+	for _, id := range ids {
+		entry.ProviderPeers = append(entry.ProviderPeers, pb.FromAddrInfo(peer.AddrInfo{
+			ID:    id,
+			Addrs: p.cfg.AddressFilter(p.addrBook.Addrs(id)),
+		}))
+		if !private_routing.FitsInRow(mesg, p.cfg.PIRRowSize-private_routing.KeywordSlotOverhead) {
+			entry.ProviderPeers = entry.ProviderPeers[:len(entry.ProviderPeers)-1]
+			break
+		}
+		oldest = providers[id]
+	}
+	if len(entry.ProviderPeers) == 0 {
+		return private_routing.KeywordEntry{}, time.Time{}, false
+	}
+
+	return private_routing.KeywordEntry{Key: mh.Multihash(key), Message: mesg}, oldest, true
+}
+
+// loadProviderBuckets reads all provider records from the datastore and
+// places them in 2^bucketIndexLength buckets. The caller must hold the lock of
+// p.pirBuckets. Expired and malformed records are skipped and left for the
+// garbage collection.
+func (p *ProvidersBackend) loadProviderBuckets(ctx context.Context, bucketIndexLength int) error {
+	q, err := p.datastore.Query(ctx, dsq.Query{Prefix: newDatastoreKey(p.namespace).String()})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err = q.Close(); err != nil {
+			p.log.LogAttrs(ctx, slog.LevelWarn, "failed closing provider buckets query", slog.String("err", err.Error()))
+		}
+	}()
+
+	b := p.pirBuckets
+	b.bucketIndexLength = bucketIndexLength
+	b.records = make([]map[string]map[peer.ID]time.Time, 1<<bucketIndexLength)
+	b.oldest = make([]time.Time, 1<<bucketIndexLength)
+	b.stale = make(map[int]struct{}, len(b.records))
+	b.db = nil
+	b.keywords = nil
+	b.keywordStale = make(map[string]struct{})
+	for i := range b.records {
+		b.stale[i] = struct{}{}
+	}
+
+	now := p.cfg.clk.Now()
+	for e := range q.Next() {
+		if e.Error != nil {
+			p.log.LogAttrs(ctx, slog.LevelWarn, "Provider buckets datastore entry contains error", slog.String("key", e.Key), slog.String("err", e.Error.Error()))
+			continue
+		}
+
+		rec := expiryRecord{}
+		if err := rec.UnmarshalBinary(e.Value); err != nil || now.Sub(rec.expiry) > p.cfg.ProvideValidity {
+			continue
+		}
+
+		key, id, err := parseDatastoreKey(e.Key)
+		if err != nil {
+			continue
+		}
+
+		p.addToProviderBucket(key, id, rec.expiry)
+	}
+
+	return nil
+}
+
+// marshalProviderBucket returns the row of the bucket with the given index,
+// padded to [ProvidersBackendConfig.PIRRowSize]. If the records of the bucket
+// don't fit into the row, the records are added to the row from the most to
+// the least recently stored one, until the next record doesn't fit anymore.
+// The remaining records are left out of the row, but stay in the bucket and
+// the datastore. Expired records are dropped from the bucket. The caller must
+// hold the lock of p.pirBuckets.
+func (p *ProvidersBackend) marshalProviderBucket(index int, now time.Time) ([]byte, error) {
+	b := p.pirBuckets
+
+	type providerRecord struct {
+		key string
+		id  peer.ID
+		t   time.Time
+	}
+
+	var (
+		oldest  time.Time
+		records []providerRecord
+	)
+	for key, providers := range b.records[index] {
+		for id, t := range providers {
+			if now.Sub(t) > p.cfg.ProvideValidity {
+				delete(providers, id)
+				continue
+			}
+
+			if oldest.IsZero() || t.Before(oldest) {
+				oldest = t
+			}
+			records = append(records, providerRecord{key: key, id: id, t: t})
+		}
+
+		if len(providers) == 0 {
+			delete(b.records[index], key)
+		}
+	}
+	b.oldest[index] = oldest
+
+	// order the records from the most to the least recently stored one, and
+	// by multihash and peer ID for deterministic rows
+	sort.Slice(records, func(i, j int) bool {
+		switch {
+		case !records[i].t.Equal(records[j].t):
+			return records[i].t.After(records[j].t)
+		case records[i].key != records[j].key:
+			return records[i].key < records[j].key
+		default:
+			return records[i].id < records[j].id
+		}
+	})
+
+	mesg := &pb.Message{}
+	entries := make(map[string]*pb.Message_CIDToProviderMap)
+	for i, rec := range records {
+		entry, found := entries[rec.key]
+		if !found {
+			entry = &pb.Message_CIDToProviderMap{Cid: []byte(rec.key)}
+			mesg.Buckets = append(mesg.Buckets, entry)
+		}
+		entry.ProviderPeers = append(entry.ProviderPeers, pb.FromAddrInfo(peer.AddrInfo{
+			ID:    rec.id,
+			Addrs: p.cfg.AddressFilter(p.addrBook.Addrs(rec.id)),
+		}))
+
+		if private_routing.FitsInRow(mesg, p.cfg.PIRRowSize) {
+			entries[rec.key] = entry
+			continue
+		}
+
+		// undo adding the record and leave it and all older records out
+		if found {
+			entry.ProviderPeers = entry.ProviderPeers[:len(entry.ProviderPeers)-1]
+		} else {
+			mesg.Buckets = mesg.Buckets[:len(mesg.Buckets)-1]
+		}
+		p.log.Debug("Provider records exceed PIR row size", slog.Int("bucket", index), slog.Int("left_out", len(records)-i))
+		break
+	}
+
+	// sort the multihashes for deterministic rows
+	sort.Slice(mesg.Buckets, func(i, j int) bool {
+		return string(mesg.Buckets[i].Cid) < string(mesg.Buckets[j].Cid)
+	})
+
+	return private_routing.MarshallPBToFixedSizePlaintext(mesg, p.cfg.PIRRowSize)
+}
+
+// addToProviderBucket adds the provider record to its bucket, if the provider
+// buckets are loaded, and marks the bucket as stale. The caller must hold the
+// lock of p.pirBuckets.
+func (p *ProvidersBackend) addToProviderBucket(key string, id peer.ID, t time.Time) {
+	b := p.pirBuckets
+	if b.bucketIndexLength == 0 {
+		return
+	}
+
+	// provider records are stored under the multihash of the CID
+	index, err := private_routing.ProviderBucketIndex(mh.Multihash(key), b.bucketIndexLength)
+	if err != nil {
+		return
+	}
+
+	if b.records[index] == nil {
+		b.records[index] = make(map[string]map[peer.ID]time.Time)
+	}
+	if b.records[index][key] == nil {
+		b.records[index][key] = make(map[peer.ID]time.Time)
+	}
+	b.records[index][key][id] = t
+
+	if b.oldest[index].IsZero() || t.Before(b.oldest[index]) {
+		b.oldest[index] = t
+	}
+	b.stale[index] = struct{}{}
+	b.keywordStale[key] = struct{}{}
+}
+
+// removeFromProviderBucket removes the provider record that is stored at the
+// given datastore key from its bucket, if the provider buckets are loaded,
+// and marks the bucket as stale.
+func (p *ProvidersBackend) removeFromProviderBucket(dsKey ds.Key) {
+	key, id, err := parseDatastoreKey(dsKey.String())
+	if err != nil {
+		return
+	}
+
+	b := p.pirBuckets
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.bucketIndexLength == 0 {
+		return
+	}
+
+	index, err := private_routing.ProviderBucketIndex(mh.Multihash(key), b.bucketIndexLength)
+	if err != nil {
+		return
+	}
+
+	providers, found := b.records[index][key]
+	if !found {
+		return
+	}
+	if _, found := providers[id]; !found {
+		return
+	}
+
+	delete(providers, id)
+	if len(providers) == 0 {
+		delete(b.records[index], key)
+	}
+	b.stale[index] = struct{}{}
+	b.keywordStale[key] = struct{}{}
+}
+
+// parseDatastoreKey returns the binary multihash and the peer ID of the
+// provider record that is stored at the given datastore key. In contrast to
+// decomposeDatastoreKey, it doesn't delete the record if the key is malformed.
+func parseDatastoreKey(key string) (string, peer.ID, error) {
+	idxPeerID := strings.LastIndex(key, "/")
+	if idxPeerID < 0 {
+		return "", "", fmt.Errorf("malformed provider record key: %s", key)
+	}
+	binPeerID, err := base32.RawStdEncoding.DecodeString(key[idxPeerID+1:])
+	if err != nil {
+		return "", "", fmt.Errorf("decode peer id of provider record key: %w", err)
+	}
+
+	idxCID := strings.LastIndex(key[:idxPeerID], "/")
+	binCID, err := base32.RawStdEncoding.DecodeString(key[idxCID+1 : idxPeerID])
+	if err != nil {
+		return "", "", fmt.Errorf("decode multihash of provider record key: %w", err)
+	}
+
+	return string(binCID), peer.ID(binPeerID), nil
+}
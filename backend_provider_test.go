@@ -1,8 +1,10 @@
 package zikade
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -12,11 +14,14 @@ import (
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/slog"
 
 	"github.com/plprobelab/zikade/internal/kadtest"
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/private_routing"
 )
 
 var devnull = slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -119,6 +124,274 @@ func TestProvidersBackend_GarbageCollection_lifecycle_thread_safe(t *testing.T)
 	assert.Nil(t, b.gcDone)
 }
 
+func TestProvidersBackend_ProviderPeersDatabaseForPIR_incremental(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+	clk := clock.NewMock()
+
+	cfg, err := DefaultProviderBackendConfig()
+	require.NoError(t, err)
+
+	cfg.clk = clk
+	cfg.Logger = devnull
+
+	b := newBackendProvider(t, cfg)
+
+	// find two multihashes that fall into different buckets
+	bucketIndexLength := private_routing.ProviderBucketIndexLength
+	key1, err := mh.Sum([]byte("first"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	idx1, err := private_routing.ProviderBucketIndex(key1, bucketIndexLength)
+	require.NoError(t, err)
+
+	var (
+		key2 mh.Multihash
+		idx2 int
+	)
+	for i := 0; ; i++ {
+		key2, err = mh.Sum([]byte(strconv.Itoa(i)), mh.SHA2_256, -1)
+		require.NoError(t, err)
+		idx2, err = private_routing.ProviderBucketIndex(key2, bucketIndexLength)
+		require.NoError(t, err)
+		if idx2 != idx1 {
+			break
+		}
+	}
+
+	bucket := func(db *private_routing.Database, idx int) []*pb.Message_CIDToProviderMap {
+		msg, err := private_routing.UnmarshallPlaintextToPB(db.Rows()[idx])
+		require.NoError(t, err)
+		return msg.GetBuckets()
+	}
+
+	p1 := newAddrInfo(t)
+	_, err = b.Store(ctx, string(key1), p1)
+	require.NoError(t, err)
+
+	db1, err := b.ProviderPeersDatabaseForPIR(ctx, bucketIndexLength)
+	require.NoError(t, err)
+	require.Len(t, db1.Rows(), 1<<bucketIndexLength)
+	require.Len(t, bucket(db1, idx1), 1)
+	assert.Equal(t, []byte(key1), bucket(db1, idx1)[0].Cid)
+	assert.Equal(t, []byte(p1.ID), bucket(db1, idx1)[0].ProviderPeers[0].Id)
+
+	// the database is reused as long as no records change
+	db, err := b.ProviderPeersDatabaseForPIR(ctx, bucketIndexLength)
+	require.NoError(t, err)
+	assert.Same(t, db1, db)
+
+	// storing a record only changes its bucket
+	clk.Add(cfg.ProvideValidity / 2)
+	p2 := newAddrInfo(t)
+	_, err = b.Store(ctx, string(key2), p2)
+	require.NoError(t, err)
+
+	db2, err := b.ProviderPeersDatabaseForPIR(ctx, bucketIndexLength)
+	require.NoError(t, err)
+	assert.NotSame(t, db1, db2)
+	assert.Equal(t, db1.Rows()[idx1], db2.Rows()[idx1])
+	require.Len(t, bucket(db2, idx2), 1)
+	assert.Equal(t, []byte(key2), bucket(db2, idx2)[0].Cid)
+
+	// expired records are dropped from their bucket
+	clk.Add(cfg.ProvideValidity/2 + time.Minute)
+	db3, err := b.ProviderPeersDatabaseForPIR(ctx, bucketIndexLength)
+	require.NoError(t, err)
+	assert.Empty(t, bucket(db3, idx1))
+	assert.Len(t, bucket(db3, idx2), 1)
+
+	// deleted records, e.g., by the garbage collection, are dropped from their bucket
+	b.delete(ctx, newDatastoreKey(namespaceProviders, string(key2), string(p2.ID)))
+	db4, err := b.ProviderPeersDatabaseForPIR(ctx, bucketIndexLength)
+	require.NoError(t, err)
+	assert.Empty(t, bucket(db4, idx2))
+}
+
+func TestProvidersBackend_ProviderKeywordDatabaseForPIR(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+	clk := clock.NewMock()
+
+	cfg, err := DefaultProviderBackendConfig()
+	require.NoError(t, err)
+
+	cfg.clk = clk
+	cfg.Logger = devnull
+
+	b := newBackendProvider(t, cfg)
+	log2NumSlots := private_routing.ProviderKeywordTableLength
+
+	occupied := func(db *private_routing.KeywordDatabase) int {
+		count := 0
+		for _, row := range db.Rows() {
+			require.Len(t, row, cfg.PIRRowSize)
+			if !bytes.Equal(row, make([]byte, cfg.PIRRowSize)) {
+				count++
+			}
+		}
+		return count
+	}
+
+	key1, err := mh.Sum([]byte("first"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	_, err = b.Store(ctx, string(key1), newAddrInfo(t))
+	require.NoError(t, err)
+	_, err = b.Store(ctx, string(key1), newAddrInfo(t))
+	require.NoError(t, err)
+
+	db1, err := b.ProviderKeywordDatabaseForPIR(ctx)
+	require.NoError(t, err)
+	require.Len(t, db1.Rows(), 1<<log2NumSlots)
+	assert.Equal(t, log2NumSlots, db1.Log2NumSlots)
+	assert.Empty(t, db1.Stash)
+	assert.Equal(t, 1, occupied(db1))
+
+	// the database is reused as long as no records change
+	db, err := b.ProviderKeywordDatabaseForPIR(ctx)
+	require.NoError(t, err)
+	assert.Same(t, db1, db)
+
+	// storing a record of another multihash takes another slot
+	clk.Add(cfg.ProvideValidity / 2)
+	key2, err := mh.Sum([]byte("second"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	p2 := newAddrInfo(t)
+	_, err = b.Store(ctx, string(key2), p2)
+	require.NoError(t, err)
+
+	db2, err := b.ProviderKeywordDatabaseForPIR(ctx)
+	require.NoError(t, err)
+	assert.NotSame(t, db1, db2)
+	assert.Equal(t, 2, occupied(db2))
+
+	// the slots of expired records are cleared
+	clk.Add(cfg.ProvideValidity/2 + time.Minute)
+	db3, err := b.ProviderKeywordDatabaseForPIR(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, occupied(db3))
+
+	// as are the slots of deleted records
+	b.delete(ctx, newDatastoreKey(namespaceProviders, string(key2), string(p2.ID)))
+	db4, err := b.ProviderKeywordDatabaseForPIR(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, occupied(db4))
+}
+
+func TestProvidersBackend_ProviderKeywordDatabaseForPIR_sized(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+	clk := clock.NewMock()
+
+	cfg, err := DefaultProviderBackendConfig()
+	require.NoError(t, err)
+
+	cfg.clk = clk
+	cfg.Logger = devnull
+	cfg.PIRRowSize = 256
+
+	b := newBackendProvider(t, cfg)
+
+	// store the records of more multihashes than fit into the smallest table
+	numKeys := 1 << private_routing.ProviderKeywordTableLength
+	keys := make([]mh.Multihash, numKeys)
+	for i := range keys {
+		keys[i], err = mh.Sum([]byte("key-"+strconv.Itoa(i)), mh.SHA2_256, -1)
+		require.NoError(t, err)
+		_, err = b.Store(ctx, string(keys[i]), newAddrInfo(t))
+		require.NoError(t, err)
+	}
+
+	db1, err := b.ProviderKeywordDatabaseForPIR(ctx)
+	require.NoError(t, err)
+	require.Equal(t, private_routing.ProviderKeywordTableLengthFor(numKeys), db1.Log2NumSlots)
+	require.Len(t, db1.Rows(), 1<<db1.Log2NumSlots)
+
+	// the records of all multihashes are placed in the table or its stash
+	occupied := 0
+	for _, row := range db1.Rows() {
+		if !bytes.Equal(row, make([]byte, cfg.PIRRowSize)) {
+			occupied++
+		}
+	}
+	assert.Equal(t, numKeys, occupied+len(db1.Stash))
+
+	// storing another record only changes the slots of its multihash
+	clk.Add(time.Minute)
+	_, err = b.Store(ctx, string(keys[0]), newAddrInfo(t))
+	require.NoError(t, err)
+
+	db2, err := b.ProviderKeywordDatabaseForPIR(ctx)
+	require.NoError(t, err)
+	require.Equal(t, db1.Log2NumSlots, db2.Log2NumSlots)
+
+	changed := 0
+	for i, row := range db2.Rows() {
+		if !bytes.Equal(row, db1.Rows()[i]) {
+			changed++
+		}
+	}
+	assert.Equal(t, 1, changed)
+}
+
+func TestProvidersBackend_ProviderPeersDatabaseForPIR_fixed_row_size(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+	clk := clock.NewMock()
+
+	cfg, err := DefaultProviderBackendConfig()
+	require.NoError(t, err)
+
+	cfg.clk = clk
+	cfg.Logger = devnull
+	cfg.PIRRowSize = 256
+
+	b := newBackendProvider(t, cfg)
+
+	key, err := mh.Sum([]byte("popular"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	idx, err := private_routing.ProviderBucketIndex(key, private_routing.ProviderBucketIndexLength)
+	require.NoError(t, err)
+
+	// store more provider records than fit into a row
+	providers := make([]peer.AddrInfo, 10)
+	for i := range providers {
+		providers[i] = newAddrInfo(t)
+		_, err = b.Store(ctx, string(key), providers[i])
+		require.NoError(t, err)
+		clk.Add(time.Minute)
+	}
+
+	db, err := b.ProviderPeersDatabaseForPIR(ctx, private_routing.ProviderBucketIndexLength)
+	require.NoError(t, err)
+
+	// all rows have the same size
+	for _, row := range db.Rows() {
+		require.Len(t, row, cfg.PIRRowSize)
+	}
+
+	// the most recently stored providers are kept
+	msg, err := private_routing.UnmarshallPlaintextToPB(db.Rows()[idx])
+	require.NoError(t, err)
+	require.Len(t, msg.GetBuckets(), 1)
+
+	kept := msg.GetBuckets()[0].GetProviderPeers()
+	require.NotEmpty(t, kept)
+	require.Less(t, len(kept), len(providers))
+	for i, provider := range kept {
+		assert.Equal(t, []byte(providers[len(providers)-1-i].ID), provider.Id)
+	}
+}
+
+func TestNewBackendProvider_invalid_row_size(t *testing.T) {
+	cfg, err := DefaultProviderBackendConfig()
+	require.NoError(t, err)
+
+	cfg.PIRRowSize = private_routing.RowLengthPrefixSize - 1
+
+	dstore, err := InMemoryDatastore()
+	require.NoError(t, err)
+	defer dstore.Close()
+
+	_, err = NewBackendProvider(newTestHost(t).Peerstore(), dstore, cfg)
+	assert.Error(t, err)
+}
+
 func TestProvidersBackend_Validate(t *testing.T) {
 	ctx := kadtest.CtxShort(t)
 
@@ -177,3 +450,26 @@ func TestProvidersBackend_Validate(t *testing.T) {
 		assert.Equal(t, 0, idx)
 	})
 }
+
+func TestProvidersBackend_MapCIDBucketsToProviderPeerBytesForPIR(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+
+	cfg, err := DefaultProviderBackendConfig()
+	require.NoError(t, err)
+	cfg.Logger = devnull
+
+	b := newBackendProvider(t, cfg)
+	_, err = b.Store(ctx, string(NewRandomContent(t).Hash()), newAddrInfo(t))
+	require.NoError(t, err)
+
+	db, err := b.ProviderPeersDatabaseForPIR(ctx, private_routing.ProviderBucketIndexLength)
+	require.NoError(t, err)
+
+	// the rows are those of the database, but don't share its memory
+	rows, err := b.MapCIDBucketsToProviderPeerBytesForPIR(ctx, private_routing.ProviderBucketIndexLength)
+	require.NoError(t, err)
+	require.Equal(t, db.Rows(), rows)
+
+	rows[0][0] ^= 1
+	assert.NotEqual(t, db.Rows()[0], rows[0])
+}
@@ -19,6 +19,10 @@ type RecordBackend struct {
 	namespace string
 	datastore ds.TxnDatastore
 	validator record.Validator
+
+	// pirBuckets holds the database of the records that PIR requests for
+	// records are processed over, see [RecordBackend.RecordDatabaseForPIR].
+	pirBuckets recordBuckets
 }
 
 var _ Backend = (*RecordBackend)(nil)
@@ -28,6 +32,14 @@ type RecordBackendConfig struct {
 	MaxRecordAge time.Duration
 	Logger       *slog.Logger
 	Tele         *Telemetry
+
+	// PIRRowSize is the size in bytes of each row of the database that PIR
+	// requests for records are processed over. All rows are padded to this
+	// size, so that the size of a response doesn't depend on the number of
+	// records in a bucket. If the records of a bucket don't fit into a row,
+	// the records that were received most recently are kept and older
+	// records are left out of the row. See [RecordBackend.RecordDatabaseForPIR].
+	PIRRowSize int
 }
 
 func DefaultRecordBackendConfig() (*RecordBackendConfig, error) {
@@ -41,6 +53,7 @@ func DefaultRecordBackendConfig() (*RecordBackendConfig, error) {
 		Logger:       slog.Default(),
 		Tele:         telemetry,
 		MaxRecordAge: 48 * time.Hour, // empirically measured in: https://github.com/plprobelab/network-measurements/blob/master/results/rfm17-provider-record-liveness.md
+		PIRRowSize:   4096,           // MAGIC: the bytes of a single response ciphertext with the default RLWE parameters
 	}, nil
 }
 
@@ -83,6 +96,7 @@ func (r *RecordBackend) Store(ctx context.Context, key string, value any) (any,
 	if err = txn.Commit(ctx); err != nil {
 		return nil, fmt.Errorf("committing new record to datastore: %w", err)
 	}
+	r.pirBuckets.markStale()
 
 	return rec, nil
 }
@@ -105,6 +119,7 @@ func (r *RecordBackend) Fetch(ctx context.Context, key string) (any, error) {
 		if err := r.datastore.Delete(ctx, dsKey); err != nil {
 			r.log.LogAttrs(ctx, slog.LevelWarn, "Failed deleting corrupt record from datastore", slog.String("err", err.Error()))
 		}
+		r.pirBuckets.markStale()
 
 		return nil, nil
 	}
@@ -121,6 +136,7 @@ func (r *RecordBackend) Fetch(ctx context.Context, key string) (any, error) {
 		if err = r.datastore.Delete(ctx, dsKey); err != nil {
 			r.log.LogAttrs(ctx, slog.LevelWarn, "Failed deleting bad record from datastore", slog.String("err", err.Error()))
 		}
+		r.pirBuckets.markStale()
 		return nil, nil
 	}
 
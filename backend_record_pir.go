@@ -0,0 +1,191 @@
+package zikade
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dsq "github.com/ipfs/go-datastore/query"
+	recpb "github.com/libp2p/go-libp2p-record/pb"
+	"github.com/multiformats/go-base32"
+	"golang.org/x/exp/slog"
+
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/private_routing"
+)
+
+// recordBuckets holds the database of the records of a [RecordBackend] that
+// PIR requests for records are processed over. Records change much less often
+// than provider records, so the database is built again from the datastore
+// whenever a record was stored or deleted since it was built, or one of its
+// records expired. The zero value holds no database.
+type recordBuckets struct {
+	mu sync.Mutex
+
+	// bucketIndexLength is the length in bits of the bucket indices of db
+	bucketIndexLength int
+
+	// db is the database that was last returned by
+	// [RecordBackend.RecordDatabaseForPIR]. It is outdated if stale is set, or
+	// once oldest, the time at which its oldest record was received, expired.
+	db     *private_routing.Database
+	stale  bool
+	oldest time.Time
+}
+
+// markStale marks the database as outdated.
+func (b *recordBuckets) markStale() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stale = true
+}
+
+// RecordDatabaseForPIR returns the database of the records of the backend that
+// PIR requests for records are processed over. The records are placed in
+// 2^bucketIndexLength buckets by [private_routing.RecordBucketIndex] of their
+// routing keys, and each row of the database holds the records of one bucket,
+// padded to [RecordBackendConfig.PIRRowSize], see [RecordBackend.marshalRecordBucket].
+// Records are served like by [RecordBackend.Fetch], i.e., they are not
+// validated, but expired records are left out.
+func (r *RecordBackend) RecordDatabaseForPIR(ctx context.Context, bucketIndexLength int) (*private_routing.Database, error) {
+	if bucketIndexLength < 1 || bucketIndexLength > private_routing.MaxRecordBucketIndexLength {
+		return nil, fmt.Errorf("bucketIndexLength represents the length of the bucket index, in *bits* --- it must be between 1 and %d", private_routing.MaxRecordBucketIndexLength)
+	}
+
+	b := &r.pirBuckets
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := r.cfg.clk.Now()
+	expired := !b.oldest.IsZero() && now.Sub(b.oldest) > r.cfg.MaxRecordAge
+	if b.db != nil && b.bucketIndexLength == bucketIndexLength && !b.stale && !expired {
+		return b.db, nil
+	}
+
+	buckets, oldest, err := r.loadRecordBuckets(ctx, bucketIndexLength, now)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]byte, len(buckets))
+	for i, records := range buckets {
+		rows[i], err = r.marshalRecordBucket(i, records)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b.db = private_routing.NewDatabase(rows)
+	b.bucketIndexLength = bucketIndexLength
+	b.stale = false
+	b.oldest = oldest
+
+	return b.db, nil
+}
+
+// bucketRecord is a record of a bucket of the database of a [RecordBackend],
+// along with the time at which it was received.
+type bucketRecord struct {
+	rec        *recpb.Record
+	receivedAt time.Time
+}
+
+// marshalRecordBucket returns the row of the bucket with the given index and
+// records, padded to [RecordBackendConfig.PIRRowSize]. If the records of the
+// bucket don't fit into the row, the records are added to the row from the
+// most to the least recently received one, until the next record doesn't fit
+// anymore. The remaining records are left out of the row, but stay in the
+// datastore.
+func (r *RecordBackend) marshalRecordBucket(index int, records []bucketRecord) ([]byte, error) {
+	// order the records from the most to the least recently received one,
+	// and by key for deterministic rows
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].receivedAt.Equal(records[j].receivedAt) {
+			return records[i].receivedAt.After(records[j].receivedAt)
+		}
+		return string(records[i].rec.GetKey()) < string(records[j].rec.GetKey())
+	})
+
+	mesg := &pb.Message{}
+	for i, br := range records {
+		mesg.BucketRecords = append(mesg.BucketRecords, br.rec)
+		if private_routing.FitsInRow(mesg, r.cfg.PIRRowSize) {
+			continue
+		}
+
+		// undo adding the record and leave it and all older records out
+		mesg.BucketRecords = mesg.BucketRecords[:len(mesg.BucketRecords)-1]
+		r.log.Debug("Records exceed PIR row size", slog.Int("bucket", index), slog.Int("left_out", len(records)-i))
+		break
+	}
+
+	// sort the records by key for deterministic rows
+	sort.Slice(mesg.BucketRecords, func(i, j int) bool {
+		return string(mesg.BucketRecords[i].GetKey()) < string(mesg.BucketRecords[j].GetKey())
+	})
+
+	return private_routing.MarshallPBToFixedSizePlaintext(mesg, r.cfg.PIRRowSize)
+}
+
+// loadRecordBuckets reads all records of the backend from the datastore and
+// places them in 2^bucketIndexLength buckets. It also returns the time at which
+// the oldest record was received. The records only keep their keys and values,
+// and their keys are set to the routing keys that they are stored under.
+// Expired and malformed records are skipped and left for [RecordBackend.Fetch]
+// to delete.
+func (r *RecordBackend) loadRecordBuckets(ctx context.Context, bucketIndexLength int, now time.Time) ([][]bucketRecord, time.Time, error) {
+	q, err := r.datastore.Query(ctx, dsq.Query{Prefix: newDatastoreKey(r.namespace).String()})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	defer func() {
+		if err = q.Close(); err != nil {
+			r.log.LogAttrs(ctx, slog.LevelWarn, "failed closing record buckets query", slog.String("err", err.Error()))
+		}
+	}()
+
+	var oldest time.Time
+	buckets := make([][]bucketRecord, 1<<bucketIndexLength)
+	for e := range q.Next() {
+		if e.Error != nil {
+			r.log.LogAttrs(ctx, slog.LevelWarn, "Record buckets datastore entry contains error", slog.String("key", e.Key), slog.String("err", e.Error.Error()))
+			continue
+		}
+
+		rec := &recpb.Record{}
+		if err := rec.Unmarshal(e.Value); err != nil {
+			continue
+		}
+
+		receivedAt, err := time.Parse(time.RFC3339Nano, rec.GetTimeReceived())
+		if err != nil || now.Sub(receivedAt) > r.cfg.MaxRecordAge {
+			continue
+		}
+
+		path, err := base32.RawStdEncoding.DecodeString(e.Key[strings.LastIndex(e.Key, "/")+1:])
+		if err != nil {
+			continue
+		}
+
+		key := []byte(newRoutingKey(r.namespace, string(path)))
+		index, err := private_routing.RecordBucketIndex(key, bucketIndexLength)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		buckets[index] = append(buckets[index], bucketRecord{
+			rec:        &recpb.Record{Key: key, Value: rec.GetValue()},
+			receivedAt: receivedAt,
+		})
+		if oldest.IsZero() || receivedAt.Before(oldest) {
+			oldest = receivedAt
+		}
+	}
+
+	return buckets, oldest, nil
+}
@@ -5,11 +5,17 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/benbjohnson/clock"
 	record "github.com/libp2p/go-libp2p-record"
+	recpb "github.com/libp2p/go-libp2p-record/pb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/plprobelab/zikade/internal/kadtest"
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/private_routing"
 )
 
 // testValidator is a validator that considers all values valid that have a
@@ -112,3 +118,141 @@ func TestRecordBackend_Validate(t *testing.T) {
 		assert.Equal(t, 0, idx)
 	})
 }
+
+func TestRecordBackend_RecordDatabaseForPIR(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+	clk := clock.NewMock()
+
+	dstore, err := InMemoryDatastore()
+	require.NoError(t, err)
+
+	cfg, err := DefaultRecordBackendConfig()
+	require.NoError(t, err)
+	cfg.clk = clk
+	cfg.Logger = devnull
+
+	b, err := NewBackendPublicKey(dstore, cfg)
+	require.NoError(t, err)
+
+	bucketIndexLength := private_routing.RecordBucketIndexLength
+	bucket := func(db *private_routing.Database, key string) []*recpb.Record {
+		idx, err := private_routing.RecordBucketIndex([]byte(key), bucketIndexLength)
+		require.NoError(t, err)
+		msg, err := private_routing.UnmarshallPlaintextToPB(db.Rows()[idx])
+		require.NoError(t, err)
+		return msg.GetBucketRecords()
+	}
+
+	key1, v1 := makePkKeyValue(t)
+	_, path1, err := record.SplitKey(key1)
+	require.NoError(t, err)
+	_, err = b.Store(ctx, path1, record.MakePutRecord(key1, v1))
+	require.NoError(t, err)
+
+	db1, err := b.RecordDatabaseForPIR(ctx, bucketIndexLength)
+	require.NoError(t, err)
+	require.Len(t, db1.Rows(), 1<<bucketIndexLength)
+
+	// records are placed in the bucket of their routing key and only keep their key and value
+	records := bucket(db1, key1)
+	require.Len(t, records, 1)
+	assert.Equal(t, []byte(key1), records[0].GetKey())
+	assert.Equal(t, v1, records[0].GetValue())
+	assert.Empty(t, records[0].GetTimeReceived())
+
+	// the database is reused as long as no records change
+	db, err := b.RecordDatabaseForPIR(ctx, bucketIndexLength)
+	require.NoError(t, err)
+	assert.Same(t, db1, db)
+
+	// storing a record builds the database again
+	clk.Add(cfg.MaxRecordAge / 2)
+	key2, v2 := makePkKeyValue(t)
+	_, path2, err := record.SplitKey(key2)
+	require.NoError(t, err)
+	_, err = b.Store(ctx, path2, record.MakePutRecord(key2, v2))
+	require.NoError(t, err)
+
+	db2, err := b.RecordDatabaseForPIR(ctx, bucketIndexLength)
+	require.NoError(t, err)
+	assert.NotSame(t, db1, db2)
+	assert.NotNil(t, (&pb.Message{BucketRecords: bucket(db2, key2)}).BucketRecord([]byte(key2)))
+
+	// expired records are left out
+	clk.Add(cfg.MaxRecordAge/2 + time.Minute)
+	db3, err := b.RecordDatabaseForPIR(ctx, bucketIndexLength)
+	require.NoError(t, err)
+	assert.Nil(t, (&pb.Message{BucketRecords: bucket(db3, key1)}).BucketRecord([]byte(key1)))
+	assert.NotNil(t, (&pb.Message{BucketRecords: bucket(db3, key2)}).BucketRecord([]byte(key2)))
+
+	_, err = b.RecordDatabaseForPIR(ctx, 0)
+	assert.Error(t, err)
+}
+
+func TestRecordBackend_RecordDatabaseForPIR_row_size(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+	clk := clock.NewMock()
+
+	dstore, err := InMemoryDatastore()
+	require.NoError(t, err)
+
+	cfg, err := DefaultRecordBackendConfig()
+	require.NoError(t, err)
+	cfg.clk = clk
+	cfg.Logger = devnull
+	cfg.PIRRowSize = 256
+
+	b, err := NewBackendPublicKey(dstore, cfg)
+	require.NoError(t, err)
+
+	// store more records than fit into the rows of two buckets
+	bucketIndexLength := 1
+	stored := make([][]string, 1<<bucketIndexLength)
+	for i := 0; i < 10; i++ {
+		key, v := makePkKeyValue(t)
+		_, path, err := record.SplitKey(key)
+		require.NoError(t, err)
+		_, err = b.Store(ctx, path, record.MakePutRecord(key, v))
+		require.NoError(t, err)
+		clk.Add(time.Minute)
+
+		idx, err := private_routing.RecordBucketIndex([]byte(key), bucketIndexLength)
+		require.NoError(t, err)
+		stored[idx] = append(stored[idx], key)
+	}
+
+	db, err := b.RecordDatabaseForPIR(ctx, bucketIndexLength)
+	require.NoError(t, err)
+
+	leftOut := false
+	for idx, row := range db.Rows() {
+		// all rows have the same size
+		require.Len(t, row, cfg.PIRRowSize)
+
+		msg, err := private_routing.UnmarshallPlaintextToPB(row)
+		require.NoError(t, err)
+		kept := msg.GetBucketRecords()
+		require.NotEmpty(t, kept)
+		leftOut = leftOut || len(kept) < len(stored[idx])
+
+		// the most recently received records are kept
+		for _, key := range stored[idx][len(stored[idx])-len(kept):] {
+			assert.NotNil(t, msg.BucketRecord([]byte(key)))
+		}
+	}
+	assert.True(t, leftOut)
+}
+
+func TestNewBackendPublicKey_invalid_row_size(t *testing.T) {
+	cfg, err := DefaultRecordBackendConfig()
+	require.NoError(t, err)
+
+	cfg.PIRRowSize = private_routing.RowLengthPrefixSize - 1
+
+	dstore, err := InMemoryDatastore()
+	require.NoError(t, err)
+	defer dstore.Close()
+
+	_, err = NewBackendPublicKey(dstore, cfg)
+	assert.Error(t, err)
+}
@@ -21,6 +21,8 @@ import (
 
 	"github.com/plprobelab/zikade/internal/coord/routing"
 	"github.com/plprobelab/zikade/kadt"
+	"github.com/plprobelab/zikade/pir"
+	"github.com/plprobelab/zikade/private_routing"
 )
 
 // ServiceName is used to scope incoming streams for the resource manager.
@@ -59,6 +61,13 @@ type (
 	// only has the two forms: client or server.
 	mode string
 
+	// PrivacyOpt describes whether this [DHT] performs lookups in a way that
+	// hides the looked up key from the peers that are contacted. Private
+	// lookups send PIR requests instead of the key, which is considerably more
+	// expensive for both sides, and can only be answered by peers that support
+	// the private message types.
+	PrivacyOpt string
+
 	// Datastore is an interface definition that gathers the datastore
 	// requirements. The [DHT] requires the datastore to support batching and
 	// transactions. Example datastores that implement both features are leveldb
@@ -98,6 +107,17 @@ const (
 	// modeServer means that the [DHT] is currently operating in server [mode].
 	// For more information, check ModeOpt documentation.
 	modeServer mode = "server"
+
+	// PrivacyOptOff configures the DHT to only perform plaintext lookups.
+	PrivacyOptOff PrivacyOpt = "off"
+
+	// PrivacyOptPrivate configures the DHT to find providers with
+	// PRIVATE_GET_PROVIDERS lookups instead of plaintext GET_PROVIDERS lookups,
+	// and to search values with PRIVATE_GET_VALUE lookups instead of plaintext
+	// GET_VALUE lookups. Provider records are advertised to the closest peers
+	// that are found with PRIVATE_FIND_NODE lookups instead of plaintext
+	// FIND_NODE lookups, so that only these peers see the provided CID.
+	PrivacyOptPrivate PrivacyOpt = "private"
 )
 
 // Config contains all the configuration options for a [DHT]. Use [DefaultConfig]
@@ -111,6 +131,119 @@ type Config struct {
 	// between both automatically (see ModeOpt).
 	Mode ModeOpt
 
+	// Privacy defines if lookups should hide the looked up key from the peers
+	// that are contacted (see PrivacyOpt).
+	Privacy PrivacyOpt
+
+	// PIRSchemes holds the PIR schemes that this DHT supports when it
+	// processes private requests from other peers. A private request that was
+	// generated with any other scheme is answered with an UNSUPPORTED_SCHEME
+	// error. The default registry supports all RLWE modes, see
+	// [pir.NewDefaultRegistry].
+	PIRSchemes *pir.Registry
+
+	// PIRWorkers is the largest number of goroutines that this DHT evaluates
+	// private requests from other peers with, across all requests. The row
+	// multiplications of each request are spread over the workers, so that a
+	// busy server can use several cores without the number of goroutines
+	// growing with the number of requests. A value of 0 evaluates each request
+	// on the goroutine that handles it, one row after another.
+	PIRWorkers int
+
+	// PIRRequestBudget is the largest estimated cost of a private request
+	// from another peer that this DHT processes. The cost is estimated from
+	// the number of rows and the row size of the database and the scheme of
+	// the request, see [pir.CostEstimator]. Requests that exceed it are
+	// refused with a BUDGET_EXCEEDED error before they are processed, so that
+	// peers can't make this DHT spend unbounded computation on a request. A
+	// budget of 0 doesn't limit the cost of requests.
+	PIRRequestBudget int64
+
+	// PIRProviderKeywordLookup configures private lookups of provider records
+	// to retrieve the records of the exact CID with keyword PIR, instead of the
+	// bucket of records that the CID falls into. The client then doesn't learn
+	// the records of other CIDs, at the cost of a batch request for several
+	// slots of the keyword table of each contacted peer.
+	PIRProviderKeywordLookup bool
+
+	// PIRProviderDimensions is the number of dimensions that private lookups
+	// of provider records arrange the buckets of provider records of a peer
+	// in. Requests of more than one dimension are smaller and cheaper for the
+	// peer to expand, at the cost of responses that grow about eightfold with
+	// every dimension after the first, see
+	// [pir.NewSimpleRLWE_PIR_Protocol_recursive]. It has no effect with
+	// PIRProviderKeywordLookup.
+	PIRProviderDimensions int
+
+	// PIRPeerRateLimit is the number of private requests per second that this
+	// DHT processes for each remote peer, with bursts of up to PIRPeerBurst
+	// requests. PIRGlobalRateLimit and PIRGlobalBurst limit the private
+	// requests of all peers together, and PIRMaxInFlight is the largest number
+	// of private requests that are processed at the same time. Private
+	// requests that exceed any of these limits are answered with a BUSY error,
+	// so that the remote peer sends its request to another peer instead. A
+	// rate limit or a maximum of 0 doesn't limit the requests.
+	PIRPeerRateLimit   float64
+	PIRPeerBurst       int
+	PIRGlobalRateLimit float64
+	PIRGlobalBurst     int
+	PIRMaxInFlight     int
+
+	// PIRVerifyPeerRecords configures private lookups to ask peers for the
+	// signed peer records of the closer peers that they return, and to only
+	// use peers whose signed records are valid, with the addresses from their
+	// records. Peers that return forged or tampered records are removed from
+	// the routing table. Peers whose records the server doesn't hold are
+	// dropped, so lookups may return fewer peers.
+	PIRVerifyPeerRecords bool
+
+	// PIRResponseChunkSize is the largest number of ciphertext bytes of the
+	// responses to private requests that this DHT sends in a single message.
+	// Responses to peers that accept streamed responses are streamed: each PIR
+	// response is sent in chunks of at most this size as soon as it was
+	// computed, so that the peer can process it while the next one is still
+	// being computed. Responses to peers that only accept chunked responses
+	// are split into chunks once all PIR responses were computed. Either way,
+	// large responses don't exceed the message size limit of the stream.
+	// Responses to other peers are sent in a single message. It must not
+	// exceed [MaxPIRResponseChunkSize]. A size of 0 disables chunking.
+	PIRResponseChunkSize int
+
+	// PIRRowSize is the size in bytes of the rows of the PIR databases of
+	// provider records and records that this DHT serves, see
+	// [ProvidersBackendConfig.PIRRowSize]. Private lookups assume that remote
+	// peers use the same row size, and choose the RLWE parameter set of each
+	// of their requests from it and the number of rows of the database, see
+	// [pir.SelectRLWEParameterSet]. The chosen parameter set is named in the
+	// request, so that the remote peer encodes its database with it.
+	PIRRowSize int
+
+	// PIRKeyCacheSize is the number of evaluation keys of private requests
+	// that this DHT caches, so that peers only need to send their evaluation
+	// keys with their first private request instead of every request. Keys
+	// are only cached once their request was answered without error, and a
+	// peer's new keys replace its old ones of the same scheme, parameter set
+	// and number of rows. A request that references evaluation keys which
+	// aren't cached is answered with an UNKNOWN_EVALUATION_KEYS error. A size
+	// of 0 disables the cache.
+	PIRKeyCacheSize int
+
+	// PIRKeyCacheTTL is the duration for which evaluation keys of private
+	// requests are cached.
+	PIRKeyCacheTTL time.Duration
+
+	// PIRBackfillBucketSize is the largest number of peers that are added to
+	// each bucket of the normalized routing table, which private requests for
+	// closer peers are processed over, from the peers that are known in the
+	// peer store but not in the routing table. Plaintext FIND_NODE requests
+	// return the target if its addresses are in the peer store, even if its
+	// bucket in the routing table was full. The backfill lets private requests
+	// find such peers as well, without knowing the target. Only peers that
+	// support the DHT protocol and have addresses that pass the address filter
+	// are added. Peers that we are connected to, or were recently connected
+	// to, are preferred. A size of 0 disables the backfill.
+	PIRBackfillBucketSize int
+
 	// Query holds the configuration used for queries managed by the DHT.
 	Query *QueryConfig
 
@@ -190,20 +323,34 @@ type Config struct {
 // fields come from separate top-level methods prefixed with Default.
 func DefaultConfig() *Config {
 	return &Config{
-		Clock:             clock.New(),
-		Mode:              ModeOptAutoClient,
-		BucketSize:        20, // MAGIC
-		BootstrapPeers:    DefaultBootstrapPeers(),
-		ProtocolID:        ProtocolIPFS,
-		RoutingTable:      nil,                  // nil because a routing table requires information about the local node. triert.TrieRT will be used if this field is nil.
-		Backends:          map[string]Backend{}, // if empty and [ProtocolIPFS] is used, it'll be populated with the ipns, pk and providers backends
-		Datastore:         nil,
-		Logger:            slog.New(zapslog.NewHandler(logging.Logger("dht").Desugar().Core())),
-		TimeoutStreamIdle: time.Minute, // MAGIC
-		AddressFilter:     AddrFilterPrivate,
-		MeterProvider:     otel.GetMeterProvider(),
-		TracerProvider:    otel.GetTracerProvider(),
-		Query:             DefaultQueryConfig(),
+		Clock:                 clock.New(),
+		Mode:                  ModeOptAutoClient,
+		Privacy:               PrivacyOptOff,
+		PIRSchemes:            pir.NewDefaultRegistry(),
+		PIRRequestBudget:      1 << 30,          // MAGIC
+		PIRProviderDimensions: 1,                // one-dimensional requests
+		PIRPeerRateLimit:      1,                // MAGIC
+		PIRPeerBurst:          10,               // MAGIC
+		PIRGlobalRateLimit:    50,               // MAGIC
+		PIRGlobalBurst:        100,              // MAGIC
+		PIRMaxInFlight:        32,               // MAGIC
+		PIRResponseChunkSize:  256 << 10,        // MAGIC
+		PIRRowSize:            4096,             // MAGIC: the bytes of a single response ciphertext with the default RLWE parameters
+		PIRKeyCacheSize:       128,              // MAGIC
+		PIRKeyCacheTTL:        10 * time.Minute, // MAGIC
+		PIRBackfillBucketSize: 20,               // MAGIC
+		BucketSize:            20,               // MAGIC
+		BootstrapPeers:        DefaultBootstrapPeers(),
+		ProtocolID:            ProtocolIPFS,
+		RoutingTable:          nil,                  // nil because a routing table requires information about the local node. triert.TrieRT will be used if this field is nil.
+		Backends:              map[string]Backend{}, // if empty and [ProtocolIPFS] is used, it'll be populated with the ipns, pk and providers backends
+		Datastore:             nil,
+		Logger:                slog.New(zapslog.NewHandler(logging.Logger("dht").Desugar().Core())),
+		TimeoutStreamIdle:     time.Minute, // MAGIC
+		AddressFilter:         AddrFilterPrivate,
+		MeterProvider:         otel.GetMeterProvider(),
+		TracerProvider:        otel.GetTracerProvider(),
+		Query:                 DefaultQueryConfig(),
 	}
 }
 
@@ -237,6 +384,100 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid mode option: %s", c.Mode)
 	}
 
+	switch c.Privacy {
+	case PrivacyOptOff:
+	case PrivacyOptPrivate:
+	default:
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("invalid privacy option: %s", c.Privacy),
+		}
+	}
+
+	if c.PIRSchemes == nil {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("PIR scheme registry must not be nil"),
+		}
+	}
+
+	if c.PIRWorkers < 0 {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("number of PIR workers must not be negative"),
+		}
+	}
+
+	if c.PIRRequestBudget < 0 {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("PIR request budget must not be negative"),
+		}
+	}
+
+	if c.PIRProviderDimensions < 1 || c.PIRProviderDimensions > pir.MaxDimensions {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("PIR provider dimensions must be between 1 and %d", pir.MaxDimensions),
+		}
+	}
+
+	if c.PIRPeerRateLimit < 0 || (c.PIRPeerRateLimit > 0 && c.PIRPeerBurst < 1) {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("PIR peer rate limit must not be negative and requires a positive burst"),
+		}
+	}
+
+	if c.PIRGlobalRateLimit < 0 || (c.PIRGlobalRateLimit > 0 && c.PIRGlobalBurst < 1) {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("PIR global rate limit must not be negative and requires a positive burst"),
+		}
+	}
+
+	if c.PIRMaxInFlight < 0 {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("maximum number of PIR requests in flight must not be negative"),
+		}
+	}
+
+	if c.PIRResponseChunkSize < 0 || c.PIRResponseChunkSize > MaxPIRResponseChunkSize {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("PIR response chunk size must be between 0 and %d bytes", MaxPIRResponseChunkSize),
+		}
+	}
+
+	if c.PIRRowSize < private_routing.RowLengthPrefixSize {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("PIR row size must be at least %d bytes", private_routing.RowLengthPrefixSize),
+		}
+	}
+
+	if c.PIRKeyCacheSize < 0 {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("PIR key cache size must not be negative"),
+		}
+	}
+
+	if c.PIRKeyCacheSize > 0 && c.PIRKeyCacheTTL <= 0 {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("PIR key cache ttl must be positive"),
+		}
+	}
+
+	if c.PIRBackfillBucketSize < 0 {
+		return &ConfigurationError{
+			Component: "Config",
+			Err:       fmt.Errorf("PIR backfill bucket size must not be negative"),
+		}
+	}
+
 	if c.Query == nil {
 		return &ConfigurationError{
 			Component: "Config",
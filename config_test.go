@@ -8,6 +8,9 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/pir"
+	"github.com/plprobelab/zikade/private_routing"
 )
 
 func TestConfig_Validate(t *testing.T) {
@@ -22,6 +25,93 @@ func TestConfig_Validate(t *testing.T) {
 		assert.Error(t, cfg.Validate())
 	})
 
+	t.Run("invalid privacy", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Privacy = "invalid"
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("nil PIR schemes", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PIRSchemes = nil
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("negative number of PIR workers", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PIRWorkers = -1
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("negative PIR rate limits", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PIRPeerRateLimit = -1
+		assert.Error(t, cfg.Validate())
+
+		cfg = DefaultConfig()
+		cfg.PIRGlobalRateLimit = -1
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("PIR rate limit without burst", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PIRPeerBurst = 0
+		assert.Error(t, cfg.Validate())
+
+		cfg = DefaultConfig()
+		cfg.PIRGlobalBurst = 0
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("negative maximum of PIR requests in flight", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PIRMaxInFlight = -1
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("negative PIR request budget", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PIRRequestBudget = -1
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("invalid PIR provider dimensions", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PIRProviderDimensions = 0
+		assert.Error(t, cfg.Validate())
+
+		cfg = DefaultConfig()
+		cfg.PIRProviderDimensions = pir.MaxDimensions + 1
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("PIR row size too small", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PIRRowSize = private_routing.RowLengthPrefixSize - 1
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("negative PIR key cache size", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PIRKeyCacheSize = -1
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("non-positive PIR key cache ttl", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PIRKeyCacheTTL = 0
+		assert.Error(t, cfg.Validate())
+
+		cfg.PIRKeyCacheSize = 0
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("negative PIR backfill bucket size", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.PIRBackfillBucketSize = -1
+		assert.Error(t, cfg.Validate())
+	})
+
 	t.Run("nil Query configuration", func(t *testing.T) {
 		cfg := DefaultConfig()
 		cfg.Query = nil
@@ -18,6 +18,8 @@ import (
 	"github.com/plprobelab/zikade/internal/coord"
 	"github.com/plprobelab/zikade/internal/coord/routing"
 	"github.com/plprobelab/zikade/kadt"
+	"github.com/plprobelab/zikade/pir"
+	"github.com/plprobelab/zikade/private_routing"
 	"github.com/plprobelab/zikade/tele"
 )
 
@@ -58,6 +60,32 @@ type DHT struct {
 	// tele holds a reference to a telemetry struct
 	tele *Telemetry
 
+	// rtDatabases caches the PIR databases of the normalized routing table
+	// that private requests for closer peers are processed over.
+	rtDatabases *rtDatabaseCache
+
+	// pirSchemes holds the PIR schemes of the configuration, which evaluate
+	// requests on pirWorkers if the DHT is configured with PIR workers.
+	pirSchemes *pir.Registry
+
+	// pirWorkers bounds the goroutines that private requests from other peers
+	// are evaluated with. It is nil if requests are evaluated sequentially.
+	pirWorkers *pir.WorkerPool
+
+	// pirAdmission limits the private requests from other peers that are
+	// processed, see [Config.PIRPeerRateLimit].
+	pirAdmission *pirAdmission
+
+	// pirKeys caches the evaluation keys of private requests from other
+	// peers. It is nil if the cache is disabled.
+	pirKeys *private_routing.EvaluationKeyCache
+
+	// connCancels cancels the contexts of requests from other peers once the
+	// connection they were received on was closed. It is notified through
+	// the single notifiee connNotifiee.
+	connCancels  connCancels
+	connNotifiee network.Notifiee
+
 	// indicates whether this DHT instance was stopped ([DHT.Close] was called).
 	stopped atomic.Bool
 }
@@ -74,9 +102,30 @@ func New(h host.Host, cfg *Config) (*DHT, error) {
 	}
 
 	d := &DHT{
-		host: h,
-		cfg:  cfg,
-		log:  cfg.Logger,
+		host:         h,
+		cfg:          cfg,
+		log:          cfg.Logger,
+		rtDatabases:  newRTDatabaseCache(),
+		pirAdmission: newPIRAdmission(cfg),
+	}
+
+	d.pirSchemes = cfg.PIRSchemes
+	if cfg.PIRWorkers > 0 {
+		d.pirWorkers, err = pir.NewWorkerPool(context.Background(), cfg.PIRWorkers)
+		if err != nil {
+			return nil, fmt.Errorf("new PIR worker pool: %w", err)
+		}
+		d.pirSchemes = d.pirSchemes.WithWorkerPool(d.pirWorkers)
+	}
+	if cfg.PIRRequestBudget > 0 {
+		d.pirSchemes = d.pirSchemes.WithRequestBudget(cfg.PIRRequestBudget)
+	}
+
+	if cfg.PIRKeyCacheSize > 0 {
+		d.pirKeys, err = private_routing.NewEvaluationKeyCache(cfg.PIRKeyCacheSize, cfg.PIRKeyCacheTTL, cfg.Clock)
+		if err != nil {
+			return nil, fmt.Errorf("new PIR key cache: %w", err)
+		}
 	}
 
 	nid := kadt.PeerID(d.host.ID())
@@ -116,6 +165,13 @@ func New(h host.Host, cfg *Config) (*DHT, error) {
 	coordCfg.Logger = cfg.Logger
 	coordCfg.MeterProvider = cfg.MeterProvider
 	coordCfg.TracerProvider = cfg.TracerProvider
+	coordCfg.ProviderKeywordLookup = cfg.PIRProviderKeywordLookup
+	coordCfg.ProviderDimensions = cfg.PIRProviderDimensions
+	coordCfg.VerifyPeerRecords = cfg.PIRVerifyPeerRecords
+	coordCfg.PIRRowSize = cfg.PIRRowSize
+
+	// invalidate the cached PIR databases of the routing table when it changes
+	coordCfg.RoutingObserver = d.rtDatabases
 
 	coordCfg.Query.Clock = cfg.Clock
 	coordCfg.Query.Logger = cfg.Logger.With("behaviour", "pooledquery")
@@ -153,6 +209,10 @@ func New(h host.Host, cfg *Config) (*DHT, error) {
 		return nil, fmt.Errorf("invalid dht mode %s", cfg.Mode)
 	}
 
+	// cancel the handling of requests from peers that disconnected
+	d.connNotifiee = &network.NotifyBundle{DisconnectedF: d.connCancels.disconnected}
+	d.host.Network().Notify(d.connNotifiee)
+
 	// create subscription to various network events
 	d.sub, err = d.networkEventsSubscription()
 	if err != nil {
@@ -191,6 +251,7 @@ func (d *DHT) initAminoBackends() (map[string]Backend, error) {
 	pbeCfg.AddressFilter = d.cfg.AddressFilter
 	pbeCfg.Tele = d.tele
 	pbeCfg.clk = d.cfg.Clock
+	pbeCfg.PIRRowSize = d.cfg.PIRRowSize
 
 	pbe, err := NewBackendProvider(d.host.Peerstore(), dstore, pbeCfg)
 	if err != nil {
@@ -204,6 +265,7 @@ func (d *DHT) initAminoBackends() (map[string]Backend, error) {
 	rbeCfg.Logger = d.cfg.Logger
 	rbeCfg.Tele = d.tele
 	rbeCfg.clk = d.cfg.Clock
+	rbeCfg.PIRRowSize = d.cfg.PIRRowSize
 
 	ipnsBe, err := NewBackendIPNS(dstore, d.host.Peerstore(), rbeCfg)
 	if err != nil {
@@ -232,10 +294,16 @@ func (d *DHT) Close() error {
 		d.debugErr(err, "failed closing event bus subscription")
 	}
 
+	d.host.Network().StopNotify(d.connNotifiee)
+
 	if err := d.kad.Close(); err != nil {
 		d.debugErr(err, "failed closing coordinator")
 	}
 
+	if d.pirWorkers != nil {
+		d.pirWorkers.Close()
+	}
+
 	for ns, b := range d.backends {
 		closer, ok := b.(io.Closer)
 		if !ok {
@@ -5,11 +5,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 
 	ds "github.com/ipfs/go-datastore"
 	record "github.com/libp2p/go-libp2p-record"
 	recpb "github.com/libp2p/go-libp2p-record/pb"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	lprecord "github.com/libp2p/go-libp2p/core/record"
 	"go.opentelemetry.io/otel/attribute"
 	otel "go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slog"
@@ -290,15 +294,20 @@ func (d *DHT) handlePrivateFindPeer(ctx context.Context, remote peer.ID, msg *pb
 		return nil, fmt.Errorf("PIR Request for CloserPeers not sent in the message")
 	}
 
-	bucketsWithAddrInfos, err := d.NormalizeRTJoinedWithPeerStore(kadt.PeerID(remote).Key())
+	normalizedRT, err := d.normalizedRTDatabase(kadt.PeerID(remote).Key(), msg.GetSignedPeerRecords())
 	if err != nil {
 		return nil, fmt.Errorf("could not form normalized, joined routing table to run PIR request over")
 	}
 
-	pirResponse, err := private_routing.RunPIRforCloserPeersRecords(pirRequest, bucketsWithAddrInfos)
+	pirResponse, err := d.runPIRWithCachedKeys(ctx, remote, pb.PIR_Chunk_CLOSER_PEERS, pirRequest, func(ctx context.Context, req *pb.PIR_Request) (*pb.PIR_Response, error) {
+		return private_routing.RunPIRforCloserPeersDatabase(ctx, d.pirSchemes, req, normalizedRT)
+	})
 	if err != nil {
 		return nil, err
 	}
+	if err := streamPIRResponse(ctx, pb.PIR_Chunk_CLOSER_PEERS, pirResponse); err != nil {
+		return nil, fmt.Errorf("stream PIR response for closer peers: %w", err)
+	}
 	// println(pirResponse)
 
 	// TODO Ask Gui: handleFindPeer also looks up peerStore directly for the target key and adds it to the closerPeers.
@@ -327,15 +336,20 @@ func (d *DHT) handlePrivateGetProviderRecords(ctx context.Context, remote peer.I
 		return nil, fmt.Errorf("PIR Request for Closer Peers not sent in the message")
 	}
 
-	bucketsWithAddrInfos, err := d.NormalizeRTJoinedWithPeerStore(kadt.PeerID(remote).Key())
+	normalizedRT, err := d.normalizedRTDatabase(kadt.PeerID(remote).Key(), msg.GetSignedPeerRecords())
 	if err != nil {
 		return nil, fmt.Errorf("could not form normalized, joined routing table to run PIR request over")
 	}
 
-	closerPeersResponse, err := private_routing.RunPIRforCloserPeersRecords(closerPeersRequest, bucketsWithAddrInfos)
+	closerPeersResponse, err := d.runPIRWithCachedKeys(ctx, remote, pb.PIR_Chunk_CLOSER_PEERS, closerPeersRequest, func(ctx context.Context, req *pb.PIR_Request) (*pb.PIR_Response, error) {
+		return private_routing.RunPIRforCloserPeersDatabase(ctx, d.pirSchemes, req, normalizedRT)
+	})
 	if err != nil {
 		return nil, err
 	}
+	if err := streamPIRResponse(ctx, pb.PIR_Chunk_CLOSER_PEERS, closerPeersResponse); err != nil {
+		return nil, fmt.Errorf("stream PIR response for closer peers: %w", err)
+	}
 
 	providerPeersRequest := msg.GetProviderPeersRequest()
 	if providerPeersRequest == nil {
@@ -343,26 +357,129 @@ func (d *DHT) handlePrivateGetProviderRecords(ctx context.Context, remote peer.I
 	}
 
 	backend, err := typedBackend[*ProvidersBackend](d, namespaceProviders)
-	// TODO: This is the bucket index length in the number of bits. It should be hardcoded to 4096.
-	bucketIndexLength := 5 * 8
 	if err != nil {
 		panic("could not typecast backend, to run the function to prepare the DB for PIR")
 	}
-	mapCIDtoProviderPeers, err := backend.MapCIDBucketsToProviderPeerBytesForPIR(ctx, bucketIndexLength)
-	if err != nil {
-		return nil, fmt.Errorf("could not construct a map of CIDs to provider peers for PIR,  %s\n", err)
+
+	response := &pb.Message{
+		Type:                pb.Message_PRIVATE_GET_PROVIDERS,
+		PIR_Message_ID:      msg.PIR_Message_ID,
+		CloserPeersResponse: closerPeersResponse,
 	}
 
-	providerPeersResponse, err := private_routing.RunPIRforProviderPeersRecords(providerPeersRequest, mapCIDtoProviderPeers)
+	var providerPeers *private_routing.Database
+	if version := msg.GetProviderKeywordTableVersion(); version != 0 {
+		// keyword requests retrieve the slots of the cuckoo table of provider records
+		if version != private_routing.ProviderKeywordTableVersion {
+			return nil, fmt.Errorf("unsupported provider keyword table version %d, expected %d", version, private_routing.ProviderKeywordTableVersion)
+		}
+
+		keywords, err := backend.ProviderKeywordDatabaseForPIR(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not construct a keyword table of provider peers for PIR, %w", err)
+		}
+		response.ProviderKeywordTableLength = uint32(keywords.Log2NumSlots)
+
+		length := int(msg.GetProviderKeywordTableLength())
+		if length == 0 {
+			length = private_routing.ProviderKeywordTableLength
+		}
+		if length != keywords.Log2NumSlots {
+			// the client generates its request again for the length of our table
+			response.ProviderPeersResponse = &pb.PIR_Response{Error: &pb.PIR_Error{
+				Code:    pb.PIR_Error_TABLE_LENGTH_MISMATCH,
+				Message: fmt.Sprintf("request for a keyword table of 2^%d slots, table has 2^%d slots", length, keywords.Log2NumSlots),
+			}}
+			return response, nil
+		}
+
+		providerPeers = keywords.Database
+		response.ProviderKeywordStash = keywords.Stash
+	} else {
+		if msg.GetProviderBucketIndexVersion() != private_routing.ProviderBucketIndexVersion {
+			return nil, fmt.Errorf("unsupported provider bucket index version %d, expected %d", msg.GetProviderBucketIndexVersion(), private_routing.ProviderBucketIndexVersion)
+		}
+
+		providerPeers, err = backend.ProviderPeersDatabaseForPIR(ctx, private_routing.ProviderBucketIndexLength)
+		if err != nil {
+			return nil, fmt.Errorf("could not construct a map of CIDs to provider peers for PIR,  %s\n", err)
+		}
+	}
+
+	response.ProviderPeersResponse, err = d.runPIRWithCachedKeys(ctx, remote, pb.PIR_Chunk_PROVIDER_PEERS, providerPeersRequest, func(ctx context.Context, req *pb.PIR_Request) (*pb.PIR_Response, error) {
+		return private_routing.RunPIRforProviderPeersDatabase(ctx, d.pirSchemes, req, providerPeers)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("PIR for provider peers failed, %s\n", err)
 	}
+	if err := streamPIRResponse(ctx, pb.PIR_Chunk_PROVIDER_PEERS, response.ProviderPeersResponse); err != nil {
+		return nil, fmt.Errorf("stream PIR response for provider peers: %w", err)
+	}
+
+	return response, nil
+}
+
+// Responds to a PIR request in a private GetValue message with a PIR response.
+// The record request is run over the database of the records of the namespace
+// that the message names, see [RecordBackend.RecordDatabaseForPIR].
+func (d *DHT) handlePrivateGetValue(ctx context.Context, remote peer.ID, msg *pb.Message) (*pb.Message, error) {
+	_, span := d.tele.Tracer.Start(ctx, "DHT.handlePrivateGetValue", otel.WithAttributes(attribute.String("remote", remote.String())))
+	defer span.End()
+
+	closerPeersRequest := msg.GetCloserPeersRequest()
+	if closerPeersRequest == nil {
+		return nil, fmt.Errorf("PIR Request for Closer Peers not sent in the message")
+	}
+
+	recordRequest := msg.GetRecordRequest()
+	if recordRequest == nil {
+		return nil, fmt.Errorf("PIR Request for Record not sent in the message")
+	}
+
+	if msg.GetRecordBucketIndexVersion() != private_routing.RecordBucketIndexVersion {
+		return nil, fmt.Errorf("unsupported record bucket index version %d, expected %d", msg.GetRecordBucketIndexVersion(), private_routing.RecordBucketIndexVersion)
+	}
+
+	backend, err := typedBackend[*RecordBackend](d, msg.GetRecordNamespace())
+	if err != nil {
+		return nil, fmt.Errorf("unsupported record type: %s", msg.GetRecordNamespace())
+	}
+
+	records, err := backend.RecordDatabaseForPIR(ctx, private_routing.RecordBucketIndexLength)
+	if err != nil {
+		return nil, fmt.Errorf("could not construct a database of records for PIR: %w", err)
+	}
+
+	normalizedRT, err := d.normalizedRTDatabase(kadt.PeerID(remote).Key(), msg.GetSignedPeerRecords())
+	if err != nil {
+		return nil, fmt.Errorf("could not form normalized, joined routing table to run PIR request over")
+	}
+
+	closerPeersResponse, err := d.runPIRWithCachedKeys(ctx, remote, pb.PIR_Chunk_CLOSER_PEERS, closerPeersRequest, func(ctx context.Context, req *pb.PIR_Request) (*pb.PIR_Response, error) {
+		return private_routing.RunPIRforCloserPeersDatabase(ctx, d.pirSchemes, req, normalizedRT)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := streamPIRResponse(ctx, pb.PIR_Chunk_CLOSER_PEERS, closerPeersResponse); err != nil {
+		return nil, fmt.Errorf("stream PIR response for closer peers: %w", err)
+	}
+
+	recordResponse, err := d.runPIRWithCachedKeys(ctx, remote, pb.PIR_Chunk_RECORD, recordRequest, func(ctx context.Context, req *pb.PIR_Request) (*pb.PIR_Response, error) {
+		return private_routing.RunPIRforRecordsDatabase(ctx, d.pirSchemes, req, records)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("PIR for records failed: %w", err)
+	}
+	if err := streamPIRResponse(ctx, pb.PIR_Chunk_RECORD, recordResponse); err != nil {
+		return nil, fmt.Errorf("stream PIR response for record: %w", err)
+	}
 
 	response := &pb.Message{
-		Type:                  pb.Message_PRIVATE_GET_PROVIDERS,
-		PIR_Message_ID:        msg.PIR_Message_ID,
-		CloserPeersResponse:   closerPeersResponse,
-		ProviderPeersResponse: providerPeersResponse,
+		Type:                pb.Message_PRIVATE_GET_VALUE,
+		PIR_Message_ID:      msg.PIR_Message_ID,
+		CloserPeersResponse: closerPeersResponse,
+		RecordResponse:      recordResponse,
 	}
 
 	return response, nil
@@ -370,23 +487,67 @@ func (d *DHT) handlePrivateGetProviderRecords(ctx context.Context, remote peer.I
 
 // This function first normalizes the RT --- filling up any buckets that are not full with
 // nearest nodes from other buckets, given only the common prefix length for that bucket.
+// Each bucket is then backfilled with peers that are only known in the peer store.
 // The (normalized) RT consists of <kad ID, peer ID> records.
 // The d.host.Peerstore() consists of <peer ID, peer address> records.
 // We then join these key-value stores here, oblivious to the target.
 func (d *DHT) NormalizeRTJoinedWithPeerStore(queryingPeerKadId kadt.Key) ([][]byte, error) {
+	return d.normalizeRTJoinedWithPeerStore(queryingPeerKadId, false)
+}
+
+// normalizeRTJoinedWithPeerStore implements [DHT.NormalizeRTJoinedWithPeerStore].
+// If signed is set, each peer carries the marshalled signed envelope of its
+// peer record from the certified address book of the peer store, if there is
+// one, so that the client can verify the addresses of the peer.
+func (d *DHT) normalizeRTJoinedWithPeerStore(queryingPeerKadId kadt.Key, signed bool) ([][]byte, error) {
+	var certifiedAddrBook peerstore.CertifiedAddrBook
+	if signed {
+		cab, ok := peerstore.GetCertifiedAddrBook(d.host.Peerstore())
+		if !ok {
+			return nil, fmt.Errorf("peer store does not keep signed peer records")
+		}
+		certifiedAddrBook = cab
+	}
+
 	// Bucket -> [PeerID1, PeerID2, ...]
-	bucketsWithPeerIDs := d.rt.NormalizeRT(queryingPeerKadId)
+	rtBuckets := d.rt.NormalizeRT(queryingPeerKadId)
+	inRT := make(map[kadt.PeerID]struct{})
+	for _, bucket := range rtBuckets {
+		for _, p := range bucket {
+			inRT[p] = struct{}{}
+		}
+	}
+	bucketsWithPeerIDs := d.backfillFromPeerStore(rtBuckets)
 
 	// Bucket -> <Peer ID -> multiaddress array
 	bucketsWithAddrInfos := make([][]byte, len(bucketsWithPeerIDs))
 
 	// Bucket -> <Peer ID and multiaddress array>
 	for bid, bucket := range bucketsWithPeerIDs {
-		addrInfos := make([]*pb.Message_Peer, len(bucket))
-		for i, peerID := range bucket {
+		addrInfos := make([]*pb.Message_Peer, 0, len(bucket))
+		for _, peerID := range bucket {
+			// only serve the addresses of backfilled peers that pass the
+			// address filter, and leave out peers without any
 			peerInfo := d.host.Peerstore().PeerInfo(peer.ID(peerID))
+			_, found := inRT[peerID]
+			if !found {
+				peerInfo.Addrs = d.cfg.AddressFilter(peerInfo.Addrs)
+				if len(peerInfo.Addrs) == 0 {
+					continue
+				}
+			}
 			messagePeer := pb.FromAddrInfo(peerInfo)
-			addrInfos[i] = messagePeer
+			if certifiedAddrBook != nil {
+				// the signed peer records of backfilled peers must not carry addresses that the filter rejects
+				if envelope := certifiedAddrBook.GetPeerRecord(peer.ID(peerID)); envelope != nil && (found || d.passesAddressFilter(envelope)) {
+					signedRecord, err := envelope.Marshal()
+					if err != nil {
+						return nil, fmt.Errorf("marshal signed peer record: %w", err)
+					}
+					messagePeer.SignedRecord = signedRecord
+				}
+			}
+			addrInfos = append(addrInfos, messagePeer)
 		}
 		mesg := &pb.Message{
 			CloserPeers: addrInfos,
@@ -407,25 +568,118 @@ func (d *DHT) NormalizeRTJoinedWithPeerStore(queryingPeerKadId kadt.Key) ([][]by
 	return bucketsWithAddrInfos, nil
 }
 
-// TODO: How to extend this function to provide the functionality in Line 52 in handleFindPeer
-//  obliviously to the target key.
-// Line 52 in handleFindPeer looks up the peerstore with the target kademlia ID,
-// even though closerPeer looks up the peerStore with the output of
-// d.rt.NearestNodes(..)
-// See the comments there --- the rationale is that the target may be in a bucket
-// of the RT that was full, so we don't store its <kad ID, peer ID> in the RT.
-// But we still store its <peer ID, multiaddress array> in the peerstore.
-
-// So to do this obliviously to the target, we add some steps to *this function*,
-//  which is run before answering the PIR request.
-// We can fill up the RT with <kad ID, peer ID> of nodes that *are* in the peerstore but *not* in the RT.
-// This effectively adds more entries to the RT; some other than the target which may not have been there earlier.
-// So we need to ask Gui if this is acceptable. Let's suppose it is acceptable.
-// Then, we would've ensured that every <peer ID, multiaddress []> in the peerstore
-// has a corresponding <kad ID, peer ID> in the RT.
-
-// Then we would run NormalizeRT as seen below.
-// (Buckets might be very full already, so we might not need to normalize some buckets.)
-// Then the join will ensure that *any* target which was earlier in the peerstore,
-// but not in the RT, will *also* be included in the join output:
-// Join: <target's kadID, target's peerID> <target's peerID, target's address>
+// backfillFromPeerStore adds the peers that are known in the peer store, but
+// not in the given normalized routing table, to the bucket of their common
+// prefix length with our key. Plaintext FIND_NODE requests return the target
+// if we happen to know its addresses, although its bucket in the routing table
+// may have been full. Backfilling every bucket lets private requests find such
+// peers too, without us learning the target. Only backfill candidates (see
+// [DHT.isBackfillCandidate]) are added. Peers that we are connected to come
+// first, followed by peers that we were recently connected to, so that at
+// most [Config.PIRBackfillBucketSize] of the most recently seen peers are
+// added to each bucket. Ties are broken by peer ID, so that the databases
+// don't depend on the iteration order of the peer store.
+func (d *DHT) backfillFromPeerStore(buckets [][]kadt.PeerID) [][]kadt.PeerID {
+	if d.cfg.PIRBackfillBucketSize == 0 || len(buckets) == 0 {
+		return buckets
+	}
+
+	known := make(map[peer.ID]struct{})
+	for _, bucket := range buckets {
+		for _, p := range bucket {
+			known[peer.ID(p)] = struct{}{}
+		}
+	}
+
+	pstore := d.host.Peerstore()
+	selfKey := kadt.PeerID(d.host.ID()).Key()
+
+	candidates := make([][]peer.ID, len(buckets))
+	for _, p := range pstore.PeersWithAddrs() {
+		if _, found := known[p]; found {
+			continue
+		}
+		if !d.isBackfillCandidate(p) {
+			continue
+		}
+
+		cpl := selfKey.CommonPrefixLength(kadt.PeerID(p).Key())
+		if cpl >= len(buckets) {
+			cpl = len(buckets) - 1
+		}
+		candidates[cpl] = append(candidates[cpl], p)
+	}
+
+	recency := func(p peer.ID) int {
+		switch d.host.Network().Connectedness(p) {
+		case network.Connected:
+			return 0
+		case network.CanConnect:
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	backfilled := make([][]kadt.PeerID, len(buckets))
+	for bid, bucket := range buckets {
+		peers := candidates[bid]
+		if len(peers) == 0 {
+			backfilled[bid] = bucket
+			continue
+		}
+
+		sort.Slice(peers, func(i, j int) bool {
+			ri, rj := recency(peers[i]), recency(peers[j])
+			if ri != rj {
+				return ri < rj
+			}
+			return peers[i] < peers[j]
+		})
+		if len(peers) > d.cfg.PIRBackfillBucketSize {
+			peers = peers[:d.cfg.PIRBackfillBucketSize]
+		}
+
+		// copy the bucket, as it may be shared with the routing table
+		extended := make([]kadt.PeerID, len(bucket), len(bucket)+len(peers))
+		copy(extended, bucket)
+		for _, p := range peers {
+			extended = append(extended, kadt.PeerID(p))
+		}
+		backfilled[bid] = extended
+	}
+
+	return backfilled
+}
+
+// passesAddressFilter returns true if all addresses of the signed peer record
+// in the envelope pass the address filter.
+func (d *DHT) passesAddressFilter(envelope *lprecord.Envelope) bool {
+	rec, err := envelope.Record()
+	if err != nil {
+		return false
+	}
+	peerRecord, ok := rec.(*peer.PeerRecord)
+	if !ok {
+		return false
+	}
+	return len(d.cfg.AddressFilter(peerRecord.Addrs)) == len(peerRecord.Addrs)
+}
+
+// isBackfillCandidate returns true if the backfill is enabled and the peer
+// may be backfilled into the normalized routing table from the peer store.
+// This is the case if the peer isn't ourselves, supports the DHT protocol, so
+// that querying peers don't waste requests on peers that can't answer them,
+// and has addresses that pass the address filter.
+func (d *DHT) isBackfillCandidate(p peer.ID) bool {
+	if d.cfg.PIRBackfillBucketSize == 0 || p == d.host.ID() {
+		return false
+	}
+
+	pstore := d.host.Peerstore()
+	if protocols, err := pstore.SupportsProtocols(p, d.cfg.ProtocolID); err != nil || len(protocols) == 0 {
+		return false
+	}
+
+	return len(d.cfg.AddressFilter(pstore.Addrs(p))) > 0
+}
@@ -15,11 +15,15 @@ import (
 
 	"github.com/benbjohnson/clock"
 	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
 	record "github.com/libp2p/go-libp2p-record"
 	recpb "github.com/libp2p/go-libp2p-record/pb"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	lprecord "github.com/libp2p/go-libp2p/core/record"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -1509,7 +1513,7 @@ func TestDHT_handlePrivateFindPeer(t *testing.T) {
 	serverKey := kadt.PeerID(serverPeer).Key()
 
 	mode := pir.RLWE_Whispir_3_Keys
-	pirClientPeerRouting := private_routing.NewPirClientPeerRouting(mode)
+	pirClientPeerRouting := private_routing.NewPirClientPeerRouting(mode, d.cfg.PIRRowSize)
 	pirRequestCloserPeers, err := pirClientPeerRouting.GenerateRequest(targetKey, serverKey)
 	require.NoError(t, err)
 
@@ -1530,15 +1534,448 @@ func TestDHT_handlePrivateFindPeer(t *testing.T) {
 	plaintextPBCloserPeers, err := pirClientPeerRouting.ProcessResponse(resp.CloserPeersResponse)
 	require.NoError(t, err)
 
-	checkCloserPeers(t, plaintextPBCloserPeers, d.cfg.BucketSize)
+	checkCloserPeers(t, plaintextPBCloserPeers, d.cfg.BucketSize, d.cfg.PIRBackfillBucketSize)
 	assert.Len(t, resp.ProviderPeers, 0)
 
 }
 
+func TestDHT_handlePrivateFindPeer_backfill(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDHT(t)
+
+	peers := fillRoutingTable(t, d, 250)
+
+	// the target is only known in the peer store, not in the routing table
+	target := newPeerID(t)
+	targetAddr := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	d.host.Peerstore().AddAddr(target, targetAddr, time.Hour)
+	d.host.Peerstore().AddAddr(target, ma.StringCast("/ip4/192.168.1.1/tcp/4001"), time.Hour)
+	require.NoError(t, d.host.Peerstore().AddProtocols(target, d.cfg.ProtocolID))
+
+	req := &pb.Message{
+		Type: pb.Message_FIND_NODE,
+		Key:  []byte(target),
+	}
+	resp, err := d.handleFindPeer(ctx, peers[0], req)
+	require.NoError(t, err)
+	require.True(t, resp.ContainsCloserPeer(target))
+
+	findPrivately := func(t *testing.T) *pb.Message {
+		t.Helper()
+
+		pirClientPeerRouting := private_routing.NewPirClientPeerRouting(pir.RLWE_Whispir_3_Keys, d.cfg.PIRRowSize)
+		pirRequestCloserPeers, err := pirClientPeerRouting.GenerateRequest(kadt.PeerID(target).Key(), kadt.PeerID(d.host.ID()).Key())
+		require.NoError(t, err)
+
+		msg := &pb.Message{
+			Type:               pb.Message_PRIVATE_FIND_NODE,
+			PIR_Message_ID:     1234,
+			CloserPeersRequest: pirRequestCloserPeers,
+		}
+
+		resp, err := d.handlePrivateFindPeer(ctx, peers[0], msg)
+		require.NoError(t, err)
+
+		plaintextPBCloserPeers, err := pirClientPeerRouting.ProcessResponse(resp.CloserPeersResponse)
+		require.NoError(t, err)
+		return plaintextPBCloserPeers
+	}
+
+	// the private response returns the target with the addresses that pass
+	// the address filter
+	privateResp := findPrivately(t)
+	require.True(t, privateResp.ContainsCloserPeer(target))
+	for _, p := range privateResp.CloserPeers {
+		if peer.ID(p.Id) != target {
+			continue
+		}
+		require.Len(t, p.Addresses(), 1)
+		assert.True(t, p.Addresses()[0].Equal(targetAddr))
+	}
+
+	// without the backfill, the target is only returned in plaintext
+	d.cfg.PIRBackfillBucketSize = 0
+	d.rtDatabases.invalidate()
+
+	privateResp = findPrivately(t)
+	assert.False(t, privateResp.ContainsCloserPeer(target))
+}
+
+func TestDHT_backfillFromPeerStore(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Logger = devnull
+	cfg.PIRBackfillBucketSize = 2
+	d := newTestDHTWithConfig(t, cfg)
+
+	fillRoutingTable(t, d, 250)
+
+	// peers that are only known in the peer store
+	pstore := d.host.Peerstore()
+	for i := 0; i < 50; i++ {
+		p := newPeerID(t)
+		a := ma.StringCast(fmt.Sprintf("/ip4/1.2.3.4/tcp/%d", 4000+i))
+		pstore.AddAddr(p, a, time.Hour)
+		require.NoError(t, pstore.AddProtocols(p, d.cfg.ProtocolID))
+	}
+
+	// peers with private addresses only are filtered out
+	private := newPeerID(t)
+	pstore.AddAddr(private, ma.StringCast("/ip4/127.0.1.1/tcp/4001"), time.Hour)
+	require.NoError(t, pstore.AddProtocols(private, d.cfg.ProtocolID))
+
+	// peers that don't support the DHT protocol are filtered out
+	nonDHT := newPeerID(t)
+	pstore.AddAddr(nonDHT, ma.StringCast("/ip4/1.2.3.4/tcp/5000"), time.Hour)
+
+	selfKey := kadt.PeerID(d.host.ID()).Key()
+	normalized := d.rt.NormalizeRT(selfKey)
+	buckets := d.backfillFromPeerStore(normalized)
+	require.Len(t, buckets, len(normalized))
+
+	total := 0
+	backfilled := make([][]kadt.PeerID, len(buckets))
+	for bid, bucket := range buckets {
+		require.GreaterOrEqual(t, len(bucket), len(normalized[bid]))
+		assert.Equal(t, normalized[bid], bucket[:len(normalized[bid])])
+
+		added := bucket[len(normalized[bid]):]
+		assert.LessOrEqual(t, len(added), cfg.PIRBackfillBucketSize)
+		for _, p := range added {
+			assert.NotEqual(t, private, peer.ID(p))
+			assert.NotEqual(t, nonDHT, peer.ID(p))
+			_, inRT := d.rt.GetNode(p.Key())
+			assert.False(t, inRT)
+			if bid < len(buckets)-1 {
+				assert.Equal(t, bid, selfKey.CommonPrefixLength(p.Key()))
+			}
+		}
+		total += len(added)
+		backfilled[bid] = added
+	}
+	assert.Greater(t, total, 0)
+
+	// the backfilled peers don't depend on the iteration order of the peer store
+	normalized = d.rt.NormalizeRT(selfKey)
+	for bid, bucket := range d.backfillFromPeerStore(normalized) {
+		assert.Equal(t, backfilled[bid], bucket[len(normalized[bid]):])
+	}
+}
+
+func TestDHT_handlePrivateFindPeer_workers(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Logger = devnull
+	cfg.PIRWorkers = 4
+	d := newTestDHTWithConfig(t, cfg)
+	require.NotNil(t, d.pirWorkers)
+
+	peers := fillRoutingTable(t, d, 250)
+
+	pirClientPeerRouting := private_routing.NewPirClientPeerRouting(pir.RLWE_Whispir_3_Keys, d.cfg.PIRRowSize)
+	pirRequestCloserPeers, err := pirClientPeerRouting.GenerateRequest(kadt.PeerID(peers[1]).Key(), kadt.PeerID(d.host.ID()).Key())
+	require.NoError(t, err)
+
+	msg := &pb.Message{
+		Type:               pb.Message_PRIVATE_FIND_NODE,
+		PIR_Message_ID:     1234,
+		CloserPeersRequest: pirRequestCloserPeers,
+	}
+
+	resp, err := d.handlePrivateFindPeer(context.Background(), peers[0], msg)
+	require.NoError(t, err)
+
+	plaintextPBCloserPeers, err := pirClientPeerRouting.ProcessResponse(resp.CloserPeersResponse)
+	require.NoError(t, err)
+	checkCloserPeers(t, plaintextPBCloserPeers, d.cfg.BucketSize, d.cfg.PIRBackfillBucketSize)
+
+	// requests aren't evaluated after the DHT was closed
+	require.NoError(t, d.Close())
+	_, err = d.handlePrivateFindPeer(context.Background(), peers[0], msg)
+	require.ErrorIs(t, err, pir.ErrWorkerPoolClosed)
+}
+
+func TestDHT_handlePrivateFindPeer_busy(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Logger = devnull
+	cfg.Clock = clock.NewMock() // the bucket isn't refilled while the first request is processed
+	cfg.PIRPeerRateLimit = 1
+	cfg.PIRPeerBurst = 1
+	d := newTestDHTWithConfig(t, cfg)
+
+	peers := fillRoutingTable(t, d, 250)
+
+	pirClientPeerRouting := private_routing.NewPirClientPeerRouting(pir.RLWE_Whispir_3_Keys, d.cfg.PIRRowSize)
+	pirRequestCloserPeers, err := pirClientPeerRouting.GenerateRequest(kadt.PeerID(peers[1]).Key(), kadt.PeerID(d.host.ID()).Key())
+	require.NoError(t, err)
+
+	msg := &pb.Message{
+		Type:               pb.Message_PRIVATE_FIND_NODE,
+		PIR_Message_ID:     1234,
+		CloserPeersRequest: pirRequestCloserPeers,
+	}
+
+	resp, err := d.handleMsg(context.Background(), peers[0], msg)
+	require.NoError(t, err)
+	_, err = pirClientPeerRouting.ProcessResponse(resp.CloserPeersResponse)
+	require.NoError(t, err)
+
+	// the remote peer exceeded its rate limit
+	resp, err = d.handleMsg(context.Background(), peers[0], msg)
+	require.NoError(t, err)
+	assert.Equal(t, msg.PIR_Message_ID, resp.PIR_Message_ID)
+	assert.Equal(t, pb.PIR_Error_BUSY, resp.GetCloserPeersResponse().GetError().GetCode())
+	_, err = pirClientPeerRouting.ProcessResponse(resp.CloserPeersResponse)
+	assert.ErrorIs(t, err, private_routing.ErrServerBusy)
+
+	// other peers are still served
+	resp, err = d.handleMsg(context.Background(), peers[1], msg)
+	require.NoError(t, err)
+	assert.Nil(t, resp.GetCloserPeersResponse().GetError())
+}
+
+func TestDHT_handlePrivateFindPeer_unsupported_scheme(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Logger = devnull
+	cfg.PIRSchemes = pir.NewRegistry()
+	cfg.PIRSchemes.Register(pir.RLWE_Whispir_2_Keys, func(log2_num_rows int) pir.PIR_Protocol {
+		return pir.NewSimpleRLWE_PIR_Protocol_mode(log2_num_rows, pir.RLWE_Whispir_2_Keys)
+	})
+	d := newTestDHTWithConfig(t, cfg)
+
+	peers := fillRoutingTable(t, d, 250)
+
+	targetKey := kadt.PeerID([]byte("key")).Key()
+	serverKey := kadt.PeerID(d.host.ID()).Key()
+
+	pirClientPeerRouting := private_routing.NewPirClientPeerRouting(pir.RLWE_Whispir_3_Keys, d.cfg.PIRRowSize)
+	pirRequestCloserPeers, err := pirClientPeerRouting.GenerateRequest(targetKey, serverKey)
+	require.NoError(t, err)
+
+	msg := &pb.Message{
+		Type:               pb.Message_PRIVATE_FIND_NODE,
+		PIR_Message_ID:     1234,
+		CloserPeersRequest: pirRequestCloserPeers,
+	}
+
+	resp, err := d.handlePrivateFindPeer(context.Background(), peers[0], msg)
+	require.NoError(t, err)
+
+	assert.Equal(t, pb.Message_PRIVATE_FIND_NODE, resp.Type)
+	assert.Equal(t, resp.PIR_Message_ID, msg.PIR_Message_ID)
+	require.NotNil(t, resp.CloserPeersResponse)
+	assert.Empty(t, resp.CloserPeersResponse.Ciphertexts)
+	assert.Equal(t, pb.PIR_Error_UNSUPPORTED_SCHEME, resp.CloserPeersResponse.GetError().GetCode())
+	assert.Equal(t, []string{pir.RLWE_Whispir_2_Keys}, resp.CloserPeersResponse.GetError().GetSupportedSchemes())
+
+	_, err = pirClientPeerRouting.ProcessResponse(resp.CloserPeersResponse)
+	assert.ErrorIs(t, err, pir.ErrUnsupportedScheme)
+}
+
+func TestDHT_handlePrivateFindPeer_cached_evaluation_keys(t *testing.T) {
+	d := newTestDHT(t)
+
+	peers := fillRoutingTable(t, d, 250)
+
+	targetKey := kadt.PeerID([]byte("key")).Key()
+	serverKey := kadt.PeerID(d.host.ID()).Key()
+
+	session, err := pir.NewSimpleRLWE_Session(pir.RLWE_Whispir_3_Keys)
+	require.NoError(t, err)
+
+	sendRequest := func(remote peer.ID) (*private_routing.PirClientPeerRouting, *pb.Message) {
+		client := private_routing.NewPirClientPeerRoutingWithSession(session)
+		req, err := client.GenerateRequest(targetKey, serverKey)
+		require.NoError(t, err)
+
+		msg := &pb.Message{
+			Type:               pb.Message_PRIVATE_FIND_NODE,
+			PIR_Message_ID:     1234,
+			CloserPeersRequest: req,
+		}
+
+		resp, err := d.handlePrivateFindPeer(context.Background(), remote, msg)
+		require.NoError(t, err)
+
+		return client, resp
+	}
+
+	// the first request carries the evaluation keys, which are cached
+	client, resp := sendRequest(peers[0])
+	assert.True(t, resp.CloserPeersResponse.GetEvaluationKeysCached())
+	_, err = client.ProcessResponse(resp.CloserPeersResponse)
+	require.NoError(t, err)
+
+	// the next request only references them
+	client, resp = sendRequest(peers[0])
+	assert.False(t, resp.CloserPeersResponse.GetEvaluationKeysCached())
+	plaintextPBCloserPeers, err := client.ProcessResponse(resp.CloserPeersResponse)
+	require.NoError(t, err)
+	checkCloserPeers(t, plaintextPBCloserPeers, d.cfg.BucketSize, d.cfg.PIRBackfillBucketSize)
+
+	// which other peers can't do
+	client, resp = sendRequest(peers[1])
+	assert.Equal(t, pb.PIR_Error_UNKNOWN_EVALUATION_KEYS, resp.CloserPeersResponse.GetError().GetCode())
+	_, err = client.ProcessResponse(resp.CloserPeersResponse)
+	assert.ErrorIs(t, err, pir.ErrUnknownEvaluationKeys)
+
+	// so the keys are sent again
+	_, resp = sendRequest(peers[1])
+	assert.Nil(t, resp.CloserPeersResponse.GetError())
+	assert.True(t, resp.CloserPeersResponse.GetEvaluationKeysCached())
+}
+
+func TestDHT_handlePrivateFindPeer_invalid_evaluation_keys(t *testing.T) {
+	d := newTestDHT(t)
+
+	peers := fillRoutingTable(t, d, 250)
+
+	targetKey := kadt.PeerID([]byte("key")).Key()
+	serverKey := kadt.PeerID(d.host.ID()).Key()
+
+	session, err := pir.NewSimpleRLWE_Session(pir.RLWE_Whispir_3_Keys)
+	require.NoError(t, err)
+
+	client := private_routing.NewPirClientPeerRoutingWithSession(session)
+	req, err := client.GenerateRequest(targetKey, serverKey)
+	require.NoError(t, err)
+	require.NotEmpty(t, req.GetEvaluationKeysId())
+
+	// the request is rejected for its malformed evaluation keys
+	req.SchemeDependent = &pb.PIR_Request_RLWEEvaluationKeys{RLWEEvaluationKeys: []byte("malformed keys")}
+	resp, err := d.handlePrivateFindPeer(context.Background(), peers[0], &pb.Message{
+		Type:               pb.Message_PRIVATE_FIND_NODE,
+		PIR_Message_ID:     1234,
+		CloserPeersRequest: req,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, pb.PIR_Error_INVALID_REQUEST, resp.CloserPeersResponse.GetError().GetCode())
+	assert.False(t, resp.CloserPeersResponse.GetEvaluationKeysCached())
+
+	// so its keys aren't cached
+	req.SchemeDependent = nil
+	resp, err = d.handlePrivateFindPeer(context.Background(), peers[0], &pb.Message{
+		Type:               pb.Message_PRIVATE_FIND_NODE,
+		PIR_Message_ID:     1234,
+		CloserPeersRequest: req,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, pb.PIR_Error_UNKNOWN_EVALUATION_KEYS, resp.CloserPeersResponse.GetError().GetCode())
+}
+
 // func TestDHT_compareHandleFindPeer_and_privateHandleFindPeer(t *testing.T) {
 // 	// TODO: check that the output of PrivateFindPeer includes all nodes from FindPeer that have the same CPL as the target key
 // }
 
+func TestDHT_handlePrivateFindPeer_signed_peer_records(t *testing.T) {
+	d := newTestDHT(t)
+
+	cab, ok := peerstore.GetCertifiedAddrBook(d.host.Peerstore())
+	require.True(t, ok)
+
+	// the peers of the routing table have signed peer records in the peer store
+	signed := map[peer.ID]ma.Multiaddr{}
+	var peers []peer.ID
+	for i := 0; i < 20; i++ {
+		pid, priv := newIdentity(t)
+		a, err := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.1.1/tcp/%d", 2000+i))
+		require.NoError(t, err)
+
+		envelope, err := lprecord.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: pid, Addrs: []ma.Multiaddr{a}}), priv)
+		require.NoError(t, err)
+		_, err = cab.ConsumePeerRecord(envelope, time.Hour)
+		require.NoError(t, err)
+
+		d.rt.AddNode(kadt.PeerID(pid))
+		signed[pid] = a
+		peers = append(peers, pid)
+	}
+
+	targetKey := kadt.PeerID(peers[0]).Key()
+	serverKey := kadt.PeerID(d.host.ID()).Key()
+
+	for _, signedPeerRecords := range []bool{false, true} {
+		client := private_routing.NewPirClientPeerRouting(pir.RLWE_Whispir_3_Keys, d.cfg.PIRRowSize)
+		req, err := client.GenerateRequest(targetKey, serverKey)
+		require.NoError(t, err)
+
+		resp, err := d.handlePrivateFindPeer(context.Background(), newPeerID(t), &pb.Message{
+			Type:               pb.Message_PRIVATE_FIND_NODE,
+			PIR_Message_ID:     1234,
+			CloserPeersRequest: req,
+			SignedPeerRecords:  signedPeerRecords,
+		})
+		require.NoError(t, err)
+
+		if !signedPeerRecords {
+			// without signed records, verification drops all peers
+			msg, err := client.ProcessResponse(resp.CloserPeersResponse)
+			require.NoError(t, err)
+			require.NotEmpty(t, msg.CloserPeers)
+			for _, p := range msg.CloserPeers {
+				assert.Empty(t, p.SignedRecord)
+			}
+
+			verified, err := private_routing.VerifyPeerRecords(msg.CloserPeers)
+			require.NoError(t, err)
+			assert.Empty(t, verified)
+			continue
+		}
+
+		msg, err := client.ProcessVerifiedResponse(resp.CloserPeersResponse)
+		require.NoError(t, err)
+		require.NotEmpty(t, msg.CloserPeers)
+		for _, p := range msg.CloserPeers {
+			id, err := peer.IDFromBytes(p.Id)
+			require.NoError(t, err)
+			require.Contains(t, signed, id)
+			assert.Equal(t, []ma.Multiaddr{signed[id]}, p.Addresses())
+		}
+	}
+}
+
+func TestDHT_normalizeRTJoinedWithPeerStore_signed_backfill(t *testing.T) {
+	d := newTestDHT(t)
+	fillRoutingTable(t, d, 10)
+
+	cab, ok := peerstore.GetCertifiedAddrBook(d.host.Peerstore())
+	require.True(t, ok)
+
+	// backfilled peers whose signed peer records carry a public address, or
+	// a public and a private one
+	publicAddr := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+	privateAddr := ma.StringCast("/ip4/192.168.1.1/tcp/4001")
+	backfill := func(addrs ...ma.Multiaddr) peer.ID {
+		pid, priv := newIdentity(t)
+		envelope, err := lprecord.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: pid, Addrs: addrs}), priv)
+		require.NoError(t, err)
+		_, err = cab.ConsumePeerRecord(envelope, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, d.host.Peerstore().AddProtocols(pid, d.cfg.ProtocolID))
+		return pid
+	}
+	public := backfill(publicAddr)
+	mixed := backfill(publicAddr, privateAddr)
+
+	buckets, err := d.normalizeRTJoinedWithPeerStore(kadt.PeerID(newPeerID(t)).Key(), true)
+	require.NoError(t, err)
+
+	served := map[peer.ID]*pb.Message_Peer{}
+	for _, bucket := range buckets {
+		msg, err := private_routing.UnmarshallPlaintextToPB(bucket)
+		require.NoError(t, err)
+		for _, p := range msg.CloserPeers {
+			served[peer.ID(p.Id)] = p
+		}
+	}
+
+	// both peers are served with the addresses that pass the filter, but
+	// only the record without the private address is attached
+	require.Contains(t, served, public)
+	require.Contains(t, served, mixed)
+	assert.Equal(t, []ma.Multiaddr{publicAddr}, served[mixed].Addresses())
+	assert.NotEmpty(t, served[public].SignedRecord)
+	assert.Empty(t, served[mixed].SignedRecord)
+}
+
 func TestDHT_handlePrivateGetProviders(t *testing.T) {
 	d := newTestDHT(t)
 
@@ -1556,7 +1993,7 @@ func TestDHT_handlePrivateGetProviders(t *testing.T) {
 	serverKey := kadt.PeerID(queryingPeer).Key()
 
 	mode := pir.RLWE_Whispir_3_Keys
-	pirClientPeerRouting := private_routing.NewPirClientPeerRouting(mode)
+	pirClientPeerRouting := private_routing.NewPirClientPeerRouting(mode, d.cfg.PIRRowSize)
 	pirRequestCloserPeers, err := pirClientPeerRouting.GenerateRequest(targetKey, serverKey)
 	require.NoError(t, err)
 
@@ -1564,21 +2001,22 @@ func TestDHT_handlePrivateGetProviders(t *testing.T) {
 	be, providers, cids := createProviders(t, d, 1<<log2_num_records)
 	log2_num_Buckets := 8
 	var lookupFileCID = cids[0]
-	pirClientProviderRouting := private_routing.NewPirClientProviderRouting(log2_num_Buckets, mode)
+	pirClientProviderRouting := private_routing.NewPirClientProviderRouting(log2_num_Buckets, mode, d.cfg.PIRRowSize)
 	pirRequestProviderPeers, err := pirClientProviderRouting.GenerateRequest(lookupFileCID)
 	require.NoError(t, err)
 
 	msg := &pb.Message{
-		Type:                 pb.Message_PRIVATE_FIND_NODE,
-		PIR_Message_ID:       1234,
-		CloserPeersRequest:   pirRequestCloserPeers,
-		ProviderPeersRequest: pirRequestProviderPeers,
+		Type:                       pb.Message_PRIVATE_GET_PROVIDERS,
+		PIR_Message_ID:             1234,
+		CloserPeersRequest:         pirRequestCloserPeers,
+		ProviderPeersRequest:       pirRequestProviderPeers,
+		ProviderBucketIndexVersion: private_routing.ProviderBucketIndexVersion,
 	}
 	//
 	resp, err := d.handlePrivateGetProviderRecords(context.Background(), queryingPeer, msg)
 	require.NoError(t, err)
 
-	assert.Equal(t, pb.Message_PRIVATE_FIND_NODE, resp.Type)
+	assert.Equal(t, pb.Message_PRIVATE_GET_PROVIDERS, resp.Type)
 	assert.Equal(t, resp.PIR_Message_ID, msg.PIR_Message_ID)
 	assert.NotNil(t, resp.CloserPeersResponse)
 	assert.Nil(t, resp.Record)
@@ -1586,12 +2024,212 @@ func TestDHT_handlePrivateGetProviders(t *testing.T) {
 	plaintextPBCloserPeers, err := pirClientPeerRouting.ProcessResponse(resp.CloserPeersResponse)
 	require.NoError(t, err)
 
-	checkCloserPeers(t, plaintextPBCloserPeers, d.cfg.BucketSize)
+	checkCloserPeers(t, plaintextPBCloserPeers, d.cfg.BucketSize, d.cfg.PIRBackfillBucketSize)
+
+	plaintextPBProviderPeers, err := pirClientProviderRouting.ProcessResponse(resp.ProviderPeersResponse)
+	require.NoError(t, err)
+
+	checkProviderPeers(t, plaintextPBProviderPeers, be, providers, lookupFileCID)
+}
+
+func TestDHT_handlePrivateGetProviders_recursive(t *testing.T) {
+	d := newTestDHT(t)
+	fillRoutingTable(t, d, 10)
+	queryingPeer := newPeerID(t)
+
+	be, providers, cids := createProviders(t, d, 1<<8)
+	lookupFileCID := cids[0]
+
+	// the parameter set suits the first of the two dimensions of the buckets
+	mode := pir.RLWE_Whispir_3_Keys
+	set, err := pir.SelectRLWEParameterSet(mode, private_routing.ProviderBucketIndexLength/2, d.cfg.PIRRowSize)
+	require.NoError(t, err)
+	session, err := pir.NewSimpleRLWE_Session_parameters(mode, set)
+	require.NoError(t, err)
+
+	client := private_routing.NewPirClientProviderRoutingRecursiveWithSession(private_routing.ProviderBucketIndexLength, session, 2)
+	pirRequestProviderPeers, err := client.GenerateRequest(lookupFileCID)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, pirRequestProviderPeers.GetNumDimensions())
+
+	closerPeersClient := private_routing.NewPirClientPeerRouting(mode, d.cfg.PIRRowSize)
+	pirRequestCloserPeers, err := closerPeersClient.GenerateRequest(kadt.PeerID(lookupFileCID.Hash()).Key(), kadt.PeerID(d.host.ID()).Key())
+	require.NoError(t, err)
+
+	msg := &pb.Message{
+		Type:                       pb.Message_PRIVATE_GET_PROVIDERS,
+		PIR_Message_ID:             1234,
+		CloserPeersRequest:         pirRequestCloserPeers,
+		ProviderPeersRequest:       pirRequestProviderPeers,
+		ProviderBucketIndexVersion: private_routing.ProviderBucketIndexVersion,
+	}
+
+	resp, err := d.handlePrivateGetProviderRecords(context.Background(), queryingPeer, msg)
+	require.NoError(t, err)
+	require.Nil(t, resp.GetProviderPeersResponse().GetError())
+
+	plaintextPBProviderPeers, err := client.ProcessResponse(resp.ProviderPeersResponse)
+	require.NoError(t, err)
+
+	checkProviderPeers(t, plaintextPBProviderPeers, be, providers, lookupFileCID)
+}
+
+func TestDHT_handlePrivateGetProviders_keyword(t *testing.T) {
+	d := newTestDHT(t)
+	fillRoutingTable(t, d, 10)
+	queryingPeer := newPeerID(t)
+
+	be, providers, cids := createProviders(t, d, 1<<8)
+	lookupFileCID := cids[0]
+
+	sendRequest := func(fileCID cid.Cid) (*private_routing.PirClientProviderKeywordRouting, *pb.Message) {
+		client := private_routing.NewPirClientProviderKeywordRouting(private_routing.ProviderKeywordTableLength, pir.RLWE_Whispir_3_Keys, d.cfg.PIRRowSize)
+		pirRequestProviderPeers, err := client.GenerateRequest(fileCID)
+		require.NoError(t, err)
+		assert.Len(t, pirRequestProviderPeers.GetBatchEncryptedQueries(), private_routing.ProviderKeywordNumHashes)
+
+		msg := &pb.Message{
+			Type:                        pb.Message_PRIVATE_GET_PROVIDERS,
+			PIR_Message_ID:              1234,
+			CloserPeersRequest:          pir.NewDPF_TwoServer_PIR_Protocol(8).GenerateEpochRequest(),
+			ProviderPeersRequest:        pirRequestProviderPeers,
+			ProviderKeywordTableVersion: private_routing.ProviderKeywordTableVersion,
+		}
+		resp, err := d.handlePrivateGetProviderRecords(context.Background(), queryingPeer, msg)
+		require.NoError(t, err)
+		return client, resp
+	}
+
+	client, resp := sendRequest(lookupFileCID)
+	plaintextPBProviderPeers, err := client.ProcessResponse(resp.ProviderPeersResponse)
+	require.NoError(t, err)
+
+	// the client only learns the providers of its CID
+	require.Len(t, plaintextPBProviderPeers.Buckets, 1)
+	checkProviderPeers(t, plaintextPBProviderPeers, be, providers, lookupFileCID)
 
-	plaintextPBProviderPeers, err := pirClientPeerRouting.ProcessResponse(resp.ProviderPeersResponse)
+	// and nothing for a CID without providers, with a response of the same size
+	unknownClient, unknownResp := sendRequest(NewRandomContent(t))
+	assert.Equal(t, proto.Size(resp.ProviderPeersResponse), proto.Size(unknownResp.ProviderPeersResponse))
+	plaintextPBProviderPeers, err = unknownClient.ProcessResponse(unknownResp.ProviderPeersResponse)
 	require.NoError(t, err)
+	assert.Empty(t, plaintextPBProviderPeers.Buckets)
+}
+
+func TestDHT_handlePrivateGetProviders_keyword_table_length(t *testing.T) {
+	d := newTestDHT(t)
+	fillRoutingTable(t, d, 10)
+	queryingPeer := newPeerID(t)
+
+	// the records of more CIDs than fit into the smallest table
+	be, providers, cids := createProviders(t, d, 1<<(private_routing.ProviderKeywordTableLength+1))
+	lookupFileCID := cids[0]
+	length := private_routing.ProviderKeywordTableLengthFor(len(cids))
+	require.Greater(t, length, private_routing.ProviderKeywordTableLength)
+
+	sendRequest := func(length int) (*private_routing.PirClientProviderKeywordRouting, *pb.Message) {
+		client := private_routing.NewPirClientProviderKeywordRouting(length, pir.RLWE_Whispir_3_Keys, d.cfg.PIRRowSize)
+		pirRequestProviderPeers, err := client.GenerateRequest(lookupFileCID)
+		require.NoError(t, err)
+
+		msg := &pb.Message{
+			Type:                        pb.Message_PRIVATE_GET_PROVIDERS,
+			PIR_Message_ID:              1234,
+			CloserPeersRequest:          pir.NewDPF_TwoServer_PIR_Protocol(8).GenerateEpochRequest(),
+			ProviderPeersRequest:        pirRequestProviderPeers,
+			ProviderKeywordTableVersion: private_routing.ProviderKeywordTableVersion,
+			ProviderKeywordTableLength:  uint32(length),
+		}
+		resp, err := d.handlePrivateGetProviderRecords(context.Background(), queryingPeer, msg)
+		require.NoError(t, err)
+		return client, resp
+	}
 
-	checkProviderPeers(t, plaintextPBProviderPeers, be, providers)
+	// a request for the smallest table is answered with the length of the table of the server
+	client, resp := sendRequest(private_routing.ProviderKeywordTableLength)
+	assert.NotNil(t, resp.CloserPeersResponse)
+	assert.Equal(t, uint32(length), resp.GetProviderKeywordTableLength())
+	_, err := client.ProcessResponse(resp.ProviderPeersResponse)
+	assert.ErrorIs(t, err, private_routing.ErrKeywordTableLength)
+
+	// which the request is generated for again
+	client, resp = sendRequest(length)
+	assert.Equal(t, uint32(length), resp.GetProviderKeywordTableLength())
+	plaintextPBProviderPeers, err := client.ProcessResponseWithStash(resp.ProviderPeersResponse, resp.GetProviderKeywordStash())
+	require.NoError(t, err)
+	require.Len(t, plaintextPBProviderPeers.Buckets, 1)
+	checkProviderPeers(t, plaintextPBProviderPeers, be, providers, lookupFileCID)
+}
+
+func TestDHT_handlePrivateGetProviders_two_servers(t *testing.T) {
+	ctx := context.Background()
+
+	// servers only process two-server requests if they register the scheme
+	newServer := func() *DHT {
+		cfg := DefaultConfig()
+		cfg.Logger = devnull
+		cfg.PIRSchemes = pir.NewDefaultRegistry()
+		cfg.PIRSchemes.Register(pir.DPF_TwoServer, func(log2_num_rows int) pir.PIR_Protocol {
+			return pir.NewDPF_TwoServer_PIR_Protocol(log2_num_rows)
+		})
+		return newTestDHTWithConfig(t, cfg)
+	}
+	servers := []*DHT{newServer(), newServer()}
+	for _, d := range servers {
+		fillRoutingTable(t, d, 10)
+	}
+	queryingPeer := newPeerID(t)
+
+	// both servers hold the same provider records
+	be, providers, cids := createProviders(t, servers[0], 1<<10)
+	replica, err := typedBackend[*ProvidersBackend](servers[1], namespaceProviders)
+	require.NoError(t, err)
+	for _, p := range providers {
+		servers[1].host.Peerstore().AddAddrs(p.ID, p.Addrs, time.Hour)
+	}
+	q, err := be.datastore.Query(ctx, dsq.Query{Prefix: be.namespace})
+	require.NoError(t, err)
+	entries, err := q.Rest()
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.NoError(t, replica.datastore.Put(ctx, ds.NewKey(e.Key), e.Value))
+	}
+
+	client := private_routing.NewTwoServerPirClientProviderRouting(private_routing.ProviderBucketIndexLength)
+	sendRequest := func(d *DHT, req *pb.PIR_Request) *pb.PIR_Response {
+		// the request for closer peers only asks for the epoch of the routing table, which is cheap
+		msg := &pb.Message{
+			Type:                       pb.Message_PRIVATE_GET_PROVIDERS,
+			PIR_Message_ID:             1234,
+			CloserPeersRequest:         pir.NewDPF_TwoServer_PIR_Protocol(8).GenerateEpochRequest(),
+			ProviderPeersRequest:       req,
+			ProviderBucketIndexVersion: private_routing.ProviderBucketIndexVersion,
+		}
+		resp, err := d.handlePrivateGetProviderRecords(ctx, queryingPeer, msg)
+		require.NoError(t, err)
+		return resp.ProviderPeersResponse
+	}
+
+	epochRequest := client.GenerateEpochRequest()
+	require.NoError(t, client.AgreeOnEpoch(sendRequest(servers[0], epochRequest), sendRequest(servers[1], epochRequest)))
+
+	lookupFileCID := cids[0]
+	req0, req1, err := client.GenerateRequests(lookupFileCID)
+	require.NoError(t, err)
+
+	plaintextPBProviderPeers, err := client.ProcessResponses(sendRequest(servers[0], req0), sendRequest(servers[1], req1))
+	require.NoError(t, err)
+	checkProviderPeers(t, plaintextPBProviderPeers, be, providers, lookupFileCID)
+
+	// a server whose provider records changed rejects the query for the agreed epoch
+	_, err = replica.Store(ctx, string(NewRandomContent(t).Hash()), newAddrInfo(t))
+	require.NoError(t, err)
+	req0, req1, err = client.GenerateRequests(lookupFileCID)
+	require.NoError(t, err)
+	res1 := sendRequest(servers[1], req1)
+	assert.Equal(t, pb.PIR_Error_EPOCH_MISMATCH, res1.GetError().GetCode())
+	_, err = client.ProcessResponses(sendRequest(servers[0], req0), res1)
+	assert.ErrorIs(t, err, pir.ErrEpochMismatch)
 }
 
 func BenchmarkDHT_PrivateFindPeer(b *testing.B) {
@@ -1607,7 +2245,7 @@ func BenchmarkDHT_PrivateFindPeer(b *testing.B) {
 	ourResults := make([]results, runs)
 
 	mode := pir.RLWE_Whispir_3_Keys
-	pirClient := private_routing.NewPirClientPeerRouting(mode)
+	pirClient := private_routing.NewPirClientPeerRouting(mode, d.cfg.PIRRowSize)
 
 	// build requests
 	reqs := make([]*pb.Message, runs)
@@ -1646,29 +2284,87 @@ func BenchmarkDHT_PrivateFindPeer(b *testing.B) {
 	printStats(ourResults)
 }
 
-func checkCloserPeers(t *testing.T, resp *pb.Message, bucketSize int) {
-	assert.Len(t, resp.CloserPeers, bucketSize)
+// checkCloserPeers checks that the bucket holds the peers of the normalized
+// routing table and at most backfillSize peers from the peer store.
+func checkCloserPeers(t *testing.T, resp *pb.Message, bucketSize int, backfillSize int) {
+	assert.GreaterOrEqual(t, len(resp.CloserPeers), bucketSize)
+	assert.LessOrEqual(t, len(resp.CloserPeers), bucketSize+backfillSize)
 	assert.Equal(t, len(resp.CloserPeers[0].Addrs), 1)
 	printCloserPeers(resp)
 }
 
-func checkProviderPeers(t *testing.T, resp *pb.Message, backend *ProvidersBackend, providers []peer.AddrInfo) {
+func checkProviderPeers(t *testing.T, resp *pb.Message, backend *ProvidersBackend, providers []peer.AddrInfo, lookupFileCID cid.Cid) {
 	// check that each provider is one of the providers from the variable above
 	// based on the multiaddresses
-	for _, providerPeer := range resp.ProviderPeers {
-		assert.Len(t, providerPeer.Addresses(), 1)
-		multiaddr := providerPeer.Addresses()[0]
-		matchFound := false
-		for _, provider := range providers {
-			if provider.Addrs[0] == multiaddr {
-				matchFound = true
-				break
+	for _, bucket := range resp.Buckets {
+		for _, providerPeer := range bucket.ProviderPeers {
+			assert.Len(t, providerPeer.Addresses(), 1)
+			multiaddr := providerPeer.Addresses()[0]
+			matchFound := false
+			for _, provider := range providers {
+				if provider.Addrs[0].Equal(multiaddr) {
+					matchFound = true
+					break
+				}
 			}
+			require.True(t, matchFound)
 		}
-		require.True(t, matchFound)
 	}
-	// TODO: check that there exists 2 providers
-	//    for the given CID, in the response as in the normal handleGetProviders case.
-	//     (There may be more providers, but for other CIDs.)
-	// require.Len(t, resp.ProviderPeers, 2) // this is incorrect probably
+	// the bucket contains the 2 providers for the given CID, as in the normal
+	// handleGetProviders case. (There may be more providers, but for other CIDs.)
+	assert.Len(t, resp.BucketProviderAddrInfos(lookupFileCID.Hash()), 2)
+}
+
+func TestDHT_handlePrivateGetValue(t *testing.T) {
+	ctx := context.Background()
+	d := newTestDHT(t)
+	fillRoutingTable(t, d, 10)
+	queryingPeer := newPeerID(t)
+
+	key, v := makePkKeyValue(t)
+	require.NoError(t, d.putValueLocal(ctx, key, v))
+
+	mode := pir.RLWE_Whispir_3_Keys
+	pirClientPeerRouting := private_routing.NewPirClientPeerRouting(mode, d.cfg.PIRRowSize)
+	pirRequestCloserPeers, err := pirClientPeerRouting.GenerateRequest(kadt.NewKey([]byte(key)), kadt.PeerID(queryingPeer).Key())
+	require.NoError(t, err)
+
+	pirClientRecordRouting := private_routing.NewPirClientRecordRouting(private_routing.RecordBucketIndexLength, mode, d.cfg.PIRRowSize)
+	pirRequestRecord, err := pirClientRecordRouting.GenerateRequest([]byte(key))
+	require.NoError(t, err)
+
+	msg := &pb.Message{
+		Type:                     pb.Message_PRIVATE_GET_VALUE,
+		PIR_Message_ID:           1234,
+		CloserPeersRequest:       pirRequestCloserPeers,
+		RecordRequest:            pirRequestRecord,
+		RecordNamespace:          namespacePublicKey,
+		RecordBucketIndexVersion: private_routing.RecordBucketIndexVersion,
+	}
+
+	resp, err := d.handlePrivateGetValue(ctx, queryingPeer, msg)
+	require.NoError(t, err)
+	assert.Equal(t, pb.Message_PRIVATE_GET_VALUE, resp.Type)
+	assert.Equal(t, msg.PIR_Message_ID, resp.PIR_Message_ID)
+	assert.Nil(t, resp.Record)
+
+	plaintextPBCloserPeers, err := pirClientPeerRouting.ProcessResponse(resp.CloserPeersResponse)
+	require.NoError(t, err)
+	assert.NotEmpty(t, plaintextPBCloserPeers.CloserPeers)
+
+	plaintextPBRecord, err := pirClientRecordRouting.ProcessResponse(resp.RecordResponse)
+	require.NoError(t, err)
+	rec := plaintextPBRecord.BucketRecord([]byte(key))
+	require.NotNil(t, rec)
+	assert.Equal(t, v, rec.GetValue())
+
+	// the namespace selects the database of records
+	msg.RecordNamespace = "unknown"
+	_, err = d.handlePrivateGetValue(ctx, queryingPeer, msg)
+	assert.Error(t, err)
+
+	msg.RecordNamespace = namespacePublicKey
+	msg.RecordBucketIndexVersion = private_routing.RecordBucketIndexVersion + 1
+	_, err = d.handlePrivateGetValue(ctx, queryingPeer, msg)
+	assert.Error(t, err)
 }
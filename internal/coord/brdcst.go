@@ -33,6 +33,16 @@ type PooledBroadcastBehaviour struct {
 	// it must only be accessed while performMu is held
 	notifiers map[coordt.QueryID]*queryNotifier[*EventBroadcastFinished]
 
+	// codecs is a map that keeps track of the message codec used by each running broadcast that asks nodes for
+	// closer nodes with a different message to each node.
+	// it must only be accessed while performMu is held
+	codecs map[coordt.QueryID]coordt.MessageCodec
+
+	// storeCodecs is a map that keeps track of the codec that produces the message stored with each node, for each
+	// running broadcast that stores a different message with each node.
+	// it must only be accessed while performMu is held
+	storeCodecs map[coordt.QueryID]coordt.MessageCodec
+
 	// pendingInboundMu guards access to pendingInbound
 	pendingInboundMu sync.Mutex
 
@@ -46,11 +56,13 @@ var _ Behaviour[BehaviourEvent, BehaviourEvent] = (*PooledBroadcastBehaviour)(ni
 
 func NewPooledBroadcastBehaviour(brdcstPool *brdcst.Pool[kadt.Key, kadt.PeerID, *pb.Message], logger *slog.Logger, tracer trace.Tracer) *PooledBroadcastBehaviour {
 	b := &PooledBroadcastBehaviour{
-		pool:      brdcstPool,
-		notifiers: make(map[coordt.QueryID]*queryNotifier[*EventBroadcastFinished]),
-		ready:     make(chan struct{}, 1),
-		logger:    logger.With("behaviour", "pooledBroadcast"),
-		tracer:    tracer,
+		pool:        brdcstPool,
+		notifiers:   make(map[coordt.QueryID]*queryNotifier[*EventBroadcastFinished]),
+		codecs:      make(map[coordt.QueryID]coordt.MessageCodec),
+		storeCodecs: make(map[coordt.QueryID]coordt.MessageCodec),
+		ready:       make(chan struct{}, 1),
+		logger:      logger.With("behaviour", "pooledBroadcast"),
+		tracer:      tracer,
 	}
 	return b
 }
@@ -173,6 +185,12 @@ func (b *PooledBroadcastBehaviour) perfomNextInbound(ctx context.Context) (Behav
 		if ev.Notify != nil {
 			b.notifiers[ev.QueryID] = &queryNotifier[*EventBroadcastFinished]{monitor: ev.Notify}
 		}
+		if ev.Codec != nil {
+			b.codecs[ev.QueryID] = ev.Codec
+		}
+		if ev.NewMessage != nil {
+			b.storeCodecs[ev.QueryID] = ev.NewMessage.Codec()
+		}
 
 	case *EventGetCloserNodesSuccess:
 		for _, info := range ev.CloserNodes {
@@ -197,10 +215,14 @@ func (b *PooledBroadcastBehaviour) perfomNextInbound(ctx context.Context) (Behav
 		}
 
 	case *EventGetCloserNodesFailure:
-		// queue an event that will notify the routing behaviour of a failed node
-		b.pendingOutbound = append(b.pendingOutbound, &EventNotifyNonConnectivity{
-			ev.To,
-		})
+		// queue an event that will notify the routing behaviour of a failed node,
+		// unless the node only refused a private request because it is busy or
+		// we couldn't encode the request for the node
+		if !keepsConnectivity(ev.Err) {
+			b.pendingOutbound = append(b.pendingOutbound, &EventNotifyNonConnectivity{
+				ev.To,
+			})
+		}
 
 		cmd = &brdcst.EventPoolGetCloserNodesFailure[kadt.Key, kadt.PeerID]{
 			NodeID:  ev.To,
@@ -232,10 +254,14 @@ func (b *PooledBroadcastBehaviour) perfomNextInbound(ctx context.Context) (Behav
 		}
 
 	case *EventSendMessageFailure:
-		// queue an event that will notify the routing behaviour of a failed node
-		b.pendingOutbound = append(b.pendingOutbound, &EventNotifyNonConnectivity{
-			ev.To,
-		})
+		// queue an event that will notify the routing behaviour of a failed node,
+		// unless the node only refused the request because it is busy or we
+		// couldn't encode the request for the node
+		if !keepsConnectivity(ev.Err) {
+			b.pendingOutbound = append(b.pendingOutbound, &EventNotifyNonConnectivity{
+				ev.To,
+			})
+		}
 
 		// TODO: How do we know it's a StoreRecord response?
 		cmd = &brdcst.EventPoolStoreRecordFailure[kadt.Key, kadt.PeerID, *pb.Message]{
@@ -271,6 +297,7 @@ func (b *PooledBroadcastBehaviour) advancePool(ctx context.Context, ev brdcst.Po
 			QueryID: st.QueryID,
 			To:      st.NodeID,
 			Target:  st.Target,
+			Codec:   b.codecs[st.QueryID],
 			Notify:  b,
 		}, true
 	case *brdcst.StatePoolStoreRecord[kadt.Key, kadt.PeerID, *pb.Message]:
@@ -278,9 +305,12 @@ func (b *PooledBroadcastBehaviour) advancePool(ctx context.Context, ev brdcst.Po
 			QueryID: st.QueryID,
 			To:      st.NodeID,
 			Message: st.Message,
+			Codec:   b.storeCodecs[st.QueryID],
 			Notify:  b,
 		}, true
 	case *brdcst.StatePoolBroadcastFinished[kadt.Key, kadt.PeerID]:
+		delete(b.codecs, st.QueryID)
+		delete(b.storeCodecs, st.QueryID)
 		waiter, ok := b.notifiers[st.QueryID]
 		if ok {
 			waiter.NotifyFinished(ctx, &EventBroadcastFinished{
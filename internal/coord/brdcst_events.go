@@ -9,12 +9,14 @@ import (
 
 // EventStartBroadcast starts a new
 type EventStartBroadcast struct {
-	QueryID coordt.QueryID
-	Target  kadt.Key
-	Message *pb.Message
-	Seed    []kadt.PeerID
-	Config  brdcst.Config
-	Notify  QueryMonitor[*EventBroadcastFinished]
+	QueryID    coordt.QueryID
+	Target     kadt.Key
+	Message    *pb.Message
+	Seed       []kadt.PeerID
+	Config     brdcst.Config
+	Codec      coordt.MessageCodec   // if non-nil, Codec produces the requests for closer nodes, e.g. to hide Target
+	NewMessage coordt.MessageFactory // if non-nil, NewMessage replaces Message with a message stored with each node
+	Notify     QueryMonitor[*EventBroadcastFinished]
 }
 
 func (*EventStartBroadcast) behaviourEvent() {}
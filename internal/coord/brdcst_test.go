@@ -0,0 +1,184 @@
+package coord
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+
+	"github.com/plprobelab/zikade/internal/coord/brdcst"
+	"github.com/plprobelab/zikade/internal/coord/coordt"
+	"github.com/plprobelab/zikade/internal/kadtest"
+	"github.com/plprobelab/zikade/internal/nettest"
+	"github.com/plprobelab/zikade/kadt"
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/tele"
+)
+
+// stubCodec is a [coordt.MessageCodec] that sends PRIVATE_FIND_NODE requests and decodes every response into the
+// given closer nodes.
+type stubCodec struct {
+	closer []kadt.PeerID
+}
+
+var _ coordt.MessageCodec = (*stubCodec)(nil)
+
+func (c *stubCodec) Encode(ctx context.Context, to kadt.PeerID) (*pb.Message, error) {
+	return &pb.Message{Type: pb.Message_PRIVATE_FIND_NODE}, nil
+}
+
+func (c *stubCodec) Decode(ctx context.Context, from kadt.PeerID, resp *pb.Message) (*pb.Message, error) {
+	decoded := &pb.Message{Type: resp.GetType()}
+	for _, id := range c.closer {
+		decoded.CloserPeers = append(decoded.CloserPeers, &pb.Message_Peer{Id: []byte(id)})
+	}
+	return decoded, nil
+}
+
+// recordingRouter is a [coordt.Router] that answers every message with an empty response of the same type and
+// records the messages it sent.
+type recordingRouter struct {
+	sent []*pb.Message
+}
+
+var _ coordt.Router[kadt.Key, kadt.PeerID, *pb.Message] = (*recordingRouter)(nil)
+
+func (r *recordingRouter) SendMessage(ctx context.Context, to kadt.PeerID, req *pb.Message) (*pb.Message, error) {
+	r.sent = append(r.sent, req)
+	return &pb.Message{Type: req.GetType()}, nil
+}
+
+func (r *recordingRouter) GetClosestNodes(ctx context.Context, to kadt.PeerID, target kadt.Key) ([]kadt.PeerID, error) {
+	return nil, fmt.Errorf("unexpected plaintext request for closer nodes")
+}
+
+func TestPooledBroadcastBehaviour_codec(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+
+	_, nodes, err := nettest.LinearTopology(4, clock.NewMock())
+	require.NoError(t, err)
+
+	pool, err := brdcst.NewPool[kadt.Key, kadt.PeerID, *pb.Message](nodes[0].NodeID, nil)
+	require.NoError(t, err)
+
+	b := NewPooledBroadcastBehaviour(pool, slog.Default(), tele.NoopTracer())
+
+	codec := &stubCodec{}
+	b.Notify(ctx, &EventStartBroadcast{
+		QueryID: "test",
+		Target:  nodes[3].NodeID.Key(),
+		Message: &pb.Message{Type: pb.Message_ADD_PROVIDER},
+		Seed:    []kadt.PeerID{nodes[1].NodeID},
+		Config:  brdcst.DefaultConfigFollowUp(),
+		Codec:   codec,
+	})
+
+	// the closer nodes are requested with the codec of the broadcast
+	bev, ok := b.Perform(ctx)
+	require.True(t, ok)
+	require.IsType(t, &EventOutboundGetCloserNodes{}, bev)
+
+	egc := bev.(*EventOutboundGetCloserNodes)
+	require.True(t, egc.To.Equal(nodes[1].NodeID))
+	require.Equal(t, coordt.MessageCodec(codec), egc.Codec)
+}
+
+func TestNodeHandler_GetCloserNodes_codec(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+
+	_, nodes, err := nettest.LinearTopology(4, clock.NewMock())
+	require.NoError(t, err)
+
+	rtr := &recordingRouter{}
+	h := NewNodeHandler(nodes[1].NodeID, rtr, slog.Default(), tele.NoopTracer())
+
+	var events []BehaviourEvent
+	notify := NotifyFunc[BehaviourEvent](func(ctx context.Context, ev BehaviourEvent) {
+		events = append(events, ev)
+	})
+
+	h.send(ctx, &EventOutboundGetCloserNodes{
+		QueryID: "test",
+		To:      nodes[1].NodeID,
+		Target:  nodes[3].NodeID.Key(),
+		Codec:   &stubCodec{closer: []kadt.PeerID{nodes[2].NodeID}},
+		Notify:  notify,
+	})
+
+	// the node is sent the request of the codec instead of a FIND_NODE request
+	require.Len(t, rtr.sent, 1)
+	require.Equal(t, pb.Message_PRIVATE_FIND_NODE, rtr.sent[0].GetType())
+
+	// the closer nodes are read from the decoded response
+	require.Len(t, events, 1)
+	require.IsType(t, &EventGetCloserNodesSuccess{}, events[0])
+
+	success := events[0].(*EventGetCloserNodesSuccess)
+	require.True(t, success.To.Equal(nodes[1].NodeID))
+	require.Equal(t, []kadt.PeerID{nodes[2].NodeID}, success.CloserNodes)
+}
+
+func TestPooledBroadcastBehaviour_message_factory(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+
+	_, nodes, err := nettest.LinearTopology(4, clock.NewMock())
+	require.NoError(t, err)
+
+	pool, err := brdcst.NewPool[kadt.Key, kadt.PeerID, *pb.Message](nodes[0].NodeID, nil)
+	require.NoError(t, err)
+
+	b := NewPooledBroadcastBehaviour(pool, slog.Default(), tele.NoopTracer())
+
+	b.Notify(ctx, &EventStartBroadcast{
+		QueryID: "test",
+		Target:  nodes[3].NodeID.Key(),
+		Message: &pb.Message{Type: pb.Message_PUT_VALUE},
+		Seed:    []kadt.PeerID{nodes[1].NodeID, nodes[2].NodeID},
+		Config:  brdcst.DefaultConfigStatic(),
+		NewMessage: func(to kadt.PeerID) (*pb.Message, error) {
+			if to.Equal(nodes[2].NodeID) {
+				return nil, fmt.Errorf("no message for node")
+			}
+			return &pb.Message{Type: pb.Message_PUT_VALUE, Key: []byte(to)}, nil
+		},
+	})
+
+	// the message stored with each node is produced by the factory once it is sent to the node
+	var sends []*EventOutboundSendMessage
+	for len(sends) < 2 {
+		bev, ok := b.Perform(ctx)
+		require.True(t, ok)
+		require.IsType(t, &EventOutboundSendMessage{}, bev)
+		sends = append(sends, bev.(*EventOutboundSendMessage))
+	}
+
+	for _, send := range sends {
+		require.NotNil(t, send.Codec)
+
+		rtr := &recordingRouter{}
+		h := NewNodeHandler(send.To, rtr, slog.Default(), tele.NoopTracer())
+
+		var events []BehaviourEvent
+		send.Notify = NotifyFunc[BehaviourEvent](func(ctx context.Context, ev BehaviourEvent) {
+			events = append(events, ev)
+		})
+		h.send(ctx, send)
+		require.Len(t, events, 1)
+
+		if send.To.Equal(nodes[2].NodeID) {
+			// a failing factory fails the attempt to store the record with the node without sending anything
+			require.Empty(t, rtr.sent)
+			require.IsType(t, &EventSendMessageFailure{}, events[0])
+			require.ErrorIs(t, events[0].(*EventSendMessageFailure).Err, coordt.ErrEncodeRequest)
+			continue
+		}
+
+		require.Len(t, rtr.sent, 1)
+		require.Equal(t, []byte(send.To), rtr.sent[0].GetKey())
+		require.IsType(t, &EventSendMessageSuccess{}, events[0])
+		require.Equal(t, rtr.sent[0], events[0].(*EventSendMessageSuccess).Request)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/plprobelab/zikade/internal/coord/routing"
 	"github.com/plprobelab/zikade/kadt"
 	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/pir"
 	"github.com/plprobelab/zikade/tele"
 )
 
@@ -62,6 +63,9 @@ type Coordinator struct {
 	// tele provides tracing and metric reporting capabilities
 	tele *Telemetry
 
+	// pirSessions holds the PIR key material that private queries reuse for the requests sent to each node
+	pirSessions *pirSessions
+
 	// routingNotifierMu guards access to routingNotifier which may be changed during coordinator operation
 	routingNotifierMu sync.RWMutex
 
@@ -94,6 +98,29 @@ type CoordinatorConfig struct {
 
 	// Query is the configuration used for the [PooledQueryBehaviour] which manages the execution of user queries.
 	Query QueryConfig
+
+	// ProviderKeywordLookup configures private queries for provider records to retrieve the records of the exact key
+	// of the query with keyword PIR, instead of the bucket of records that the key falls into.
+	ProviderKeywordLookup bool
+
+	// ProviderDimensions is the number of dimensions that private queries for provider records arrange the buckets
+	// of provider records of nodes in, see [pir.NewSimpleRLWE_PIR_Protocol_recursive]. A value of 1 sends
+	// one-dimensional requests. It has no effect with ProviderKeywordLookup.
+	ProviderDimensions int
+
+	// VerifyPeerRecords configures private queries to ask nodes for the signed peer records of the closer peers that
+	// they return, and to only use peers whose records are valid. Nodes that return invalid records are treated like
+	// unresponsive nodes.
+	VerifyPeerRecords bool
+
+	// PIRRowSize is the size in bytes of the rows of the PIR databases of nodes. Private queries choose the RLWE
+	// parameter set of each PIR request from it and the number of rows of the database, see
+	// [pir.SelectRLWEParameterSet].
+	PIRRowSize int
+
+	// RoutingObserver, if not nil, receives every routing notification before the notifier that was set with
+	// [Coordinator.SetRoutingNotifier]. Unlike that notifier, it can't be replaced once the coordinator was created.
+	RoutingObserver RoutingNotifier
 }
 
 // Validate checks the configuration options and returns an error if any have invalid values.
@@ -126,6 +153,20 @@ func (cfg *CoordinatorConfig) Validate() error {
 		}
 	}
 
+	if cfg.PIRRowSize < 1 {
+		return &errs.ConfigurationError{
+			Component: "CoordinatorConfig",
+			Err:       fmt.Errorf("PIR row size must be positive"),
+		}
+	}
+
+	if cfg.ProviderDimensions < 1 || cfg.ProviderDimensions > pir.MaxDimensions {
+		return &errs.ConfigurationError{
+			Component: "CoordinatorConfig",
+			Err:       fmt.Errorf("provider dimensions must be between 1 and %d", pir.MaxDimensions),
+		}
+	}
+
 	return nil
 }
 
@@ -136,6 +177,9 @@ func DefaultCoordinatorConfig() *CoordinatorConfig {
 		Logger:         tele.DefaultLogger("coord"),
 		MeterProvider:  otel.GetMeterProvider(),
 		TracerProvider: otel.GetTracerProvider(),
+
+		PIRRowSize:         4096, // MAGIC: the bytes of a single response ciphertext with the default RLWE parameters
+		ProviderDimensions: 1,
 	}
 
 	cfg.Query = *DefaultQueryConfig()
@@ -184,6 +228,13 @@ func NewCoordinator(self kadt.PeerID, rtr coordt.Router[kadt.Key, kadt.PeerID, *
 
 	brdcstBehaviour := NewPooledBroadcastBehaviour(b, cfg.Logger, tele.Tracer)
 
+	// MAGIC: the key material of a session takes up to a megabyte, so
+	// only keep the sessions of the nodes that were queried most recently
+	sessions, err := newPIRSessions(64, pir.RLWE_Whispir_3_Keys, cfg.PIRRowSize)
+	if err != nil {
+		return nil, fmt.Errorf("pir sessions: %w", err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	d := &Coordinator{
@@ -200,6 +251,8 @@ func NewCoordinator(self kadt.PeerID, rtr coordt.Router[kadt.Key, kadt.PeerID, *
 		queryBehaviour:   queryBehaviour,
 		brdcstBehaviour:  brdcstBehaviour,
 
+		pirSessions: sessions,
+
 		routingNotifier: nullRoutingNotifier{},
 	}
 
@@ -263,6 +316,9 @@ func (c *Coordinator) dispatchEvent(ctx context.Context, ev BehaviourEvent) {
 	case RoutingCommand:
 		c.routingBehaviour.Notify(ctx, ev)
 	case RoutingNotification:
+		if c.cfg.RoutingObserver != nil {
+			c.cfg.RoutingObserver.Notify(ctx, ev)
+		}
 		c.routingNotifierMu.RLock()
 		rn := c.routingNotifier
 		c.routingNotifierMu.RUnlock()
@@ -290,16 +346,29 @@ func (c *Coordinator) GetClosestNodes(ctx context.Context, k kadt.Key, n int) ([
 	return c.rt.NearestNodes(k, n), nil
 }
 
-// QueryPrivate reimplements QueryMessage, when the message sent to each node may be different
-// When privately retrieving peer records from other nodes, the PIR requests to each node are different.
-// TODO: fn should be of the type coordt.QueryFunc and more specifically, it should process PIR responses.
+// QueryPrivate starts a query that iterates over the closest nodes to the target key in the supplied message
+// without revealing the target to the nodes that are visited. Instead of sending the message itself, a PIR request
+// is generated for each node visited, which retrieves the closer nodes to the target from the node's normalized
+// routing table. For PRIVATE_GET_PROVIDERS messages, the provider records for the key of the message are retrieved
+// along with the closer nodes, and for PRIVATE_GET_VALUE messages, the bucket of records that the key falls into.
+// The supplied message only determines the key and the type of the private request.
+//
+// The supplied [QueryFunc] is called after each successful request to a node with the ID of the node,
+// the decrypted response received from the node and the current query stats. The query terminates when
+// [QueryFunc] returns an error or when the query has visited the configured minimum number of closest nodes
+// (default 20).
 func (c *Coordinator) QueryPrivate(ctx context.Context, msg *pb.Message, fn coordt.QueryFunc, numResults int) ([]kadt.PeerID, coordt.QueryStats, error) {
 	ctx, span := c.tele.Tracer.Start(ctx, "Coordinator.QueryPrivate")
 	defer span.End()
 	if msg == nil {
 		return nil, coordt.QueryStats{}, fmt.Errorf("no message supplied for query")
 	}
-	c.cfg.Logger.Debug("starting query with message", tele.LogAttrKey(msg.Target()), slog.String("type", msg.Type.String()))
+	c.cfg.Logger.Debug("starting private query with message", tele.LogAttrKey(msg.Target()), slog.String("type", msg.Type.String()))
+
+	codec, err := newPrivateCodec(msg, c.pirSessions, c.cfg.ProviderKeywordLookup, c.cfg.ProviderDimensions, c.cfg.VerifyPeerRecords)
+	if err != nil {
+		return nil, coordt.QueryStats{}, err
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -317,13 +386,11 @@ func (c *Coordinator) QueryPrivate(ctx context.Context, msg *pb.Message, fn coor
 	waiter := NewQueryWaiter(numResults)
 	queryID := c.newOperationID()
 
-	// TODO: Generate a ciphertext message from plaintext msg
-	//  For routing, generate the ciphertext PIR request
-	//   using the target node's kadID and the plaintext msg
 	cmd := &EventStartMessageQuery{
 		QueryID:           queryID,
 		Target:            msg.Target(),
 		Message:           msg,
+		Codec:             codec,
 		KnownClosestNodes: seedIDs,
 		Notify:            waiter,
 		NumResults:        numResults,
@@ -332,8 +399,7 @@ func (c *Coordinator) QueryPrivate(ctx context.Context, msg *pb.Message, fn coor
 	// queue the start of the query
 	c.queryBehaviour.Notify(ctx, cmd)
 
-	closest, stats, err := c.waitForQuery(ctx, queryID, waiter, fn)
-	return closest, stats, err
+	return c.waitForQuery(ctx, queryID, waiter, fn)
 }
 
 // QueryClosest starts a query that attempts to find the closest nodes to the target key.
@@ -442,16 +508,46 @@ func (c *Coordinator) BroadcastRecord(ctx context.Context, msg *pb.Message) erro
 	if err != nil {
 		return err
 	}
-	return c.broadcast(ctx, msg, seeds, brdcst.DefaultConfigFollowUp())
+	return c.broadcast(ctx, msg, seeds, brdcst.DefaultConfigFollowUp(), nil)
+}
+
+// BroadcastRecordPrivate is like [Coordinator.BroadcastRecord], but the closest nodes to the target key of msg are
+// discovered with PRIVATE_FIND_NODE requests instead of FIND_NODE requests, so that the nodes that are visited
+// along the way don't learn the target. Only the closest nodes, which msg is stored with, see the target.
+func (c *Coordinator) BroadcastRecordPrivate(ctx context.Context, msg *pb.Message) error {
+	ctx, span := c.tele.Tracer.Start(ctx, "Coordinator.BroadcastRecordPrivate")
+	defer span.End()
+	if msg == nil {
+		return fmt.Errorf("no message supplied for broadcast")
+	}
+	c.cfg.Logger.Debug("starting private broadcast with message", tele.LogAttrKey(msg.Target()), slog.String("type", msg.Type.String()))
+
+	findNode := &pb.Message{
+		Type: pb.Message_PRIVATE_FIND_NODE,
+		Key:  msg.GetKey(),
+	}
+	codec, err := newPrivateCodec(findNode, c.pirSessions, c.cfg.ProviderKeywordLookup, c.cfg.ProviderDimensions, c.cfg.VerifyPeerRecords)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	seeds, err := c.GetClosestNodes(ctx, msg.Target(), 20) // TODO: parameterize
+	if err != nil {
+		return err
+	}
+	return c.broadcast(ctx, msg, seeds, brdcst.DefaultConfigFollowUp(), codec)
 }
 
 func (c *Coordinator) BroadcastStatic(ctx context.Context, msg *pb.Message, seeds []kadt.PeerID) error {
 	ctx, span := c.tele.Tracer.Start(ctx, "Coordinator.BroadcastStatic")
 	defer span.End()
-	return c.broadcast(ctx, msg, seeds, brdcst.DefaultConfigStatic())
+	return c.broadcast(ctx, msg, seeds, brdcst.DefaultConfigStatic(), nil)
 }
 
-func (c *Coordinator) broadcast(ctx context.Context, msg *pb.Message, seeds []kadt.PeerID, cfg brdcst.Config) error {
+func (c *Coordinator) broadcast(ctx context.Context, msg *pb.Message, seeds []kadt.PeerID, cfg brdcst.Config, codec coordt.MessageCodec) error {
 	ctx, span := c.tele.Tracer.Start(ctx, "Coordinator.broadcast")
 	defer span.End()
 
@@ -468,6 +564,7 @@ func (c *Coordinator) broadcast(ctx context.Context, msg *pb.Message, seeds []ka
 		Seed:    seeds,
 		Notify:  waiter,
 		Config:  cfg,
+		Codec:   codec,
 	}
 
 	// queue the start of the query
@@ -505,6 +602,8 @@ func (c *Coordinator) waitForQuery(ctx context.Context, queryID coordt.QueryID,
 				Requests: ev.Stats.Requests,
 				Success:  ev.Stats.Success,
 				Failure:  ev.Stats.Failure,
+
+				EncodeFailure: ev.Stats.EncodeFailure,
 			}
 			err := fn(ctx, ev.NodeID, ev.Response, lastStats)
 			if errors.Is(err, coordt.ErrSkipRemaining) {
@@ -528,6 +627,8 @@ func (c *Coordinator) waitForQuery(ctx context.Context, queryID coordt.QueryID,
 					Requests: ev.Stats.Requests,
 					Success:  ev.Stats.Success,
 					Failure:  ev.Stats.Failure,
+
+					EncodeFailure: ev.Stats.EncodeFailure,
 				}
 				if err := fn(ctx, ev.NodeID, ev.Response, lastStats); err != nil {
 					return nil, lastStats, err
@@ -538,8 +639,18 @@ func (c *Coordinator) waitForQuery(ctx context.Context, queryID coordt.QueryID,
 			}
 
 			// query is done
-			lastStats.Exhausted = true
-			c.cfg.Logger.Debug("query ran to exhaustion", "query_id", queryID, slog.Duration("elapsed", wev.Event.Stats.End.Sub(wev.Event.Stats.Start)), slog.Int("requests", wev.Event.Stats.Requests), slog.Int("failures", wev.Event.Stats.Failure))
+			stats := wev.Event.Stats
+			lastStats = coordt.QueryStats{
+				Start:     stats.Start,
+				End:       stats.End,
+				Requests:  stats.Requests,
+				Success:   stats.Success,
+				Failure:   stats.Failure,
+				Exhausted: true,
+
+				EncodeFailure: stats.EncodeFailure,
+			}
+			c.cfg.Logger.Debug("query ran to exhaustion", "query_id", queryID, slog.Duration("elapsed", stats.End.Sub(stats.Start)), slog.Int("requests", stats.Requests), slog.Int("failures", stats.Failure), slog.Int("encode_failures", stats.EncodeFailure))
 			return wev.Event.ClosestNodes, lastStats, nil
 
 		}
@@ -49,6 +49,10 @@ type QueryStats struct {
 	Success   int       // Success is a count of the number of nodes the query succesfully contacted.
 	Failure   int       // Failure is a count of the number of nodes the query received an error response from.
 	Exhausted bool      // Exhausted is true if the query ended after visiting every node it could.
+
+	// EncodeFailure is a count of the failures included in Failure where the request for the node could not be
+	// produced, so that the node was never contacted. See [ErrEncodeRequest].
+	EncodeFailure int
 }
 
 var (
@@ -57,6 +61,19 @@ var (
 
 	// ErrSkipRemaining is used as a return value a QueryFunc to indicate that all remaining nodes are to be skipped.
 	ErrSkipRemaining = errors.New("skip remaining nodes")
+
+	// ErrResendMessage may be wrapped by the error returned from [MessageCodec.Decode] to indicate that the request
+	// is to be encoded and sent to the node once more, e.g., because the node lacked state that the request relied on.
+	ErrResendMessage = errors.New("resend message")
+
+	// ErrNodeBusy may be wrapped by the error returned from [MessageCodec.Decode] to indicate that the node refused
+	// the request because it is overloaded. The query continues with other nodes, but the node isn't considered to
+	// lack connectivity, so it is not removed from the routing table.
+	ErrNodeBusy = errors.New("node busy")
+
+	// ErrEncodeRequest is wrapped by the error of a failed attempt to contact a node if [MessageCodec.Encode] could
+	// not produce the request for the node, so that nothing was sent to the node.
+	ErrEncodeRequest = errors.New("encode request")
 )
 
 type Message interface{}
@@ -69,3 +86,59 @@ type Router[K kad.Key[K], N kad.NodeID[K], M Message] interface {
 	// closest to the target key.
 	GetClosestNodes(ctx context.Context, to N, target K) ([]N, error)
 }
+
+// MessageCodec is used by queries and broadcasts whose request differs for each node that is visited, such as
+// private queries where the request is encrypted for the node that receives it. Encode is called to produce the
+// request sent to a node only once the request is dispatched to that node, and Decode is called with the node's
+// response to produce the message processed by the query. The closer nodes of the decoded message are used to
+// continue the query. If Encode fails, the attempt to contact the node fails with an error wrapping
+// [ErrEncodeRequest]. If Decode returns an error wrapping [ErrResendMessage], Encode is called again and the new
+// request is sent to the node once more.
+type MessageCodec interface {
+	Encode(ctx context.Context, to kadt.PeerID) (*pb.Message, error)
+	Decode(ctx context.Context, from kadt.PeerID, resp *pb.Message) (*pb.Message, error)
+}
+
+// MessageFactory produces the message sent to a node by queries and broadcasts whose message differs for each node,
+// such as the records stored with each node by a broadcast. It is called only once the message is dispatched to the
+// node. If it fails, the attempt to contact the node fails with an error wrapping [ErrEncodeRequest], like a failed
+// [MessageCodec.Encode].
+type MessageFactory func(to kadt.PeerID) (*pb.Message, error)
+
+// Codec returns a [MessageCodec] that produces the requests with the factory and leaves the responses as they are.
+func (f MessageFactory) Codec() MessageCodec {
+	return factoryCodec(f)
+}
+
+// factoryCodec is the [MessageCodec] of a [MessageFactory].
+type factoryCodec MessageFactory
+
+func (c factoryCodec) Encode(ctx context.Context, to kadt.PeerID) (*pb.Message, error) {
+	return c(to)
+}
+
+func (c factoryCodec) Decode(ctx context.Context, from kadt.PeerID, resp *pb.Message) (*pb.Message, error) {
+	return resp, nil
+}
+
+// ResponseRecorder may be implemented by a [Router] to record information carried in a response that could only be
+// read after it was decoded by a [MessageCodec], such as the addresses of closer nodes in a private response.
+type ResponseRecorder[K kad.Key[K], N kad.NodeID[K], M Message] interface {
+	RecordResponse(ctx context.Context, from N, resp M)
+}
+
+// PartialResponseRouter may be implemented by a [Router] that receives some responses in parts, such as private
+// responses whose PIR responses are streamed as soon as the node computed them. SendMessageInParts is like
+// [Router.SendMessage], but calls onPart with each part of the response as soon as it was received, before the whole
+// response is returned.
+type PartialResponseRouter[K kad.Key[K], N kad.NodeID[K], M Message] interface {
+	SendMessageInParts(ctx context.Context, to N, req M, onPart func(part M)) (M, error)
+}
+
+// PartialDecoder may be implemented by a [MessageCodec] that can process the parts of a response that a
+// [PartialResponseRouter] receives before the whole response was received. DecodePart is called with each part of
+// the response of the node, and [MessageCodec.Decode] with the whole response afterwards, which reports the errors
+// of processing the parts.
+type PartialDecoder interface {
+	DecodePart(ctx context.Context, from kadt.PeerID, part *pb.Message)
+}
@@ -67,6 +67,7 @@ type EventOutboundGetCloserNodes struct {
 	QueryID coordt.QueryID
 	To      kadt.PeerID
 	Target  kadt.Key
+	Codec   coordt.MessageCodec // if non-nil, Codec produces the request sent to To instead of a FIND_NODE for Target
 	Notify  Notify[BehaviourEvent]
 }
 
@@ -78,6 +79,7 @@ type EventOutboundSendMessage struct {
 	QueryID coordt.QueryID
 	To      kadt.PeerID
 	Message *pb.Message
+	Codec   coordt.MessageCodec // if non-nil, Codec produces the message sent to To and decodes its response
 	Notify  Notify[BehaviourEvent]
 }
 
@@ -89,6 +91,8 @@ type EventStartMessageQuery struct {
 	QueryID           coordt.QueryID
 	Target            kadt.Key
 	Message           *pb.Message
+	Codec             coordt.MessageCodec   // if non-nil, Codec replaces Message with a request specific to each node
+	NewMessage        coordt.MessageFactory // if non-nil and Codec is nil, NewMessage replaces Message with a message specific to each node
 	KnownClosestNodes []kadt.PeerID
 	Notify            QueryMonitor[*EventQueryFinished]
 	NumResults        int // the minimum number of nodes to successfully contact before considering iteration complete
@@ -2,6 +2,7 @@ package coord
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -139,7 +140,7 @@ func (h *NodeHandler) send(ctx context.Context, ev NodeHandlerRequest) bool {
 		if cmd.Notify == nil {
 			break
 		}
-		nodes, err := h.rtr.GetClosestNodes(ctx, h.self, cmd.Target)
+		nodes, err := h.getClosestNodes(ctx, cmd.Target, cmd.Codec)
 		if err != nil {
 			cmd.Notify.Notify(ctx, &EventGetCloserNodesFailure{
 				QueryID: cmd.QueryID,
@@ -160,12 +161,12 @@ func (h *NodeHandler) send(ctx context.Context, ev NodeHandlerRequest) bool {
 		if cmd.Notify == nil {
 			break
 		}
-		resp, err := h.rtr.SendMessage(ctx, h.self, cmd.Message)
+		req, resp, err := h.sendMessage(ctx, cmd.Message, cmd.Codec)
 		if err != nil {
 			cmd.Notify.Notify(ctx, &EventSendMessageFailure{
 				QueryID: cmd.QueryID,
 				To:      h.self,
-				Request: cmd.Message,
+				Request: req,
 				Err:     fmt.Errorf("NodeHandler: %w", err),
 			})
 			return false
@@ -174,7 +175,7 @@ func (h *NodeHandler) send(ctx context.Context, ev NodeHandlerRequest) bool {
 		cmd.Notify.Notify(ctx, &EventSendMessageSuccess{
 			QueryID:     cmd.QueryID,
 			To:          h.self,
-			Request:     cmd.Message,
+			Request:     req,
 			Response:    resp,
 			CloserNodes: resp.CloserNodes(),
 		})
@@ -185,6 +186,78 @@ func (h *NodeHandler) send(ctx context.Context, ev NodeHandlerRequest) bool {
 	return false
 }
 
+// getClosestNodes asks the node for the closest nodes to the target. If codec is non-nil, the node is sent the
+// request produced by the codec instead of a FIND_NODE request for the target, and the closer nodes are read from
+// the decoded response.
+func (h *NodeHandler) getClosestNodes(ctx context.Context, target kadt.Key, codec coordt.MessageCodec) ([]kadt.PeerID, error) {
+	if codec == nil {
+		return h.rtr.GetClosestNodes(ctx, h.self, target)
+	}
+
+	_, resp, err := h.sendMessage(ctx, nil, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.CloserNodes(), nil
+}
+
+// sendMessage sends msg to the node and returns the request that was sent together with the response. If codec is
+// non-nil, the request is produced by the codec instead and the response is decoded by it before being returned.
+// The request is encoded and sent once more if the codec asks for it with [coordt.ErrResendMessage].
+func (h *NodeHandler) sendMessage(ctx context.Context, msg *pb.Message, codec coordt.MessageCodec) (*pb.Message, *pb.Message, error) {
+	if codec == nil {
+		resp, err := h.rtr.SendMessage(ctx, h.self, msg)
+		return msg, resp, err
+	}
+
+	req, resp, err := h.sendEncoded(ctx, msg, codec)
+	if errors.Is(err, coordt.ErrResendMessage) {
+		req, resp, err = h.sendEncoded(ctx, msg, codec)
+	}
+	if err != nil {
+		return req, nil, err
+	}
+
+	// the router could not read the closer nodes of the encoded response, so
+	// give it the chance to record them before the query attempts to contact them.
+	if rec, ok := h.rtr.(coordt.ResponseRecorder[kadt.Key, kadt.PeerID, *pb.Message]); ok {
+		rec.RecordResponse(ctx, h.self, resp)
+	}
+
+	return req, resp, nil
+}
+
+// sendEncoded sends the request produced by the codec to the node and returns it together with the decoded response.
+func (h *NodeHandler) sendEncoded(ctx context.Context, msg *pb.Message, codec coordt.MessageCodec) (*pb.Message, *pb.Message, error) {
+	req, err := codec.Encode(ctx, h.self)
+	if err != nil {
+		return msg, nil, fmt.Errorf("%w: %w", coordt.ErrEncodeRequest, err)
+	}
+
+	// the codec processes the parts of the response while the rest is still being received, if it can
+	var resp *pb.Message
+	prr, partial := h.rtr.(coordt.PartialResponseRouter[kadt.Key, kadt.PeerID, *pb.Message])
+	pd, decodesParts := codec.(coordt.PartialDecoder)
+	if partial && decodesParts {
+		resp, err = prr.SendMessageInParts(ctx, h.self, req, func(part *pb.Message) {
+			pd.DecodePart(ctx, h.self, part)
+		})
+	} else {
+		resp, err = h.rtr.SendMessage(ctx, h.self, req)
+	}
+	if err != nil {
+		return req, nil, err
+	}
+
+	resp, err = codec.Decode(ctx, h.self, resp)
+	if err != nil {
+		return req, nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return req, resp, nil
+}
+
 func (h *NodeHandler) ID() kadt.PeerID {
 	return h.self
 }
@@ -0,0 +1,135 @@
+package coord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+
+	"github.com/plprobelab/zikade/internal/coord/coordt"
+	"github.com/plprobelab/zikade/internal/kadtest"
+	"github.com/plprobelab/zikade/internal/nettest"
+	"github.com/plprobelab/zikade/kadt"
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/tele"
+)
+
+// failingCodec is a [coordt.MessageCodec] that can't produce a request for any node.
+type failingCodec struct{}
+
+var _ coordt.MessageCodec = (*failingCodec)(nil)
+
+func (c *failingCodec) Encode(ctx context.Context, to kadt.PeerID) (*pb.Message, error) {
+	return nil, fmt.Errorf("no session for %s", to)
+}
+
+func (c *failingCodec) Decode(ctx context.Context, from kadt.PeerID, resp *pb.Message) (*pb.Message, error) {
+	return nil, errors.New("unexpected response")
+}
+
+func TestNodeHandler_SendMessage_encode_failure(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+
+	_, nodes, err := nettest.LinearTopology(2, clock.NewMock())
+	require.NoError(t, err)
+
+	rtr := &recordingRouter{}
+	h := NewNodeHandler(nodes[1].NodeID, rtr, slog.Default(), tele.NoopTracer())
+
+	var events []BehaviourEvent
+	notify := NotifyFunc[BehaviourEvent](func(ctx context.Context, ev BehaviourEvent) {
+		events = append(events, ev)
+	})
+
+	h.send(ctx, &EventOutboundSendMessage{
+		QueryID: "test",
+		To:      nodes[1].NodeID,
+		Message: &pb.Message{Type: pb.Message_PRIVATE_FIND_NODE},
+		Codec:   &failingCodec{},
+		Notify:  notify,
+	})
+
+	// nothing is sent to the node and the failure is told apart from network failures
+	require.Empty(t, rtr.sent)
+	require.Len(t, events, 1)
+	require.IsType(t, &EventSendMessageFailure{}, events[0])
+	require.ErrorIs(t, events[0].(*EventSendMessageFailure).Err, coordt.ErrEncodeRequest)
+}
+
+// partRouter is a [coordt.PartialResponseRouter] that answers every message with a response whose closer nodes are
+// handed over as a part first.
+type partRouter struct {
+	recordingRouter
+	closer []kadt.PeerID
+}
+
+var _ coordt.PartialResponseRouter[kadt.Key, kadt.PeerID, *pb.Message] = (*partRouter)(nil)
+
+func (r *partRouter) SendMessageInParts(ctx context.Context, to kadt.PeerID, req *pb.Message, onPart func(part *pb.Message)) (*pb.Message, error) {
+	resp, err := r.SendMessage(ctx, to, req)
+	if err != nil {
+		return nil, err
+	}
+
+	part := &pb.Message{Type: resp.GetType()}
+	for _, id := range r.closer {
+		part.CloserPeers = append(part.CloserPeers, &pb.Message_Peer{Id: []byte(id)})
+	}
+	onPart(part)
+
+	return resp, nil
+}
+
+// partialCodec is a [coordt.PartialDecoder] that decodes the closer nodes from the parts of a response.
+type partialCodec struct {
+	stubCodec
+	parts []*pb.Message
+}
+
+var _ coordt.PartialDecoder = (*partialCodec)(nil)
+
+func (c *partialCodec) DecodePart(ctx context.Context, from kadt.PeerID, part *pb.Message) {
+	c.parts = append(c.parts, part)
+}
+
+func (c *partialCodec) Decode(ctx context.Context, from kadt.PeerID, resp *pb.Message) (*pb.Message, error) {
+	if len(c.parts) == 0 {
+		return nil, errors.New("response decoded before its parts")
+	}
+	return c.parts[0], nil
+}
+
+func TestNodeHandler_SendMessage_parts(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+
+	_, nodes, err := nettest.LinearTopology(3, clock.NewMock())
+	require.NoError(t, err)
+
+	rtr := &partRouter{closer: []kadt.PeerID{nodes[2].NodeID}}
+	h := NewNodeHandler(nodes[1].NodeID, rtr, slog.Default(), tele.NoopTracer())
+
+	var events []BehaviourEvent
+	notify := NotifyFunc[BehaviourEvent](func(ctx context.Context, ev BehaviourEvent) {
+		events = append(events, ev)
+	})
+
+	codec := &partialCodec{}
+	h.send(ctx, &EventOutboundSendMessage{
+		QueryID: "test",
+		To:      nodes[1].NodeID,
+		Message: &pb.Message{Type: pb.Message_PRIVATE_FIND_NODE},
+		Codec:   codec,
+		Notify:  notify,
+	})
+
+	// the codec decodes the parts of the response before the whole response
+	require.Len(t, rtr.sent, 1)
+	require.Len(t, codec.parts, 1)
+	require.Len(t, events, 1)
+	require.IsType(t, &EventSendMessageSuccess{}, events[0])
+	require.Equal(t, []kadt.PeerID{nodes[2].NodeID}, events[0].(*EventSendMessageSuccess).CloserNodes)
+}
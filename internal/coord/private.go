@@ -0,0 +1,397 @@
+package coord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/ipfs/go-cid"
+	record "github.com/libp2p/go-libp2p-record"
+
+	"github.com/plprobelab/zikade/internal/coord/coordt"
+	"github.com/plprobelab/zikade/kadt"
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/pir"
+	"github.com/plprobelab/zikade/private_routing"
+)
+
+// privateCodec is a [coordt.MessageCodec] used by private queries. Each node is sent a PIR request for the bucket
+// of its normalized routing table that holds the closer peers to the target, which depends on the common prefix
+// length of the target and the node's key. For PRIVATE_GET_PROVIDERS messages, the request additionally contains
+// a PIR request for the bucket of the node's provider records that the key of the message falls into, arranged in
+// providerDimensions dimensions, or with keywordLookup, a keyword PIR request for the provider records of the exact
+// key. For PRIVATE_GET_VALUE messages, the
+// request additionally contains a PIR request for the bucket of the node's records of the namespace of the key that
+// the key falls into, and only the namespace is sent in the clear. With verifyPeerRecords, nodes are
+// asked for the signed peer records of their closer peers, and a response whose records fail verification is
+// treated like a failed request, which removes the node from the routing table. The key
+// material used to generate the requests is taken from the node's session, so that the evaluation keys only need
+// to be sent to the node until it cached them.
+type privateCodec struct {
+	msgType   pb.Message_MessageType
+	key       []byte
+	namespace string // namespace of the key of PRIVATE_GET_VALUE messages
+	target    kadt.Key
+	mode      string
+	sessions  *pirSessions
+
+	// keywordLookup is set if provider records are retrieved with keyword PIR requests
+	keywordLookup bool
+
+	// providerDimensions is the number of dimensions of the PIR requests for buckets of provider records
+	providerDimensions int
+
+	// verifyPeerRecords is set if the closer peers must carry valid signed peer records
+	verifyPeerRecords bool
+
+	mu      sync.Mutex
+	pending map[kadt.PeerID]*privateRequest
+}
+
+var (
+	_ coordt.MessageCodec   = (*privateCodec)(nil)
+	_ coordt.PartialDecoder = (*privateCodec)(nil)
+)
+
+// privateRequest holds the state of the PIR requests sent to a node that are awaiting a response.
+type privateRequest struct {
+	id            int64
+	closerPeers   *private_routing.PirClientPeerRouting
+	providerPeers providerPeersClient                     // nil unless the message type is PRIVATE_GET_PROVIDERS
+	records       *private_routing.PirClientRecordRouting // nil unless the message type is PRIVATE_GET_VALUE
+
+	// closerPeersDecoded is set once the PIR response for closer peers was processed by DecodePart, with the
+	// result in decodedCloserPeers and decodeCloserPeersErr
+	closerPeersDecoded   bool
+	decodedCloserPeers   *pb.Message
+	decodeCloserPeersErr error
+}
+
+// providerPeersClient is implemented by the clients that retrieve provider records with PIR.
+type providerPeersClient interface {
+	GenerateRequest(fileCID cid.Cid) (*pb.PIR_Request, error)
+	ProcessResponse(res *pb.PIR_Response) (*pb.Message, error)
+}
+
+// pirSessions holds the PIR key material that is reused for the private requests sent to each node. Each node
+// has its own session for each parameter set, so that nodes can't link the requests of this node by its key
+// material.
+type pirSessions struct {
+	mode string
+
+	// rowSize is the size in bytes of the rows of the PIR databases of nodes, see [pirSessions.get]
+	rowSize int
+
+	// mu guards the creation of sessions, so that concurrent queries don't create several sessions for a node
+	mu    sync.Mutex
+	cache *lru.Cache[sessionKey, *pir.SimpleRLWE_Session]
+
+	// keywordLengths holds the lengths of the keyword tables of provider records that nodes advertised, see
+	// [private_routing.ProviderKeywordTableLengthFor]
+	keywordLengths *lru.Cache[kadt.PeerID, int]
+}
+
+// sessionKey identifies the session of a node for requests with a parameter set. Key material can't be shared
+// between parameter sets.
+type sessionKey struct {
+	id  kadt.PeerID
+	set string
+}
+
+func newPIRSessions(size int, mode string, rowSize int) (*pirSessions, error) {
+	cache, err := lru.New[sessionKey, *pir.SimpleRLWE_Session](size)
+	if err != nil {
+		return nil, fmt.Errorf("new PIR sessions cache: %w", err)
+	}
+
+	keywordLengths, err := lru.New[kadt.PeerID, int](size)
+	if err != nil {
+		return nil, fmt.Errorf("new keyword table lengths cache: %w", err)
+	}
+
+	return &pirSessions{
+		mode:           mode,
+		rowSize:        rowSize,
+		cache:          cache,
+		keywordLengths: keywordLengths,
+	}, nil
+}
+
+// get returns the session for requests to the node over a database of 2^log2_num_rows rows, creating one if there
+// is none. The parameter set of the session is chosen from the shape of the database with
+// [pir.SelectRLWEParameterSet], and the requests of the session name it, so that the node encodes its database
+// with the same parameters.
+func (s *pirSessions) get(id kadt.PeerID, log2_num_rows int) (*pir.SimpleRLWE_Session, error) {
+	set, err := pir.SelectRLWEParameterSet(s.mode, log2_num_rows, s.rowSize)
+	if err != nil {
+		return nil, fmt.Errorf("select RLWE parameter set: %w", err)
+	}
+	key := sessionKey{id: id, set: set.Name}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.cache.Get(key); ok {
+		return session, nil
+	}
+
+	session, err := pir.NewSimpleRLWE_Session_parameters(s.mode, set)
+	if err != nil {
+		return nil, fmt.Errorf("new PIR session: %w", err)
+	}
+	s.cache.Add(key, session)
+
+	return session, nil
+}
+
+// keywordTableLength returns the length of the keyword table of provider records that the node advertised last, or
+// the length of the smallest table if it didn't advertise one yet.
+func (s *pirSessions) keywordTableLength(id kadt.PeerID) int {
+	if length, ok := s.keywordLengths.Get(id); ok {
+		return length
+	}
+	return private_routing.ProviderKeywordTableLength
+}
+
+// setKeywordTableLength records the length of the keyword table of provider records that the node advertised.
+// Lengths beyond [private_routing.MaxProviderKeywordTableLength] are ignored, as requests for such tables are too
+// costly.
+func (s *pirSessions) setKeywordTableLength(id kadt.PeerID, length int) {
+	if length < private_routing.ProviderKeywordTableLength || length > private_routing.MaxProviderKeywordTableLength {
+		return
+	}
+	s.keywordLengths.Add(id, length)
+}
+
+func newPrivateCodec(msg *pb.Message, sessions *pirSessions, keywordLookup bool, providerDimensions int, verifyPeerRecords bool) (*privateCodec, error) {
+	switch msg.GetType() {
+	case pb.Message_PRIVATE_FIND_NODE:
+	case pb.Message_PRIVATE_GET_PROVIDERS:
+	case pb.Message_PRIVATE_GET_VALUE:
+	default:
+		return nil, fmt.Errorf("unsupported message type for private query: %s", msg.GetType())
+	}
+
+	var namespace string
+	if msg.GetType() == pb.Message_PRIVATE_GET_VALUE {
+		// the key of a value message is the routing key /$namespace/$binary_id
+		ns, _, err := record.SplitKey(string(msg.GetKey()))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key for private value query: %w", err)
+		}
+		namespace = ns
+	}
+
+	return &privateCodec{
+		msgType:            msg.GetType(),
+		key:                msg.GetKey(),
+		namespace:          namespace,
+		target:             msg.Target(),
+		mode:               sessions.mode,
+		sessions:           sessions,
+		keywordLookup:      keywordLookup,
+		providerDimensions: providerDimensions,
+		verifyPeerRecords:  verifyPeerRecords,
+		pending:            make(map[kadt.PeerID]*privateRequest),
+	}, nil
+}
+
+func (c *privateCodec) Encode(ctx context.Context, to kadt.PeerID) (*pb.Message, error) {
+	// each PIR request is generated with the session for the parameter set that suits the shape of its database
+	session, err := c.sessions.get(to, private_routing.PeerRoutingLog2NumRows)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &privateRequest{
+		id:          rand.Int63(),
+		closerPeers: private_routing.NewPirClientPeerRoutingWithSession(session),
+	}
+
+	closerPeersRequest, err := pr.closerPeers.GenerateRequest(c.target, to.Key())
+	if err != nil {
+		return nil, fmt.Errorf("generate PIR request for closer peers: %w", err)
+	}
+
+	msg := &pb.Message{
+		Type:               c.msgType,
+		PIR_Message_ID:     pr.id,
+		CloserPeersRequest: closerPeersRequest,
+		SignedPeerRecords:  c.verifyPeerRecords,
+
+		// the responses of large databases may not fit into a single message,
+		// and the closer peers can be decrypted while the node still computes
+		// the other PIR responses of a streamed response
+		AcceptChunkedResponse:  true,
+		AcceptStreamedResponse: true,
+	}
+
+	if c.msgType == pb.Message_PRIVATE_GET_PROVIDERS {
+		if c.keywordLookup {
+			length := c.sessions.keywordTableLength(to)
+			session, err := c.sessions.get(to, length)
+			if err != nil {
+				return nil, err
+			}
+			pr.providerPeers = private_routing.NewPirClientProviderKeywordRoutingWithSession(length, session)
+			msg.ProviderKeywordTableVersion = private_routing.ProviderKeywordTableVersion
+			msg.ProviderKeywordTableLength = uint32(length)
+		} else if c.providerDimensions > 1 {
+			// the parameter set suits the first dimension, which is the longest one
+			length := private_routing.ProviderBucketIndexLength
+			session, err := c.sessions.get(to, (length+c.providerDimensions-1)/c.providerDimensions)
+			if err != nil {
+				return nil, err
+			}
+			pr.providerPeers = private_routing.NewPirClientProviderRoutingRecursiveWithSession(length, session, c.providerDimensions)
+			msg.ProviderBucketIndexVersion = private_routing.ProviderBucketIndexVersion
+		} else {
+			session, err := c.sessions.get(to, private_routing.ProviderBucketIndexLength)
+			if err != nil {
+				return nil, err
+			}
+			pr.providerPeers = private_routing.NewPirClientProviderRoutingWithSession(private_routing.ProviderBucketIndexLength, session)
+			msg.ProviderBucketIndexVersion = private_routing.ProviderBucketIndexVersion
+		}
+
+		// the key of a provider message is the multihash of the CID
+		msg.ProviderPeersRequest, err = pr.providerPeers.GenerateRequest(cid.NewCidV1(cid.Raw, c.key))
+		if err != nil {
+			return nil, fmt.Errorf("generate PIR request for provider peers: %w", err)
+		}
+	}
+
+	if c.msgType == pb.Message_PRIVATE_GET_VALUE {
+		session, err := c.sessions.get(to, private_routing.RecordBucketIndexLength)
+		if err != nil {
+			return nil, err
+		}
+		pr.records = private_routing.NewPirClientRecordRoutingWithSession(private_routing.RecordBucketIndexLength, session)
+		msg.RecordNamespace = c.namespace
+		msg.RecordBucketIndexVersion = private_routing.RecordBucketIndexVersion
+
+		msg.RecordRequest, err = pr.records.GenerateRequest(c.key)
+		if err != nil {
+			return nil, fmt.Errorf("generate PIR request for record: %w", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.pending[to] = pr
+	c.mu.Unlock()
+
+	return msg, nil
+}
+
+func (c *privateCodec) Decode(ctx context.Context, from kadt.PeerID, resp *pb.Message) (*pb.Message, error) {
+	c.mu.Lock()
+	pr, ok := c.pending[from]
+	delete(c.pending, from)
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no pending PIR request for %s", from)
+	}
+
+	if resp.GetPIR_Message_ID() != pr.id {
+		return nil, fmt.Errorf("unexpected PIR message id: %d", resp.GetPIR_Message_ID())
+	}
+
+	if resp.GetCloserPeersResponse() == nil {
+		return nil, fmt.Errorf("PIR response for closer peers not sent in the message")
+	}
+
+	closerPeers, err := pr.decodedCloserPeers, pr.decodeCloserPeersErr
+	if !pr.closerPeersDecoded {
+		closerPeers, err = c.decodeCloserPeers(pr, resp.GetCloserPeersResponse())
+	}
+	if err != nil {
+		return nil, decodeError("process PIR response for closer peers", err)
+	}
+
+	decoded := &pb.Message{
+		Type:           resp.GetType(),
+		PIR_Message_ID: resp.GetPIR_Message_ID(),
+		CloserPeers:    closerPeers.GetCloserPeers(),
+	}
+
+	if pr.providerPeers != nil {
+		if resp.GetProviderPeersResponse() == nil {
+			return nil, fmt.Errorf("PIR response for provider peers not sent in the message")
+		}
+
+		var providerPeers *pb.Message
+		if keywords, ok := pr.providerPeers.(*private_routing.PirClientProviderKeywordRouting); ok {
+			// the node advertises the length of its keyword table, which the request is generated for if it's resent
+			if length := resp.GetProviderKeywordTableLength(); length != 0 {
+				c.sessions.setKeywordTableLength(from, int(length))
+			}
+			providerPeers, err = keywords.ProcessResponseWithStash(resp.GetProviderPeersResponse(), resp.GetProviderKeywordStash())
+		} else {
+			providerPeers, err = pr.providerPeers.ProcessResponse(resp.GetProviderPeersResponse())
+		}
+		if err != nil {
+			return nil, decodeError("process PIR response for provider peers", err)
+		}
+		decoded.Buckets = providerPeers.GetBuckets()
+	}
+
+	if pr.records != nil {
+		if resp.GetRecordResponse() == nil {
+			return nil, fmt.Errorf("PIR response for record not sent in the message")
+		}
+
+		records, err := pr.records.ProcessResponse(resp.GetRecordResponse())
+		if err != nil {
+			return nil, decodeError("process PIR response for record", err)
+		}
+		decoded.BucketRecords = records.GetBucketRecords()
+	}
+
+	return decoded, nil
+}
+
+// DecodePart processes the PIR response for closer peers of a streamed response as soon as it was received, while
+// the node still computes the other PIR responses of the message. Decode returns its result.
+func (c *privateCodec) DecodePart(ctx context.Context, from kadt.PeerID, part *pb.Message) {
+	if part.GetCloserPeersResponse() == nil {
+		return
+	}
+
+	c.mu.Lock()
+	pr, ok := c.pending[from]
+	c.mu.Unlock()
+
+	if !ok || part.GetPIR_Message_ID() != pr.id || pr.closerPeersDecoded {
+		return
+	}
+
+	pr.decodedCloserPeers, pr.decodeCloserPeersErr = c.decodeCloserPeers(pr, part.GetCloserPeersResponse())
+	pr.closerPeersDecoded = true
+}
+
+// decodeCloserPeers processes the PIR response for closer peers of the request.
+func (c *privateCodec) decodeCloserPeers(pr *privateRequest, res *pb.PIR_Response) (*pb.Message, error) {
+	if c.verifyPeerRecords {
+		return pr.closerPeers.ProcessVerifiedResponse(res)
+	}
+	return pr.closerPeers.ProcessResponse(res)
+}
+
+// decodeError wraps an error that occurred while processing a PIR response. If the node didn't hold the evaluation
+// keys that the request referenced, the error also wraps [coordt.ErrResendMessage], so that the request is encoded
+// with the evaluation keys and sent again. The same holds if the node's keyword table has another length than the one
+// the request was generated for, so that the request is generated again for the length that the node advertised. If the node was busy, the error wraps [coordt.ErrNodeBusy], so that the
+// query continues with other nodes without removing the node from the routing table.
+func decodeError(msg string, err error) error {
+	if errors.Is(err, pir.ErrUnknownEvaluationKeys) || errors.Is(err, private_routing.ErrKeywordTableLength) {
+		return fmt.Errorf("%s: %w: %w", msg, coordt.ErrResendMessage, err)
+	}
+	if errors.Is(err, private_routing.ErrServerBusy) {
+		return fmt.Errorf("%s: %w: %w", msg, coordt.ErrNodeBusy, err)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
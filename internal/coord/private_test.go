@@ -0,0 +1,63 @@
+package coord
+
+import (
+	"context"
+	"testing"
+
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/kadt"
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/pir"
+)
+
+func TestPIRSessions_get(t *testing.T) {
+	sessions, err := newPIRSessions(8, pir.RLWE_All_Keys, 8192)
+	require.NoError(t, err)
+	id := kadt.PeerID("peer")
+
+	// small databases with large rows are queried with another parameter set than large databases
+	small, err := sessions.get(id, 4)
+	require.NoError(t, err)
+	large, err := sessions.get(id, 12)
+	require.NoError(t, err)
+	require.NotSame(t, small, large)
+
+	// the session of a parameter set is reused
+	again, err := sessions.get(id, 5)
+	require.NoError(t, err)
+	require.Same(t, small, again)
+
+	// but not across nodes
+	other, err := sessions.get(kadt.PeerID("other"), 4)
+	require.NoError(t, err)
+	require.NotSame(t, small, other)
+
+	// databases that no parameter set supports can't be queried
+	_, err = sessions.get(id, 16)
+	require.Error(t, err)
+}
+
+func TestPrivateCodec_Encode_provider_dimensions(t *testing.T) {
+	sessions, err := newPIRSessions(8, pir.RLWE_Whispir_3_Keys, 4096)
+	require.NoError(t, err)
+
+	key, err := mh.Sum([]byte("key"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+
+	for _, dimensions := range []int{1, 2} {
+		codec, err := newPrivateCodec(&pb.Message{Type: pb.Message_PRIVATE_GET_PROVIDERS, Key: key}, sessions, false, dimensions, false)
+		require.NoError(t, err)
+
+		msg, err := codec.Encode(context.Background(), kadt.PeerID("peer"))
+		require.NoError(t, err)
+
+		// one-dimensional requests leave the number of dimensions unset
+		if dimensions == 1 {
+			require.Zero(t, msg.GetProviderPeersRequest().GetNumDimensions())
+		} else {
+			require.EqualValues(t, dimensions, msg.GetProviderPeersRequest().GetNumDimensions())
+		}
+	}
+}
@@ -2,6 +2,7 @@ package coord
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -123,6 +124,11 @@ type QueryBehaviour struct {
 	// it must only be accessed while performMu is held
 	notifiers map[coordt.QueryID]*queryNotifier[*EventQueryFinished]
 
+	// codecs is a map that keeps track of the message codec used by each running query that sends a different
+	// message to each node.
+	// it must only be accessed while performMu is held
+	codecs map[coordt.QueryID]coordt.MessageCodec
+
 	// pendingOutbound is a queue of outbound events.
 	// it must only be accessed while performMu is held
 	pendingOutbound []BehaviourEvent
@@ -162,6 +168,7 @@ func NewQueryBehaviour(self kadt.PeerID, cfg *QueryConfig) (*QueryBehaviour, err
 		cfg:       *cfg,
 		pool:      pool,
 		notifiers: make(map[coordt.QueryID]*queryNotifier[*EventQueryFinished]),
+		codecs:    make(map[coordt.QueryID]coordt.MessageCodec),
 		ready:     make(chan struct{}, 1),
 	}
 	return h, err
@@ -280,6 +287,11 @@ func (p *QueryBehaviour) perfomNextInbound(ctx context.Context) (BehaviourEvent,
 		if ev.Notify != nil {
 			p.notifiers[ev.QueryID] = &queryNotifier[*EventQueryFinished]{monitor: ev.Notify}
 		}
+		if ev.Codec != nil {
+			p.codecs[ev.QueryID] = ev.Codec
+		} else if ev.NewMessage != nil {
+			p.codecs[ev.QueryID] = ev.NewMessage.Codec()
+		}
 	case *EventStopQuery:
 		cmd = &query.EventPoolStopQuery{
 			QueryID: ev.QueryID,
@@ -302,8 +314,10 @@ func (p *QueryBehaviour) perfomNextInbound(ctx context.Context) (BehaviourEvent,
 		}
 	case *EventGetCloserNodesFailure:
 		// queue an event that will notify the routing behaviour of a failed node
-		p.cfg.Logger.Debug("peer has no connectivity", tele.LogAttrPeerID(ev.To), "source", "query")
-		p.queueNonConnectivityEvent(ev.To)
+		if !keepsConnectivity(ev.Err) {
+			p.cfg.Logger.Debug("peer has no connectivity", tele.LogAttrPeerID(ev.To), "source", "query")
+			p.queueNonConnectivityEvent(ev.To)
+		}
 
 		cmd = &query.EventPoolNodeFailure[kadt.Key, kadt.PeerID]{
 			NodeID:  ev.To,
@@ -326,9 +340,15 @@ func (p *QueryBehaviour) perfomNextInbound(ctx context.Context) (BehaviourEvent,
 			CloserNodes: ev.CloserNodes,
 		}
 	case *EventSendMessageFailure:
-		// queue an event that will notify the routing behaviour of a failed node
-		p.cfg.Logger.Debug("peer has no connectivity", tele.LogAttrPeerID(ev.To), "source", "query")
-		p.queueNonConnectivityEvent(ev.To)
+		// a busy node refused the request, or we couldn't encode the request for the node, but
+		// the node has connectivity, so only the query skips it
+		if keepsConnectivity(ev.Err) {
+			p.cfg.Logger.Debug("peer kept connectivity", tele.LogAttrPeerID(ev.To), "source", "query", tele.LogAttrError(ev.Err))
+		} else {
+			// queue an event that will notify the routing behaviour of a failed node
+			p.cfg.Logger.Debug("peer has no connectivity", tele.LogAttrPeerID(ev.To), "source", "query")
+			p.queueNonConnectivityEvent(ev.To)
+		}
 
 		cmd = &query.EventPoolNodeFailure[kadt.Key, kadt.PeerID]{
 			NodeID:  ev.To,
@@ -389,6 +409,7 @@ func (p *QueryBehaviour) advancePool(ctx context.Context, ev query.PoolEvent) (o
 			QueryID: st.QueryID,
 			To:      st.NodeID,
 			Message: st.Message,
+			Codec:   p.codecs[st.QueryID],
 			Notify:  p,
 		}, true
 	case *query.StatePoolWaitingAtCapacity:
@@ -396,6 +417,7 @@ func (p *QueryBehaviour) advancePool(ctx context.Context, ev query.PoolEvent) (o
 	case *query.StatePoolWaitingWithCapacity:
 		// nothing to do except wait for message response or timeout
 	case *query.StatePoolQueryFinished[kadt.Key, kadt.PeerID]:
+		delete(p.codecs, st.QueryID)
 		waiter, ok := p.notifiers[st.QueryID]
 		if ok {
 			waiter.NotifyFinished(ctx, &EventQueryFinished{
@@ -424,6 +446,13 @@ func (p *QueryBehaviour) queueAddNodeEvents(nodes []kadt.PeerID) {
 	}
 }
 
+// keepsConnectivity reports whether a failed request says nothing about the connectivity of the node, because the
+// node refused the request as it is busy, or because the request was never sent as we couldn't encode it. Such nodes
+// are skipped by the query, but aren't removed from the routing table.
+func keepsConnectivity(err error) bool {
+	return errors.Is(err, coordt.ErrNodeBusy) || errors.Is(err, coordt.ErrEncodeRequest)
+}
+
 func (p *QueryBehaviour) queueNonConnectivityEvent(nid kadt.PeerID) {
 	p.pendingOutbound = append(p.pendingOutbound, &EventNotifyNonConnectivity{
 		NodeID: nid,
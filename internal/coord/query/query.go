@@ -2,6 +2,7 @@ package query
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -21,6 +22,10 @@ type QueryStats struct {
 	Requests int
 	Success  int
 	Failure  int
+
+	// EncodeFailure counts the failures that were caused by a request that
+	// could not be produced for the node (see [coordt.ErrEncodeRequest]).
+	EncodeFailure int
 }
 
 // QueryConfig specifies optional configuration for a Query
@@ -161,7 +166,7 @@ func (q *Query[K, N, M]) Advance(ctx context.Context, ev QueryEvent) (out QueryS
 		q.onNodeResponse(ctx, tev.NodeID, tev.CloserNodes)
 	case *EventQueryNodeFailure[K, N]:
 		span.RecordError(tev.Error)
-		q.onNodeFailure(ctx, tev.NodeID)
+		q.onNodeFailure(ctx, tev.NodeID, tev.Error)
 	case *EventQueryPoll:
 		// no event to process
 
@@ -347,7 +352,7 @@ func (q *Query[K, N, M]) onNodeResponse(ctx context.Context, node N, closer []N)
 }
 
 // onNodeFailure processes the result of a failed attempt to contact a node.
-func (q *Query[K, N, M]) onNodeFailure(ctx context.Context, node N) {
+func (q *Query[K, N, M]) onNodeFailure(ctx context.Context, node N, err error) {
 	ni, found := q.iter.Find(node.Key())
 	if !found {
 		// got a rogue message
@@ -357,6 +362,9 @@ func (q *Query[K, N, M]) onNodeFailure(ctx context.Context, node N) {
 	case *StateNodeWaiting:
 		q.inFlight--
 		q.stats.Failure++
+		if errors.Is(err, coordt.ErrEncodeRequest) {
+			q.stats.EncodeFailure++
+		}
 	case *StateNodeUnresponsive:
 		// update node state to failed
 		break
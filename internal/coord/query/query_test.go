@@ -2,6 +2,7 @@ package query
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -1307,3 +1308,53 @@ func TestFindCloserQueryIncludesPartialClosestNodesWhenCancelled(t *testing.T) {
 	stf := state.(*StateQueryFinished[tiny.Key, tiny.Node])
 	require.Equal(t, 1, len(stf.ClosestNodes))
 }
+
+func TestQueryCountsEncodeFailures(t *testing.T) {
+	ctx := context.Background()
+
+	target := tiny.Key(0b00000001)
+	a := tiny.NewNode(0b00000100) // 4
+	b := tiny.NewNode(0b00001000) // 8
+
+	knownNodes := []tiny.Node{a, b}
+
+	iter := NewClosestNodesIter[tiny.Key, tiny.Node](target)
+
+	cfg := DefaultQueryConfig()
+	cfg.Clock = clock.NewMock()
+
+	queryID := coordt.QueryID("test")
+
+	self := tiny.NewNode(0)
+	msg := tiny.Message{Content: "msg"}
+	qry, err := NewQuery[tiny.Key, tiny.Node, tiny.Message](self, queryID, target, msg, iter, knownNodes, cfg)
+	require.NoError(t, err)
+
+	// the query contacts both nodes
+	state := qry.Advance(ctx, &EventQueryPoll{})
+	require.IsType(t, &StateQuerySendMessage[tiny.Key, tiny.Node, tiny.Message]{}, state)
+	state = qry.Advance(ctx, &EventQueryPoll{})
+	require.IsType(t, &StateQuerySendMessage[tiny.Key, tiny.Node, tiny.Message]{}, state)
+
+	// the request for node a could not be produced
+	state = qry.Advance(ctx, &EventQueryNodeFailure[tiny.Key, tiny.Node]{
+		NodeID: a,
+		Error:  fmt.Errorf("%w: no session", coordt.ErrEncodeRequest),
+	})
+	require.IsType(t, &StateQueryWaitingWithCapacity{}, state)
+	stww := state.(*StateQueryWaitingWithCapacity)
+	require.Equal(t, 1, stww.Stats.Failure)
+	require.Equal(t, 1, stww.Stats.EncodeFailure)
+
+	// node b failed to respond
+	state = qry.Advance(ctx, &EventQueryNodeFailure[tiny.Key, tiny.Node]{
+		NodeID: b,
+		Error:  fmt.Errorf("stream reset"),
+	})
+	require.IsType(t, &StateQueryFinished[tiny.Key, tiny.Node]{}, state)
+	stf := state.(*StateQueryFinished[tiny.Key, tiny.Node])
+	require.Equal(t, 2, stf.Stats.Requests)
+	require.Equal(t, 0, stf.Stats.Success)
+	require.Equal(t, 2, stf.Stats.Failure)
+	require.Equal(t, 1, stf.Stats.EncodeFailure)
+}
@@ -2,6 +2,7 @@ package coord
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"testing"
 
@@ -150,6 +151,156 @@ func (ts *QueryBehaviourBaseTestSuite) TestNotifiesNoProgress() {
 	kadtest.ReadItem[CtxEvent[*EventQueryFinished]](t, ctx, waiter.Finished())
 }
 
+func (ts *QueryBehaviourBaseTestSuite) TestBusyNodeKeepsConnectivity() {
+	t := ts.T()
+	ctx := kadtest.CtxShort(t)
+
+	target := ts.nodes[3].NodeID.Key()
+	rt := ts.nodes[0].RoutingTable
+	seeds := rt.NearestNodes(target, 5)
+
+	b, err := NewQueryBehaviour(ts.nodes[0].NodeID, ts.cfg)
+	ts.Require().NoError(err)
+
+	waiter := NewQueryWaiter(5)
+	cmd := &EventStartMessageQuery{
+		QueryID:           "test",
+		Target:            target,
+		Message:           &pb.Message{Type: pb.Message_PRIVATE_FIND_NODE},
+		KnownClosestNodes: seeds,
+		Notify:            waiter,
+		NumResults:        10,
+	}
+
+	// queue the start of the query
+	b.Notify(ctx, cmd)
+
+	// behaviour should emit EventOutboundSendMessage to start the query
+	bev, ok := b.Perform(ctx)
+	ts.Require().True(ok)
+	ts.Require().IsType(&EventOutboundSendMessage{}, bev)
+
+	esm := bev.(*EventOutboundSendMessage)
+	ts.Require().True(esm.To.Equal(ts.nodes[1].NodeID))
+
+	// notify that node 1 was busy
+	b.Notify(ctx, &EventSendMessageFailure{
+		QueryID: "test",
+		To:      esm.To,
+		Err:     fmt.Errorf("decode response: %w", coordt.ErrNodeBusy),
+	})
+
+	// the query skips node 1, but doesn't report it as non connective
+	bev, ok = b.Perform(ctx)
+	if ok {
+		ts.Require().NotEqual(fmt.Sprintf("%T", &EventNotifyNonConnectivity{}), fmt.Sprintf("%T", bev))
+	}
+
+	// ensure that the waiter received query finished event
+	kadtest.ReadItem[CtxEvent[*EventQueryFinished]](t, ctx, waiter.Finished())
+}
+
+func (ts *QueryBehaviourBaseTestSuite) TestEncodeFailureKeepsConnectivity() {
+	t := ts.T()
+	ctx := kadtest.CtxShort(t)
+
+	target := ts.nodes[3].NodeID.Key()
+	rt := ts.nodes[0].RoutingTable
+	seeds := rt.NearestNodes(target, 5)
+
+	b, err := NewQueryBehaviour(ts.nodes[0].NodeID, ts.cfg)
+	ts.Require().NoError(err)
+
+	waiter := NewQueryWaiter(5)
+	cmd := &EventStartMessageQuery{
+		QueryID:           "test",
+		Target:            target,
+		Message:           &pb.Message{Type: pb.Message_PRIVATE_FIND_NODE},
+		KnownClosestNodes: seeds,
+		Notify:            waiter,
+		NumResults:        10,
+	}
+
+	// queue the start of the query
+	b.Notify(ctx, cmd)
+
+	// behaviour should emit EventOutboundSendMessage to start the query
+	bev, ok := b.Perform(ctx)
+	ts.Require().True(ok)
+	ts.Require().IsType(&EventOutboundSendMessage{}, bev)
+
+	esm := bev.(*EventOutboundSendMessage)
+	ts.Require().True(esm.To.Equal(ts.nodes[1].NodeID))
+
+	// notify that the request for node 1 could not be encoded
+	b.Notify(ctx, &EventSendMessageFailure{
+		QueryID: "test",
+		To:      esm.To,
+		Err:     fmt.Errorf("NodeHandler: %w: no session", coordt.ErrEncodeRequest),
+	})
+
+	// the query skips node 1, but doesn't report it as non connective
+	for {
+		bev, ok = b.Perform(ctx)
+		if !ok {
+			break
+		}
+		ts.Require().NotEqual(fmt.Sprintf("%T", &EventNotifyNonConnectivity{}), fmt.Sprintf("%T", bev))
+	}
+
+	// node 1 is still routable
+	_, found := rt.GetNode(esm.To.Key())
+	ts.Require().True(found)
+
+	// the failure is counted as an encode failure
+	wev := kadtest.ReadItem[CtxEvent[*EventQueryFinished]](t, ctx, waiter.Finished())
+	ts.Require().Equal(1, wev.Event.Stats.Failure)
+	ts.Require().Equal(1, wev.Event.Stats.EncodeFailure)
+}
+
+func (ts *QueryBehaviourBaseTestSuite) TestMessageFactory() {
+	t := ts.T()
+	ctx := kadtest.CtxShort(t)
+
+	target := ts.nodes[3].NodeID.Key()
+	rt := ts.nodes[0].RoutingTable
+	seeds := rt.NearestNodes(target, 5)
+
+	b, err := NewQueryBehaviour(ts.nodes[0].NodeID, ts.cfg)
+	ts.Require().NoError(err)
+
+	var produced []kadt.PeerID
+	cmd := &EventStartMessageQuery{
+		QueryID: "test",
+		Target:  target,
+		Message: &pb.Message{Type: pb.Message_GET_VALUE},
+		NewMessage: func(to kadt.PeerID) (*pb.Message, error) {
+			produced = append(produced, to)
+			return &pb.Message{Type: pb.Message_GET_VALUE, Key: []byte(to)}, nil
+		},
+		KnownClosestNodes: seeds,
+		NumResults:        10,
+	}
+
+	// queue the start of the query
+	b.Notify(ctx, cmd)
+
+	// behaviour should emit EventOutboundSendMessage to start the query
+	bev, ok := b.Perform(ctx)
+	ts.Require().True(ok)
+	ts.Require().IsType(&EventOutboundSendMessage{}, bev)
+
+	// the message isn't produced before it is sent to the node
+	esm := bev.(*EventOutboundSendMessage)
+	ts.Require().NotNil(esm.Codec)
+	ts.Require().Empty(produced)
+
+	msg, err := esm.Codec.Encode(ctx, esm.To)
+	ts.Require().NoError(err)
+	ts.Require().Equal([]byte(esm.To), msg.GetKey())
+	ts.Require().Equal([]kadt.PeerID{esm.To}, produced)
+}
+
 func (ts *QueryBehaviourBaseTestSuite) TestNotifiesQueryProgressed() {
 	t := ts.T()
 	ctx := kadtest.CtxShort(t)
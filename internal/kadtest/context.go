@@ -21,6 +21,23 @@ func CtxShort(t *testing.T) context.Context {
 	} else {
 		timeout = 10 * time.Second
 	}
+
+	return ctxWithTimeout(t, timeout)
+}
+
+// CtxLong returns a Context for tests that are expected to take a while, such
+// as tests that run private lookups, which perform PIR computations on every hop.
+// The context will be cancelled after 60 seconds or just before the test
+// binary deadline (as specified by the -timeout flag when running the test), whichever
+// is sooner.
+func CtxLong(t *testing.T) context.Context {
+	t.Helper()
+	return ctxWithTimeout(t, 60*time.Second)
+}
+
+func ctxWithTimeout(t *testing.T, timeout time.Duration) context.Context {
+	t.Helper()
+
 	goal := time.Now().Add(timeout)
 
 	deadline, ok := t.Deadline()
@@ -89,6 +89,15 @@ func (d *DHT) onEvtLocalReachabilityChanged(evt event.EvtLocalReachabilityChange
 }
 
 func (d *DHT) onEvtPeerIdentificationCompleted(evt event.EvtPeerIdentificationCompleted) {
+	// identify stores the listen addresses of the peer in the peer store. If
+	// the peer is in the routing table, the PIR databases of the routing table
+	// may now hold outdated addresses. Otherwise, if the peer is a backfill
+	// candidate, it may now be backfilled into the databases. Identify of
+	// other peers, which happens all the time, leaves the databases intact.
+	if d.isBackfillCandidate(evt.Peer) || d.kad.IsRoutable(context.Background(), kadt.PeerID(evt.Peer)) {
+		d.rtDatabases.invalidate()
+	}
+
 	// tell the coordinator about a new candidate for inclusion in the routing table
 	d.kad.AddNodes(context.Background(), []kadt.PeerID{kadt.PeerID(evt.Peer)})
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	math_bits "math/bits"
 
+	recpb "github.com/libp2p/go-libp2p-record/pb"
 	"github.com/libp2p/go-libp2p/core/peer"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/plprobelab/zikade/kadt"
@@ -40,6 +41,8 @@ func (m *Message) ExpectResponse() bool {
 		return true
 	case Message_PRIVATE_GET_PROVIDERS:
 		return true
+	case Message_PRIVATE_GET_VALUE:
+		return true
 	default:
 		panic(fmt.Sprintf("unexpected message type %d", m.Type))
 	}
@@ -88,6 +91,50 @@ func (m *Message) ProviderAddrInfos() []peer.AddrInfo {
 	return addrInfos
 }
 
+// BucketProviderAddrInfos returns the peer.AddrInfo's of the provider peers
+// that are listed for the given key in the provider buckets of this message.
+// The buckets of a private provider lookup contain the providers of all keys
+// that share a bucket with the requested key, so they must be filtered.
+func (m *Message) BucketProviderAddrInfos(key []byte) []peer.AddrInfo {
+	if m == nil {
+		return nil
+	}
+
+	var addrInfos []peer.AddrInfo
+	for _, b := range m.Buckets {
+		if !bytes.Equal(b.Cid, key) {
+			continue
+		}
+
+		for _, p := range b.ProviderPeers {
+			addrInfos = append(addrInfos, peer.AddrInfo{
+				ID:    peer.ID(p.Id),
+				Addrs: p.Addresses(),
+			})
+		}
+	}
+
+	return addrInfos
+}
+
+// BucketRecord returns the record for the given routing key in the bucket
+// records of this message, or nil if there is none. The bucket of a private
+// value lookup contains the records of all keys that share a bucket with the
+// requested key, so it must be filtered.
+func (m *Message) BucketRecord(key []byte) *recpb.Record {
+	if m == nil {
+		return nil
+	}
+
+	for _, rec := range m.BucketRecords {
+		if bytes.Equal(rec.GetKey(), key) {
+			return rec
+		}
+	}
+
+	return nil
+}
+
 // CloserPeersAddrInfos returns the peer.AddrInfo's of the closer peers in this
 // message.
 func (m *Message) CloserPeersAddrInfos() []peer.AddrInfo {
@@ -194,6 +241,10 @@ func (m *Message_Peer) Size() (n int) {
 	if m.Connection != 0 {
 		n += 1 + sovDht(uint64(m.Connection))
 	}
+	l = len(m.SignedRecord)
+	if l > 0 {
+		n += 1 + l + sovDht(uint64(l))
+	}
 	return n
 }
 
@@ -35,6 +35,7 @@ const (
 	Message_PING                  Message_MessageType = 5
 	Message_PRIVATE_FIND_NODE     Message_MessageType = 32
 	Message_PRIVATE_GET_PROVIDERS Message_MessageType = 33
+	Message_PRIVATE_GET_VALUE     Message_MessageType = 34
 )
 
 // Enum value maps for Message_MessageType.
@@ -48,6 +49,7 @@ var (
 		5:  "PING",
 		32: "PRIVATE_FIND_NODE",
 		33: "PRIVATE_GET_PROVIDERS",
+		34: "PRIVATE_GET_VALUE",
 	}
 	Message_MessageType_value = map[string]int32{
 		"PUT_VALUE":             0,
@@ -58,6 +60,7 @@ var (
 		"PING":                  5,
 		"PRIVATE_FIND_NODE":     32,
 		"PRIVATE_GET_PROVIDERS": 33,
+		"PRIVATE_GET_VALUE":     34,
 	}
 )
 
@@ -145,6 +148,193 @@ func (Message_ConnectionType) EnumDescriptor() ([]byte, []int) {
 	return file_msg_proto_rawDescGZIP(), []int{0, 1}
 }
 
+type PIR_Chunk_Response int32
+
+const (
+	PIR_Chunk_CLOSER_PEERS   PIR_Chunk_Response = 0
+	PIR_Chunk_PROVIDER_PEERS PIR_Chunk_Response = 1
+	PIR_Chunk_RECORD         PIR_Chunk_Response = 2
+)
+
+// Enum value maps for PIR_Chunk_Response.
+var (
+	PIR_Chunk_Response_name = map[int32]string{
+		0: "CLOSER_PEERS",
+		1: "PROVIDER_PEERS",
+		2: "RECORD",
+	}
+	PIR_Chunk_Response_value = map[string]int32{
+		"CLOSER_PEERS":   0,
+		"PROVIDER_PEERS": 1,
+		"RECORD":         2,
+	}
+)
+
+func (x PIR_Chunk_Response) Enum() *PIR_Chunk_Response {
+	p := new(PIR_Chunk_Response)
+	*p = x
+	return p
+}
+
+func (x PIR_Chunk_Response) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PIR_Chunk_Response) Descriptor() protoreflect.EnumDescriptor {
+	return file_msg_proto_enumTypes[2].Descriptor()
+}
+
+func (PIR_Chunk_Response) Type() protoreflect.EnumType {
+	return &file_msg_proto_enumTypes[2]
+}
+
+func (x PIR_Chunk_Response) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PIR_Chunk_Response.Descriptor instead.
+func (PIR_Chunk_Response) EnumDescriptor() ([]byte, []int) {
+	return file_msg_proto_rawDescGZIP(), []int{1, 0}
+}
+
+type PIR_Chunk_Field int32
+
+const (
+	PIR_Chunk_CIPHERTEXTS       PIR_Chunk_Field = 0
+	PIR_Chunk_BATCH_CIPHERTEXTS PIR_Chunk_Field = 1
+	PIR_Chunk_LWE_HINT          PIR_Chunk_Field = 2
+)
+
+// Enum value maps for PIR_Chunk_Field.
+var (
+	PIR_Chunk_Field_name = map[int32]string{
+		0: "CIPHERTEXTS",
+		1: "BATCH_CIPHERTEXTS",
+		2: "LWE_HINT",
+	}
+	PIR_Chunk_Field_value = map[string]int32{
+		"CIPHERTEXTS":       0,
+		"BATCH_CIPHERTEXTS": 1,
+		"LWE_HINT":          2,
+	}
+)
+
+func (x PIR_Chunk_Field) Enum() *PIR_Chunk_Field {
+	p := new(PIR_Chunk_Field)
+	*p = x
+	return p
+}
+
+func (x PIR_Chunk_Field) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PIR_Chunk_Field) Descriptor() protoreflect.EnumDescriptor {
+	return file_msg_proto_enumTypes[3].Descriptor()
+}
+
+func (PIR_Chunk_Field) Type() protoreflect.EnumType {
+	return &file_msg_proto_enumTypes[3]
+}
+
+func (x PIR_Chunk_Field) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PIR_Chunk_Field.Descriptor instead.
+func (PIR_Chunk_Field) EnumDescriptor() ([]byte, []int) {
+	return file_msg_proto_rawDescGZIP(), []int{1, 1}
+}
+
+type PIR_Error_Code int32
+
+const (
+	PIR_Error_UNKNOWN PIR_Error_Code = 0
+	// The server does not support the scheme of the request.
+	PIR_Error_UNSUPPORTED_SCHEME PIR_Error_Code = 1
+	// The server does not hold the evaluation keys that the request
+	// references, e.g. because they were evicted from its cache.
+	PIR_Error_UNKNOWN_EVALUATION_KEYS PIR_Error_Code = 2
+	// The query was generated with the hint of another epoch of the
+	// database. The client should download the hint again.
+	PIR_Error_STALE_HINT PIR_Error_Code = 3
+	// The database of the server is of another epoch than the one that
+	// the client agreed on for a two-server scheme.
+	PIR_Error_EPOCH_MISMATCH PIR_Error_Code = 4
+	// The estimated cost of processing the request exceeds the budget
+	// of the server, e.g. because the request batches too many queries.
+	PIR_Error_BUDGET_EXCEEDED PIR_Error_Code = 5
+	// The server is overloaded and refused to process the request. The
+	// client should send its request to another peer.
+	PIR_Error_BUSY PIR_Error_Code = 6
+	// The request names an RLWE parameter set that the server doesn't
+	// know, or carries parameters that differ from the parameter set.
+	PIR_Error_UNSUPPORTED_PARAMETER_SET PIR_Error_Code = 7
+	// The request is malformed, e.g. its ciphertexts or evaluation keys
+	// don't match its parameters, or it selects from another number of
+	// rows than the database holds.
+	PIR_Error_INVALID_REQUEST PIR_Error_Code = 8
+	// The request was generated for a keyword table of another length
+	// than the one of the server, which the server advertises in its
+	// response.
+	PIR_Error_TABLE_LENGTH_MISMATCH PIR_Error_Code = 9
+)
+
+// Enum value maps for PIR_Error_Code.
+var (
+	PIR_Error_Code_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "UNSUPPORTED_SCHEME",
+		2: "UNKNOWN_EVALUATION_KEYS",
+		3: "STALE_HINT",
+		4: "EPOCH_MISMATCH",
+		5: "BUDGET_EXCEEDED",
+		6: "BUSY",
+		7: "UNSUPPORTED_PARAMETER_SET",
+		8: "INVALID_REQUEST",
+		9: "TABLE_LENGTH_MISMATCH",
+	}
+	PIR_Error_Code_value = map[string]int32{
+		"UNKNOWN":                   0,
+		"UNSUPPORTED_SCHEME":        1,
+		"UNKNOWN_EVALUATION_KEYS":   2,
+		"STALE_HINT":                3,
+		"EPOCH_MISMATCH":            4,
+		"BUDGET_EXCEEDED":           5,
+		"BUSY":                      6,
+		"UNSUPPORTED_PARAMETER_SET": 7,
+		"INVALID_REQUEST":           8,
+		"TABLE_LENGTH_MISMATCH":     9,
+	}
+)
+
+func (x PIR_Error_Code) Enum() *PIR_Error_Code {
+	p := new(PIR_Error_Code)
+	*p = x
+	return p
+}
+
+func (x PIR_Error_Code) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PIR_Error_Code) Descriptor() protoreflect.EnumDescriptor {
+	return file_msg_proto_enumTypes[4].Descriptor()
+}
+
+func (PIR_Error_Code) Type() protoreflect.EnumType {
+	return &file_msg_proto_enumTypes[4]
+}
+
+func (x PIR_Error_Code) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PIR_Error_Code.Descriptor instead.
+func (PIR_Error_Code) EnumDescriptor() ([]byte, []int) {
+	return file_msg_proto_rawDescGZIP(), []int{5, 0}
+}
+
 // Message is the top-level envelope for exchanging
 // information with the DHT protocol.
 type Message struct {
@@ -179,6 +369,59 @@ type Message struct {
 	ProviderPeersRequest  *PIR_Request  `protobuf:"bytes,33,opt,name=provider_peers_request,json=providerPeersRequest,proto3" json:"provider_peers_request,omitempty"`
 	CloserPeersResponse   *PIR_Response `protobuf:"bytes,34,opt,name=closer_peers_response,json=closerPeersResponse,proto3" json:"closer_peers_response,omitempty"`
 	ProviderPeersResponse *PIR_Response `protobuf:"bytes,35,opt,name=provider_peers_response,json=providerPeersResponse,proto3" json:"provider_peers_response,omitempty"`
+	// Version of the derivation of the bucket index of a CID that the
+	// provider_peers_request was generated with. Servers must place CIDs into
+	// buckets the same way, otherwise the client retrieves the wrong bucket.
+	ProviderBucketIndexVersion uint32 `protobuf:"varint,36,opt,name=provider_bucket_index_version,json=providerBucketIndexVersion,proto3" json:"provider_bucket_index_version,omitempty"`
+	// Version of the layout of the cuckoo table of provider records that a
+	// keyword provider_peers_request was generated with. If set, the request
+	// retrieves the slots of the table that the records of a CID may be placed
+	// in, instead of the bucket of the CID, and the bucket index version is
+	// ignored.
+	ProviderKeywordTableVersion uint32 `protobuf:"varint,37,opt,name=provider_keyword_table_version,json=providerKeywordTableVersion,proto3" json:"provider_keyword_table_version,omitempty"`
+	// Asks the server to include the signed peer record of each peer in the
+	// buckets that a closer_peers_request is run over, such that the client
+	// can verify the peers that it retrieves.
+	SignedPeerRecords bool `protobuf:"varint,38,opt,name=signed_peer_records,json=signedPeerRecords,proto3" json:"signed_peer_records,omitempty"`
+	// Set by clients that can read chunked responses. The server may then move
+	// the ciphertexts of the PIR responses out of the response into PIR_Chunk
+	// messages that follow it on the stream, so that no single message exceeds
+	// the message size limit.
+	AcceptChunkedResponse bool `protobuf:"varint,39,opt,name=accept_chunked_response,json=acceptChunkedResponse,proto3" json:"accept_chunked_response,omitempty"`
+	// Number of PIR_Chunk messages that follow this response on the stream.
+	ResponseChunks uint32 `protobuf:"varint,40,opt,name=response_chunks,json=responseChunks,proto3" json:"response_chunks,omitempty"`
+	// Records whose keys fall into the same bucket. Used in the rows of the
+	// PIR database of the records of a namespace.
+	BucketRecords []*pb.Record `protobuf:"bytes,41,rep,name=bucket_records,json=bucketRecords,proto3" json:"bucket_records,omitempty"`
+	// PIR request for the bucket of records that the key of a
+	// PRIVATE_GET_VALUE lookup falls into. Only the namespace of the key is
+	// sent in the clear, as it selects the database that the request is run
+	// over.
+	RecordRequest   *PIR_Request  `protobuf:"bytes,42,opt,name=record_request,json=recordRequest,proto3" json:"record_request,omitempty"`
+	RecordResponse  *PIR_Response `protobuf:"bytes,43,opt,name=record_response,json=recordResponse,proto3" json:"record_response,omitempty"`
+	RecordNamespace string        `protobuf:"bytes,44,opt,name=record_namespace,json=recordNamespace,proto3" json:"record_namespace,omitempty"`
+	// Version of the derivation of the bucket index of a record key that the
+	// record_request was generated with, like provider_bucket_index_version.
+	RecordBucketIndexVersion uint32 `protobuf:"varint,45,opt,name=record_bucket_index_version,json=recordBucketIndexVersion,proto3" json:"record_bucket_index_version,omitempty"`
+	// Log of the number of slots of the cuckoo table of provider records that a
+	// keyword provider_peers_request was generated for. Unset stands for the
+	// smallest table. Servers size their table from the number of CIDs that
+	// they hold records for and set the length of their table in their
+	// responses. If it differs from the one of the request, the
+	// provider_peers_response carries a TABLE_LENGTH_MISMATCH error.
+	ProviderKeywordTableLength uint32 `protobuf:"varint,46,opt,name=provider_keyword_table_length,json=providerKeywordTableLength,proto3" json:"provider_keyword_table_length,omitempty"`
+	// Stash of the cuckoo table of provider records, with the sealed entries
+	// that didn't find a slot in the table. Set in responses to keyword
+	// provider_peers_requests.
+	ProviderKeywordStash [][]byte `protobuf:"bytes,47,rep,name=provider_keyword_stash,json=providerKeywordStash,proto3" json:"provider_keyword_stash,omitempty"`
+	// Set by clients that can read streamed responses. The server may then
+	// send each PIR response in PIR_Chunk messages as soon as it computed it,
+	// before it computed the next one.
+	AcceptStreamedResponse bool `protobuf:"varint,48,opt,name=accept_streamed_response,json=acceptStreamedResponse,proto3" json:"accept_streamed_response,omitempty"`
+	// Set in the first message of a streamed response. It is followed by a
+	// PIR_Chunk with the header of each PIR response and chunks of its
+	// ciphertexts, and ends with a PIR_Chunk with the trailer of the response.
+	StreamedResponse bool `protobuf:"varint,49,opt,name=streamed_response,json=streamedResponse,proto3" json:"streamed_response,omitempty"`
 }
 
 func (x *Message) Reset() {
@@ -298,11 +541,208 @@ func (x *Message) GetProviderPeersResponse() *PIR_Response {
 	return nil
 }
 
+func (x *Message) GetProviderBucketIndexVersion() uint32 {
+	if x != nil {
+		return x.ProviderBucketIndexVersion
+	}
+	return 0
+}
+
+func (x *Message) GetProviderKeywordTableVersion() uint32 {
+	if x != nil {
+		return x.ProviderKeywordTableVersion
+	}
+	return 0
+}
+
+func (x *Message) GetSignedPeerRecords() bool {
+	if x != nil {
+		return x.SignedPeerRecords
+	}
+	return false
+}
+
+func (x *Message) GetAcceptChunkedResponse() bool {
+	if x != nil {
+		return x.AcceptChunkedResponse
+	}
+	return false
+}
+
+func (x *Message) GetResponseChunks() uint32 {
+	if x != nil {
+		return x.ResponseChunks
+	}
+	return 0
+}
+
+func (x *Message) GetBucketRecords() []*pb.Record {
+	if x != nil {
+		return x.BucketRecords
+	}
+	return nil
+}
+
+func (x *Message) GetRecordRequest() *PIR_Request {
+	if x != nil {
+		return x.RecordRequest
+	}
+	return nil
+}
+
+func (x *Message) GetRecordResponse() *PIR_Response {
+	if x != nil {
+		return x.RecordResponse
+	}
+	return nil
+}
+
+func (x *Message) GetRecordNamespace() string {
+	if x != nil {
+		return x.RecordNamespace
+	}
+	return ""
+}
+
+func (x *Message) GetRecordBucketIndexVersion() uint32 {
+	if x != nil {
+		return x.RecordBucketIndexVersion
+	}
+	return 0
+}
+
+func (x *Message) GetProviderKeywordTableLength() uint32 {
+	if x != nil {
+		return x.ProviderKeywordTableLength
+	}
+	return 0
+}
+
+func (x *Message) GetProviderKeywordStash() [][]byte {
+	if x != nil {
+		return x.ProviderKeywordStash
+	}
+	return nil
+}
+
+func (x *Message) GetAcceptStreamedResponse() bool {
+	if x != nil {
+		return x.AcceptStreamedResponse
+	}
+	return false
+}
+
+func (x *Message) GetStreamedResponse() bool {
+	if x != nil {
+		return x.StreamedResponse
+	}
+	return false
+}
+
+// A chunk of the ciphertexts of a PIR response of a chunked or streamed
+// response. The data of the chunks of a field are appended to it in the order
+// that they are received.
+type PIR_Chunk struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Response PIR_Chunk_Response `protobuf:"varint,1,opt,name=response,proto3,enum=dht.pb.PIR_Chunk_Response" json:"response,omitempty"`
+	Field    PIR_Chunk_Field    `protobuf:"varint,2,opt,name=field,proto3,enum=dht.pb.PIR_Chunk_Field" json:"field,omitempty"`
+	// Index of the ciphertexts in the batch_ciphertexts of the response.
+	Index uint32 `protobuf:"varint,3,opt,name=index,proto3" json:"index,omitempty"`
+	Data  []byte `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	// Starts a PIR response of a streamed response. It holds the PIR response
+	// without its ciphertexts, which follow in the next chunks.
+	Header *PIR_Response `protobuf:"bytes,5,opt,name=header,proto3" json:"header,omitempty"`
+	// Ends a streamed response. It holds the fields of the response that
+	// weren't streamed.
+	Trailer *Message `protobuf:"bytes,6,opt,name=trailer,proto3" json:"trailer,omitempty"`
+}
+
+func (x *PIR_Chunk) Reset() {
+	*x = PIR_Chunk{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_msg_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PIR_Chunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PIR_Chunk) ProtoMessage() {}
+
+func (x *PIR_Chunk) ProtoReflect() protoreflect.Message {
+	mi := &file_msg_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PIR_Chunk.ProtoReflect.Descriptor instead.
+func (*PIR_Chunk) Descriptor() ([]byte, []int) {
+	return file_msg_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PIR_Chunk) GetResponse() PIR_Chunk_Response {
+	if x != nil {
+		return x.Response
+	}
+	return PIR_Chunk_CLOSER_PEERS
+}
+
+func (x *PIR_Chunk) GetField() PIR_Chunk_Field {
+	if x != nil {
+		return x.Field
+	}
+	return PIR_Chunk_CIPHERTEXTS
+}
+
+func (x *PIR_Chunk) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *PIR_Chunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *PIR_Chunk) GetHeader() *PIR_Response {
+	if x != nil {
+		return x.Header
+	}
+	return nil
+}
+
+func (x *PIR_Chunk) GetTrailer() *Message {
+	if x != nil {
+		return x.Trailer
+	}
+	return nil
+}
+
 type PIR_Request struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
+	// Identifier of the PIR scheme that the request was generated with,
+	// e.g. RLWE_Whispir_3_Keys. The server processes the request with the
+	// same scheme, or responds with an UNSUPPORTED_SCHEME error.
+	Scheme      string `protobuf:"bytes,5,opt,name=scheme,proto3" json:"scheme,omitempty"`
 	Log2NumRows int64  `protobuf:"varint,1,opt,name=log2_num_rows,json=log2NumRows,proto3" json:"log2_num_rows,omitempty"`
 	Parameters  []byte `protobuf:"bytes,2,opt,name=parameters,proto3" json:"parameters,omitempty"`
 	// Types that are assignable to SchemeDependent:
@@ -313,12 +753,40 @@ type PIR_Request struct {
 	SchemeDependent        isPIR_Request_SchemeDependent `protobuf_oneof:"SchemeDependent"`
 	EncryptedQuery         []byte                        `protobuf:"bytes,3,opt,name=encrypted_query,json=encryptedQuery,proto3" json:"encrypted_query,omitempty"`
 	EncryptedPaillierQuery [][]byte                      `protobuf:"bytes,4,rep,name=encrypted_paillier_query,json=encryptedPaillierQuery,proto3" json:"encrypted_paillier_query,omitempty"`
+	// Set instead of the encrypted query by batch requests, which retrieve
+	// one row for each of the encrypted queries.
+	BatchEncryptedQueries [][]byte `protobuf:"bytes,6,rep,name=batch_encrypted_queries,json=batchEncryptedQueries,proto3" json:"batch_encrypted_queries,omitempty"`
+	// Identifier of the evaluation keys of the request, chosen by the client.
+	// If the request carries evaluation keys, the server may cache them under
+	// this identifier. Otherwise, the server processes the request with the
+	// keys that it cached, or responds with an UNKNOWN_EVALUATION_KEYS error.
+	EvaluationKeysId []byte `protobuf:"bytes,7,opt,name=evaluation_keys_id,json=evaluationKeysId,proto3" json:"evaluation_keys_id,omitempty"`
+	// Number of dimensions of the hypercube that the server arranges the
+	// database as. The encrypted query holds one ciphertext per dimension.
+	// 0 and 1 both select the one-dimensional mode.
+	NumDimensions int64 `protobuf:"varint,8,opt,name=num_dimensions,json=numDimensions,proto3" json:"num_dimensions,omitempty"`
+	// Epoch of the hint that the client generated the query with, for
+	// schemes with a hint such as LWE_SimplePIR. The server responds with a
+	// STALE_HINT error if the hint of its database is of another epoch. A
+	// request without a query asks for the hint instead.
+	HintEpoch []byte `protobuf:"bytes,9,opt,name=hint_epoch,json=hintEpoch,proto3" json:"hint_epoch,omitempty"`
+	// Epoch of the database that the client agreed on with both servers of
+	// a two-server scheme such as DPF_TwoServer. The server responds with
+	// an EPOCH_MISMATCH error if its database is of another epoch. A
+	// request without a query asks for the epoch of the database instead.
+	DatabaseEpoch []byte `protobuf:"bytes,12,opt,name=database_epoch,json=databaseEpoch,proto3" json:"database_epoch,omitempty"`
+	// Name of the parameter set that the parameters of an RLWE request were
+	// generated from. The server encodes its database with the same
+	// parameters, or responds with an UNSUPPORTED_PARAMETER_SET error if it
+	// doesn't know the parameter set or the parameters differ from it. An
+	// empty name stands for the default parameter set.
+	ParameterSet string `protobuf:"bytes,13,opt,name=parameter_set,json=parameterSet,proto3" json:"parameter_set,omitempty"`
 }
 
 func (x *PIR_Request) Reset() {
 	*x = PIR_Request{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_msg_proto_msgTypes[1]
+		mi := &file_msg_proto_msgTypes[2]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -331,7 +799,7 @@ func (x *PIR_Request) String() string {
 func (*PIR_Request) ProtoMessage() {}
 
 func (x *PIR_Request) ProtoReflect() protoreflect.Message {
-	mi := &file_msg_proto_msgTypes[1]
+	mi := &file_msg_proto_msgTypes[2]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -344,7 +812,14 @@ func (x *PIR_Request) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PIR_Request.ProtoReflect.Descriptor instead.
 func (*PIR_Request) Descriptor() ([]byte, []int) {
-	return file_msg_proto_rawDescGZIP(), []int{1}
+	return file_msg_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PIR_Request) GetScheme() string {
+	if x != nil {
+		return x.Scheme
+	}
+	return ""
 }
 
 func (x *PIR_Request) GetLog2NumRows() int64 {
@@ -403,6 +878,48 @@ func (x *PIR_Request) GetEncryptedPaillierQuery() [][]byte {
 	return nil
 }
 
+func (x *PIR_Request) GetBatchEncryptedQueries() [][]byte {
+	if x != nil {
+		return x.BatchEncryptedQueries
+	}
+	return nil
+}
+
+func (x *PIR_Request) GetEvaluationKeysId() []byte {
+	if x != nil {
+		return x.EvaluationKeysId
+	}
+	return nil
+}
+
+func (x *PIR_Request) GetNumDimensions() int64 {
+	if x != nil {
+		return x.NumDimensions
+	}
+	return 0
+}
+
+func (x *PIR_Request) GetHintEpoch() []byte {
+	if x != nil {
+		return x.HintEpoch
+	}
+	return nil
+}
+
+func (x *PIR_Request) GetDatabaseEpoch() []byte {
+	if x != nil {
+		return x.DatabaseEpoch
+	}
+	return nil
+}
+
+func (x *PIR_Request) GetParameterSet() string {
+	if x != nil {
+		return x.ParameterSet
+	}
+	return ""
+}
+
 type isPIR_Request_SchemeDependent interface {
 	isPIR_Request_SchemeDependent()
 }
@@ -432,12 +949,26 @@ type PIR_Response struct {
 
 	Ciphertexts               []byte   `protobuf:"bytes,1,opt,name=ciphertexts,proto3" json:"ciphertexts,omitempty"`
 	EncryptedPaillierResponse [][]byte `protobuf:"bytes,2,rep,name=encrypted_paillier_response,json=encryptedPaillierResponse,proto3" json:"encrypted_paillier_response,omitempty"`
+	// Set instead of the ciphertexts if the server could not process the request.
+	Error *PIR_Error `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	// Set instead of the ciphertexts in responses to batch requests, with the
+	// ciphertexts for each of the encrypted queries of the request in order.
+	BatchCiphertexts [][]byte `protobuf:"bytes,4,rep,name=batch_ciphertexts,json=batchCiphertexts,proto3" json:"batch_ciphertexts,omitempty"`
+	// Set if the server cached the evaluation keys of the request, such that
+	// subsequent requests can reference them by their identifier.
+	EvaluationKeysCached bool `protobuf:"varint,5,opt,name=evaluation_keys_cached,json=evaluationKeysCached,proto3" json:"evaluation_keys_cached,omitempty"`
+	// Set instead of the ciphertexts in responses to requests for the hint of
+	// the database.
+	LweHint *LWE_Hint `protobuf:"bytes,6,opt,name=lwe_hint,json=lweHint,proto3" json:"lwe_hint,omitempty"`
+	// Epoch of the database that the response was computed over, for
+	// two-server schemes such as DPF_TwoServer.
+	DatabaseEpoch []byte `protobuf:"bytes,7,opt,name=database_epoch,json=databaseEpoch,proto3" json:"database_epoch,omitempty"`
 }
 
 func (x *PIR_Response) Reset() {
 	*x = PIR_Response{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_msg_proto_msgTypes[2]
+		mi := &file_msg_proto_msgTypes[3]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -450,7 +981,7 @@ func (x *PIR_Response) String() string {
 func (*PIR_Response) ProtoMessage() {}
 
 func (x *PIR_Response) ProtoReflect() protoreflect.Message {
-	mi := &file_msg_proto_msgTypes[2]
+	mi := &file_msg_proto_msgTypes[3]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -463,7 +994,7 @@ func (x *PIR_Response) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PIR_Response.ProtoReflect.Descriptor instead.
 func (*PIR_Response) Descriptor() ([]byte, []int) {
-	return file_msg_proto_rawDescGZIP(), []int{2}
+	return file_msg_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *PIR_Response) GetCiphertexts() []byte {
@@ -480,6 +1011,183 @@ func (x *PIR_Response) GetEncryptedPaillierResponse() [][]byte {
 	return nil
 }
 
+func (x *PIR_Response) GetError() *PIR_Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *PIR_Response) GetBatchCiphertexts() [][]byte {
+	if x != nil {
+		return x.BatchCiphertexts
+	}
+	return nil
+}
+
+func (x *PIR_Response) GetEvaluationKeysCached() bool {
+	if x != nil {
+		return x.EvaluationKeysCached
+	}
+	return false
+}
+
+func (x *PIR_Response) GetLweHint() *LWE_Hint {
+	if x != nil {
+		return x.LweHint
+	}
+	return nil
+}
+
+func (x *PIR_Response) GetDatabaseEpoch() []byte {
+	if x != nil {
+		return x.DatabaseEpoch
+	}
+	return nil
+}
+
+// Hint of a database for the LWE_SimplePIR scheme, which clients download
+// once per epoch of the database to generate queries and decrypt responses.
+type LWE_Hint struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Seed of the public matrix of the LWE samples.
+	Seed []byte `protobuf:"bytes,1,opt,name=seed,proto3" json:"seed,omitempty"`
+	// Identifier of the epoch of the database, which changes with its rows.
+	Epoch []byte `protobuf:"bytes,2,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	// Length of the rows of the database, in bytes.
+	RowLength int64 `protobuf:"varint,3,opt,name=row_length,json=rowLength,proto3" json:"row_length,omitempty"`
+	// The database multiplied with the public matrix, as little-endian
+	// uint32 values in row-major order.
+	Hint []byte `protobuf:"bytes,4,opt,name=hint,proto3" json:"hint,omitempty"`
+}
+
+func (x *LWE_Hint) Reset() {
+	*x = LWE_Hint{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_msg_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LWE_Hint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LWE_Hint) ProtoMessage() {}
+
+func (x *LWE_Hint) ProtoReflect() protoreflect.Message {
+	mi := &file_msg_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LWE_Hint.ProtoReflect.Descriptor instead.
+func (*LWE_Hint) Descriptor() ([]byte, []int) {
+	return file_msg_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *LWE_Hint) GetSeed() []byte {
+	if x != nil {
+		return x.Seed
+	}
+	return nil
+}
+
+func (x *LWE_Hint) GetEpoch() []byte {
+	if x != nil {
+		return x.Epoch
+	}
+	return nil
+}
+
+func (x *LWE_Hint) GetRowLength() int64 {
+	if x != nil {
+		return x.RowLength
+	}
+	return 0
+}
+
+func (x *LWE_Hint) GetHint() []byte {
+	if x != nil {
+		return x.Hint
+	}
+	return nil
+}
+
+type PIR_Error struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Code    PIR_Error_Code `protobuf:"varint,1,opt,name=code,proto3,enum=dht.pb.PIR_Error_Code" json:"code,omitempty"`
+	Message string         `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	// Identifiers of the schemes that the server supports.
+	SupportedSchemes []string `protobuf:"bytes,3,rep,name=supported_schemes,json=supportedSchemes,proto3" json:"supported_schemes,omitempty"`
+}
+
+func (x *PIR_Error) Reset() {
+	*x = PIR_Error{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_msg_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PIR_Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PIR_Error) ProtoMessage() {}
+
+func (x *PIR_Error) ProtoReflect() protoreflect.Message {
+	mi := &file_msg_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PIR_Error.ProtoReflect.Descriptor instead.
+func (*PIR_Error) Descriptor() ([]byte, []int) {
+	return file_msg_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PIR_Error) GetCode() PIR_Error_Code {
+	if x != nil {
+		return x.Code
+	}
+	return PIR_Error_UNKNOWN
+}
+
+func (x *PIR_Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *PIR_Error) GetSupportedSchemes() []string {
+	if x != nil {
+		return x.SupportedSchemes
+	}
+	return nil
+}
+
 type Paillier_Public_Key struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -493,7 +1201,7 @@ type Paillier_Public_Key struct {
 func (x *Paillier_Public_Key) Reset() {
 	*x = Paillier_Public_Key{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_msg_proto_msgTypes[3]
+		mi := &file_msg_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -506,7 +1214,7 @@ func (x *Paillier_Public_Key) String() string {
 func (*Paillier_Public_Key) ProtoMessage() {}
 
 func (x *Paillier_Public_Key) ProtoReflect() protoreflect.Message {
-	mi := &file_msg_proto_msgTypes[3]
+	mi := &file_msg_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -519,7 +1227,7 @@ func (x *Paillier_Public_Key) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Paillier_Public_Key.ProtoReflect.Descriptor instead.
 func (*Paillier_Public_Key) Descriptor() ([]byte, []int) {
-	return file_msg_proto_rawDescGZIP(), []int{3}
+	return file_msg_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *Paillier_Public_Key) GetN() []byte {
@@ -554,12 +1262,16 @@ type Message_Peer struct {
 	Addrs [][]byte `protobuf:"bytes,2,rep,name=addrs,proto3" json:"addrs,omitempty"`
 	// used to signal the sender's connection capabilities to the peer
 	Connection Message_ConnectionType `protobuf:"varint,3,opt,name=connection,proto3,enum=dht.pb.Message_ConnectionType" json:"connection,omitempty"`
+	// Marshalled signed envelope of the peer record of the peer, which
+	// authenticates its addrs. Only set in the buckets of PIR responses
+	// to requests that ask for signed_peer_records.
+	SignedRecord []byte `protobuf:"bytes,4,opt,name=signed_record,json=signedRecord,proto3" json:"signed_record,omitempty"`
 }
 
 func (x *Message_Peer) Reset() {
 	*x = Message_Peer{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_msg_proto_msgTypes[4]
+		mi := &file_msg_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -572,7 +1284,7 @@ func (x *Message_Peer) String() string {
 func (*Message_Peer) ProtoMessage() {}
 
 func (x *Message_Peer) ProtoReflect() protoreflect.Message {
-	mi := &file_msg_proto_msgTypes[4]
+	mi := &file_msg_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -609,6 +1321,13 @@ func (x *Message_Peer) GetConnection() Message_ConnectionType {
 	return Message_NOT_CONNECTED
 }
 
+func (x *Message_Peer) GetSignedRecord() []byte {
+	if x != nil {
+		return x.SignedRecord
+	}
+	return nil
+}
+
 type Message_CIDToProviderMap struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -621,7 +1340,7 @@ type Message_CIDToProviderMap struct {
 func (x *Message_CIDToProviderMap) Reset() {
 	*x = Message_CIDToProviderMap{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_msg_proto_msgTypes[5]
+		mi := &file_msg_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -634,7 +1353,7 @@ func (x *Message_CIDToProviderMap) String() string {
 func (*Message_CIDToProviderMap) ProtoMessage() {}
 
 func (x *Message_CIDToProviderMap) ProtoReflect() protoreflect.Message {
-	mi := &file_msg_proto_msgTypes[5]
+	mi := &file_msg_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -671,7 +1390,7 @@ var file_msg_proto_rawDesc = []byte{
 	0x2e, 0x70, 0x62, 0x1a, 0x32, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f,
 	0x6c, 0x69, 0x62, 0x70, 0x32, 0x70, 0x2f, 0x67, 0x6f, 0x2d, 0x6c, 0x69, 0x62, 0x70, 0x32, 0x70,
 	0x2d, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x2f, 0x70, 0x62, 0x2f, 0x72, 0x65, 0x63, 0x6f, 0x72,
-	0x64, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xf1, 0x08, 0x0a, 0x07, 0x4d, 0x65, 0x73, 0x73,
+	0x64, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xc6, 0x0f, 0x0a, 0x07, 0x4d, 0x65, 0x73, 0x73,
 	0x61, 0x67, 0x65, 0x12, 0x3a, 0x0a, 0x07, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x14,
 	0x20, 0x03, 0x28, 0x0b, 0x32, 0x20, 0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x4d, 0x65,
 	0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x43, 0x49, 0x44, 0x54, 0x6f, 0x50, 0x72, 0x6f, 0x76, 0x69,
@@ -714,71 +1433,207 @@ var file_msg_proto_rawDesc = []byte{
 	0x18, 0x23, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e,
 	0x50, 0x49, 0x52, 0x5f, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x15, 0x70, 0x72,
 	0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x50, 0x65, 0x65, 0x72, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f,
-	0x6e, 0x73, 0x65, 0x1a, 0x6c, 0x0a, 0x04, 0x50, 0x65, 0x65, 0x72, 0x12, 0x0e, 0x0a, 0x02, 0x69,
-	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x02, 0x69, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x61,
-	0x64, 0x64, 0x72, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x05, 0x61, 0x64, 0x64, 0x72,
-	0x73, 0x12, 0x3e, 0x0a, 0x0a, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18,
-	0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1e, 0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x4d,
-	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f,
-	0x6e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0a, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f,
-	0x6e, 0x1a, 0x61, 0x0a, 0x10, 0x43, 0x49, 0x44, 0x54, 0x6f, 0x50, 0x72, 0x6f, 0x76, 0x69, 0x64,
-	0x65, 0x72, 0x4d, 0x61, 0x70, 0x12, 0x10, 0x0a, 0x03, 0x63, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x0c, 0x52, 0x03, 0x63, 0x69, 0x64, 0x12, 0x3b, 0x0a, 0x0e, 0x70, 0x72, 0x6f, 0x76, 0x69,
-	0x64, 0x65, 0x72, 0x5f, 0x70, 0x65, 0x65, 0x72, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32,
-	0x14, 0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
-	0x2e, 0x50, 0x65, 0x65, 0x72, 0x52, 0x0d, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x50,
-	0x65, 0x65, 0x72, 0x73, 0x22, 0x9b, 0x01, 0x0a, 0x0b, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
-	0x54, 0x79, 0x70, 0x65, 0x12, 0x0d, 0x0a, 0x09, 0x50, 0x55, 0x54, 0x5f, 0x56, 0x41, 0x4c, 0x55,
-	0x45, 0x10, 0x00, 0x12, 0x0d, 0x0a, 0x09, 0x47, 0x45, 0x54, 0x5f, 0x56, 0x41, 0x4c, 0x55, 0x45,
-	0x10, 0x01, 0x12, 0x10, 0x0a, 0x0c, 0x41, 0x44, 0x44, 0x5f, 0x50, 0x52, 0x4f, 0x56, 0x49, 0x44,
-	0x45, 0x52, 0x10, 0x02, 0x12, 0x11, 0x0a, 0x0d, 0x47, 0x45, 0x54, 0x5f, 0x50, 0x52, 0x4f, 0x56,
-	0x49, 0x44, 0x45, 0x52, 0x53, 0x10, 0x03, 0x12, 0x0d, 0x0a, 0x09, 0x46, 0x49, 0x4e, 0x44, 0x5f,
-	0x4e, 0x4f, 0x44, 0x45, 0x10, 0x04, 0x12, 0x08, 0x0a, 0x04, 0x50, 0x49, 0x4e, 0x47, 0x10, 0x05,
-	0x12, 0x15, 0x0a, 0x11, 0x50, 0x52, 0x49, 0x56, 0x41, 0x54, 0x45, 0x5f, 0x46, 0x49, 0x4e, 0x44,
-	0x5f, 0x4e, 0x4f, 0x44, 0x45, 0x10, 0x20, 0x12, 0x19, 0x0a, 0x15, 0x50, 0x52, 0x49, 0x56, 0x41,
-	0x54, 0x45, 0x5f, 0x47, 0x45, 0x54, 0x5f, 0x50, 0x52, 0x4f, 0x56, 0x49, 0x44, 0x45, 0x52, 0x53,
-	0x10, 0x21, 0x22, 0x57, 0x0a, 0x0e, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e,
-	0x54, 0x79, 0x70, 0x65, 0x12, 0x11, 0x0a, 0x0d, 0x4e, 0x4f, 0x54, 0x5f, 0x43, 0x4f, 0x4e, 0x4e,
-	0x45, 0x43, 0x54, 0x45, 0x44, 0x10, 0x00, 0x12, 0x0d, 0x0a, 0x09, 0x43, 0x4f, 0x4e, 0x4e, 0x45,
-	0x43, 0x54, 0x45, 0x44, 0x10, 0x01, 0x12, 0x0f, 0x0a, 0x0b, 0x43, 0x41, 0x4e, 0x5f, 0x43, 0x4f,
-	0x4e, 0x4e, 0x45, 0x43, 0x54, 0x10, 0x02, 0x12, 0x12, 0x0a, 0x0e, 0x43, 0x41, 0x4e, 0x4e, 0x4f,
-	0x54, 0x5f, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x10, 0x03, 0x22, 0xeb, 0x02, 0x0a, 0x0b,
-	0x50, 0x49, 0x52, 0x5f, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x22, 0x0a, 0x0d, 0x6c,
-	0x6f, 0x67, 0x32, 0x5f, 0x6e, 0x75, 0x6d, 0x5f, 0x72, 0x6f, 0x77, 0x73, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x03, 0x52, 0x0b, 0x6c, 0x6f, 0x67, 0x32, 0x4e, 0x75, 0x6d, 0x52, 0x6f, 0x77, 0x73, 0x12,
-	0x1e, 0x0a, 0x0a, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x73, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x0c, 0x52, 0x0a, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x73, 0x12,
-	0x32, 0x0a, 0x14, 0x52, 0x4c, 0x57, 0x45, 0x5f, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x69,
-	0x6f, 0x6e, 0x5f, 0x6b, 0x65, 0x79, 0x73, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52,
-	0x12, 0x52, 0x4c, 0x57, 0x45, 0x45, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4b,
-	0x65, 0x79, 0x73, 0x12, 0x4d, 0x0a, 0x13, 0x50, 0x61, 0x69, 0x6c, 0x6c, 0x69, 0x65, 0x72, 0x5f,
-	0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f, 0x4b, 0x65, 0x79, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0b,
-	0x32, 0x1b, 0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x61, 0x69, 0x6c, 0x6c, 0x69,
-	0x65, 0x72, 0x5f, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f, 0x4b, 0x65, 0x79, 0x48, 0x00, 0x52,
-	0x11, 0x50, 0x61, 0x69, 0x6c, 0x6c, 0x69, 0x65, 0x72, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x4b,
-	0x65, 0x79, 0x12, 0x1f, 0x0a, 0x0a, 0x6f, 0x74, 0x68, 0x65, 0x72, 0x5f, 0x6b, 0x65, 0x79, 0x73,
-	0x18, 0x15, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x09, 0x6f, 0x74, 0x68, 0x65, 0x72, 0x4b,
-	0x65, 0x79, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64,
-	0x5f, 0x71, 0x75, 0x65, 0x72, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0e, 0x65, 0x6e,
-	0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x38, 0x0a, 0x18,
-	0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x5f, 0x70, 0x61, 0x69, 0x6c, 0x6c, 0x69,
-	0x65, 0x72, 0x5f, 0x71, 0x75, 0x65, 0x72, 0x79, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x16,
-	0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x50, 0x61, 0x69, 0x6c, 0x6c, 0x69, 0x65,
-	0x72, 0x51, 0x75, 0x65, 0x72, 0x79, 0x42, 0x11, 0x0a, 0x0f, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x65,
-	0x44, 0x65, 0x70, 0x65, 0x6e, 0x64, 0x65, 0x6e, 0x74, 0x22, 0x70, 0x0a, 0x0c, 0x50, 0x49, 0x52,
-	0x5f, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x63, 0x69, 0x70,
-	0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0b,
-	0x63, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x73, 0x12, 0x3e, 0x0a, 0x1b, 0x65,
-	0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x5f, 0x70, 0x61, 0x69, 0x6c, 0x6c, 0x69, 0x65,
-	0x72, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0c,
-	0x52, 0x19, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x50, 0x61, 0x69, 0x6c, 0x6c,
-	0x69, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x49, 0x0a, 0x13, 0x50,
-	0x61, 0x69, 0x6c, 0x6c, 0x69, 0x65, 0x72, 0x5f, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f, 0x4b,
-	0x65, 0x79, 0x12, 0x0c, 0x0a, 0x01, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x01, 0x6e,
-	0x12, 0x0c, 0x0a, 0x01, 0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x01, 0x67, 0x12, 0x16,
-	0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06,
-	0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x42, 0x07, 0x5a, 0x05, 0x2e, 0x2f, 0x3b, 0x70, 0x62, 0x62,
-	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x6e, 0x73, 0x65, 0x12, 0x41, 0x0a, 0x1d, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x5f,
+	0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x5f, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x5f, 0x76, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x18, 0x24, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x1a, 0x70, 0x72, 0x6f, 0x76,
+	0x69, 0x64, 0x65, 0x72, 0x42, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x56,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x43, 0x0a, 0x1e, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64,
+	0x65, 0x72, 0x5f, 0x6b, 0x65, 0x79, 0x77, 0x6f, 0x72, 0x64, 0x5f, 0x74, 0x61, 0x62, 0x6c, 0x65,
+	0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x25, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x1b,
+	0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x4b, 0x65, 0x79, 0x77, 0x6f, 0x72, 0x64, 0x54,
+	0x61, 0x62, 0x6c, 0x65, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x2e, 0x0a, 0x13, 0x73,
+	0x69, 0x67, 0x6e, 0x65, 0x64, 0x5f, 0x70, 0x65, 0x65, 0x72, 0x5f, 0x72, 0x65, 0x63, 0x6f, 0x72,
+	0x64, 0x73, 0x18, 0x26, 0x20, 0x01, 0x28, 0x08, 0x52, 0x11, 0x73, 0x69, 0x67, 0x6e, 0x65, 0x64,
+	0x50, 0x65, 0x65, 0x72, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x73, 0x12, 0x36, 0x0a, 0x17, 0x61,
+	0x63, 0x63, 0x65, 0x70, 0x74, 0x5f, 0x63, 0x68, 0x75, 0x6e, 0x6b, 0x65, 0x64, 0x5f, 0x72, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x27, 0x20, 0x01, 0x28, 0x08, 0x52, 0x15, 0x61, 0x63,
+	0x63, 0x65, 0x70, 0x74, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x65, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x27, 0x0a, 0x0f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f,
+	0x63, 0x68, 0x75, 0x6e, 0x6b, 0x73, 0x18, 0x28, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0e, 0x72, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x73, 0x12, 0x38, 0x0a, 0x0e,
+	0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x5f, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x73, 0x18, 0x29,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x2e, 0x70, 0x62,
+	0x2e, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x0d, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x52,
+	0x65, 0x63, 0x6f, 0x72, 0x64, 0x73, 0x12, 0x3a, 0x0a, 0x0e, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64,
+	0x5f, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x18, 0x2a, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13,
+	0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x49, 0x52, 0x5f, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x52, 0x0d, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x3d, 0x0a, 0x0f, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x5f, 0x72, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x2b, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x64, 0x68,
+	0x74, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x49, 0x52, 0x5f, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x52, 0x0e, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x12, 0x29, 0x0a, 0x10, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x5f, 0x6e, 0x61, 0x6d, 0x65,
+	0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x2c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x72, 0x65, 0x63,
+	0x6f, 0x72, 0x64, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x12, 0x3d, 0x0a, 0x1b,
+	0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x5f, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x5f, 0x69, 0x6e,
+	0x64, 0x65, 0x78, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x2d, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x18, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x42, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x49,
+	0x6e, 0x64, 0x65, 0x78, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x41, 0x0a, 0x1d, 0x70,
+	0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x5f, 0x6b, 0x65, 0x79, 0x77, 0x6f, 0x72, 0x64, 0x5f,
+	0x74, 0x61, 0x62, 0x6c, 0x65, 0x5f, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x2e, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x1a, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x4b, 0x65, 0x79, 0x77,
+	0x6f, 0x72, 0x64, 0x54, 0x61, 0x62, 0x6c, 0x65, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x34,
+	0x0a, 0x16, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x5f, 0x6b, 0x65, 0x79, 0x77, 0x6f,
+	0x72, 0x64, 0x5f, 0x73, 0x74, 0x61, 0x73, 0x68, 0x18, 0x2f, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x14,
+	0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x4b, 0x65, 0x79, 0x77, 0x6f, 0x72, 0x64, 0x53,
+	0x74, 0x61, 0x73, 0x68, 0x12, 0x38, 0x0a, 0x18, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74, 0x5f, 0x73,
+	0x74, 0x72, 0x65, 0x61, 0x6d, 0x65, 0x64, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x18, 0x30, 0x20, 0x01, 0x28, 0x08, 0x52, 0x16, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74, 0x53, 0x74,
+	0x72, 0x65, 0x61, 0x6d, 0x65, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2b,
+	0x0a, 0x11, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x65, 0x64, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x18, 0x31, 0x20, 0x01, 0x28, 0x08, 0x52, 0x10, 0x73, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x65, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x1a, 0x91, 0x01, 0x0a, 0x04,
+	0x50, 0x65, 0x65, 0x72, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x02, 0x69, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x61, 0x64, 0x64, 0x72, 0x73, 0x18, 0x02, 0x20,
+	0x03, 0x28, 0x0c, 0x52, 0x05, 0x61, 0x64, 0x64, 0x72, 0x73, 0x12, 0x3e, 0x0a, 0x0a, 0x63, 0x6f,
+	0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1e,
+	0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e,
+	0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0a,
+	0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x23, 0x0a, 0x0d, 0x73, 0x69,
+	0x67, 0x6e, 0x65, 0x64, 0x5f, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x0c, 0x73, 0x69, 0x67, 0x6e, 0x65, 0x64, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x1a,
+	0x61, 0x0a, 0x10, 0x43, 0x49, 0x44, 0x54, 0x6f, 0x50, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72,
+	0x4d, 0x61, 0x70, 0x12, 0x10, 0x0a, 0x03, 0x63, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x03, 0x63, 0x69, 0x64, 0x12, 0x3b, 0x0a, 0x0e, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65,
+	0x72, 0x5f, 0x70, 0x65, 0x65, 0x72, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e,
+	0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x50,
+	0x65, 0x65, 0x72, 0x52, 0x0d, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x50, 0x65, 0x65,
+	0x72, 0x73, 0x22, 0xb2, 0x01, 0x0a, 0x0b, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79,
+	0x70, 0x65, 0x12, 0x0d, 0x0a, 0x09, 0x50, 0x55, 0x54, 0x5f, 0x56, 0x41, 0x4c, 0x55, 0x45, 0x10,
+	0x00, 0x12, 0x0d, 0x0a, 0x09, 0x47, 0x45, 0x54, 0x5f, 0x56, 0x41, 0x4c, 0x55, 0x45, 0x10, 0x01,
+	0x12, 0x10, 0x0a, 0x0c, 0x41, 0x44, 0x44, 0x5f, 0x50, 0x52, 0x4f, 0x56, 0x49, 0x44, 0x45, 0x52,
+	0x10, 0x02, 0x12, 0x11, 0x0a, 0x0d, 0x47, 0x45, 0x54, 0x5f, 0x50, 0x52, 0x4f, 0x56, 0x49, 0x44,
+	0x45, 0x52, 0x53, 0x10, 0x03, 0x12, 0x0d, 0x0a, 0x09, 0x46, 0x49, 0x4e, 0x44, 0x5f, 0x4e, 0x4f,
+	0x44, 0x45, 0x10, 0x04, 0x12, 0x08, 0x0a, 0x04, 0x50, 0x49, 0x4e, 0x47, 0x10, 0x05, 0x12, 0x15,
+	0x0a, 0x11, 0x50, 0x52, 0x49, 0x56, 0x41, 0x54, 0x45, 0x5f, 0x46, 0x49, 0x4e, 0x44, 0x5f, 0x4e,
+	0x4f, 0x44, 0x45, 0x10, 0x20, 0x12, 0x19, 0x0a, 0x15, 0x50, 0x52, 0x49, 0x56, 0x41, 0x54, 0x45,
+	0x5f, 0x47, 0x45, 0x54, 0x5f, 0x50, 0x52, 0x4f, 0x56, 0x49, 0x44, 0x45, 0x52, 0x53, 0x10, 0x21,
+	0x12, 0x15, 0x0a, 0x11, 0x50, 0x52, 0x49, 0x56, 0x41, 0x54, 0x45, 0x5f, 0x47, 0x45, 0x54, 0x5f,
+	0x56, 0x41, 0x4c, 0x55, 0x45, 0x10, 0x22, 0x22, 0x57, 0x0a, 0x0e, 0x43, 0x6f, 0x6e, 0x6e, 0x65,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x11, 0x0a, 0x0d, 0x4e, 0x4f, 0x54,
+	0x5f, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x45, 0x44, 0x10, 0x00, 0x12, 0x0d, 0x0a, 0x09,
+	0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x45, 0x44, 0x10, 0x01, 0x12, 0x0f, 0x0a, 0x0b, 0x43,
+	0x41, 0x4e, 0x5f, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x10, 0x02, 0x12, 0x12, 0x0a, 0x0e,
+	0x43, 0x41, 0x4e, 0x4e, 0x4f, 0x54, 0x5f, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x10, 0x03,
+	0x22, 0xf2, 0x02, 0x0a, 0x09, 0x50, 0x49, 0x52, 0x5f, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x12, 0x36,
+	0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e,
+	0x32, 0x1a, 0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x49, 0x52, 0x5f, 0x43, 0x68,
+	0x75, 0x6e, 0x6b, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x08, 0x72, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2d, 0x0a, 0x05, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x17, 0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x50,
+	0x49, 0x52, 0x5f, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x52, 0x05,
+	0x66, 0x69, 0x65, 0x6c, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x12, 0x0a, 0x04, 0x64,
+	0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12,
+	0x2c, 0x0a, 0x06, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x14, 0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x49, 0x52, 0x5f, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x06, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x12, 0x29, 0x0a,
+	0x07, 0x74, 0x72, 0x61, 0x69, 0x6c, 0x65, 0x72, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f,
+	0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52,
+	0x07, 0x74, 0x72, 0x61, 0x69, 0x6c, 0x65, 0x72, 0x22, 0x3c, 0x0a, 0x08, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x10, 0x0a, 0x0c, 0x43, 0x4c, 0x4f, 0x53, 0x45, 0x52, 0x5f, 0x50,
+	0x45, 0x45, 0x52, 0x53, 0x10, 0x00, 0x12, 0x12, 0x0a, 0x0e, 0x50, 0x52, 0x4f, 0x56, 0x49, 0x44,
+	0x45, 0x52, 0x5f, 0x50, 0x45, 0x45, 0x52, 0x53, 0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x52, 0x45,
+	0x43, 0x4f, 0x52, 0x44, 0x10, 0x02, 0x22, 0x3d, 0x0a, 0x05, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x12,
+	0x0f, 0x0a, 0x0b, 0x43, 0x49, 0x50, 0x48, 0x45, 0x52, 0x54, 0x45, 0x58, 0x54, 0x53, 0x10, 0x00,
+	0x12, 0x15, 0x0a, 0x11, 0x42, 0x41, 0x54, 0x43, 0x48, 0x5f, 0x43, 0x49, 0x50, 0x48, 0x45, 0x52,
+	0x54, 0x45, 0x58, 0x54, 0x53, 0x10, 0x01, 0x12, 0x0c, 0x0a, 0x08, 0x4c, 0x57, 0x45, 0x5f, 0x48,
+	0x49, 0x4e, 0x54, 0x10, 0x02, 0x22, 0xfb, 0x04, 0x0a, 0x0b, 0x50, 0x49, 0x52, 0x5f, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x65, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x65, 0x12, 0x22, 0x0a,
+	0x0d, 0x6c, 0x6f, 0x67, 0x32, 0x5f, 0x6e, 0x75, 0x6d, 0x5f, 0x72, 0x6f, 0x77, 0x73, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x0b, 0x6c, 0x6f, 0x67, 0x32, 0x4e, 0x75, 0x6d, 0x52, 0x6f, 0x77,
+	0x73, 0x12, 0x1e, 0x0a, 0x0a, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x73, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72,
+	0x73, 0x12, 0x32, 0x0a, 0x14, 0x52, 0x4c, 0x57, 0x45, 0x5f, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6b, 0x65, 0x79, 0x73, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0c, 0x48,
+	0x00, 0x52, 0x12, 0x52, 0x4c, 0x57, 0x45, 0x45, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x4b, 0x65, 0x79, 0x73, 0x12, 0x4d, 0x0a, 0x13, 0x50, 0x61, 0x69, 0x6c, 0x6c, 0x69, 0x65,
+	0x72, 0x5f, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f, 0x4b, 0x65, 0x79, 0x18, 0x0b, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x61, 0x69, 0x6c,
+	0x6c, 0x69, 0x65, 0x72, 0x5f, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x5f, 0x4b, 0x65, 0x79, 0x48,
+	0x00, 0x52, 0x11, 0x50, 0x61, 0x69, 0x6c, 0x6c, 0x69, 0x65, 0x72, 0x50, 0x75, 0x62, 0x6c, 0x69,
+	0x63, 0x4b, 0x65, 0x79, 0x12, 0x1f, 0x0a, 0x0a, 0x6f, 0x74, 0x68, 0x65, 0x72, 0x5f, 0x6b, 0x65,
+	0x79, 0x73, 0x18, 0x15, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x09, 0x6f, 0x74, 0x68, 0x65,
+	0x72, 0x4b, 0x65, 0x79, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74,
+	0x65, 0x64, 0x5f, 0x71, 0x75, 0x65, 0x72, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0e,
+	0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x38,
+	0x0a, 0x18, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x5f, 0x70, 0x61, 0x69, 0x6c,
+	0x6c, 0x69, 0x65, 0x72, 0x5f, 0x71, 0x75, 0x65, 0x72, 0x79, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0c,
+	0x52, 0x16, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x50, 0x61, 0x69, 0x6c, 0x6c,
+	0x69, 0x65, 0x72, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x36, 0x0a, 0x17, 0x62, 0x61, 0x74, 0x63,
+	0x68, 0x5f, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x5f, 0x71, 0x75, 0x65, 0x72,
+	0x69, 0x65, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x15, 0x62, 0x61, 0x74, 0x63, 0x68,
+	0x45, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x51, 0x75, 0x65, 0x72, 0x69, 0x65, 0x73,
+	0x12, 0x2c, 0x0a, 0x12, 0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6b,
+	0x65, 0x79, 0x73, 0x5f, 0x69, 0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x10, 0x65, 0x76,
+	0x61, 0x6c, 0x75, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4b, 0x65, 0x79, 0x73, 0x49, 0x64, 0x12, 0x25,
+	0x0a, 0x0e, 0x6e, 0x75, 0x6d, 0x5f, 0x64, 0x69, 0x6d, 0x65, 0x6e, 0x73, 0x69, 0x6f, 0x6e, 0x73,
+	0x18, 0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0d, 0x6e, 0x75, 0x6d, 0x44, 0x69, 0x6d, 0x65, 0x6e,
+	0x73, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x68, 0x69, 0x6e, 0x74, 0x5f, 0x65, 0x70,
+	0x6f, 0x63, 0x68, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x68, 0x69, 0x6e, 0x74, 0x45,
+	0x70, 0x6f, 0x63, 0x68, 0x12, 0x25, 0x0a, 0x0e, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65,
+	0x5f, 0x65, 0x70, 0x6f, 0x63, 0x68, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0d, 0x64, 0x61,
+	0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x45, 0x70, 0x6f, 0x63, 0x68, 0x12, 0x23, 0x0a, 0x0d, 0x70,
+	0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x5f, 0x73, 0x65, 0x74, 0x18, 0x0d, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0c, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x53, 0x65, 0x74,
+	0x42, 0x11, 0x0a, 0x0f, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x65, 0x44, 0x65, 0x70, 0x65, 0x6e, 0x64,
+	0x65, 0x6e, 0x74, 0x22, 0xd0, 0x02, 0x0a, 0x0c, 0x50, 0x49, 0x52, 0x5f, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x63, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74, 0x65,
+	0x78, 0x74, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0b, 0x63, 0x69, 0x70, 0x68, 0x65,
+	0x72, 0x74, 0x65, 0x78, 0x74, 0x73, 0x12, 0x3e, 0x0a, 0x1b, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70,
+	0x74, 0x65, 0x64, 0x5f, 0x70, 0x61, 0x69, 0x6c, 0x6c, 0x69, 0x65, 0x72, 0x5f, 0x72, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x19, 0x65, 0x6e, 0x63,
+	0x72, 0x79, 0x70, 0x74, 0x65, 0x64, 0x50, 0x61, 0x69, 0x6c, 0x6c, 0x69, 0x65, 0x72, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x27, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x50,
+	0x49, 0x52, 0x5f, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x12,
+	0x2b, 0x0a, 0x11, 0x62, 0x61, 0x74, 0x63, 0x68, 0x5f, 0x63, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74,
+	0x65, 0x78, 0x74, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x10, 0x62, 0x61, 0x74, 0x63,
+	0x68, 0x43, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x73, 0x12, 0x34, 0x0a, 0x16,
+	0x65, 0x76, 0x61, 0x6c, 0x75, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6b, 0x65, 0x79, 0x73, 0x5f,
+	0x63, 0x61, 0x63, 0x68, 0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x14, 0x65, 0x76,
+	0x61, 0x6c, 0x75, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4b, 0x65, 0x79, 0x73, 0x43, 0x61, 0x63, 0x68,
+	0x65, 0x64, 0x12, 0x2b, 0x0a, 0x08, 0x6c, 0x77, 0x65, 0x5f, 0x68, 0x69, 0x6e, 0x74, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x64, 0x68, 0x74, 0x2e, 0x70, 0x62, 0x2e, 0x4c, 0x57,
+	0x45, 0x5f, 0x48, 0x69, 0x6e, 0x74, 0x52, 0x07, 0x6c, 0x77, 0x65, 0x48, 0x69, 0x6e, 0x74, 0x12,
+	0x25, 0x0a, 0x0e, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x65, 0x70, 0x6f, 0x63,
+	0x68, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0d, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73,
+	0x65, 0x45, 0x70, 0x6f, 0x63, 0x68, 0x22, 0x67, 0x0a, 0x08, 0x4c, 0x57, 0x45, 0x5f, 0x48, 0x69,
+	0x6e, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x04, 0x73, 0x65, 0x65, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x70, 0x6f, 0x63, 0x68, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x65, 0x70, 0x6f, 0x63, 0x68, 0x12, 0x1d, 0x0a, 0x0a,
+	0x72, 0x6f, 0x77, 0x5f, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x09, 0x72, 0x6f, 0x77, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x12, 0x0a, 0x04, 0x68,
+	0x69, 0x6e, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x68, 0x69, 0x6e, 0x74, 0x22,
+	0xdb, 0x02, 0x0a, 0x09, 0x50, 0x49, 0x52, 0x5f, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x2a, 0x0a,
+	0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x16, 0x2e, 0x64, 0x68,
+	0x74, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x49, 0x52, 0x5f, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x2e, 0x43,
+	0x6f, 0x64, 0x65, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73,
+	0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x12, 0x2b, 0x0a, 0x11, 0x73, 0x75, 0x70, 0x70, 0x6f, 0x72, 0x74, 0x65, 0x64,
+	0x5f, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x10,
+	0x73, 0x75, 0x70, 0x70, 0x6f, 0x72, 0x74, 0x65, 0x64, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x65, 0x73,
+	0x22, 0xda, 0x01, 0x0a, 0x04, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e, 0x4b,
+	0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x16, 0x0a, 0x12, 0x55, 0x4e, 0x53, 0x55, 0x50, 0x50,
+	0x4f, 0x52, 0x54, 0x45, 0x44, 0x5f, 0x53, 0x43, 0x48, 0x45, 0x4d, 0x45, 0x10, 0x01, 0x12, 0x1b,
+	0x0a, 0x17, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x5f, 0x45, 0x56, 0x41, 0x4c, 0x55, 0x41,
+	0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x4b, 0x45, 0x59, 0x53, 0x10, 0x02, 0x12, 0x0e, 0x0a, 0x0a, 0x53,
+	0x54, 0x41, 0x4c, 0x45, 0x5f, 0x48, 0x49, 0x4e, 0x54, 0x10, 0x03, 0x12, 0x12, 0x0a, 0x0e, 0x45,
+	0x50, 0x4f, 0x43, 0x48, 0x5f, 0x4d, 0x49, 0x53, 0x4d, 0x41, 0x54, 0x43, 0x48, 0x10, 0x04, 0x12,
+	0x13, 0x0a, 0x0f, 0x42, 0x55, 0x44, 0x47, 0x45, 0x54, 0x5f, 0x45, 0x58, 0x43, 0x45, 0x45, 0x44,
+	0x45, 0x44, 0x10, 0x05, 0x12, 0x08, 0x0a, 0x04, 0x42, 0x55, 0x53, 0x59, 0x10, 0x06, 0x12, 0x1d,
+	0x0a, 0x19, 0x55, 0x4e, 0x53, 0x55, 0x50, 0x50, 0x4f, 0x52, 0x54, 0x45, 0x44, 0x5f, 0x50, 0x41,
+	0x52, 0x41, 0x4d, 0x45, 0x54, 0x45, 0x52, 0x5f, 0x53, 0x45, 0x54, 0x10, 0x07, 0x12, 0x13, 0x0a,
+	0x0f, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x52, 0x45, 0x51, 0x55, 0x45, 0x53, 0x54,
+	0x10, 0x08, 0x12, 0x19, 0x0a, 0x15, 0x54, 0x41, 0x42, 0x4c, 0x45, 0x5f, 0x4c, 0x45, 0x4e, 0x47,
+	0x54, 0x48, 0x5f, 0x4d, 0x49, 0x53, 0x4d, 0x41, 0x54, 0x43, 0x48, 0x10, 0x09, 0x22, 0x49, 0x0a,
+	0x13, 0x50, 0x61, 0x69, 0x6c, 0x6c, 0x69, 0x65, 0x72, 0x5f, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x63,
+	0x5f, 0x4b, 0x65, 0x79, 0x12, 0x0c, 0x0a, 0x01, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x01, 0x6e, 0x12, 0x0c, 0x0a, 0x01, 0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x01, 0x67,
+	0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x42, 0x07, 0x5a, 0x05, 0x2e, 0x2f, 0x3b, 0x70,
+	0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -793,37 +1648,53 @@ func file_msg_proto_rawDescGZIP() []byte {
 	return file_msg_proto_rawDescData
 }
 
-var file_msg_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_msg_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_msg_proto_enumTypes = make([]protoimpl.EnumInfo, 5)
+var file_msg_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_msg_proto_goTypes = []interface{}{
 	(Message_MessageType)(0),         // 0: dht.pb.Message.MessageType
 	(Message_ConnectionType)(0),      // 1: dht.pb.Message.ConnectionType
-	(*Message)(nil),                  // 2: dht.pb.Message
-	(*PIR_Request)(nil),              // 3: dht.pb.PIR_Request
-	(*PIR_Response)(nil),             // 4: dht.pb.PIR_Response
-	(*Paillier_Public_Key)(nil),      // 5: dht.pb.Paillier_Public_Key
-	(*Message_Peer)(nil),             // 6: dht.pb.Message.Peer
-	(*Message_CIDToProviderMap)(nil), // 7: dht.pb.Message.CIDToProviderMap
-	(*pb.Record)(nil),                // 8: record.pb.Record
+	(PIR_Chunk_Response)(0),          // 2: dht.pb.PIR_Chunk.Response
+	(PIR_Chunk_Field)(0),             // 3: dht.pb.PIR_Chunk.Field
+	(PIR_Error_Code)(0),              // 4: dht.pb.PIR_Error.Code
+	(*Message)(nil),                  // 5: dht.pb.Message
+	(*PIR_Chunk)(nil),                // 6: dht.pb.PIR_Chunk
+	(*PIR_Request)(nil),              // 7: dht.pb.PIR_Request
+	(*PIR_Response)(nil),             // 8: dht.pb.PIR_Response
+	(*LWE_Hint)(nil),                 // 9: dht.pb.LWE_Hint
+	(*PIR_Error)(nil),                // 10: dht.pb.PIR_Error
+	(*Paillier_Public_Key)(nil),      // 11: dht.pb.Paillier_Public_Key
+	(*Message_Peer)(nil),             // 12: dht.pb.Message.Peer
+	(*Message_CIDToProviderMap)(nil), // 13: dht.pb.Message.CIDToProviderMap
+	(*pb.Record)(nil),                // 14: record.pb.Record
 }
 var file_msg_proto_depIdxs = []int32{
-	7,  // 0: dht.pb.Message.buckets:type_name -> dht.pb.Message.CIDToProviderMap
+	13, // 0: dht.pb.Message.buckets:type_name -> dht.pb.Message.CIDToProviderMap
 	0,  // 1: dht.pb.Message.type:type_name -> dht.pb.Message.MessageType
-	8,  // 2: dht.pb.Message.record:type_name -> record.pb.Record
-	6,  // 3: dht.pb.Message.closer_peers:type_name -> dht.pb.Message.Peer
-	6,  // 4: dht.pb.Message.provider_peers:type_name -> dht.pb.Message.Peer
-	3,  // 5: dht.pb.Message.closer_peers_request:type_name -> dht.pb.PIR_Request
-	3,  // 6: dht.pb.Message.provider_peers_request:type_name -> dht.pb.PIR_Request
-	4,  // 7: dht.pb.Message.closer_peers_response:type_name -> dht.pb.PIR_Response
-	4,  // 8: dht.pb.Message.provider_peers_response:type_name -> dht.pb.PIR_Response
-	5,  // 9: dht.pb.PIR_Request.Paillier_Public_Key:type_name -> dht.pb.Paillier_Public_Key
-	1,  // 10: dht.pb.Message.Peer.connection:type_name -> dht.pb.Message.ConnectionType
-	6,  // 11: dht.pb.Message.CIDToProviderMap.provider_peers:type_name -> dht.pb.Message.Peer
-	12, // [12:12] is the sub-list for method output_type
-	12, // [12:12] is the sub-list for method input_type
-	12, // [12:12] is the sub-list for extension type_name
-	12, // [12:12] is the sub-list for extension extendee
-	0,  // [0:12] is the sub-list for field type_name
+	14, // 2: dht.pb.Message.record:type_name -> record.pb.Record
+	12, // 3: dht.pb.Message.closer_peers:type_name -> dht.pb.Message.Peer
+	12, // 4: dht.pb.Message.provider_peers:type_name -> dht.pb.Message.Peer
+	7,  // 5: dht.pb.Message.closer_peers_request:type_name -> dht.pb.PIR_Request
+	7,  // 6: dht.pb.Message.provider_peers_request:type_name -> dht.pb.PIR_Request
+	8,  // 7: dht.pb.Message.closer_peers_response:type_name -> dht.pb.PIR_Response
+	8,  // 8: dht.pb.Message.provider_peers_response:type_name -> dht.pb.PIR_Response
+	14, // 9: dht.pb.Message.bucket_records:type_name -> record.pb.Record
+	7,  // 10: dht.pb.Message.record_request:type_name -> dht.pb.PIR_Request
+	8,  // 11: dht.pb.Message.record_response:type_name -> dht.pb.PIR_Response
+	2,  // 12: dht.pb.PIR_Chunk.response:type_name -> dht.pb.PIR_Chunk.Response
+	3,  // 13: dht.pb.PIR_Chunk.field:type_name -> dht.pb.PIR_Chunk.Field
+	8,  // 14: dht.pb.PIR_Chunk.header:type_name -> dht.pb.PIR_Response
+	5,  // 15: dht.pb.PIR_Chunk.trailer:type_name -> dht.pb.Message
+	11, // 16: dht.pb.PIR_Request.Paillier_Public_Key:type_name -> dht.pb.Paillier_Public_Key
+	10, // 17: dht.pb.PIR_Response.error:type_name -> dht.pb.PIR_Error
+	9,  // 18: dht.pb.PIR_Response.lwe_hint:type_name -> dht.pb.LWE_Hint
+	4,  // 19: dht.pb.PIR_Error.code:type_name -> dht.pb.PIR_Error.Code
+	1,  // 20: dht.pb.Message.Peer.connection:type_name -> dht.pb.Message.ConnectionType
+	12, // 21: dht.pb.Message.CIDToProviderMap.provider_peers:type_name -> dht.pb.Message.Peer
+	22, // [22:22] is the sub-list for method output_type
+	22, // [22:22] is the sub-list for method input_type
+	22, // [22:22] is the sub-list for extension type_name
+	22, // [22:22] is the sub-list for extension extendee
+	0,  // [0:22] is the sub-list for field type_name
 }
 
 func init() { file_msg_proto_init() }
@@ -845,7 +1716,7 @@ func file_msg_proto_init() {
 			}
 		}
 		file_msg_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PIR_Request); i {
+			switch v := v.(*PIR_Chunk); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -857,7 +1728,7 @@ func file_msg_proto_init() {
 			}
 		}
 		file_msg_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PIR_Response); i {
+			switch v := v.(*PIR_Request); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -869,7 +1740,7 @@ func file_msg_proto_init() {
 			}
 		}
 		file_msg_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Paillier_Public_Key); i {
+			switch v := v.(*PIR_Response); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -881,7 +1752,7 @@ func file_msg_proto_init() {
 			}
 		}
 		file_msg_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Message_Peer); i {
+			switch v := v.(*LWE_Hint); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -893,6 +1764,42 @@ func file_msg_proto_init() {
 			}
 		}
 		file_msg_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PIR_Error); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_msg_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Paillier_Public_Key); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_msg_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Message_Peer); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_msg_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*Message_CIDToProviderMap); i {
 			case 0:
 				return &v.state
@@ -905,7 +1812,7 @@ func file_msg_proto_init() {
 			}
 		}
 	}
-	file_msg_proto_msgTypes[1].OneofWrappers = []interface{}{
+	file_msg_proto_msgTypes[2].OneofWrappers = []interface{}{
 		(*PIR_Request_RLWEEvaluationKeys)(nil),
 		(*PIR_Request_Paillier_Public_Key)(nil),
 		(*PIR_Request_OtherKeys)(nil),
@@ -915,8 +1822,8 @@ func file_msg_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_msg_proto_rawDesc,
-			NumEnums:      2,
-			NumMessages:   6,
+			NumEnums:      5,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
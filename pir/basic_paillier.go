@@ -1,6 +1,7 @@
 package pir
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -85,6 +86,7 @@ func (paillierProtocol *BasicPaillier_PIR_Protocol) marshalRequestToPB() (*pb.PI
 	}
 	paillierPublicKey := marshalPaillierPublicKeyToBytes(paillierProtocol.public_key)
 	pirRequest := pb.PIR_Request{
+		Scheme:      Basic_Paillier,
 		Log2NumRows: int64(paillierProtocol.log2_num_rows),
 		SchemeDependent: &pb.PIR_Request_Paillier_Public_Key{
 			Paillier_Public_Key: paillierPublicKey,
@@ -106,6 +108,8 @@ func (paillierProtocol *BasicPaillier_PIR_Protocol) unmarshallRequestFromPB(req
 	switch schemeDependent := req.SchemeDependent.(type) {
 	case *pb.PIR_Request_Paillier_Public_Key:
 		paillierProtocol.public_key = unmarshalPaillierPublicKeyFromBytes(schemeDependent.Paillier_Public_Key)
+	default:
+		return fmt.Errorf("unmarshalling request from PB: need a Paillier public key, got %T", schemeDependent)
 	}
 
 	Nsq := paillierProtocol.public_key.Nsq
@@ -219,10 +223,14 @@ func (paillierProtocol *BasicPaillier_PIR_Protocol) unmarshallResponseFromPB(res
 	return nil
 }
 
-func (paillierProtocol *BasicPaillier_PIR_Protocol) ProcessRequestAndReturnResponse(request *pb.PIR_Request, database [][]byte) (*pb.PIR_Response, error) {
+func (paillierProtocol *BasicPaillier_PIR_Protocol) ProcessRequestAndReturnResponse(ctx context.Context, request *pb.PIR_Request, database [][]byte) (*pb.PIR_Response, error) {
 
 	// start := time.Now()
 
+	if request.GetScheme() != Basic_Paillier {
+		return nil, fmt.Errorf("%w: %q, expected %q", ErrUnsupportedScheme, request.GetScheme(), Basic_Paillier)
+	}
+
 	err := paillierProtocol.unmarshallRequestFromPB(request)
 	if err != nil {
 		return nil, err
@@ -271,6 +279,9 @@ func (paillierProtocol *BasicPaillier_PIR_Protocol) ProcessRequestAndReturnRespo
 			wg.Add(1)
 			go func(i, j int) {
 				defer wg.Done()
+				if ctx.Err() != nil {
+					return
+				}
 				encryptedMul := paillierProtocol.public_key.Mul(encrypted_query[i], paillierProtocol.plaintextDB[i][j])
 				mu.Lock()
 				defer mu.Unlock()
@@ -284,6 +295,9 @@ func (paillierProtocol *BasicPaillier_PIR_Protocol) ProcessRequestAndReturnRespo
 		}
 	}
 	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	response, err := paillierProtocol.marshalResponseToPB()
 	if err != nil {
@@ -1,6 +1,7 @@
 package pir
 
 import (
+	"context"
 	"math/big"
 	"math/rand"
 	"testing"
@@ -119,7 +120,7 @@ func TestBasicPIR_with_Paillier_ProcessRequestAndReturnResponse(t *testing.T) {
 			}
 		}
 
-		response, err = server_PIR_Protocol.ProcessRequestAndReturnResponse(pirRequest, db)
+		response, err = server_PIR_Protocol.ProcessRequestAndReturnResponse(context.Background(), pirRequest, db)
 		if err != nil {
 			t.Error("Error in processing request and returning response")
 		}
@@ -173,7 +174,7 @@ func BenchmarkBasicPIR_with_Paillier_ProcessRequestAndReturnResponse(b *testing.
 			}
 		}
 
-		response, err = server_PIR_Protocol.ProcessRequestAndReturnResponse(pirRequest, db)
+		response, err = server_PIR_Protocol.ProcessRequestAndReturnResponse(context.Background(), pirRequest, db)
 		if err != nil {
 			b.Errorf("Error: %v", err)
 			// return
@@ -1,6 +1,7 @@
 package pir
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -17,6 +18,9 @@ import (
 	"gonum.org/v1/gonum/stat"
 )
 
+// benchmarkWorkers is set if the servers of the benchmarks evaluate RLWE requests on a worker pool.
+var benchmarkWorkers *WorkerPool
+
 func getPaillierPIRRequestSize(req *pb.PIR_Request) int {
 	// TODO: there must be a better way!
 	total := len(req.Parameters)
@@ -47,6 +51,14 @@ func getRLWEPIRResponseSize(resp *pb.PIR_Response) int {
 	return len(resp.Ciphertexts)
 }
 
+func getLWEPIRRequestSize(req *pb.PIR_Request) int {
+	return len(req.EncryptedQuery) + len(req.HintEpoch)
+}
+
+func getLWEPIRResponseSize(resp *pb.PIR_Response) int {
+	return len(resp.Ciphertexts)
+}
+
 func TestE2E(t *testing.T) {
 	// ensures that all CPUs are used
 	fmt.Println(runtime.GOMAXPROCS(runtime.NumCPU() - 4))
@@ -71,7 +83,12 @@ func TestE2E(t *testing.T) {
 	}
 
 	b := testing.B{N: 1}
-	toParallelizeServerResponseComputation = true
+	benchmarkWorkers, err = NewWorkerPool(context.Background(), runtime.NumCPU())
+	require.NoError(t, err)
+	defer func() {
+		benchmarkWorkers.Close()
+		benchmarkWorkers = nil
+	}()
 	s.end_to_end_PIR(&b, log2_number_of_rows, log2_num_db_rows, mode_str, row_size)
 }
 
@@ -94,12 +111,19 @@ func (s *resultsStats) end_to_end_PIR(b *testing.B, log2_number_of_rows int, log
 	var client_PIR_Protocol PIR_Protocol
 	if mode == RLWE_All_Keys || mode == RLWE_Whispir_3_Keys || mode == RLWE_Whispir_2_Keys {
 		client_PIR_Protocol = NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+	} else if mode == LWE_SimplePIR {
+		client_PIR_Protocol = NewSimpleLWE_PIR_Protocol(log2_number_of_rows)
 	} else { // mode == Basic_Paillier
 		client_PIR_Protocol = NewBasicPaillier_PIR_Protocol(log2_number_of_rows)
 	}
 	err := client_PIR_Protocol.CreatePrivateKeyMaterial()
 	assert.NoError(b, err)
 
+	// the hint is downloaded once, offline, before the queries
+	if lweClient, ok := client_PIR_Protocol.(*SimpleLWE_PIR_Protocol); ok {
+		s.HintLen = s.offline_hint(b, lweClient, log2_number_of_rows, db)
+	}
+
 	// prepare requests
 	runs := s.Runs
 	ourResults := make([]*results, runs)
@@ -119,6 +143,22 @@ func (s *resultsStats) end_to_end_PIR(b *testing.B, log2_number_of_rows int, log
 
 }
 
+// offline_hint downloads the hint of the database for the client and returns its size.
+func (s *resultsStats) offline_hint(b *testing.B, client_PIR_Protocol *SimpleLWE_PIR_Protocol, log2_number_of_rows int, db [][]byte) int {
+	start_time := time.Now()
+	hintResponse, err := NewSimpleLWE_PIR_Protocol(log2_number_of_rows).ProcessRequestAndReturnResponse(context.Background(), client_PIR_Protocol.GenerateHintRequest(), db)
+	require.NoError(b, err)
+	s.HintRuntime = time.Since(start_time).Milliseconds()
+
+	err = client_PIR_Protocol.ProcessHintResponse(hintResponse)
+	require.NoError(b, err)
+
+	hintLen := len(hintResponse.GetLweHint().GetHint())
+	fmt.Println("- offline hint size B: ", hintLen)
+	fmt.Println("- offline hint server time (ms):", s.HintRuntime)
+	return hintLen
+}
+
 func (r *results) Client_PIR_Request(b *testing.B, client_PIR_Protocol PIR_Protocol, log2_number_of_rows int) *pb.PIR_Request {
 	number_of_rows := 1 << log2_number_of_rows
 
@@ -157,13 +197,19 @@ func (r *results) Server_PIR(b *testing.B, log2_number_of_rows int, mode string,
 
 	var server_PIR_Protocol PIR_Protocol
 	if mode == RLWE_All_Keys || mode == RLWE_Whispir_3_Keys || mode == RLWE_Whispir_2_Keys {
-		server_PIR_Protocol = NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		rlwe_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		if benchmarkWorkers != nil {
+			rlwe_PIR_Protocol.SetWorkerPool(benchmarkWorkers)
+		}
+		server_PIR_Protocol = rlwe_PIR_Protocol
+	} else if mode == LWE_SimplePIR {
+		server_PIR_Protocol = NewSimpleLWE_PIR_Protocol(log2_number_of_rows)
 	} else { // mode == Basic_Paillier
 		server_PIR_Protocol = NewBasicPaillier_PIR_Protocol(log2_number_of_rows)
 	}
 
 	start_time := time.Now()
-	response, err := server_PIR_Protocol.ProcessRequestAndReturnResponse(pirRequest, db)
+	response, err := server_PIR_Protocol.ProcessRequestAndReturnResponse(context.Background(), pirRequest, db)
 	assert.NoError(b, err)
 	elapsed := time.Since(start_time)
 	r.serverRuntime = elapsed.Milliseconds()
@@ -177,6 +223,9 @@ func (r *results) setReqResLen(mode string) {
 		// Lattigo library doesn't implement this trick yet
 		r.requestLen = getRLWEPIRRequestSize(r.pirRequest) / 2
 		r.responseLen = getRLWEPIRResponseSize(r.pirResponse)
+	} else if mode == LWE_SimplePIR {
+		r.requestLen = getLWEPIRRequestSize(r.pirRequest)
+		r.responseLen = getLWEPIRResponseSize(r.pirResponse)
 	} else { // mode == Basic_Paillier
 		r.requestLen = getPaillierPIRRequestSize(r.pirRequest)
 		r.responseLen = getPaillierPIRResponseSize(r.pirResponse)
@@ -192,7 +241,7 @@ func Benchmark_PIR_for_Routing_Table(b *testing.B) {
 	row_size := 20 * 81 // 81 is the size of a multiaddress, 20 multiaddress in each row
 
 	runs := 10 // b.N
-	modes := []string{Basic_Paillier, RLWE_All_Keys, RLWE_Whispir_2_Keys, RLWE_Whispir_3_Keys}
+	modes := []string{Basic_Paillier, RLWE_All_Keys, RLWE_Whispir_2_Keys, RLWE_Whispir_3_Keys, LWE_SimplePIR}
 	experimentName := "peerRouting-"
 	resultFiles := createResultsFiles(b, experimentName, modes)
 
@@ -344,6 +393,8 @@ func getMode(mode string) string {
 		return "RLWE_Whispir_3_Keys"
 	} else if mode == Basic_Paillier {
 		return "Basic_Paillier"
+	} else if mode == LWE_SimplePIR {
+		return "LWE_SimplePIR"
 	}
 	return ""
 }
@@ -416,4 +467,8 @@ type resultsStats struct {
 	ResLenMean          int     `csv:"ResLenMean(Bytes)"`
 	ServerRuntimeMean   float64 `csv:"ServerRuntimeMean(ms)"`
 	ServerRuntimeStddev float64 `csv:"ServerRuntimeStddev(ms)"`
+
+	// offline download of the hint, for schemes with a hint
+	HintLen     int   `csv:"HintLen(Bytes)"`
+	HintRuntime int64 `csv:"HintRuntime(ms)"`
 }
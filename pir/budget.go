@@ -0,0 +1,44 @@
+package pir
+
+import (
+	"errors"
+	"math"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+// ErrBudgetExceeded is returned when the estimated cost of processing a request exceeds the
+// per-request budget of the server, see [Registry.WithRequestBudget].
+var ErrBudgetExceeded = errors.New("PIR request exceeds the budget of the server")
+
+// CostEstimator is implemented by PIR_Protocols that can estimate the cost of processing a request
+// before processing it, so that a server can refuse expensive requests up front instead of spending
+// the computation. The cost is the approximate number of word operations on the ciphertexts and the
+// rows, so that the costs of different schemes are comparable. The request must not be modified.
+type CostEstimator interface {
+	EstimateCost(request *pb.PIR_Request, num_rows int, row_size int) (int64, error)
+}
+
+// mulCost returns the product of the factors, saturated at [math.MaxInt64], so that estimates for
+// huge requests don't overflow into small costs.
+func mulCost(factors ...int64) int64 {
+	cost := int64(1)
+	for _, f := range factors {
+		if f <= 0 {
+			return 0
+		}
+		if cost > math.MaxInt64/f {
+			return math.MaxInt64
+		}
+		cost *= f
+	}
+	return cost
+}
+
+// addCost returns the sum of the costs, saturated at [math.MaxInt64].
+func addCost(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
@@ -1,9 +1,13 @@
 package pir
 
-import "github.com/plprobelab/zikade/pb"
+import (
+	"context"
+
+	"github.com/plprobelab/zikade/pb"
+)
 
 type PIR_Protocol interface {
-	ProcessRequestAndReturnResponse(request *pb.PIR_Request, database [][]byte) (*pb.PIR_Response, error)
+	ProcessRequestAndReturnResponse(ctx context.Context, request *pb.PIR_Request, database [][]byte) (*pb.PIR_Response, error)
 	GenerateRequestFromQuery(int) (*pb.PIR_Request, error)
 	ProcessResponseToPlaintext(res *pb.PIR_Response) ([]byte, error)
 
@@ -13,3 +17,57 @@ type PIR_Protocol interface {
 	marshalResponseToPB() (*pb.PIR_Response, error)
 	unmarshallResponseFromPB(res *pb.PIR_Response) error
 }
+
+// EncodedDatabase is a database that was encoded by a [DatabaseEncoder] into the form that
+// requests are processed over. It is safe to process multiple requests over it concurrently.
+type EncodedDatabase interface {
+	NumRows() int
+}
+
+// DatabaseEncoder is implemented by PIR_Protocols that can encode a database ahead of time,
+// such that a server only has to do the homomorphic operations for each request that it
+// processes over the encoded database, instead of encoding the database for every request.
+type DatabaseEncoder interface {
+	EncodeDatabase(database [][]byte) (EncodedDatabase, error)
+	ProcessRequestOverEncodedDatabase(ctx context.Context, request *pb.PIR_Request, database EncodedDatabase) (*pb.PIR_Response, error)
+}
+
+// IncrementalDatabaseEncoder is implemented by DatabaseEncoders that can update the encoding of
+// a database when only some of its rows changed, instead of encoding the whole database again.
+type IncrementalDatabaseEncoder interface {
+	DatabaseEncoder
+	UpdateEncodedDatabase(encoded EncodedDatabase, database [][]byte, changedRows []int) (EncodedDatabase, error)
+}
+
+// BatchPIR_Protocol is implemented by PIR_Protocols that can retrieve multiple rows with a single
+// request. A server processes batch requests with ProcessRequestAndReturnResponse, like any other.
+type BatchPIR_Protocol interface {
+	PIR_Protocol
+	GenerateRequestFromQueries(requested_rows []int) (*pb.PIR_Request, error)
+	ProcessBatchResponseToPlaintexts(res *pb.PIR_Response) ([][]byte, error)
+}
+
+// TwoServerPIR_Protocol is implemented by PIR_Protocols that split each query between two servers,
+// which hold the same database and are assumed not to collude. Each server processes its request with
+// ProcessRequestAndReturnResponse, like any other.
+type TwoServerPIR_Protocol interface {
+	PIR_Protocol
+	GenerateRequestsFromQuery(requested_row int) (*pb.PIR_Request, *pb.PIR_Request, error)
+	ProcessResponsesToPlaintext(res0 *pb.PIR_Response, res1 *pb.PIR_Response) ([]byte, error)
+}
+
+// ConcurrentPIR_Protocol is implemented by PIR_Protocols that can spread the evaluation of a request over
+// the workers of a [WorkerPool]. [Registry.ProtocolForRequest] sets the pool of its registry, if any.
+type ConcurrentPIR_Protocol interface {
+	PIR_Protocol
+	SetWorkerPool(workers *WorkerPool)
+}
+
+// ParameterizedPIR_Protocol is implemented by PIR_Protocols whose clients choose the parameters of their requests
+// from a fixed list of parameter sets, and name the parameter set in the request. [Registry.ProtocolForRequest]
+// configures the instance with the parameter set of the request.
+type ParameterizedPIR_Protocol interface {
+	PIR_Protocol
+	SetParameterSet(name string) error
+	ParameterSet() string
+}
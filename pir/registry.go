@@ -0,0 +1,143 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+// ErrUnsupportedScheme is returned when a PIR request was generated with a scheme
+// that is not registered with the [Registry] that is used to process it.
+var ErrUnsupportedScheme = errors.New("unsupported PIR scheme")
+
+// NewProtocolFunc returns a new instance of a PIR_Protocol, that is used by a server
+// to process a request over a database of 2^log2_num_rows rows.
+type NewProtocolFunc func(log2_num_rows int) PIR_Protocol
+
+// Registry maps the identifiers of PIR schemes, as carried in the Scheme field of a
+// PIR request, to the PIR_Protocol implementations that a server uses to process them.
+// A Registry must not be modified once it is used to process requests.
+type Registry struct {
+	protocols map[string]NewProtocolFunc
+
+	// workers is set on the instances of [ConcurrentPIR_Protocol]s, see [Registry.WithWorkerPool]
+	workers *WorkerPool
+
+	// budget is the largest estimated cost of a request, see [Registry.WithRequestBudget]
+	budget int64
+}
+
+// NewRegistry returns an empty [Registry].
+func NewRegistry() *Registry {
+	return &Registry{
+		protocols: make(map[string]NewProtocolFunc),
+	}
+}
+
+// NewDefaultRegistry returns a [Registry] with all RLWE modes registered.
+// [DPF_TwoServer], [Basic_Paillier] and [LWE_SimplePIR] can be registered in
+// addition with [Registry.Register]. [DPF_TwoServer] isn't registered by
+// default, as private lookups don't send two-server requests.
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, mode := range []string{RLWE_All_Keys, RLWE_Whispir_3_Keys, RLWE_Whispir_2_Keys} {
+		mode := mode
+		r.Register(mode, func(log2_num_rows int) PIR_Protocol {
+			protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_num_rows, mode)
+			if protocol == nil {
+				return nil
+			}
+			return protocol
+		})
+	}
+	return r
+}
+
+// Register registers the constructor of the PIR_Protocol that processes requests of
+// the given scheme, replacing any constructor registered for it before.
+func (r *Registry) Register(scheme string, fn NewProtocolFunc) {
+	r.protocols[scheme] = fn
+}
+
+// WithWorkerPool returns a copy of the registry whose PIR_Protocols evaluate requests on the workers
+// of the pool, if they implement [ConcurrentPIR_Protocol]. The copy shares the registered schemes with
+// the registry, which is left unchanged, so that a registry can be shared by servers with different pools.
+func (r *Registry) WithWorkerPool(workers *WorkerPool) *Registry {
+	copied := *r
+	copied.workers = workers
+	return &copied
+}
+
+// WithRequestBudget returns a copy of the registry that refuses requests whose estimated cost exceeds
+// the budget, see [Registry.CheckBudget]. A budget of 0 doesn't limit the cost of requests. Like
+// [Registry.WithWorkerPool], the copy shares the registered schemes with the registry.
+func (r *Registry) WithRequestBudget(budget int64) *Registry {
+	copied := *r
+	copied.budget = budget
+	return &copied
+}
+
+// CheckBudget returns an error wrapping [ErrBudgetExceeded] if the estimated cost of processing the
+// request with the protocol over num_rows rows of at most row_size bytes exceeds the budget of the
+// registry. Requests for protocols that don't implement [CostEstimator] are not limited.
+func (r *Registry) CheckBudget(protocol PIR_Protocol, req *pb.PIR_Request, num_rows int, row_size int) error {
+	estimator, ok := protocol.(CostEstimator)
+	if !ok || r.budget <= 0 {
+		return nil
+	}
+
+	cost, err := estimator.EstimateCost(req, num_rows, row_size)
+	if err != nil {
+		return fmt.Errorf("estimate cost of PIR request: %w", err)
+	}
+	if cost > r.budget {
+		return fmt.Errorf("%w: estimated cost %d, budget %d", ErrBudgetExceeded, cost, r.budget)
+	}
+	return nil
+}
+
+// Supports returns true if a PIR_Protocol is registered for the given scheme.
+func (r *Registry) Supports(scheme string) bool {
+	_, ok := r.protocols[scheme]
+	return ok
+}
+
+// Schemes returns the sorted identifiers of all registered schemes.
+func (r *Registry) Schemes() []string {
+	schemes := make([]string, 0, len(r.protocols))
+	for scheme := range r.protocols {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// ProtocolForRequest returns a new instance of the PIR_Protocol registered for the
+// scheme of the request. If no PIR_Protocol is registered for it, the returned error
+// wraps [ErrUnsupportedScheme]. If the instance doesn't support the parameter set of
+// the request, the returned error wraps [ErrUnsupportedParameterSet].
+func (r *Registry) ProtocolForRequest(req *pb.PIR_Request, log2_num_rows int) (PIR_Protocol, error) {
+	fn, ok := r.protocols[req.GetScheme()]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedScheme, req.GetScheme())
+	}
+
+	protocol := fn(log2_num_rows)
+	if protocol == nil {
+		return nil, fmt.Errorf("could not instantiate PIR scheme %q", req.GetScheme())
+	}
+
+	if parameterized, ok := protocol.(ParameterizedPIR_Protocol); ok {
+		if err := parameterized.SetParameterSet(req.GetParameterSet()); err != nil {
+			return nil, err
+		}
+	}
+
+	if concurrent, ok := protocol.(ConcurrentPIR_Protocol); ok && r.workers != nil {
+		concurrent.SetWorkerPool(r.workers)
+	}
+
+	return protocol, nil
+}
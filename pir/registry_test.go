@@ -0,0 +1,96 @@
+package pir
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+func TestRegistry_ProtocolForRequest(t *testing.T) {
+	r := NewDefaultRegistry()
+	assert.Equal(t, []string{RLWE_All_Keys, RLWE_Whispir_2_Keys, RLWE_Whispir_3_Keys}, r.Schemes())
+	assert.False(t, r.Supports(Basic_Paillier))
+	assert.False(t, r.Supports(DPF_TwoServer))
+
+	for _, scheme := range r.Schemes() {
+		protocol, err := r.ProtocolForRequest(&pb.PIR_Request{Scheme: scheme}, 4)
+		require.NoError(t, err)
+		if scheme == DPF_TwoServer {
+			assert.IsType(t, &DPF_TwoServer_PIR_Protocol{}, protocol)
+		} else {
+			assert.Equal(t, scheme, protocol.(*SimpleRLWE_PIR_Protocol).mode)
+		}
+	}
+
+	_, err := r.ProtocolForRequest(&pb.PIR_Request{Scheme: Basic_Paillier}, 4)
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+
+	_, err = r.ProtocolForRequest(&pb.PIR_Request{}, 4)
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+
+	r.Register(Basic_Paillier, func(log2_num_rows int) PIR_Protocol {
+		return INSECURE_NewBasicPaillier_PIR_Protocol_INSECURE(log2_num_rows)
+	})
+	assert.True(t, r.Supports(Basic_Paillier))
+}
+
+func TestRegistry_WithWorkerPool(t *testing.T) {
+	workers, err := NewWorkerPool(context.Background(), 2)
+	require.NoError(t, err)
+	defer workers.Close()
+
+	r := NewDefaultRegistry()
+	withWorkers := r.WithWorkerPool(workers)
+	assert.Equal(t, r.Schemes(), withWorkers.Schemes())
+
+	protocol, err := withWorkers.ProtocolForRequest(&pb.PIR_Request{Scheme: RLWE_Whispir_3_Keys}, 4)
+	require.NoError(t, err)
+	assert.Same(t, workers, protocol.(*SimpleRLWE_PIR_Protocol).workers)
+
+	// the registry that the copy was made of is left unchanged
+	protocol, err = r.ProtocolForRequest(&pb.PIR_Request{Scheme: RLWE_Whispir_3_Keys}, 4)
+	require.NoError(t, err)
+	assert.Nil(t, protocol.(*SimpleRLWE_PIR_Protocol).workers)
+}
+
+func TestSimpleRLWE_scheme_mismatch(t *testing.T) {
+	client := NewSimpleRLWE_PIR_Protocol_mode(4, RLWE_Whispir_3_Keys)
+	req, err := client.GenerateRequestFromQuery(1)
+	require.NoError(t, err)
+	assert.Equal(t, RLWE_Whispir_3_Keys, req.GetScheme())
+
+	server := NewSimpleRLWE_PIR_Protocol_mode(4, RLWE_Whispir_2_Keys)
+	_, err = server.ProcessRequestAndReturnResponse(context.Background(), req, make([][]byte, 16))
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+}
+
+func TestRegistry_WithRequestBudget(t *testing.T) {
+	r := NewDefaultRegistry()
+	protocol, err := r.ProtocolForRequest(&pb.PIR_Request{Scheme: RLWE_Whispir_3_Keys}, 8)
+	require.NoError(t, err)
+
+	req := &pb.PIR_Request{Scheme: RLWE_Whispir_3_Keys}
+	cost, err := protocol.(CostEstimator).EstimateCost(req, 256, 2000)
+	require.NoError(t, err)
+	assert.Positive(t, cost)
+
+	// batch requests and larger rows cost more
+	batchCost, err := protocol.(CostEstimator).EstimateCost(&pb.PIR_Request{BatchEncryptedQueries: make([][]byte, 3)}, 256, 2000)
+	require.NoError(t, err)
+	assert.Equal(t, 3*cost, batchCost)
+	largerCost, err := protocol.(CostEstimator).EstimateCost(req, 256, 20000)
+	require.NoError(t, err)
+	assert.Greater(t, largerCost, cost)
+
+	assert.NoError(t, r.CheckBudget(protocol, req, 256, 2000))
+	assert.NoError(t, r.WithRequestBudget(cost).CheckBudget(protocol, req, 256, 2000))
+	assert.ErrorIs(t, r.WithRequestBudget(cost-1).CheckBudget(protocol, req, 256, 2000), ErrBudgetExceeded)
+
+	// protocols that don't estimate their cost aren't limited
+	paillier := INSECURE_NewBasicPaillier_PIR_Protocol_INSECURE(8)
+	assert.NoError(t, r.WithRequestBudget(1).CheckBudget(paillier, req, 256, 2000))
+}
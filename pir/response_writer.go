@@ -0,0 +1,40 @@
+package pir
+
+import (
+	"context"
+	"encoding/binary"
+)
+
+// ResponseWriter receives the ciphertexts of a response while the server computes them, so that the server
+// can send each ciphertext to the client as soon as it is done instead of holding the whole response in
+// memory until the last one is done. See [WithResponseWriter].
+type ResponseWriter interface {
+	// WriteCiphertexts writes the next bytes of the ciphertexts field of the response. The bytes of all
+	// calls make up the ciphertexts field in order.
+	WriteCiphertexts(p []byte) error
+}
+
+// responseWriterKey is the key of the ResponseWriter in the context that a request is processed with.
+type responseWriterKey struct{}
+
+// WithResponseWriter returns a context that makes PIR_Protocols which support it write the ciphertexts of
+// their response to w while they compute them. The ciphertexts field of the response that they return is then
+// left empty. Protocols that don't support it, and responses to batch requests, ignore w and return their
+// ciphertexts as usual.
+func WithResponseWriter(ctx context.Context, w ResponseWriter) context.Context {
+	return context.WithValue(ctx, responseWriterKey{}, w)
+}
+
+// responseWriterFrom returns the ResponseWriter of the context, or nil if it has none.
+func responseWriterFrom(ctx context.Context) ResponseWriter {
+	w, _ := ctx.Value(responseWriterKey{}).(ResponseWriter)
+	return w
+}
+
+// writeVectorLength writes the length that precedes the elements of a marshalled lattigo structs.Vector, so that the
+// elements can be written one after another as they are computed.
+func writeVectorLength(w ResponseWriter, length int) error {
+	p := make([]byte, 8)
+	binary.LittleEndian.PutUint64(p, uint64(length))
+	return w.WriteCiphertexts(p)
+}
@@ -0,0 +1,94 @@
+package pir
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+// collectingWriter collects the ciphertexts that are written to it, one entry per write.
+type collectingWriter struct {
+	writes [][]byte
+}
+
+func (w *collectingWriter) WriteCiphertexts(p []byte) error {
+	w.writes = append(w.writes, append([]byte(nil), p...))
+	return nil
+}
+
+func (w *collectingWriter) ciphertexts() []byte {
+	var ciphertexts []byte
+	for _, p := range w.writes {
+		ciphertexts = append(ciphertexts, p...)
+	}
+	return ciphertexts
+}
+
+func TestSimpleRLWE_WithResponseWriter(t *testing.T) {
+	log2_number_of_rows := 4
+	mode := RLWE_Whispir_3_Keys
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	// rows of three response ciphertexts
+	db := randomDatabase(seed, 1<<log2_number_of_rows, 3*4096)
+	encoded, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).EncodeDatabase(db)
+	require.NoError(t, err)
+
+	workers, err := NewWorkerPool(context.Background(), 2)
+	require.NoError(t, err)
+	defer workers.Close()
+
+	for _, num_dimensions := range []int{1, 2} {
+		for _, pool := range []*WorkerPool{nil, workers} {
+			client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_recursive(log2_number_of_rows, mode, num_dimensions)
+			require.NotNil(t, client_PIR_Protocol)
+			pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(5)
+			require.NoError(t, err)
+
+			server_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+			if pool != nil {
+				server_PIR_Protocol.SetWorkerPool(pool)
+			}
+
+			w := &collectingWriter{}
+			response, err := server_PIR_Protocol.ProcessRequestOverEncodedDatabase(WithResponseWriter(context.Background(), w), pirRequest, encoded)
+			require.NoError(t, err)
+
+			// the ciphertexts are written one after another instead of being returned
+			assert.Empty(t, response.GetCiphertexts())
+			assert.Greater(t, len(w.writes), 3)
+
+			response_bytes, err := client_PIR_Protocol.ProcessResponseToPlaintext(&pb.PIR_Response{Ciphertexts: w.ciphertexts()})
+			require.NoError(t, err)
+			require.Equal(t, db[5], response_bytes[:len(db[5])])
+		}
+	}
+}
+
+func TestSimpleRLWE_WithResponseWriter_batch(t *testing.T) {
+	log2_number_of_rows := 4
+	mode := RLWE_Whispir_3_Keys
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	db := randomDatabase(seed, 1<<log2_number_of_rows, 256)
+	encoded, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).EncodeDatabase(db)
+	require.NoError(t, err)
+
+	client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+	require.NoError(t, client_PIR_Protocol.CreatePrivateKeyMaterial())
+	pirRequest, err := client_PIR_Protocol.GenerateRequestFromQueries([]int{1, 2})
+	require.NoError(t, err)
+
+	// the ciphertexts of batch requests are returned as usual
+	w := &collectingWriter{}
+	response, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).ProcessRequestOverEncodedDatabase(WithResponseWriter(context.Background(), w), pirRequest, encoded)
+	require.NoError(t, err)
+	assert.Empty(t, w.writes)
+	assert.Len(t, response.GetBatchCiphertexts(), 2)
+}
@@ -0,0 +1,356 @@
+package pir
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+// LWE_SimplePIR is the identifier of the [SimpleLWE_PIR_Protocol] scheme.
+const LWE_SimplePIR = "LWE_SimplePIR"
+
+// ErrStaleHint is returned when a query was generated with the hint of another epoch of the
+// database than the one that the server holds. The client should download the hint again.
+var ErrStaleHint = errors.New("stale PIR hint")
+
+// SimpleLWE_PIR_Protocol implements the SimplePIR scheme (Henzinger et al., USENIX Security '23),
+// which is based on plain LWE. The database is arranged as a matrix D with one column per row of
+// the database, holding one byte of the row per element. The server publishes the hint H = D·A,
+// where A is a public random matrix derived from a seed. A client downloads the hint once per
+// epoch of the database with a request from [SimpleLWE_PIR_Protocol.GenerateHintRequest]. After
+// that, a query for row j is the LWE encryption A·s + e + Δ·u_j of the j-th unit vector, and the
+// server answers it with a single matrix-vector product of D and the query. The client removes
+// H·s from the answer and rounds off the noise to recover the row.
+//
+// Queries and answers are small and cheap to compute, but the hint takes 4 KiB per byte of a row.
+// Any change of the database starts a new epoch, in which queries that were generated with the
+// hint of a previous epoch are answered with an [ErrStaleHint].
+type SimpleLWE_PIR_Protocol struct {
+	PIR_Protocol
+
+	log2_num_rows int
+
+	// client: the hint of the database and the secret of the last query
+	hint   *lweHint
+	secret []uint32
+
+	// the query of the request, which is empty for requests for the hint
+	query []uint32
+
+	// server: the epoch of the hint that the query was generated with
+	hint_epoch []byte
+
+	// the answer to the query or the hint, for responses to requests for the hint
+	answer        []uint32
+	response_hint *lweHint
+}
+
+var (
+	_ IncrementalDatabaseEncoder = (*SimpleLWE_PIR_Protocol)(nil)
+	_ CostEstimator              = (*SimpleLWE_PIR_Protocol)(nil)
+)
+
+// lweHint holds the hint of an epoch of the database, along with the seed of the public matrix.
+type lweHint struct {
+	seed       []byte
+	epoch      []byte
+	row_length int
+	hint       []uint32 // row_length x lweSecretDimension
+}
+
+// NewSimpleLWE_PIR_Protocol returns a new instance of the SimplePIR scheme for a database of
+// 2^log2_num_rows rows.
+func NewSimpleLWE_PIR_Protocol(log2_num_rows int) *SimpleLWE_PIR_Protocol {
+	return &SimpleLWE_PIR_Protocol{
+		log2_num_rows: log2_num_rows,
+	}
+}
+
+// CreatePrivateKeyMaterial samples a fresh LWE secret. The secret must not be reused for another
+// query, as the public matrix stays the same, so [SimpleLWE_PIR_Protocol.GenerateRequestFromQuery]
+// samples a fresh secret for every query anyway.
+func (lweStruct *SimpleLWE_PIR_Protocol) CreatePrivateKeyMaterial() error {
+	secret, err := sampleUniformVector(lweSecretDimension)
+	if err != nil {
+		return err
+	}
+	lweStruct.secret = secret
+	return nil
+}
+
+// GenerateHintRequest generates a request for the hint of the database, which needs to be
+// processed with [SimpleLWE_PIR_Protocol.ProcessHintResponse] before any query is generated.
+func (lweStruct *SimpleLWE_PIR_Protocol) GenerateHintRequest() *pb.PIR_Request {
+	return &pb.PIR_Request{
+		Scheme:      LWE_SimplePIR,
+		Log2NumRows: int64(lweStruct.log2_num_rows),
+	}
+}
+
+// ProcessHintResponse stores the hint of the database from the response to a request from
+// [SimpleLWE_PIR_Protocol.GenerateHintRequest].
+func (lweStruct *SimpleLWE_PIR_Protocol) ProcessHintResponse(res *pb.PIR_Response) error {
+	h := res.GetLweHint()
+	if h == nil {
+		return fmt.Errorf("response does not carry a hint")
+	}
+
+	row_length := int(h.GetRowLength())
+	if row_length <= 0 || len(h.GetSeed()) != lweSeedLength || len(h.GetEpoch()) == 0 {
+		return fmt.Errorf("malformed hint")
+	}
+
+	hint, err := bytesToUint32s(h.GetHint(), row_length*lweSecretDimension)
+	if err != nil {
+		return fmt.Errorf("malformed hint: %w", err)
+	}
+
+	lweStruct.hint = &lweHint{
+		seed:       h.GetSeed(),
+		epoch:      h.GetEpoch(),
+		row_length: row_length,
+		hint:       hint,
+	}
+	return nil
+}
+
+// HintEpoch returns the epoch of the hint that queries are generated with, or nil if the hint
+// wasn't downloaded yet.
+func (lweStruct *SimpleLWE_PIR_Protocol) HintEpoch() []byte {
+	if lweStruct.hint == nil {
+		return nil
+	}
+	return lweStruct.hint.epoch
+}
+
+func (lweStruct *SimpleLWE_PIR_Protocol) GenerateRequestFromQuery(requested_row int) (*pb.PIR_Request, error) {
+	if lweStruct.hint == nil {
+		return nil, fmt.Errorf("the hint of the database must be downloaded before generating a query")
+	}
+
+	num_rows := 1 << lweStruct.log2_num_rows
+	if requested_row < 0 || requested_row >= num_rows {
+		return nil, fmt.Errorf("requested row %d is out of range of 2^%d rows", requested_row, lweStruct.log2_num_rows)
+	}
+
+	err := lweStruct.CreatePrivateKeyMaterial()
+	if err != nil {
+		return nil, err
+	}
+
+	noise, err := sampleErrorVector(num_rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// query = A·s + e + Δ·u_j
+	a, err := newPublicMatrix(lweStruct.hint.seed)
+	if err != nil {
+		return nil, err
+	}
+	query := make([]uint32, num_rows)
+	a_row := make([]uint32, lweSecretDimension)
+	for j := range query {
+		a.next(a_row)
+		query[j] = dot(a_row, lweStruct.secret) + noise[j]
+	}
+	query[requested_row] += 1 << lweLog2Delta
+
+	lweStruct.query = query
+	lweStruct.hint_epoch = lweStruct.hint.epoch
+
+	return lweStruct.marshalRequestToPB()
+}
+
+func (lweStruct *SimpleLWE_PIR_Protocol) ProcessResponseToPlaintext(res *pb.PIR_Response) ([]byte, error) {
+	if lweStruct.hint == nil || lweStruct.secret == nil {
+		return nil, fmt.Errorf("no query was generated that the response could answer")
+	}
+
+	err := lweStruct.unmarshallResponseFromPB(res)
+	if err != nil {
+		return nil, err
+	}
+	if len(lweStruct.answer) != lweStruct.hint.row_length {
+		return nil, fmt.Errorf("answer has %d elements, expected %d", len(lweStruct.answer), lweStruct.hint.row_length)
+	}
+
+	// answer - H·s = Δ·D·u_j + D·e, which rounds to the j-th column of D
+	row := make([]byte, lweStruct.hint.row_length)
+	for k := range row {
+		hint_row := lweStruct.hint.hint[k*lweSecretDimension : (k+1)*lweSecretDimension]
+		noisy := lweStruct.answer[k] - dot(hint_row, lweStruct.secret)
+		row[k] = byte((noisy + 1<<(lweLog2Delta-1)) >> lweLog2Delta)
+	}
+
+	return row, nil
+}
+
+func (lweStruct *SimpleLWE_PIR_Protocol) marshalRequestToPB() (*pb.PIR_Request, error) {
+	return &pb.PIR_Request{
+		Scheme:         LWE_SimplePIR,
+		Log2NumRows:    int64(lweStruct.log2_num_rows),
+		EncryptedQuery: uint32sToBytes(lweStruct.query),
+		HintEpoch:      lweStruct.hint_epoch,
+	}, nil
+}
+
+func (lweStruct *SimpleLWE_PIR_Protocol) unmarshallRequestFromPB(req *pb.PIR_Request) error {
+	lweStruct.log2_num_rows = int(req.GetLog2NumRows())
+	if lweStruct.log2_num_rows < 0 || lweStruct.log2_num_rows > lweMaxLog2NumRows {
+		return fmt.Errorf("number of rows must be between 2^0 and 2^%d, got 2^%d", lweMaxLog2NumRows, lweStruct.log2_num_rows)
+	}
+
+	// a request without a query asks for the hint
+	lweStruct.query = nil
+	lweStruct.hint_epoch = nil
+	if len(req.GetEncryptedQuery()) == 0 {
+		return nil
+	}
+
+	query, err := bytesToUint32s(req.GetEncryptedQuery(), 1<<lweStruct.log2_num_rows)
+	if err != nil {
+		return fmt.Errorf("malformed query: %w", err)
+	}
+	lweStruct.query = query
+	lweStruct.hint_epoch = req.GetHintEpoch()
+
+	return nil
+}
+
+func (lweStruct *SimpleLWE_PIR_Protocol) marshalResponseToPB() (*pb.PIR_Response, error) {
+	if lweStruct.response_hint != nil {
+		return &pb.PIR_Response{
+			LweHint: &pb.LWE_Hint{
+				Seed:      lweStruct.response_hint.seed,
+				Epoch:     lweStruct.response_hint.epoch,
+				RowLength: int64(lweStruct.response_hint.row_length),
+				Hint:      uint32sToBytes(lweStruct.response_hint.hint),
+			},
+		}, nil
+	}
+
+	return &pb.PIR_Response{Ciphertexts: uint32sToBytes(lweStruct.answer)}, nil
+}
+
+func (lweStruct *SimpleLWE_PIR_Protocol) unmarshallResponseFromPB(res *pb.PIR_Response) error {
+	if len(res.GetCiphertexts())%4 != 0 {
+		return fmt.Errorf("malformed answer of %d bytes", len(res.GetCiphertexts()))
+	}
+
+	answer, err := bytesToUint32s(res.GetCiphertexts(), len(res.GetCiphertexts())/4)
+	if err != nil {
+		return err
+	}
+	lweStruct.answer = answer
+	return nil
+}
+
+func (lweStruct *SimpleLWE_PIR_Protocol) ProcessRequestAndReturnResponse(ctx context.Context, request *pb.PIR_Request, database [][]byte) (*pb.PIR_Response, error) {
+	encoded, err := lweStruct.EncodeDatabase(database)
+	if err != nil {
+		return nil, err
+	}
+
+	return lweStruct.ProcessRequestOverEncodedDatabase(ctx, request, encoded)
+}
+
+// EncodeDatabase prepares the database for answering queries. The seed of the public matrix and
+// the epoch are derived from the rows, so that encoding the same rows again results in the same
+// epoch. The hint is only computed once the first request for it is processed. The rows must not
+// be modified afterwards.
+func (lweStruct *SimpleLWE_PIR_Protocol) EncodeDatabase(database [][]byte) (EncodedDatabase, error) {
+	if len(database) == 0 {
+		return nil, fmt.Errorf("cannot encode an empty database")
+	}
+
+	digest := databaseDigest(database)
+	return newLWEEncodedDatabase(database, digest[:], digest), nil
+}
+
+// ProcessRequestOverEncodedDatabase answers the query of the request, or responds with the hint
+// of the database if the request doesn't carry a query.
+func (lweStruct *SimpleLWE_PIR_Protocol) ProcessRequestOverEncodedDatabase(ctx context.Context, request *pb.PIR_Request, database EncodedDatabase) (*pb.PIR_Response, error) {
+	encoded, ok := database.(*lweEncodedDatabase)
+	if !ok {
+		return nil, fmt.Errorf("database was not encoded for an LWE scheme, got %T", database)
+	}
+
+	if request.GetScheme() != LWE_SimplePIR {
+		return nil, fmt.Errorf("%w: %q, expected %q", ErrUnsupportedScheme, request.GetScheme(), LWE_SimplePIR)
+	}
+
+	err := lweStruct.unmarshallRequestFromPB(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(encoded.rows) > 1<<lweStruct.log2_num_rows {
+		return nil, fmt.Errorf("initialize this struct with log2_num_rows as greater than or equal to the log of the number of rows in the DB")
+	}
+
+	lweStruct.answer = nil
+	lweStruct.response_hint = nil
+
+	if lweStruct.query == nil {
+		lweStruct.response_hint, err = encoded.getHint()
+		if err != nil {
+			return nil, err
+		}
+		return lweStruct.marshalResponseToPB()
+	}
+
+	if !bytes.Equal(lweStruct.hint_epoch, encoded.epoch) {
+		return nil, fmt.Errorf("%w: the database is of epoch %x", ErrStaleHint, encoded.epoch)
+	}
+
+	// answer = D·query, where the rows of the database are the columns of D
+	answer := make([]uint32, encoded.row_length)
+	for j, row := range encoded.rows {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		q := lweStruct.query[j]
+		for k, b := range row {
+			answer[k] += uint32(b) * q
+		}
+	}
+	lweStruct.answer = answer
+
+	return lweStruct.marshalResponseToPB()
+}
+
+// EstimateCost estimates the cost of processing the request over num_rows rows of at most row_size
+// bytes, which is a multiplication of each byte of the database with the query.
+func (lweStruct *SimpleLWE_PIR_Protocol) EstimateCost(request *pb.PIR_Request, num_rows int, row_size int) (int64, error) {
+	return mulCost(int64(num_rows), int64(row_size)), nil
+}
+
+// uint32sToBytes encodes the values as little-endian uint32s.
+func uint32sToBytes(values []uint32) []byte {
+	if values == nil {
+		return nil
+	}
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+// bytesToUint32s decodes the given number of little-endian uint32s.
+func bytesToUint32s(b []byte, count int) ([]uint32, error) {
+	if len(b) != 4*count {
+		return nil, fmt.Errorf("expected %d bytes, got %d", 4*count, len(b))
+	}
+	values := make([]uint32, count)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return values, nil
+}
@@ -0,0 +1,291 @@
+package pir
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+)
+
+const (
+	// lweSecretDimension is the dimension n of the LWE secret. Together with the modulus q = 2^32
+	// and the error distribution, it gives 128 bits of security (see the SimplePIR paper).
+	lweSecretDimension = 1024
+
+	// lweLog2Delta is the log of the scaling factor Δ = q/p of the plaintexts, for the modulus
+	// q = 2^32 and the plaintext modulus p = 2^8, such that each byte of a row is one plaintext.
+	lweLog2Delta = 24
+
+	// lweErrorStddev is the standard deviation of the discrete Gaussian errors of the queries.
+	lweErrorStddev = 6.4
+
+	// lweSeedLength is the length in bytes of the seed of the public matrix.
+	lweSeedLength = 32
+
+	// lweEpochLength is the length in bytes of the identifier of an epoch of the database.
+	lweEpochLength = 16
+
+	// lweMaxLog2NumRows bounds the number of rows, such that the noise of an answer can be rounded off.
+	lweMaxLog2NumRows = 20
+)
+
+// lweEncodedDatabase is a database that was prepared by [SimpleLWE_PIR_Protocol.EncodeDatabase].
+type lweEncodedDatabase struct {
+	rows       [][]byte
+	row_length int
+	seed       []byte
+	epoch      []byte
+
+	// hint is computed on first use, guarded by hintMu
+	hintMu sync.Mutex
+	hint   *lweHint
+}
+
+func (db *lweEncodedDatabase) NumRows() int {
+	return len(db.rows)
+}
+
+// newLWEEncodedDatabase returns the encoded database of the rows, whose epoch is derived from the
+// seed and the digest of the rows.
+func newLWEEncodedDatabase(rows [][]byte, seed []byte, digest [sha256.Size]byte) *lweEncodedDatabase {
+	epoch := sha256.Sum256(append(append([]byte{}, seed...), digest[:]...))
+	return &lweEncodedDatabase{
+		rows:       rows,
+		row_length: maxLengthDBRows(rows),
+		seed:       seed,
+		epoch:      epoch[:lweEpochLength],
+	}
+}
+
+// getHint returns the hint of the database, computing it on first use.
+func (db *lweEncodedDatabase) getHint() (*lweHint, error) {
+	db.hintMu.Lock()
+	defer db.hintMu.Unlock()
+
+	if db.hint == nil {
+		hint, err := db.computeHint()
+		if err != nil {
+			return nil, err
+		}
+		db.hint = hint
+	}
+	return db.hint, nil
+}
+
+// computedHint returns the hint of the database, or nil if it wasn't computed yet.
+func (db *lweEncodedDatabase) computedHint() *lweHint {
+	db.hintMu.Lock()
+	defer db.hintMu.Unlock()
+
+	return db.hint
+}
+
+// computeHint computes the hint H = D·A, where the rows of the database are the columns of D.
+func (db *lweEncodedDatabase) computeHint() (*lweHint, error) {
+	a, err := newPublicMatrix(db.seed)
+	if err != nil {
+		return nil, err
+	}
+
+	hint := make([]uint32, db.row_length*lweSecretDimension)
+	a_row := make([]uint32, lweSecretDimension)
+	for _, row := range db.rows {
+		a.next(a_row)
+		addScaledRow(hint, row, a_row, 1)
+	}
+
+	return &lweHint{
+		seed:       db.seed,
+		epoch:      db.epoch,
+		row_length: db.row_length,
+		hint:       hint,
+	}, nil
+}
+
+// UpdateEncodedDatabase returns the encoding of the database, which differs from the database that
+// was encoded into encoded only in the given rows. The seed of the public matrix is kept, such that
+// the hint of the new epoch is updated with the changed rows only, if the hint was computed before.
+// The database is encoded again if the length of its rows changed.
+func (lweStruct *SimpleLWE_PIR_Protocol) UpdateEncodedDatabase(encoded EncodedDatabase, database [][]byte, changedRows []int) (EncodedDatabase, error) {
+	previous, ok := encoded.(*lweEncodedDatabase)
+	if !ok || len(previous.rows) != len(database) || previous.row_length != maxLengthDBRows(database) {
+		return lweStruct.EncodeDatabase(database)
+	}
+
+	updated := newLWEEncodedDatabase(database, previous.seed, databaseDigest(database))
+
+	previousHint := previous.computedHint()
+	if previousHint == nil {
+		return updated, nil
+	}
+
+	a, err := newPublicMatrix(previous.seed)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[int]struct{}, len(changedRows))
+	last := -1
+	for _, i := range changedRows {
+		if i < 0 || i >= len(database) {
+			return nil, fmt.Errorf("changed row %d is out of range of the database with %d rows", i, len(database))
+		}
+		changed[i] = struct{}{}
+		if i > last {
+			last = i
+		}
+	}
+
+	// H' = H + (D' - D)·A, which only differs in the columns of the changed rows
+	hint := make([]uint32, len(previousHint.hint))
+	copy(hint, previousHint.hint)
+	a_row := make([]uint32, lweSecretDimension)
+	for j := 0; j <= last; j++ {
+		a.next(a_row)
+		if _, ok := changed[j]; !ok {
+			continue
+		}
+		addScaledRow(hint, previous.rows[j], a_row, ^uint32(0)) // subtract the old row
+		addScaledRow(hint, database[j], a_row, 1)
+	}
+
+	updated.hint = &lweHint{
+		seed:       updated.seed,
+		epoch:      updated.epoch,
+		row_length: updated.row_length,
+		hint:       hint,
+	}
+
+	return updated, nil
+}
+
+// addScaledRow adds the outer product of the row and a_row, scaled by factor, to the hint.
+func addScaledRow(hint []uint32, row []byte, a_row []uint32, factor uint32) {
+	for k, b := range row {
+		if b == 0 {
+			continue
+		}
+		scaled := uint32(b) * factor
+		hint_row := hint[k*lweSecretDimension : (k+1)*lweSecretDimension]
+		for i, a := range a_row {
+			hint_row[i] += scaled * a
+		}
+	}
+}
+
+// databaseDigest returns the SHA-256 digest of the rows, with each row prefixed by its length.
+func databaseDigest(database [][]byte) [sha256.Size]byte {
+	h := sha256.New()
+	length := make([]byte, 8)
+	binary.LittleEndian.PutUint64(length, uint64(len(database)))
+	h.Write(length)
+	for _, row := range database {
+		binary.LittleEndian.PutUint64(length, uint64(len(row)))
+		h.Write(length)
+		h.Write(row)
+	}
+
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+	return digest
+}
+
+// publicMatrix generates the rows of the public matrix A from its seed, with AES-CTR as the PRG.
+type publicMatrix struct {
+	stream cipher.Stream
+	buf    []byte
+}
+
+func newPublicMatrix(seed []byte) (*publicMatrix, error) {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, fmt.Errorf("public matrix PRG: %w", err)
+	}
+	return &publicMatrix{
+		stream: cipher.NewCTR(block, make([]byte, aes.BlockSize)),
+		buf:    make([]byte, 4*lweSecretDimension),
+	}, nil
+}
+
+// next sets a_row to the next row of the matrix.
+func (a *publicMatrix) next(a_row []uint32) {
+	for i := range a.buf {
+		a.buf[i] = 0
+	}
+	a.stream.XORKeyStream(a.buf, a.buf)
+	for i := range a_row {
+		a_row[i] = binary.LittleEndian.Uint32(a.buf[4*i:])
+	}
+}
+
+// dot returns the inner product of the vectors modulo 2^32.
+func dot(a, b []uint32) uint32 {
+	var sum uint32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// sampleUniformVector samples a vector of uniformly random values modulo 2^32.
+func sampleUniformVector(length int) ([]uint32, error) {
+	buf := make([]byte, 4*length)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("sample uniform vector: %w", err)
+	}
+	return bytesToUint32s(buf, length)
+}
+
+// lweErrorCDT is the cumulative distribution of the absolute value of the discrete Gaussian
+// errors, which is cut off at ten standard deviations.
+var lweErrorCDT = func() []float64 {
+	bound := int(math.Ceil(10 * lweErrorStddev))
+	weights := make([]float64, bound+1)
+	total := 0.0
+	for x := range weights {
+		weights[x] = math.Exp(-float64(x*x) / (2 * lweErrorStddev * lweErrorStddev))
+		if x > 0 {
+			weights[x] *= 2 // for both signs
+		}
+		total += weights[x]
+	}
+
+	cdt := make([]float64, len(weights))
+	cumulative := 0.0
+	for x, w := range weights {
+		cumulative += w / total
+		cdt[x] = cumulative
+	}
+	return cdt
+}()
+
+// sampleErrorVector samples a vector of discrete Gaussian errors modulo 2^32.
+func sampleErrorVector(length int) ([]uint32, error) {
+	buf := make([]byte, 8*length)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("sample error vector: %w", err)
+	}
+
+	errors := make([]uint32, length)
+	for i := range errors {
+		r := binary.LittleEndian.Uint64(buf[8*i:])
+
+		// the 53 most significant bits select the absolute value, the least significant bit the sign
+		u := float64(r>>11) / (1 << 53)
+		x := 0
+		for x < len(lweErrorCDT)-1 && u >= lweErrorCDT[x] {
+			x++
+		}
+
+		if r&1 == 1 {
+			errors[i] = uint32(-x)
+		} else {
+			errors[i] = uint32(x)
+		}
+	}
+	return errors, nil
+}
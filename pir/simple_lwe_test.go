@@ -0,0 +1,112 @@
+package pir
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func randomDatabase(seed rand.Source, num_rows int, row_size int) [][]byte {
+	db := make([][]byte, num_rows)
+	for i := range db {
+		db[i] = make([]byte, row_size)
+		rand.New(seed).Read(db[i])
+	}
+	return db
+}
+
+func TestPIR_SimpleLWE_Correctness(t *testing.T) {
+	log2_number_of_rows := 6
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	// the database lacks rows at the end, which are retrieved as empty rows
+	db := randomDatabase(seed, 50, 300)
+	server_PIR_Protocol := NewSimpleLWE_PIR_Protocol(log2_number_of_rows)
+	encoded, err := server_PIR_Protocol.EncodeDatabase(db)
+	require.NoError(t, err)
+
+	// the client downloads the hint once
+	client_PIR_Protocol := NewSimpleLWE_PIR_Protocol(log2_number_of_rows)
+	_, err = client_PIR_Protocol.GenerateRequestFromQuery(0)
+	require.Error(t, err)
+
+	hintResponse, err := server_PIR_Protocol.ProcessRequestOverEncodedDatabase(context.Background(), client_PIR_Protocol.GenerateHintRequest(), encoded)
+	require.NoError(t, err)
+	require.NoError(t, client_PIR_Protocol.ProcessHintResponse(hintResponse))
+	require.NotEmpty(t, client_PIR_Protocol.HintEpoch())
+
+	// and then retrieves several rows with it
+	for _, query := range []int{0, 17, 49, 63} {
+		pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(query)
+		require.NoError(t, err)
+
+		response, err := NewSimpleLWE_PIR_Protocol(log2_number_of_rows).ProcessRequestOverEncodedDatabase(context.Background(), pirRequest, encoded)
+		require.NoError(t, err)
+
+		response_bytes, err := client_PIR_Protocol.ProcessResponseToPlaintext(response)
+		require.NoError(t, err)
+		if query < len(db) {
+			require.Equal(t, db[query], response_bytes)
+		} else {
+			require.Equal(t, make([]byte, len(response_bytes)), response_bytes)
+		}
+	}
+
+	// processing the request over the rows encodes them in the same epoch
+	pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(3)
+	require.NoError(t, err)
+	response, err := NewSimpleLWE_PIR_Protocol(log2_number_of_rows).ProcessRequestAndReturnResponse(context.Background(), pirRequest, db)
+	require.NoError(t, err)
+	response_bytes, err := client_PIR_Protocol.ProcessResponseToPlaintext(response)
+	require.NoError(t, err)
+	require.Equal(t, db[3], response_bytes)
+}
+
+func TestPIR_SimpleLWE_stale_hint(t *testing.T) {
+	log2_number_of_rows := 4
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	db := randomDatabase(seed, 16, 64)
+	server_PIR_Protocol := NewSimpleLWE_PIR_Protocol(log2_number_of_rows)
+	encoded, err := server_PIR_Protocol.EncodeDatabase(db)
+	require.NoError(t, err)
+
+	client_PIR_Protocol := NewSimpleLWE_PIR_Protocol(log2_number_of_rows)
+	hintResponse, err := server_PIR_Protocol.ProcessRequestOverEncodedDatabase(context.Background(), client_PIR_Protocol.GenerateHintRequest(), encoded)
+	require.NoError(t, err)
+	require.NoError(t, client_PIR_Protocol.ProcessHintResponse(hintResponse))
+
+	// a change of the database starts a new epoch
+	updatedDB := make([][]byte, len(db))
+	copy(updatedDB, db)
+	updatedDB[5] = randomDatabase(seed, 1, 64)[0]
+	updated, err := server_PIR_Protocol.UpdateEncodedDatabase(encoded, updatedDB, []int{5})
+	require.NoError(t, err)
+
+	pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(5)
+	require.NoError(t, err)
+	_, err = server_PIR_Protocol.ProcessRequestOverEncodedDatabase(context.Background(), pirRequest, updated)
+	require.ErrorIs(t, err, ErrStaleHint)
+
+	// the updated hint matches the hint of the new epoch
+	hintResponse, err = server_PIR_Protocol.ProcessRequestOverEncodedDatabase(context.Background(), client_PIR_Protocol.GenerateHintRequest(), updated)
+	require.NoError(t, err)
+	require.NoError(t, client_PIR_Protocol.ProcessHintResponse(hintResponse))
+
+	recomputed := newLWEEncodedDatabase(updatedDB, encoded.(*lweEncodedDatabase).seed, databaseDigest(updatedDB))
+	recomputedHint, err := recomputed.getHint()
+	require.NoError(t, err)
+	require.Equal(t, recomputedHint.hint, client_PIR_Protocol.hint.hint)
+	require.Equal(t, recomputedHint.epoch, client_PIR_Protocol.HintEpoch())
+
+	pirRequest, err = client_PIR_Protocol.GenerateRequestFromQuery(5)
+	require.NoError(t, err)
+	response, err := server_PIR_Protocol.ProcessRequestOverEncodedDatabase(context.Background(), pirRequest, updated)
+	require.NoError(t, err)
+	response_bytes, err := client_PIR_Protocol.ProcessResponseToPlaintext(response)
+	require.NoError(t, err)
+	require.Equal(t, updatedDB[5], response_bytes)
+}
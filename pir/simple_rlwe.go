@@ -1,10 +1,11 @@
 package pir
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"math"
-	"sync"
 	"time"
 
 	"github.com/plprobelab/zikade/pb"
@@ -19,16 +20,18 @@ const (
 	RLWE_Whispir_2_Keys        = "RLWE_Whispir_2_Keys"
 )
 
-// this should only be set to true for the private want block stage in bitswap
-// private provider routing and peer routing work better without the optimizations
-var toParallelizeServerResponseComputation bool = false
+// MaxBatchQueries is the largest number of rows that a batch request can retrieve.
+const MaxBatchQueries = 16
 
 type SimpleRLWE_PIR_Protocol struct {
 	PIR_Protocol
 
 	log2_num_rows int
 
-	parameters bgv.Parameters
+	// parameter_set is the parameter set that the parameters are generated from,
+	// see [SimpleRLWE_PIR_Protocol.SetParameterSet]
+	parameter_set *RLWEParameterSet
+	parameters    bgv.Parameters
 
 	// See the const above
 	mode string
@@ -39,52 +42,113 @@ type SimpleRLWE_PIR_Protocol struct {
 	encrypted_query      structs.Vector[rlwe.Ciphertext]
 	response_ciphertexts structs.Vector[rlwe.Ciphertext]
 
+	// set instead of encrypted_query for batch requests, with one encrypted query per row
+	batch_encrypted_queries []structs.Vector[rlwe.Ciphertext]
+
+	// num_dimensions is the number of dimensions of recursive requests, see
+	// [NewSimpleRLWE_PIR_Protocol_recursive]. 0 and 1 select the one-dimensional mode.
+	num_dimensions int
+
+	// session is set if the client reuses its key material across requests, in which case
+	// requests reference their evaluation keys by evaluation_keys_id
+	session            *SimpleRLWE_Session
+	evaluation_keys_id []byte
+
+	// workers is set if the server spreads the row multiplications of a request over a worker pool,
+	// see [SimpleRLWE_PIR_Protocol.SetWorkerPool]
+	workers *WorkerPool
+
 	bytesPerCiphertextCoefficient int
 	bytesPerCiphertext            int
 	plaintextDB                   [][]*rlwe.Plaintext
 }
 
+var (
+	_ IncrementalDatabaseEncoder = (*SimpleRLWE_PIR_Protocol)(nil)
+	_ BatchPIR_Protocol          = (*SimpleRLWE_PIR_Protocol)(nil)
+	_ CostEstimator              = (*SimpleRLWE_PIR_Protocol)(nil)
+	_ ParameterizedPIR_Protocol  = (*SimpleRLWE_PIR_Protocol)(nil)
+)
+
 // Use by client to create a new PIR request
 func NewSimpleRLWE_PIR_Protocol(log2_num_rows int) *SimpleRLWE_PIR_Protocol {
+	return NewSimpleRLWE_PIR_Protocol_mode(log2_num_rows, RLWE_All_Keys)
+}
+
+// Use by client to create a new PIR request
+func NewSimpleRLWE_PIR_Protocol_mode(log2_num_rows int, mode string) *SimpleRLWE_PIR_Protocol {
 	rlweStruct := &SimpleRLWE_PIR_Protocol{
 		log2_num_rows: log2_num_rows,
-		mode:          RLWE_All_Keys,
+		mode:          mode,
 	}
-	err := rlweStruct.generateParameters()
+	err := rlweStruct.SetParameterSet(DefaultRLWEParameterSet)
 	if err != nil {
 		return nil
 	}
-	pp := rlweStruct.parameters.PlaintextModulus()
-	rlweStruct.bytesPerCiphertextCoefficient = int(math.Floor(math.Log2(float64(pp)))) / 8
-	// TODO: Can we just get rid of this error by ensuring that this condition is always true when generating the parameters?
-	if rlweStruct.bytesPerCiphertextCoefficient > 8 {
-		fmt.Println("bytesPerCiphertextCoefficient > 8, Code can not handle coefficients larger than 64 bits")
+	return rlweStruct
+}
+
+// NewSimpleRLWE_PIR_Protocol_parameters returns a new instance that generates requests with the given
+// parameter set, e.g. one that was chosen with [SelectRLWEParameterSet]. It returns nil if responses to
+// requests of the mode over 2^log2_num_rows rows don't decrypt correctly with the parameter set.
+func NewSimpleRLWE_PIR_Protocol_parameters(log2_num_rows int, mode string, set *RLWEParameterSet) *SimpleRLWE_PIR_Protocol {
+	if !set.Supports(mode, log2_num_rows) {
 		return nil
 	}
 
-	rlweStruct.bytesPerCiphertext = rlweStruct.bytesPerCiphertextCoefficient * rlweStruct.parameters.N()
+	rlweStruct := &SimpleRLWE_PIR_Protocol{
+		log2_num_rows: log2_num_rows,
+		mode:          mode,
+	}
+	err := rlweStruct.SetParameterSet(set.Name)
+	if err != nil {
+		return nil
+	}
 	return rlweStruct
 }
 
-// Use by client to create a new PIR request
-func NewSimpleRLWE_PIR_Protocol_mode(log2_num_rows int, mode string) *SimpleRLWE_PIR_Protocol {
+// NewSimpleRLWE_PIR_Protocol_session returns a new instance that generates requests with the key
+// material of the session, in the mode of the session. See [SimpleRLWE_Session].
+func NewSimpleRLWE_PIR_Protocol_session(log2_num_rows int, session *SimpleRLWE_Session) *SimpleRLWE_PIR_Protocol {
 	rlweStruct := &SimpleRLWE_PIR_Protocol{
 		log2_num_rows: log2_num_rows,
-		mode:          mode,
+		mode:          session.mode,
+		session:       session,
 	}
-	err := rlweStruct.generateParameters()
+	err := rlweStruct.SetParameterSet(session.parameter_set.Name)
 	if err != nil {
 		return nil
 	}
+	return rlweStruct
+}
+
+// SetParameterSet configures the instance with the parameter set of the given name, see
+// [LookupRLWEParameterSet]. A server calls it with the parameter set that a request names,
+// before it processes the request.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) SetParameterSet(name string) error {
+	set, err := LookupRLWEParameterSet(name)
+	if err != nil {
+		return err
+	}
+	rlweStruct.parameter_set = set
+
+	err = rlweStruct.generateParameters()
+	if err != nil {
+		return err
+	}
 	rlweStruct.bytesPerCiphertextCoefficient = int(math.Floor(math.Log2(float64(rlweStruct.parameters.PlaintextModulus())))) / 8
 	// TODO: Can we just get rid of this error by ensuring that this condition is always true when generating the parameters?
 	if rlweStruct.bytesPerCiphertextCoefficient > 8 {
-		fmt.Println("bytesPerCiphertextCoefficient > 8, Code can not handle coefficients larger than 64 bits")
-		return nil
+		return fmt.Errorf("bytesPerCiphertextCoefficient > 8, Code can not handle coefficients larger than 64 bits")
 	}
 
 	rlweStruct.bytesPerCiphertext = rlweStruct.bytesPerCiphertextCoefficient * rlweStruct.parameters.N()
-	return rlweStruct
+	return nil
+}
+
+// ParameterSet returns the name of the parameter set that the instance is configured with.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) ParameterSet() string {
+	return rlweStruct.parameter_set.Name
 }
 
 func (rlweStruct *SimpleRLWE_PIR_Protocol) CreatePrivateKeyMaterial() error {
@@ -98,60 +162,144 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) marshalRequestToPB() (*pb.PIR_Request
 	if err != nil {
 		return nil, err
 	}
-	evk_bytes, err := rlweStruct.evaluation_keys.MarshalBinary()
-	if err != nil {
-		return nil, err
+	var schemeDependent *pb.PIR_Request_RLWEEvaluationKeys
+	if rlweStruct.evaluation_keys != nil {
+		evk_bytes, err := rlweStruct.evaluation_keys.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		schemeDependent = &pb.PIR_Request_RLWEEvaluationKeys{
+			RLWEEvaluationKeys: evk_bytes,
+		}
 	}
-	query_bytes, err := structs.Vector[rlwe.Ciphertext](rlweStruct.encrypted_query).MarshalBinary()
-	if err != nil {
-		return nil, err
+	var query_bytes []byte
+	var batch_query_bytes [][]byte
+	if rlweStruct.batch_encrypted_queries != nil {
+		batch_query_bytes = make([][]byte, len(rlweStruct.batch_encrypted_queries))
+		for i, encrypted_query := range rlweStruct.batch_encrypted_queries {
+			batch_query_bytes[i], err = encrypted_query.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		query_bytes, err = structs.Vector[rlwe.Ciphertext](rlweStruct.encrypted_query).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	pirRequest := pb.PIR_Request{
-		Log2NumRows: int64(rlweStruct.log2_num_rows),
-		Parameters:  params_bytes,
-		SchemeDependent: &pb.PIR_Request_RLWEEvaluationKeys{
-			RLWEEvaluationKeys: evk_bytes,
-		},
-		EncryptedQuery: query_bytes,
+		Scheme:                rlweStruct.mode,
+		ParameterSet:          rlweStruct.parameter_set.Name,
+		Log2NumRows:           int64(rlweStruct.log2_num_rows),
+		Parameters:            params_bytes,
+		EncryptedQuery:        query_bytes,
+		BatchEncryptedQueries: batch_query_bytes,
+		EvaluationKeysId:      rlweStruct.evaluation_keys_id,
+	}
+	if rlweStruct.isRecursive() {
+		pirRequest.NumDimensions = int64(rlweStruct.num_dimensions)
+	}
+	// a nil *PIR_Request_RLWEEvaluationKeys must not be assigned to the oneof
+	if schemeDependent != nil {
+		pirRequest.SchemeDependent = schemeDependent
 	}
 
 	// fmt.Println(" - marshalling phase: request total length: ", len(params_bytes)+len(evk_bytes)+len(query_bytes))
 	return &pirRequest, nil
 }
 
+// unmarshallRequestFromPB unmarshals a request from an untrusted client. The parameters of the request must
+// be those of the parameter set that it names, and its encrypted queries and evaluation keys must have the
+// shape that the parameters, the mode and the number of rows call for. Otherwise, the returned error wraps
+// [ErrUnsupportedParameterSet] or [ErrInvalidRequest], before any ciphertext or key is unmarshalled.
+//
+// An instance that wasn't constructed for a mode and a parameter set takes them from the request.
 func (rlweStruct *SimpleRLWE_PIR_Protocol) unmarshallRequestFromPB(req *pb.PIR_Request) error {
+	if rlweStruct.mode == "" {
+		rlweStruct.mode = req.GetScheme()
+	}
+	if rlweStruct.parameter_set == nil {
+		if err := rlweStruct.SetParameterSet(req.GetParameterSet()); err != nil {
+			return err
+		}
+	}
+	set, err := LookupRLWEParameterSet(req.GetParameterSet())
+	if err != nil {
+		return err
+	}
+	if set != rlweStruct.parameter_set {
+		return fmt.Errorf("%w: %q, expected %q", ErrUnsupportedParameterSet, set.Name, rlweStruct.parameter_set.Name)
+	}
 
+	// the parameters were generated for the parameter set that the request names, so they
+	// are compared in their encoding instead of unmarshalling the parameters of the client
+	params_bytes, err := rlweStruct.parameters.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(req.GetParameters(), params_bytes) {
+		return fmt.Errorf("%w: parameters of the request differ from parameter set %q", ErrUnsupportedParameterSet, rlweStruct.parameter_set.Name)
+	}
+
+	if req.GetLog2NumRows() < 0 || req.GetLog2NumRows() > int64(MaxDimensions*rlweStruct.parameters.LogN()) {
+		return fmt.Errorf("%w: request for 2^%d rows", ErrInvalidRequest, req.GetLog2NumRows())
+	}
 	rlweStruct.log2_num_rows = int(req.GetLog2NumRows())
 
-	err := rlweStruct.parameters.UnmarshalBinary(req.GetParameters())
-	if err != nil {
-		return fmt.Errorf("error unmarshalling parameter bytes")
+	rlweStruct.num_dimensions = int(req.GetNumDimensions())
+	if err := rlweStruct.validateDimensions(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
 	}
 
-	var encrypted_query structs.Vector[rlwe.Ciphertext]
-	err = encrypted_query.UnmarshalBinary(req.GetEncryptedQuery())
+	shapes, err := rlweStruct.parameter_set.encodingShapes()
 	if err != nil {
-		return fmt.Errorf("error unmarshalling encrypted query bytes")
+		return err
+	}
+
+	if len(req.GetBatchEncryptedQueries()) > MaxBatchQueries {
+		return fmt.Errorf("%w: batch request has %d encrypted queries, at most %d are supported", ErrInvalidRequest, len(req.GetBatchEncryptedQueries()), MaxBatchQueries)
+	} else if len(req.GetBatchEncryptedQueries()) > 0 {
+		rlweStruct.encrypted_query = nil
+		rlweStruct.batch_encrypted_queries = make([]structs.Vector[rlwe.Ciphertext], len(req.GetBatchEncryptedQueries()))
+		for i, query_bytes := range req.GetBatchEncryptedQueries() {
+			if err := rlweStruct.validateEncryptedQuery(shapes, query_bytes); err != nil {
+				return fmt.Errorf("batch query %d: %w", i, err)
+			}
+			err = rlweStruct.batch_encrypted_queries[i].UnmarshalBinary(query_bytes)
+			if err != nil {
+				return fmt.Errorf("error unmarshalling encrypted query bytes of batch query %d", i)
+			}
+		}
+	} else {
+		if err := rlweStruct.validateEncryptedQuery(shapes, req.GetEncryptedQuery()); err != nil {
+			return err
+		}
+		var encrypted_query structs.Vector[rlwe.Ciphertext]
+		err = encrypted_query.UnmarshalBinary(req.GetEncryptedQuery())
+		if err != nil {
+			return fmt.Errorf("error unmarshalling encrypted query bytes")
+		}
+		rlweStruct.encrypted_query = encrypted_query
+		rlweStruct.batch_encrypted_queries = nil
 	}
-	rlweStruct.encrypted_query = encrypted_query
 
 	switch schemeDependent := req.SchemeDependent.(type) {
 	case *pb.PIR_Request_RLWEEvaluationKeys:
 		evaluationKeysBytes := schemeDependent.RLWEEvaluationKeys
-		// println("OptionalParameters is set to EV Keys")
+		if err := rlweStruct.validateEvaluationKeys(shapes, evaluationKeysBytes); err != nil {
+			return err
+		}
 		rlweStruct.evaluation_keys = &rlwe.MemEvaluationKeySet{}
 		err = rlweStruct.evaluation_keys.UnmarshalBinary(evaluationKeysBytes)
 		if err != nil {
 			return fmt.Errorf("error unmarshalling evaluation key bytes")
 		}
-	case *pb.PIR_Request_OtherKeys:
-		otherKeysBytes := schemeDependent.OtherKeys
-		println("OptionalParameters is set to other keys", otherKeysBytes)
 	case nil:
-		return fmt.Errorf("unmarshalling request from PB: need one of EV Keys or Random lol")
+		return fmt.Errorf("%w: request carries no evaluation keys", ErrInvalidRequest)
 	default:
-		return fmt.Errorf("unmarshalling request from PB: req.OptionalParameters has unexpected type %T", schemeDependent)
+		return fmt.Errorf("%w: request carries keys of type %T instead of evaluation keys", ErrInvalidRequest, schemeDependent)
 	}
 
 	return nil
@@ -167,6 +315,31 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) marshalResponseToPB() (*pb.PIR_Respon
 	return response, nil
 }
 
+// writeResponseCiphertexts writes all response ciphertexts to w, see [SimpleRLWE_PIR_Protocol.writeResponseCiphertext],
+// and returns a response without ciphertexts.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) writeResponseCiphertexts(w ResponseWriter) (*pb.PIR_Response, error) {
+	if err := writeVectorLength(w, len(rlweStruct.response_ciphertexts)); err != nil {
+		return nil, err
+	}
+	for k := range rlweStruct.response_ciphertexts {
+		if err := rlweStruct.writeResponseCiphertext(w, k); err != nil {
+			return nil, err
+		}
+	}
+	return &pb.PIR_Response{}, nil
+}
+
+// writeResponseCiphertext writes the k-th response ciphertext to w and releases it. The bytes that are written
+// for all response ciphertexts, after their number, are those of the marshalled response ciphertexts.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) writeResponseCiphertext(w ResponseWriter, k int) error {
+	ciphertext_bytes, err := rlweStruct.response_ciphertexts[k].MarshalBinary()
+	if err != nil {
+		return err
+	}
+	rlweStruct.response_ciphertexts[k] = rlwe.Ciphertext{}
+	return w.WriteCiphertexts(ciphertext_bytes)
+}
+
 func (rlweStruct *SimpleRLWE_PIR_Protocol) unmarshallResponseFromPB(res *pb.PIR_Response) error {
 	err := rlweStruct.response_ciphertexts.UnmarshalBinary(res.GetCiphertexts())
 	if err != nil {
@@ -177,20 +350,133 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) unmarshallResponseFromPB(res *pb.PIR_
 
 func (rlweStruct *SimpleRLWE_PIR_Protocol) GenerateRequestFromQuery(requested_row int) (*pb.PIR_Request, error) {
 
-	err := rlweStruct.generateParameters()
+	err := rlweStruct.generateKeyMaterial()
 	if err != nil {
 		return nil, err
 	}
 
-	encoder := bgv.NewEncoder(rlweStruct.parameters)
-	num_slots := rlweStruct.parameters.MaxSlots()
-	log_num_cts := 0
+	ciphertext, err := rlweStruct.generateEncryptedQuery(requested_row)
+	if err != nil {
+		return nil, err
+	}
+	rlweStruct.encrypted_query = ciphertext
+	rlweStruct.batch_encrypted_queries = nil
+
+	err = rlweStruct.generateRequestEvaluationKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	return rlweStruct.marshalRequestToPB()
+}
+
+// GenerateRequestFromQueries generates a batch request that retrieves each of the requested rows.
+// All encrypted queries of the request share the evaluation keys, which make up most of the size
+// of a request, so it is much smaller than a request per row. The response to the request is
+// decrypted with [SimpleRLWE_PIR_Protocol.ProcessBatchResponseToPlaintexts].
+func (rlweStruct *SimpleRLWE_PIR_Protocol) GenerateRequestFromQueries(requested_rows []int) (*pb.PIR_Request, error) {
+	if len(requested_rows) == 0 || len(requested_rows) > MaxBatchQueries {
+		return nil, fmt.Errorf("a batch request must retrieve between 1 and %d rows, got %d", MaxBatchQueries, len(requested_rows))
+	}
+
+	err := rlweStruct.generateKeyMaterial()
+	if err != nil {
+		return nil, err
+	}
+
+	batch_encrypted_queries := make([]structs.Vector[rlwe.Ciphertext], len(requested_rows))
+	for i, requested_row := range requested_rows {
+		batch_encrypted_queries[i], err = rlweStruct.generateEncryptedQuery(requested_row)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rlweStruct.encrypted_query = nil
+	rlweStruct.batch_encrypted_queries = batch_encrypted_queries
+
+	err = rlweStruct.generateRequestEvaluationKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	return rlweStruct.marshalRequestToPB()
+}
+
+// generateKeyMaterial generates the parameters and the secret key for a request, or takes them
+// from the session.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) generateKeyMaterial() error {
+	if rlweStruct.session != nil {
+		rlweStruct.parameters = rlweStruct.session.parameters
+		rlweStruct.secret_key = rlweStruct.session.secret_key
+		return nil
+	}
+
+	err := rlweStruct.generateParameters()
+	if err != nil {
+		return err
+	}
+
+	return rlweStruct.CreatePrivateKeyMaterial()
+}
+
+// generateRequestEvaluationKeys generates the evaluation keys for a request. With a session, the
+// keys are only generated once, and left out of the request once the server cached them.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) generateRequestEvaluationKeys() error {
+	if rlweStruct.session != nil {
+		id, keys, err := rlweStruct.session.evaluationKeys(rlweStruct, rlweStruct.log2BitsPerQueryCiphertext())
+		if err != nil {
+			return err
+		}
+		rlweStruct.evaluation_keys_id = id
+		rlweStruct.evaluation_keys = keys
+		return nil
+	}
+
+	keys, err := rlweStruct.generateEvaluationKeys(rlweStruct.log2BitsPerQueryCiphertext())
+	if err != nil {
+		return err
+	}
+	rlweStruct.evaluation_keys_id = nil
+	rlweStruct.evaluation_keys = keys
+	return nil
+}
+
+// confirmCachedEvaluationKeys records in the session that the server cached the evaluation keys
+// of the request, if it says so in its response.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) confirmCachedEvaluationKeys(res *pb.PIR_Response) {
+	if rlweStruct.session != nil && rlweStruct.evaluation_keys_id != nil && res.GetEvaluationKeysCached() {
+		rlweStruct.session.confirmCached(rlweStruct.evaluation_keys_id)
+	}
+}
+
+// log2NumQueryCiphertexts returns the log of the number of ciphertexts that an encrypted query consists of.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) log2NumQueryCiphertexts() int {
 	if rlweStruct.log2_num_rows > rlweStruct.parameters.LogN() {
-		log_num_cts = rlweStruct.log2_num_rows - rlweStruct.parameters.LogN()
+		return rlweStruct.log2_num_rows - rlweStruct.parameters.LogN()
+	}
+	return 0
+}
+
+// log2BitsPerQueryCiphertext returns the log of the number of rows that each ciphertext of an encrypted query selects from.
+// For recursive requests, it is the log of the length of the longest dimension.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) log2BitsPerQueryCiphertext() int {
+	if rlweStruct.isRecursive() {
+		return rlweStruct.log2DimensionLengths()[0]
+	}
+	return rlweStruct.log2_num_rows - rlweStruct.log2NumQueryCiphertexts()
+}
+
+// generateEncryptedQuery encrypts the query for the requested row, with the parameters and the secret key
+// that were generated before.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) generateEncryptedQuery(requested_row int) ([]rlwe.Ciphertext, error) {
+	if rlweStruct.isRecursive() {
+		return rlweStruct.generateRecursiveQuery(requested_row)
 	}
-	num_cts := 1 << log_num_cts
-	log2_bits_per_ct := rlweStruct.log2_num_rows - log_num_cts
-	bits_per_ct := 1 << log2_bits_per_ct
+
+	encoder := bgv.NewEncoder(rlweStruct.parameters)
+	num_slots := rlweStruct.parameters.MaxSlots()
+	num_cts := 1 << rlweStruct.log2NumQueryCiphertexts()
+	bits_per_ct := 1 << rlweStruct.log2BitsPerQueryCiphertext()
 
 	ciphertext_index := requested_row / bits_per_ct
 	bit_index := requested_row % bits_per_ct
@@ -211,24 +497,7 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) GenerateRequestFromQuery(requested_ro
 		plaintexts[i] = query_plaintext
 	}
 
-	err = rlweStruct.CreatePrivateKeyMaterial()
-	if err != nil {
-		return nil, err
-	}
-
-	ciphertext, err := rlweStruct.encryptRLWEPlaintexts(plaintexts)
-	if err != nil {
-		return nil, err
-	}
-	rlweStruct.encrypted_query = ciphertext
-
-	keys, err := rlweStruct.generateEvaluationKeys(log2_bits_per_ct)
-	if err != nil {
-		return nil, err
-	}
-	rlweStruct.evaluation_keys = keys
-
-	return rlweStruct.marshalRequestToPB()
+	return rlweStruct.encryptRLWEPlaintexts(plaintexts)
 }
 
 // Encodes byte_array from [start_index, end_index) into a plaintext
@@ -281,11 +550,82 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) ProcessResponseToPlaintext(res *pb.PI
 	if err != nil {
 		return nil, fmt.Errorf("could not unmarshal response from PB %s", err)
 	}
+	rlweStruct.confirmCachedEvaluationKeys(res)
+
+	return rlweStruct.decryptResponseCiphertexts(rlweStruct.response_ciphertexts)
+}
+
+// ProcessBatchResponseToPlaintexts decrypts the response to a batch request that was generated with
+// [SimpleRLWE_PIR_Protocol.GenerateRequestFromQueries]. It returns the requested rows in the order
+// in which they were requested.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) ProcessBatchResponseToPlaintexts(res *pb.PIR_Response) ([][]byte, error) {
+	if len(res.GetBatchCiphertexts()) != len(rlweStruct.batch_encrypted_queries) {
+		return nil, fmt.Errorf("batch response has ciphertexts for %d queries, expected %d", len(res.GetBatchCiphertexts()), len(rlweStruct.batch_encrypted_queries))
+	}
+	rlweStruct.confirmCachedEvaluationKeys(res)
+
+	rows := make([][]byte, len(res.GetBatchCiphertexts()))
+	for i, ciphertexts_bytes := range res.GetBatchCiphertexts() {
+		var response_ciphertexts structs.Vector[rlwe.Ciphertext]
+		err := response_ciphertexts.UnmarshalBinary(ciphertexts_bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal response ciphertexts of batch query %d %s", i, err)
+		}
+
+		rows[i], err = rlweStruct.decryptResponseCiphertexts(response_ciphertexts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rows, nil
+}
+
+// decryptResponseCiphertexts decrypts the response ciphertexts of a query into the bytes of the requested row.
+// The response to a recursive request is decrypted once per dimension, as the plaintexts of each dimension but
+// the first hold the digits of the response ciphertexts of the previous dimension.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) decryptResponseCiphertexts(response_ciphertexts structs.Vector[rlwe.Ciphertext]) ([]byte, error) {
+	if len(response_ciphertexts) == 0 {
+		return nil, fmt.Errorf("response has no ciphertexts")
+	}
+
+	lengths := rlweStruct.log2DimensionLengths()
+	ciphertexts := response_ciphertexts
+	for d := len(lengths) - 1; d > 0; d-- {
+		digits, err := rlweStruct.decryptCoefficients(ciphertexts)
+		if err != nil {
+			return nil, err
+		}
+
+		ciphertexts, err = rlweStruct.recomposeCiphertexts(digits, rlweStruct.parameter_set.digitBits(rlweStruct.mode, lengths[d]), &response_ciphertexts[0])
+		if err != nil {
+			return nil, fmt.Errorf("could not recompose response ciphertexts of dimension %d %s", d-1, err)
+		}
+	}
+
+	return rlweStruct.decryptCiphertexts(ciphertexts)
+}
+
+// decryptCoefficients decrypts the ciphertexts into the coefficients of their plaintexts.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) decryptCoefficients(ciphertexts structs.Vector[rlwe.Ciphertext]) ([][]uint64, error) {
+	decryptor := bgv.NewDecryptor(rlweStruct.parameters, rlweStruct.secret_key)
+	decoder := bgv.NewEncoder(rlweStruct.parameters)
+	coefficients := make([][]uint64, len(ciphertexts))
+	for i := range ciphertexts {
+		coefficients[i] = make([]uint64, rlweStruct.parameters.N())
+		if err := decoder.Decode(decryptor.DecryptNew(&ciphertexts[i]), coefficients[i]); err != nil {
+			return nil, fmt.Errorf("could not decode response ciphertext %s", err)
+		}
+	}
+	return coefficients, nil
+}
 
+// decryptCiphertexts decrypts the ciphertexts into the bytes that were encoded in their coefficients.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) decryptCiphertexts(response_ciphertexts structs.Vector[rlwe.Ciphertext]) ([]byte, error) {
 	decryptor := bgv.NewDecryptor(rlweStruct.parameters, rlweStruct.secret_key)
 	var allPlaintextBytes []byte
-	for i := range rlweStruct.response_ciphertexts {
-		plaintext := decryptor.DecryptNew(&rlweStruct.response_ciphertexts[i])
+	for i := range response_ciphertexts {
+		plaintext := decryptor.DecryptNew(&response_ciphertexts[i])
 		slice, err := rlweStruct.PlaintextToBytesArray(plaintext)
 		if err != nil {
 			return nil, err
@@ -296,17 +636,237 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) ProcessResponseToPlaintext(res *pb.PI
 	return allPlaintextBytes, nil
 }
 
-func (rlweStruct *SimpleRLWE_PIR_Protocol) ProcessRequestAndReturnResponse(request *pb.PIR_Request, database [][]byte) (*pb.PIR_Response, error) {
+func (rlweStruct *SimpleRLWE_PIR_Protocol) ProcessRequestAndReturnResponse(ctx context.Context, request *pb.PIR_Request, database [][]byte) (*pb.PIR_Response, error) {
 
 	// TODO: @Miti Replace logging the time with Go Benchmarks
 	//   https://pkg.go.dev/testing#hdr-Benchmarks
 	// start := time.Now()
 
+	if request.GetScheme() != rlweStruct.mode {
+		return nil, fmt.Errorf("%w: %q, expected %q", ErrUnsupportedScheme, request.GetScheme(), rlweStruct.mode)
+	}
+	if err := rlweStruct.validateLog2NumRows(request, len(database)); err != nil {
+		return nil, err
+	}
+
 	err := rlweStruct.unmarshallRequestFromPB(request)
 	if err != nil {
 		return nil, err
 	}
 
+	start := time.Now()
+	err = rlweStruct.transformDBToPlaintextForm(database)
+	if err != nil {
+		return nil, err
+	}
+	duration := time.Since(start)
+	fmt.Println("- time elapsed for transformDBToPlaintextForm (ms) is: \t\t\t", duration.Milliseconds())
+
+	return rlweStruct.processQueriesOverPlaintextDB(ctx)
+}
+
+// EncodeDatabase encodes the rows of the database into plaintexts, with the parameters that
+// [SimpleRLWE_PIR_Protocol.GenerateRequestFromQuery] generates requests with.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) EncodeDatabase(database [][]byte) (EncodedDatabase, error) {
+	if len(database) == 0 {
+		return nil, fmt.Errorf("cannot encode an empty database")
+	}
+
+	err := rlweStruct.transformDBToPlaintextForm(database)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rlweEncodedDatabase{
+		parameters:                     rlweStruct.parameters,
+		plaintextDB:                    rlweStruct.plaintextDB,
+		number_of_response_ciphertexts: len(rlweStruct.response_ciphertexts),
+	}, nil
+}
+
+// UpdateEncodedDatabase returns the encoding of the database, which differs from the database that
+// was encoded into encoded only in the given rows. Only the changed rows are encoded again, unless
+// the changed rows need a different number of response ciphertexts than the encoded database.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) UpdateEncodedDatabase(encoded EncodedDatabase, database [][]byte, changedRows []int) (EncodedDatabase, error) {
+	previous, ok := encoded.(*rlweEncodedDatabase)
+	if !ok || len(previous.plaintextDB) != len(database) || !rlweStruct.parameters.Equal(&previous.parameters) {
+		return rlweStruct.EncodeDatabase(database)
+	}
+
+	rlweStruct.initializeResponseCTs(database)
+	if len(rlweStruct.response_ciphertexts) != previous.number_of_response_ciphertexts {
+		return rlweStruct.EncodeDatabase(database)
+	}
+
+	plaintextDB := make([][]*rlwe.Plaintext, len(previous.plaintextDB))
+	copy(plaintextDB, previous.plaintextDB)
+	for _, i := range changedRows {
+		if i < 0 || i >= len(database) {
+			return nil, fmt.Errorf("changed row %d is out of range of the database with %d rows", i, len(database))
+		}
+
+		row_data_plaintexts, err := rlweStruct.transformRowToPlaintextForm(database[i])
+		if err != nil {
+			return nil, err
+		}
+		plaintextDB[i] = row_data_plaintexts
+	}
+
+	return &rlweEncodedDatabase{
+		parameters:                     rlweStruct.parameters,
+		plaintextDB:                    plaintextDB,
+		number_of_response_ciphertexts: previous.number_of_response_ciphertexts,
+	}, nil
+}
+
+// ProcessRequestOverEncodedDatabase processes a request over a database that was encoded with
+// [SimpleRLWE_PIR_Protocol.EncodeDatabase]. The request must have been generated with the same
+// parameters that the database was encoded with.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) ProcessRequestOverEncodedDatabase(ctx context.Context, request *pb.PIR_Request, database EncodedDatabase) (*pb.PIR_Response, error) {
+	encoded, ok := database.(*rlweEncodedDatabase)
+	if !ok {
+		return nil, fmt.Errorf("database was not encoded for an RLWE scheme, got %T", database)
+	}
+
+	if request.GetScheme() != rlweStruct.mode {
+		return nil, fmt.Errorf("%w: %q, expected %q", ErrUnsupportedScheme, request.GetScheme(), rlweStruct.mode)
+	}
+	if err := rlweStruct.validateLog2NumRows(request, encoded.NumRows()); err != nil {
+		return nil, err
+	}
+
+	err := rlweStruct.unmarshallRequestFromPB(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if !rlweStruct.parameters.Equal(&encoded.parameters) {
+		return nil, fmt.Errorf("parameters of the request do not match the parameters the database was encoded with")
+	}
+
+	rlweStruct.plaintextDB = encoded.plaintextDB
+	rlweStruct.response_ciphertexts = make(structs.Vector[rlwe.Ciphertext], encoded.number_of_response_ciphertexts)
+
+	return rlweStruct.processQueriesOverPlaintextDB(ctx)
+}
+
+// EstimateCost estimates the cost of processing the request over num_rows rows of at most row_size
+// bytes. Each encrypted query is expanded into one indicator ciphertext per row that it selects from,
+// which takes about a key switch per row, and each row is multiplied with its indicator ciphertext once
+// for each response ciphertext. Recursive requests are estimated per dimension instead, see
+// [SimpleRLWE_PIR_Protocol.estimateRecursiveCost]. Batch requests cost as much as the same number of
+// requests.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) EstimateCost(request *pb.PIR_Request, num_rows int, row_size int) (int64, error) {
+	num_queries := int64(1)
+	if batch := len(request.GetBatchEncryptedQueries()); batch > 0 {
+		num_queries = int64(batch)
+	}
+	num_response_cts := int64((row_size + rlweStruct.bytesPerCiphertext - 1) / rlweStruct.bytesPerCiphertext)
+	if num_response_cts < 1 {
+		num_response_cts = 1
+	}
+
+	N := int64(rlweStruct.parameters.N())
+	q := int64(rlweStruct.parameters.QCount())
+	p := int64(rlweStruct.parameters.PCount())
+	key_switch := mulCost(2, N, q, q+p)
+	multiplication := mulCost(2, N, q)
+
+	// the query is expanded into an indicator ciphertext for each row that it selects from,
+	// which may be more than the database holds
+	num_indicators := int64(num_rows)
+	if log2_num_rows := request.GetLog2NumRows(); log2_num_rows > 0 && log2_num_rows < 63 && int64(1)<<log2_num_rows > num_indicators {
+		num_indicators = int64(1) << log2_num_rows
+	}
+
+	if request.GetNumDimensions() > 1 {
+		cost, err := rlweStruct.estimateRecursiveCost(request, num_rows, num_response_cts, key_switch, multiplication)
+		if err != nil {
+			return 0, err
+		}
+		return mulCost(num_queries, cost), nil
+	}
+
+	expansion := mulCost(num_indicators, key_switch)
+	selection := mulCost(int64(num_rows), num_response_cts, multiplication)
+	return mulCost(num_queries, addCost(expansion, selection)), nil
+}
+
+// estimateRecursiveCost estimates the cost of processing a single query of a recursive request over num_rows rows, whose selection
+// along the first dimension takes num_response_cts response ciphertexts. The query ciphertext of each dimension is
+// expanded into one indicator ciphertext per index along the dimension. Each dimension after the first selects
+// among the decomposed selections of the previous dimension, whose rows consist of the plaintexts that the
+// ciphertexts of a selection decompose into, see [SimpleRLWE_PIR_Protocol.decomposeCiphertexts].
+func (rlweStruct *SimpleRLWE_PIR_Protocol) estimateRecursiveCost(request *pb.PIR_Request, num_rows int, num_response_cts int64, key_switch int64, multiplication int64) (int64, error) {
+	log2_num_rows, num_dimensions := request.GetLog2NumRows(), request.GetNumDimensions()
+	if num_dimensions > MaxDimensions || log2_num_rows < num_dimensions || log2_num_rows > num_dimensions*int64(rlweStruct.parameters.LogN()) {
+		return 0, fmt.Errorf("%w: cannot arrange 2^%d rows in %d dimensions", ErrInvalidRequest, log2_num_rows, num_dimensions)
+	}
+
+	var expansion, selection int64
+	rows, cts := int64(num_rows), num_response_cts
+	for i, log2_length := range log2DimensionLengths(int(log2_num_rows), int(num_dimensions)) {
+		if i > 0 {
+			digit_bits := rlweStruct.parameter_set.digitBits(rlweStruct.mode, log2_length)
+			if digit_bits < 1 {
+				return 0, fmt.Errorf("%w: parameter set %q can't select among 2^%d rows of decomposed ciphertexts", ErrInvalidRequest, rlweStruct.parameter_set.Name, log2_length)
+			}
+			cts = mulCost(cts, int64(rlweStruct.plaintextsPerCiphertext(digit_bits)))
+		}
+
+		length := int64(1) << log2_length
+		expansion = addCost(expansion, mulCost(length, key_switch))
+		selection = addCost(selection, mulCost(rows, cts, multiplication))
+		rows = (rows + length - 1) / length
+	}
+	return addCost(expansion, selection), nil
+}
+
+// SetWorkerPool configures the server to spread the row multiplications of the requests that it
+// processes over the workers of the pool, instead of multiplying the rows one after another.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) SetWorkerPool(workers *WorkerPool) {
+	rlweStruct.workers = workers
+}
+
+// processQueriesOverPlaintextDB evaluates the encrypted query of the unmarshalled request, or each of the
+// encrypted queries of a batch request, over the plaintextDB. If ctx carries a [ResponseWriter], the response
+// ciphertexts of a request that isn't a batch request are written to it as they are computed.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) processQueriesOverPlaintextDB(ctx context.Context) (*pb.PIR_Response, error) {
+	if rlweStruct.batch_encrypted_queries == nil {
+		return rlweStruct.processRequestOverPlaintextDB(ctx, responseWriterFrom(ctx))
+	}
+
+	response := &pb.PIR_Response{
+		BatchCiphertexts: make([][]byte, len(rlweStruct.batch_encrypted_queries)),
+	}
+	for i, encrypted_query := range rlweStruct.batch_encrypted_queries {
+		rlweStruct.encrypted_query = encrypted_query
+		query_response, err := rlweStruct.processRequestOverPlaintextDB(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("batch query %d: %w", i, err)
+		}
+		response.BatchCiphertexts[i] = query_response.GetCiphertexts()
+	}
+
+	return response, nil
+}
+
+// processRequestOverPlaintextDB evaluates the unmarshalled request over the plaintextDB and
+// returns the response ciphertexts. If w is non-nil, each response ciphertext is written to w
+// once it was computed, and released, instead of being returned.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) processRequestOverPlaintextDB(ctx context.Context, w ResponseWriter) (*pb.PIR_Response, error) {
+	if rlweStruct.isRecursive() {
+		if err := rlweStruct.processRecursiveRequestOverPlaintextDB(ctx); err != nil {
+			return nil, err
+		}
+		if w != nil {
+			return rlweStruct.writeResponseCiphertexts(w)
+		}
+		return rlweStruct.marshalResponseToPB()
+	}
+
+	var err error
+
 	// access encrypted query and validate its length
 	encrypted_query := rlweStruct.encrypted_query
 	numberOfQueryCiphertexts := len(encrypted_query)
@@ -336,18 +896,10 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) ProcessRequestAndReturnResponse(reque
 	elapsed := time.Since(start_time)
 	fmt.Println("- time elapsed for key expansion (ms): \t\t\t\t\t\t\t", elapsed.Milliseconds())
 
-	start := time.Now()
-	err = rlweStruct.transformDBToPlaintextForm(database)
-	if err != nil {
-		return nil, err
-	}
-	duration := time.Since(start)
-	fmt.Println("- time elapsed for transformDBToPlaintextForm (ms) is: \t\t\t", duration.Milliseconds())
-
-	num_db_rows := len(database)
+	num_db_rows := len(rlweStruct.plaintextDB)
 	num_rows := 1 << rlweStruct.log2_num_rows
 
-	start = time.Now()
+	start := time.Now()
 	// This if statement cause the algorithm to return the last row of the database,
 	// if the query is larger than the number of rows
 	if num_rows > num_db_rows {
@@ -360,12 +912,26 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) ProcessRequestAndReturnResponse(reque
 	} else if num_rows < num_db_rows {
 		return nil, fmt.Errorf("initialize this struct with log2_num_rows as greater than or equal to the log of the number of rows in the DB")
 	}
-	duration = time.Since(start)
+	duration := time.Since(start)
 	fmt.Println("- time elapsed for evaluator.Add over indicator bits (ns): is: \t", duration.Nanoseconds())
 
-	if !toParallelizeServerResponseComputation {
-		for k := 0; k < len(rlweStruct.response_ciphertexts); k++ {
+	if w != nil {
+		if err := writeVectorLength(w, len(rlweStruct.response_ciphertexts)); err != nil {
+			return nil, err
+		}
+	}
+
+	for k := 0; k < len(rlweStruct.response_ciphertexts); k++ {
+		if rlweStruct.workers != nil {
+			if err := rlweStruct.multiplyRowsWithWorkers(ctx, evaluator, indicator_bits, k); err != nil {
+				return nil, err
+			}
+		} else {
 			for i := 0; i < num_db_rows; i++ {
+				// stop once the client went away instead of finishing the whole computation
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
 
 				multiplied, err := evaluator.MulNew(indicator_bits[i], rlweStruct.plaintextDB[i][k])
 				if err != nil {
@@ -386,51 +952,15 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) ProcessRequestAndReturnResponse(reque
 
 			}
 		}
-	} else { // parallellize
-		products2D := make([][]*rlwe.Ciphertext, len(rlweStruct.response_ciphertexts))
-		for i, _ := range products2D {
-			products2D[i] = make([]*rlwe.Ciphertext, num_db_rows)
-		}
-		var wg sync.WaitGroup
-		start = time.Now()
-
-		for k := 0; k < len(rlweStruct.response_ciphertexts); k++ {
-			for i := 0; i < num_db_rows; i++ {
-				wg.Add(1)
-				go func(index int, k int, evaluator *bgv.Evaluator) error {
-					defer wg.Done()
-					product, err := evaluator.MulNew(indicator_bits[index], rlweStruct.plaintextDB[index][k])
-					if err != nil {
-						return fmt.Errorf("MulNew failed. Check function description for conditions leading to errors. Error: %s", err)
-					}
-					products2D[k][index] = product
-					return nil
-				}(i, k, evaluator.ShallowCopy())
-			}
-		}
-
-		wg.Wait()
-		duration = time.Since(start)
-		fmt.Println("- time elapsed for parallelized part is: ", duration)
 
-		start = time.Now()
-		for k := 0; k < len(rlweStruct.response_ciphertexts); k++ {
-			for i := 0; i < num_db_rows; i++ {
-				// We accumulate the results in the first cipertext so we don't require the
-				// public key to create a new ciphertext
-				// critical part
-				if i == 0 {
-					rlweStruct.response_ciphertexts[k] = *products2D[k][i]
-				} else {
-					err := evaluator.Add(&rlweStruct.response_ciphertexts[k], products2D[k][i], &rlweStruct.response_ciphertexts[k])
-					if err != nil {
-						return nil, err
-					}
-				}
+		if w != nil {
+			if err := rlweStruct.writeResponseCiphertext(w, k); err != nil {
+				return nil, err
 			}
 		}
-		duration = time.Since(start)
-		fmt.Println("- time elapsed for adding is: ", duration)
+	}
+	if w != nil {
+		return &pb.PIR_Response{}, nil
 	}
 
 	response, err := rlweStruct.marshalResponseToPB()
@@ -443,3 +973,52 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) ProcessRequestAndReturnResponse(reque
 
 	return response, nil
 }
+
+// multiplyRowsWithWorkers computes the k-th response ciphertext like the sequential loop of
+// processRequestOverPlaintextDB, but on the workers of the pool. The rows are split into one block
+// per worker, and each task sums the products of a block with its own shallow copy of the
+// evaluator. The partial sums are added up once all tasks returned.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) multiplyRowsWithWorkers(ctx context.Context, evaluator *bgv.Evaluator, indicator_bits []*rlwe.Ciphertext, k int) error {
+	num_db_rows := len(rlweStruct.plaintextDB)
+	num_blocks := rlweStruct.workers.Size()
+	if num_blocks > num_db_rows {
+		num_blocks = num_db_rows
+	}
+
+	partial_sums := make([]*rlwe.Ciphertext, num_blocks)
+	err := rlweStruct.workers.Run(ctx, len(partial_sums), func(block int) error {
+		eval := evaluator.ShallowCopy()
+
+		var sum *rlwe.Ciphertext
+		for i := block * num_db_rows / num_blocks; i < (block+1)*num_db_rows/num_blocks; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			multiplied, err := eval.MulNew(indicator_bits[i], rlweStruct.plaintextDB[i][k])
+			if err != nil {
+				return fmt.Errorf("MulNew failed. Check function description for conditions leading to errors. Error: %w", err)
+			}
+
+			if sum == nil {
+				sum = multiplied
+			} else if err := eval.Add(sum, multiplied, sum); err != nil {
+				return err
+			}
+		}
+		partial_sums[block] = sum
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rlweStruct.response_ciphertexts[k] = *partial_sums[0]
+	for block := 1; block < num_blocks; block++ {
+		if err := evaluator.Add(&rlweStruct.response_ciphertexts[k], partial_sums[block], &rlweStruct.response_ciphertexts[k]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -15,40 +15,12 @@ import (
 	"github.com/tuneinsight/lattigo/v5/core/rlwe"
 )
 
-// From https://github.com/tuneinsight/lattigo/blob/master/schemes/bgv/examples_parameters.go
-func (rlweStruct *SimpleRLWE_PIR_Protocol) generateParameters() error { //
-	var pt_mod uint64
-	pt_mod = 40961
-	//switch rlweStruct.mode {
-	//case RLWE_All_Keys:
-	//	pt_mod = 40961 //188417
-	//case RLWE_Whispir_2_Keys:
-	//	pt_mod = 40961
-	//case RLWE_Whispir_3_Keys:
-	//	pt_mod = 40961
-	//
-	//}
-
-	BGVParamsN12QP109 := bgv.ParametersLiteral{
-		LogN:             12,
-		LogQ:             []int{54},
-		LogP:             []int{55},
-		PlaintextModulus: pt_mod,
-	}
-
-	// Possible values for Plaintext Modulus:
-	// The larger, the higher a chance of failure
-	// 40961 -> the only one that works with WhisPIR trick
-	// 65537
-	// 114689
-	// 147457
-	// 163841
-	// 188417
-	// 270337 -> this one fails too frequently
-
-	params, err := bgv.NewParametersFromLiteral(BGVParamsN12QP109)
+// generateParameters generates the parameters of the parameter set of the instance, see
+// [SimpleRLWE_PIR_Protocol.SetParameterSet].
+func (rlweStruct *SimpleRLWE_PIR_Protocol) generateParameters() error {
+	params, err := rlweStruct.parameter_set.Parameters()
 	if err != nil {
-		return fmt.Errorf("could not create test HE Parameters %s", err)
+		return err
 	}
 	rlweStruct.parameters = params
 
@@ -74,14 +46,7 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) encryptRLWEPlaintexts(plaintexts []*r
 func (rlweStruct *SimpleRLWE_PIR_Protocol) generateEvaluationKeys(log2_bits_per_ct int) (*rlwe.MemEvaluationKeySet, error) {
 	kgen := rlwe.NewKeyGenerator(rlweStruct.parameters)
 
-	var gal_keys []*rlwe.GaloisKey
-	if rlweStruct.mode == RLWE_All_Keys {
-		gal_keys = kgen.GenGaloisKeysNew(rlwe.GaloisElementsForExpand(rlweStruct.parameters, log2_bits_per_ct), rlweStruct.secret_key)
-	} else if rlweStruct.mode == RLWE_Whispir_3_Keys {
-		gal_keys = kgen.GenGaloisKeysNew([]uint64{3, 5, 1167}, rlweStruct.secret_key)
-	} else if rlweStruct.mode == RLWE_Whispir_2_Keys {
-		gal_keys = kgen.GenGaloisKeysNew([]uint64{3, 1173}, rlweStruct.secret_key)
-	}
+	gal_keys := kgen.GenGaloisKeysNew(rlweStruct.galoisElements(log2_bits_per_ct), rlweStruct.secret_key)
 
 	evk := rlwe.NewMemEvaluationKeySet(nil, gal_keys...)
 
@@ -129,31 +94,57 @@ func (rlweStruct *SimpleRLWE_PIR_Protocol) transformDBToPlaintextForm(database [
 	// https://go.dev/doc/effective_go#slices
 	transformedDB := make([][]*rlwe.Plaintext, num_db_rows) // One row per unit of y.
 	for i := range transformedDB {
-		transformedDB[i] = make([]*rlwe.Plaintext, len(rlweStruct.response_ciphertexts))
-	}
-
-	// WARNING: Inner loop is not parallelizable
-	for k := 0; k < len(rlweStruct.response_ciphertexts); k++ {
-		for i := 0; i < num_db_rows; i++ {
-			start_index := rlweStruct.bytesPerCiphertext * k
-			end_index := rlweStruct.bytesPerCiphertext * (k + 1)
-			if end_index > len(database[i]) {
-				end_index = len(database[i])
-			}
-
-			row_data_plaintext, err := rlweStruct.BytesArrayToPlaintext(database[i], start_index, end_index)
-			if err != nil {
-				return err
-			}
-
-			transformedDB[i][k] = row_data_plaintext
+		row_data_plaintexts, err := rlweStruct.transformRowToPlaintextForm(database[i])
+		if err != nil {
+			return err
 		}
+		transformedDB[i] = row_data_plaintexts
 	}
 
 	rlweStruct.plaintextDB = transformedDB
 	return nil
 }
 
+// encodes a row of the database into one plaintext per response ciphertext
+func (rlweStruct *SimpleRLWE_PIR_Protocol) transformRowToPlaintextForm(row []byte) ([]*rlwe.Plaintext, error) {
+	return rlweStruct.rowToPlaintexts(row, len(rlweStruct.response_ciphertexts))
+}
+
+// encodes a row into the given number of plaintexts, padding it with zeros
+func (rlweStruct *SimpleRLWE_PIR_Protocol) rowToPlaintexts(row []byte, number_of_plaintexts int) ([]*rlwe.Plaintext, error) {
+	row_data_plaintexts := make([]*rlwe.Plaintext, number_of_plaintexts)
+	for k := range row_data_plaintexts {
+		start_index := rlweStruct.bytesPerCiphertext * k
+		end_index := rlweStruct.bytesPerCiphertext * (k + 1)
+		if end_index > len(row) {
+			end_index = len(row)
+		}
+		if start_index > end_index {
+			start_index = end_index
+		}
+
+		row_data_plaintext, err := rlweStruct.BytesArrayToPlaintext(row, start_index, end_index)
+		if err != nil {
+			return nil, err
+		}
+
+		row_data_plaintexts[k] = row_data_plaintext
+	}
+	return row_data_plaintexts, nil
+}
+
+// rlweEncodedDatabase is a database whose rows were encoded into plaintexts by
+// [SimpleRLWE_PIR_Protocol.EncodeDatabase].
+type rlweEncodedDatabase struct {
+	parameters                     bgv.Parameters
+	plaintextDB                    [][]*rlwe.Plaintext
+	number_of_response_ciphertexts int
+}
+
+func (db *rlweEncodedDatabase) NumRows() int {
+	return len(db.plaintextDB)
+}
+
 func twoKeyAutomorphism(eval *bgv.Evaluator, ctIn *rlwe.Ciphertext, galEl uint64) (*rlwe.Ciphertext, error) {
 
 	numMap := map[int][]int{
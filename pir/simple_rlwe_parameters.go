@@ -0,0 +1,245 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+
+	"github.com/tuneinsight/lattigo/v5/schemes/bgv"
+)
+
+// ErrUnsupportedParameterSet is returned when an RLWE request names a parameter set that the server
+// does not know, or carries parameters that differ from the parameter set that it names.
+var ErrUnsupportedParameterSet = errors.New("unsupported RLWE parameter set")
+
+// DefaultRLWEParameterSet is the name of the parameter set that requests are generated with unless
+// another one is chosen, e.g. with [SelectRLWEParameterSet]. Requests that don't name a parameter set
+// were generated with it.
+const DefaultRLWEParameterSet = "N12_QP109_T40961"
+
+// noiseMarginBits is the number of bits by which the estimated noise of a response ciphertext must
+// stay below the largest noise that still decrypts correctly.
+const noiseMarginBits = 2
+
+// maxLogQP128 maps LogN to the largest bit size of the modulus QP that provides 128 bits of security
+// for secrets with ternary coefficients, according to the Homomorphic Encryption Standard.
+var maxLogQP128 = map[int]int{
+	12: 109,
+	13: 218,
+	14: 438,
+	15: 881,
+}
+
+// RLWEParameterSet is a named set of BGV parameters that RLWE requests are generated with. Clients
+// pick the parameter set that suits the shape of the database, and name it in their requests, so
+// that the server encodes the database with the same parameters.
+type RLWEParameterSet struct {
+	// Name identifies the parameter set in requests.
+	Name string
+
+	literal bgv.ParametersLiteral
+
+	// noise maps the modes that the parameter set supports to the bits of noise that the expansion
+	// of the query and the selection of a row add to a response ciphertext, on top of the bits of
+	// the coefficients of the rows and of the number of rows. The values were measured over random
+	// rows and rounded up.
+	noise map[string]float64
+
+	// shapes are the shapes of the encodings of the ciphertexts and keys of the parameter set,
+	// see [RLWEParameterSet.encodingShapes]
+	shapesOnce sync.Once
+	shapes     *rlweShapes
+	shapesErr  error
+}
+
+// rlweParameterSets are the parameter sets that clients choose from. The WhisPIR expansion uses
+// Galois elements that are specific to LogN 12, so the larger rings only support RLWE_All_Keys.
+var rlweParameterSets = []*RLWEParameterSet{
+	{
+		Name: DefaultRLWEParameterSet,
+		literal: bgv.ParametersLiteral{
+			LogN:             12,
+			LogQ:             []int{54},
+			LogP:             []int{55},
+			PlaintextModulus: 40961,
+		},
+		noise: map[string]float64{
+			RLWE_All_Keys:       12,
+			RLWE_Whispir_3_Keys: 14,
+			RLWE_Whispir_2_Keys: 14.5,
+		},
+	},
+	{
+		// two bytes per coefficient halve the responses for small databases,
+		// but leave too little noise budget for the WhisPIR expansion
+		Name: "N12_QP109_T65537",
+		literal: bgv.ParametersLiteral{
+			LogN:             12,
+			LogQ:             []int{54},
+			LogP:             []int{55},
+			PlaintextModulus: 65537,
+		},
+		noise: map[string]float64{
+			RLWE_All_Keys: 12,
+		},
+	},
+	{
+		Name: "N13_QP120_T65537",
+		literal: bgv.ParametersLiteral{
+			LogN:             13,
+			LogQ:             []int{60},
+			LogP:             []int{60},
+			PlaintextModulus: 65537,
+		},
+		noise: map[string]float64{
+			RLWE_All_Keys: 13.5,
+		},
+	},
+}
+
+// LookupRLWEParameterSet returns the parameter set with the given name. The empty name stands for
+// [DefaultRLWEParameterSet]. If there is no parameter set with the name, the returned error wraps
+// [ErrUnsupportedParameterSet].
+func LookupRLWEParameterSet(name string) (*RLWEParameterSet, error) {
+	if name == "" {
+		name = DefaultRLWEParameterSet
+	}
+	for _, set := range rlweParameterSets {
+		if set.Name == name {
+			return set, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedParameterSet, name)
+}
+
+// SelectRLWEParameterSet returns the parameter set for one-dimensional requests of the given mode
+// over 2^log2_num_rows rows of at most row_size bytes. Among the parameter sets that decrypt the
+// responses correctly, it picks the one with the smallest request and response, see
+// [RLWEParameterSet.Supports]. Ties are broken in favour of [DefaultRLWEParameterSet].
+func SelectRLWEParameterSet(mode string, log2_num_rows int, row_size int) (*RLWEParameterSet, error) {
+	var (
+		selected *RLWEParameterSet
+		min_size int
+	)
+	for _, set := range rlweParameterSets {
+		if !set.Supports(mode, log2_num_rows) {
+			continue
+		}
+		if size := set.estimateSize(mode, log2_num_rows, row_size); selected == nil || size < min_size {
+			selected, min_size = set, size
+		}
+	}
+	if selected == nil {
+		return nil, fmt.Errorf("no RLWE parameter set supports mode %q with 2^%d rows", mode, log2_num_rows)
+	}
+	return selected, nil
+}
+
+// Parameters returns the BGV parameters of the parameter set. It refuses parameters whose modulus
+// is too large for the ring dimension to provide 128 bits of security.
+func (set *RLWEParameterSet) Parameters() (bgv.Parameters, error) {
+	if logQP, max_logQP := set.logQP(), maxLogQP128[set.literal.LogN]; logQP > max_logQP {
+		return bgv.Parameters{}, fmt.Errorf("parameter set %q has a %d bit modulus, at most %d bits are secure for LogN %d", set.Name, logQP, max_logQP, set.literal.LogN)
+	}
+
+	params, err := bgv.NewParametersFromLiteral(set.literal)
+	if err != nil {
+		return bgv.Parameters{}, fmt.Errorf("could not create HE parameters of parameter set %q: %w", set.Name, err)
+	}
+	return params, nil
+}
+
+// Supports reports whether responses to requests of the given mode over 2^log2_num_rows rows decrypt
+// correctly with the parameter set. The noise of a response ciphertext grows with the bits of the
+// coefficients of the rows and with the number of rows that are summed up, and must stay below
+// Q/(2t) by a margin.
+func (set *RLWEParameterSet) Supports(mode string, log2_num_rows int) bool {
+	mode_noise, ok := set.noise[mode]
+	if !ok || log2_num_rows < 0 {
+		return false
+	}
+
+	noise := float64(8*set.bytesPerCoefficient()+log2_num_rows) + mode_noise
+	return noise+noiseMarginBits <= set.maxNoise()
+}
+
+// maxNoise returns the bits of the largest noise of a ciphertext that still decrypts correctly.
+func (set *RLWEParameterSet) maxNoise() float64 {
+	logQ := 0
+	for _, bits := range set.literal.LogQ {
+		logQ += bits
+	}
+	return float64(logQ) - 1 - math.Log2(float64(set.literal.PlaintextModulus))
+}
+
+// digitBits returns the number of bits of the digits that recursive requests of the given mode decompose the
+// coefficients of ciphertexts into, to form the rows of a dimension of 2^log2_num_rows rows after the first. The
+// digits hold up to log t bits, but fewer if the noise of the selection among the rows wouldn't stay below the
+// largest noise by the margin otherwise, see [RLWEParameterSet.Supports]. It returns 0 if no digits are small
+// enough.
+func (set *RLWEParameterSet) digitBits(mode string, log2_num_rows int) int {
+	mode_noise, ok := set.noise[mode]
+	if !ok || log2_num_rows < 0 {
+		return 0
+	}
+
+	digit_bits := int(math.Floor(set.maxNoise() - noiseMarginBits - mode_noise - float64(log2_num_rows)))
+	if log_t := bits.Len64(set.literal.PlaintextModulus) - 1; digit_bits > log_t {
+		digit_bits = log_t
+	}
+	if digit_bits < 0 {
+		return 0
+	}
+	return digit_bits
+}
+
+// logQP returns the bit size of the modulus QP of the parameter set.
+func (set *RLWEParameterSet) logQP() int {
+	logQP := 0
+	for _, bits := range append(append([]int{}, set.literal.LogQ...), set.literal.LogP...) {
+		logQP += bits
+	}
+	return logQP
+}
+
+// bytesPerCoefficient returns the number of bytes of a row that are encoded into each coefficient
+// of a plaintext.
+func (set *RLWEParameterSet) bytesPerCoefficient() int {
+	return int(math.Floor(math.Log2(float64(set.literal.PlaintextModulus)))) / 8
+}
+
+// estimateSize estimates the number of bytes of a request, including its evaluation keys, and of
+// its response for the given shape of the database.
+func (set *RLWEParameterSet) estimateSize(mode string, log2_num_rows int, row_size int) int {
+	N := 1 << set.literal.LogN
+	q, p := len(set.literal.LogQ), len(set.literal.LogP)
+
+	// each ciphertext consists of two polynomials over Q, and each evaluation key of a
+	// decomposition of Q into parts of the size of P, each of two polynomials over QP
+	ciphertext := 2 * N * q * 8
+	evaluation_key := (q + p - 1) / p * 2 * N * (q + p) * 8
+
+	log2_bits_per_ct := log2_num_rows
+	if log2_bits_per_ct > set.literal.LogN {
+		log2_bits_per_ct = set.literal.LogN
+	}
+	num_query_cts := 1 << (log2_num_rows - log2_bits_per_ct)
+
+	num_keys := log2_bits_per_ct
+	switch mode {
+	case RLWE_Whispir_3_Keys:
+		num_keys = 3
+	case RLWE_Whispir_2_Keys:
+		num_keys = 2
+	}
+
+	bytes_per_ct := set.bytesPerCoefficient() * N
+	num_response_cts := (row_size + bytes_per_ct - 1) / bytes_per_ct
+	if num_response_cts < 1 {
+		num_response_cts = 1
+	}
+
+	return (num_query_cts+num_response_cts)*ciphertext + num_keys*evaluation_key
+}
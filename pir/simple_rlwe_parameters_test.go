@@ -0,0 +1,118 @@
+package pir
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+func TestRLWEParameterSets(t *testing.T) {
+	for _, set := range rlweParameterSets {
+		params, err := set.Parameters()
+		require.NoError(t, err, set.Name)
+		assert.LessOrEqual(t, set.logQP(), maxLogQP128[params.LogN()], set.Name)
+		assert.Equal(t, 1<<set.literal.LogN, params.N(), set.Name)
+
+		found, err := LookupRLWEParameterSet(set.Name)
+		require.NoError(t, err)
+		assert.Same(t, set, found)
+	}
+
+	// the default parameter set is the one that requests were generated with before
+	// they named their parameter set
+	set, err := LookupRLWEParameterSet("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRLWEParameterSet, set.Name)
+	assert.True(t, set.Supports(RLWE_All_Keys, 15))
+	assert.True(t, set.Supports(RLWE_Whispir_3_Keys, 13))
+	assert.True(t, set.Supports(RLWE_Whispir_2_Keys, 12))
+	assert.False(t, set.Supports(RLWE_All_Keys, 16))
+
+	_, err = LookupRLWEParameterSet("N11_QP54_T257")
+	assert.ErrorIs(t, err, ErrUnsupportedParameterSet)
+
+	insecure := &RLWEParameterSet{Name: "insecure", literal: set.literal}
+	insecure.literal.LogP = []int{55, 55}
+	_, err = insecure.Parameters()
+	assert.Error(t, err)
+}
+
+func TestSelectRLWEParameterSet(t *testing.T) {
+	for _, tc := range []struct {
+		mode          string
+		log2_num_rows int
+		row_size      int
+		expected      string
+	}{
+		// buckets of a routing table
+		{RLWE_All_Keys, 8, 1040, DefaultRLWEParameterSet},
+		{RLWE_Whispir_3_Keys, 8, 1040, DefaultRLWEParameterSet},
+		// few large rows fit in fewer response ciphertexts with larger coefficients
+		{RLWE_All_Keys, 4, 1 << 16, "N12_QP109_T65537"},
+		{RLWE_All_Keys, 10, 1 << 20, "N13_QP120_T65537"},
+		// the WhisPIR expansion only works with the default parameter set
+		{RLWE_Whispir_2_Keys, 4, 1 << 20, DefaultRLWEParameterSet},
+	} {
+		set, err := SelectRLWEParameterSet(tc.mode, tc.log2_num_rows, tc.row_size)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, set.Name, "%s with 2^%d rows of %d bytes", tc.mode, tc.log2_num_rows, tc.row_size)
+		assert.True(t, set.Supports(tc.mode, tc.log2_num_rows))
+	}
+
+	// the noise of the responses would exceed the noise budget of all parameter sets
+	_, err := SelectRLWEParameterSet(RLWE_Whispir_2_Keys, 14, 1040)
+	assert.Error(t, err)
+	_, err = SelectRLWEParameterSet(RLWE_All_Keys, 16, 1040)
+	assert.Error(t, err)
+}
+
+func TestSimpleRLWE_parameter_set(t *testing.T) {
+	log2_number_of_rows := 4
+	set, err := LookupRLWEParameterSet("N13_QP120_T65537")
+	require.NoError(t, err)
+	require.Nil(t, NewSimpleRLWE_PIR_Protocol_parameters(log2_number_of_rows, RLWE_Whispir_3_Keys, set))
+
+	db := make([][]byte, 1<<log2_number_of_rows)
+	db_element_size := 20000
+	for i := range db {
+		db[i] = make([]byte, db_element_size)
+		rand.Read(db[i])
+	}
+
+	client := NewSimpleRLWE_PIR_Protocol_parameters(log2_number_of_rows, RLWE_All_Keys, set)
+	require.NotNil(t, client)
+	req, err := client.GenerateRequestFromQuery(5)
+	require.NoError(t, err)
+	assert.Equal(t, set.Name, req.GetParameterSet())
+
+	// the server is configured with the parameter set of the request
+	server, err := NewDefaultRegistry().ProtocolForRequest(req, log2_number_of_rows)
+	require.NoError(t, err)
+	assert.Equal(t, set.Name, server.(ParameterizedPIR_Protocol).ParameterSet())
+
+	encoded, err := server.(DatabaseEncoder).EncodeDatabase(db)
+	require.NoError(t, err)
+	res, err := server.(DatabaseEncoder).ProcessRequestOverEncodedDatabase(context.Background(), req, encoded)
+	require.NoError(t, err)
+
+	row, err := client.ProcessResponseToPlaintext(res)
+	require.NoError(t, err)
+	require.Equal(t, db[5], row[:db_element_size])
+
+	// the parameters of a request must match the parameter set that it names
+	mismatched := proto.Clone(req).(*pb.PIR_Request)
+	mismatched.ParameterSet = DefaultRLWEParameterSet
+	_, err = NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, RLWE_All_Keys).ProcessRequestAndReturnResponse(context.Background(), mismatched, db)
+	assert.ErrorIs(t, err, ErrUnsupportedParameterSet)
+
+	unknown := proto.Clone(req).(*pb.PIR_Request)
+	unknown.ParameterSet = "N11_QP54_T257"
+	_, err = NewDefaultRegistry().ProtocolForRequest(unknown, log2_number_of_rows)
+	assert.ErrorIs(t, err, ErrUnsupportedParameterSet)
+}
@@ -0,0 +1,290 @@
+package pir
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/schemes/bgv"
+	"github.com/tuneinsight/lattigo/v5/utils/structs"
+)
+
+// MaxDimensions is the largest number of dimensions that a recursive request can arrange the database in.
+const MaxDimensions = 4
+
+// NewSimpleRLWE_PIR_Protocol_recursive returns a new instance that generates recursive requests, which arrange
+// the database as a hypercube with num_dimensions dimensions, in the style of SealPIR. The encrypted query holds a
+// single ciphertext per dimension, which the server expands into the indicator bits that select the index of the
+// requested row along that dimension. So the size of the query and the cost of the query expansion grow with the
+// num_dimensions-th root of the number of rows, instead of linearly.
+//
+// The server selects along the first dimension for every index of the remaining dimensions, as in the
+// one-dimensional mode. The coefficients of the response ciphertexts of each selection are then decomposed into
+// digits, which form the plaintexts of the rows of the database that the server selects from along the next
+// dimension. Each dimension after the first thus multiplies the size of the response by the number of plaintexts
+// that a ciphertext decomposes into, about 2·⌈log q / log t⌉, which is 8 with the default parameters. The mode only
+// pays off for databases whose one-dimensional query would take many ciphertexts. A num_dimensions of 1 selects the
+// one-dimensional mode.
+func NewSimpleRLWE_PIR_Protocol_recursive(log2_num_rows int, mode string, num_dimensions int) *SimpleRLWE_PIR_Protocol {
+	rlweStruct := NewSimpleRLWE_PIR_Protocol_mode(log2_num_rows, mode)
+	if rlweStruct == nil {
+		return nil
+	}
+	rlweStruct.num_dimensions = num_dimensions
+	if err := rlweStruct.validateDimensions(); err != nil {
+		return nil
+	}
+	return rlweStruct
+}
+
+// NewSimpleRLWE_PIR_Protocol_session_recursive is like [NewSimpleRLWE_PIR_Protocol_recursive], but generates the
+// requests with the key material of the session, see [NewSimpleRLWE_PIR_Protocol_session].
+func NewSimpleRLWE_PIR_Protocol_session_recursive(log2_num_rows int, session *SimpleRLWE_Session, num_dimensions int) *SimpleRLWE_PIR_Protocol {
+	rlweStruct := NewSimpleRLWE_PIR_Protocol_session(log2_num_rows, session)
+	if rlweStruct == nil {
+		return nil
+	}
+	rlweStruct.num_dimensions = num_dimensions
+	if err := rlweStruct.validateDimensions(); err != nil {
+		return nil
+	}
+	return rlweStruct
+}
+
+// isRecursive reports whether requests arrange the database in more than one dimension.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) isRecursive() bool {
+	return rlweStruct.num_dimensions > 1
+}
+
+// validateDimensions checks that the rows can be arranged in the number of dimensions, such that the index along
+// each dimension is selected by the coefficients of a single query ciphertext.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) validateDimensions() error {
+	if rlweStruct.num_dimensions < 0 || rlweStruct.num_dimensions > MaxDimensions {
+		return fmt.Errorf("number of dimensions must be between 1 and %d, got %d", MaxDimensions, rlweStruct.num_dimensions)
+	}
+	if !rlweStruct.isRecursive() {
+		return nil
+	}
+
+	if rlweStruct.log2_num_rows < rlweStruct.num_dimensions {
+		return fmt.Errorf("cannot arrange 2^%d rows in %d dimensions", rlweStruct.log2_num_rows, rlweStruct.num_dimensions)
+	}
+	if rlweStruct.log2_num_rows > rlweStruct.num_dimensions*rlweStruct.parameters.LogN() {
+		return fmt.Errorf("cannot arrange 2^%d rows in %d dimensions of at most 2^%d rows", rlweStruct.log2_num_rows, rlweStruct.num_dimensions, rlweStruct.parameters.LogN())
+	}
+	for _, log2_length := range rlweStruct.log2DimensionLengths()[1:] {
+		if rlweStruct.parameter_set.digitBits(rlweStruct.mode, log2_length) < 1 {
+			return fmt.Errorf("parameter set %q leaves no noise budget to select among 2^%d rows of decomposed ciphertexts", rlweStruct.parameter_set.Name, log2_length)
+		}
+	}
+	return nil
+}
+
+// log2DimensionLengths returns the log of the length of each dimension, see [log2DimensionLengths].
+func (rlweStruct *SimpleRLWE_PIR_Protocol) log2DimensionLengths() []int {
+	return log2DimensionLengths(rlweStruct.log2_num_rows, rlweStruct.num_dimensions)
+}
+
+// log2DimensionLengths returns the log of the length of each dimension when 2^log2_num_rows rows are arranged in
+// num_dimensions dimensions. The lengths differ by at most a factor of two, with the first dimensions being the
+// longer ones. The index of a row along the first dimension is given by its least significant bits.
+func log2DimensionLengths(log2_num_rows int, num_dimensions int) []int {
+	lengths := make([]int, num_dimensions)
+	for i := range lengths {
+		lengths[i] = log2_num_rows / num_dimensions
+		if i < log2_num_rows%num_dimensions {
+			lengths[i]++
+		}
+	}
+	return lengths
+}
+
+// numDigits returns the number of digits of digit_bits bits that the coefficients modulo q are decomposed into.
+func numDigits(q uint64, digit_bits int) int {
+	return (bits.Len64(q-1) + digit_bits - 1) / digit_bits
+}
+
+// plaintextsPerCiphertext returns the number of plaintexts that a ciphertext of degree one at the largest level
+// decomposes into with digits of digit_bits bits, see [SimpleRLWE_PIR_Protocol.decomposeCiphertexts].
+func (rlweStruct *SimpleRLWE_PIR_Protocol) plaintextsPerCiphertext(digit_bits int) int {
+	num_plaintexts := 0
+	for _, q := range rlweStruct.parameters.Q() {
+		num_plaintexts += 2 * numDigits(q, digit_bits)
+	}
+	return num_plaintexts
+}
+
+// decomposeCiphertexts decomposes the coefficients of the ciphertexts into digits of digit_bits bits, in the
+// style of SealPIR, and encodes the digits into the plaintexts of a row of the next dimension. Each polynomial of
+// a ciphertext is decomposed modulo each of its moduli q_i into ⌈log q_i / digit_bits⌉ plaintexts, one for each
+// digit, which hold the digit of all coefficients of the polynomial. The metadata of the ciphertexts is left
+// out, as all selections share it, see [SimpleRLWE_PIR_Protocol.recomposeCiphertexts].
+func (rlweStruct *SimpleRLWE_PIR_Protocol) decomposeCiphertexts(cts structs.Vector[rlwe.Ciphertext], digit_bits int) ([]*rlwe.Plaintext, error) {
+	encoder := bgv.NewEncoder(rlweStruct.parameters)
+	moduli := rlweStruct.parameters.Q()
+	mask := uint64(1)<<digit_bits - 1
+
+	var plaintexts []*rlwe.Plaintext
+	digits := make([]uint64, rlweStruct.parameters.N())
+	for k := range cts {
+		for _, poly := range cts[k].Value {
+			for i, coeffs := range poly.Coeffs {
+				for d := 0; d < numDigits(moduli[i], digit_bits); d++ {
+					for j, coeff := range coeffs {
+						digits[j] = coeff >> (d * digit_bits) & mask
+					}
+
+					plaintext := bgv.NewPlaintext(rlweStruct.parameters, rlweStruct.parameters.MaxLevel())
+					plaintext.IsBatched = false
+					if err := encoder.Encode(digits, plaintext); err != nil {
+						return nil, fmt.Errorf("could not encode the digits of a ciphertext %s", err)
+					}
+					plaintexts = append(plaintexts, plaintext)
+				}
+			}
+		}
+	}
+	return plaintexts, nil
+}
+
+// recomposeCiphertexts recomposes the ciphertexts from the digits of their coefficients, that were decrypted from
+// the plaintexts of [SimpleRLWE_PIR_Protocol.decomposeCiphertexts]. The ciphertexts take the metadata of the
+// template, as the selections along all dimensions result in ciphertexts with the same metadata.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) recomposeCiphertexts(digits [][]uint64, digit_bits int, template *rlwe.Ciphertext) (structs.Vector[rlwe.Ciphertext], error) {
+	moduli := rlweStruct.parameters.Q()
+	level := rlweStruct.parameters.MaxLevel()
+	if template.Degree() != 1 || template.Level() != level {
+		return nil, fmt.Errorf("response ciphertexts of degree %d at level %d, expected degree 1 at level %d", template.Degree(), template.Level(), level)
+	}
+
+	per_ct := rlweStruct.plaintextsPerCiphertext(digit_bits)
+	if len(digits)%per_ct != 0 {
+		return nil, fmt.Errorf("%d decomposed plaintexts don't make up ciphertexts of %d plaintexts each", len(digits), per_ct)
+	}
+
+	cts := make(structs.Vector[rlwe.Ciphertext], len(digits)/per_ct)
+	next := 0
+	for k := range cts {
+		ct := rlwe.NewCiphertext(rlweStruct.parameters, 1, level)
+		*ct.MetaData = *template.MetaData
+		for _, poly := range ct.Value {
+			for i, coeffs := range poly.Coeffs {
+				for d := 0; d < numDigits(moduli[i], digit_bits); d++ {
+					for j := range coeffs {
+						coeffs[j] |= digits[next][j] << (d * digit_bits)
+					}
+					next++
+				}
+			}
+		}
+		cts[k] = *ct
+	}
+	return cts, nil
+}
+
+// generateRecursiveQuery encrypts the query for the requested row, with one ciphertext per dimension, which
+// selects the index of the row along that dimension.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) generateRecursiveQuery(requested_row int) ([]rlwe.Ciphertext, error) {
+	if requested_row < 0 || requested_row >= 1<<rlweStruct.log2_num_rows {
+		return nil, fmt.Errorf("requested row %d is out of range of 2^%d rows", requested_row, rlweStruct.log2_num_rows)
+	}
+
+	encoder := bgv.NewEncoder(rlweStruct.parameters)
+	num_slots := rlweStruct.parameters.MaxSlots()
+
+	lengths := rlweStruct.log2DimensionLengths()
+	plaintexts := make([]*rlwe.Plaintext, len(lengths))
+	for i, log2_length := range lengths {
+		query_encoded := make([]uint64, num_slots) // default value is zero
+		query_encoded[requested_row&(1<<log2_length-1)] = 1
+		requested_row >>= log2_length
+
+		query_plaintext := bgv.NewPlaintext(rlweStruct.parameters, rlweStruct.parameters.MaxLevel())
+		query_plaintext.IsBatched = false
+		err := encoder.Encode(query_encoded, query_plaintext)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode query ciphertext %s", err)
+		}
+		plaintexts[i] = query_plaintext
+	}
+
+	return rlweStruct.encryptRLWEPlaintexts(plaintexts)
+}
+
+// processRecursiveRequestOverPlaintextDB evaluates the unmarshalled recursive request over the plaintextDB, one
+// dimension after the other, and sets the response ciphertexts to the selection along the last dimension.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) processRecursiveRequestOverPlaintextDB(ctx context.Context) error {
+	lengths := rlweStruct.log2DimensionLengths()
+	if len(rlweStruct.encrypted_query) != len(lengths) {
+		return fmt.Errorf("recursive query has %d ciphertexts, expected one for each of the %d dimensions", len(rlweStruct.encrypted_query), len(lengths))
+	}
+	if len(rlweStruct.plaintextDB) > 1<<rlweStruct.log2_num_rows {
+		return fmt.Errorf("initialize this struct with log2_num_rows as greater than or equal to the log of the number of rows in the DB")
+	}
+
+	evaluator := bgv.NewEvaluator(rlweStruct.parameters, rlweStruct.evaluation_keys)
+
+	rows := rlweStruct.plaintextDB
+	for i, log2_length := range lengths {
+		indicator_bits, err := customExpand(evaluator, rlweStruct.mode, &rlweStruct.encrypted_query[i], log2_length, 0)
+		if err != nil {
+			return err
+		}
+
+		// rows that are missing at the end of a dimension select to an encryption of zero
+		length := 1 << log2_length
+		num_groups := (len(rows) + length - 1) / length
+		next_rows := make([][]*rlwe.Plaintext, num_groups)
+		for g := range next_rows {
+			end := (g + 1) * length
+			if end > len(rows) {
+				end = len(rows)
+			}
+
+			selected, err := selectRow(ctx, evaluator, indicator_bits, rows[g*length:end])
+			if err != nil {
+				return fmt.Errorf("dimension %d: %w", i, err)
+			}
+
+			if i == len(lengths)-1 {
+				rlweStruct.response_ciphertexts = selected
+				return nil
+			}
+
+			// decompose the selected ciphertexts into the plaintexts of a row of the next dimension
+			next_rows[g], err = rlweStruct.decomposeCiphertexts(selected, rlweStruct.parameter_set.digitBits(rlweStruct.mode, lengths[i+1]))
+			if err != nil {
+				return err
+			}
+		}
+		rows = next_rows
+	}
+
+	return fmt.Errorf("recursive query did not select a row")
+}
+
+// selectRow returns the sum of the products of the indicator bits and the plaintexts of the rows, which encrypts
+// the row that the indicator bits select. It returns the error of ctx once ctx is done.
+func selectRow(ctx context.Context, evaluator *bgv.Evaluator, indicator_bits []*rlwe.Ciphertext, rows [][]*rlwe.Plaintext) (structs.Vector[rlwe.Ciphertext], error) {
+	selected := make(structs.Vector[rlwe.Ciphertext], len(rows[0]))
+	for k := range selected {
+		for i := range rows {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			multiplied, err := evaluator.MulNew(indicator_bits[i], rows[i][k])
+			if err != nil {
+				return nil, fmt.Errorf("MulNew failed. Check function description for conditions leading to errors. Error: %s", err)
+			}
+
+			if i == 0 {
+				selected[k] = *multiplied
+			} else if err := evaluator.Add(&selected[k], multiplied, &selected[k]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return selected, nil
+}
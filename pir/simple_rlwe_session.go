@@ -0,0 +1,136 @@
+package pir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/schemes/bgv"
+)
+
+// ErrUnknownEvaluationKeys is returned when a PIR request references evaluation keys that the
+// server does not hold, e.g. because they were evicted from its cache. The client should send
+// the evaluation keys with the request again.
+var ErrUnknownEvaluationKeys = errors.New("unknown PIR evaluation keys")
+
+// evaluationKeysIDLength is the length in bytes of the random identifiers of evaluation keys.
+const evaluationKeysIDLength = 16
+
+// SimpleRLWE_Session holds key material that a client reuses across the requests that it sends
+// to a single server. The evaluation keys are sent to the server with a request, until the server
+// confirms that it cached them. Subsequent requests only reference them by their ID and carry the
+// encrypted query. Key material must not be shared between servers, as it would allow them to
+// link the requests of the client. It is safe for concurrent use.
+type SimpleRLWE_Session struct {
+	mode          string
+	parameter_set *RLWEParameterSet
+	parameters    bgv.Parameters
+	secret_key    *rlwe.SecretKey
+
+	mu sync.Mutex
+
+	// evaluation_keys holds the evaluation keys for each log2_bits_per_ct that
+	// requests of the session were generated for.
+	evaluation_keys map[int]*sessionEvaluationKeys
+}
+
+// sessionEvaluationKeys holds evaluation keys of a session along with their ID.
+type sessionEvaluationKeys struct {
+	id   []byte
+	keys *rlwe.MemEvaluationKeySet
+
+	// cached is set once the server confirmed that it cached the keys
+	cached bool
+}
+
+// NewSimpleRLWE_Session returns a new [SimpleRLWE_Session] for requests of the given mode, with
+// freshly generated key material for the [DefaultRLWEParameterSet].
+func NewSimpleRLWE_Session(mode string) (*SimpleRLWE_Session, error) {
+	set, err := LookupRLWEParameterSet(DefaultRLWEParameterSet)
+	if err != nil {
+		return nil, err
+	}
+	return NewSimpleRLWE_Session_parameters(mode, set)
+}
+
+// NewSimpleRLWE_Session_parameters is like [NewSimpleRLWE_Session], but generates the key material
+// for the given parameter set.
+func NewSimpleRLWE_Session_parameters(mode string, set *RLWEParameterSet) (*SimpleRLWE_Session, error) {
+	rlweStruct := &SimpleRLWE_PIR_Protocol{mode: mode, parameter_set: set}
+	err := rlweStruct.generateParameters()
+	if err != nil {
+		return nil, err
+	}
+
+	err = rlweStruct.CreatePrivateKeyMaterial()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SimpleRLWE_Session{
+		mode:            mode,
+		parameter_set:   set,
+		parameters:      rlweStruct.parameters,
+		secret_key:      rlweStruct.secret_key,
+		evaluation_keys: make(map[int]*sessionEvaluationKeys),
+	}, nil
+}
+
+// Mode returns the mode of the requests of the session.
+func (s *SimpleRLWE_Session) Mode() string {
+	return s.mode
+}
+
+// evaluationKeys returns the ID of the evaluation keys for the given log2_bits_per_ct, generating
+// them on first use. It also returns the keys, unless the server confirmed that it cached them.
+func (s *SimpleRLWE_Session) evaluationKeys(rlweStruct *SimpleRLWE_PIR_Protocol, log2_bits_per_ct int) ([]byte, *rlwe.MemEvaluationKeySet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evk, ok := s.evaluation_keys[log2_bits_per_ct]
+	if !ok {
+		keys, err := rlweStruct.generateEvaluationKeys(log2_bits_per_ct)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		id := make([]byte, evaluationKeysIDLength)
+		if _, err := rand.Read(id); err != nil {
+			return nil, nil, fmt.Errorf("generate evaluation keys id: %w", err)
+		}
+
+		evk = &sessionEvaluationKeys{id: id, keys: keys}
+		s.evaluation_keys[log2_bits_per_ct] = evk
+	}
+
+	if evk.cached {
+		return evk.id, nil, nil
+	}
+	return evk.id, evk.keys, nil
+}
+
+// confirmCached records that the server cached the evaluation keys with the given ID.
+func (s *SimpleRLWE_Session) confirmCached(id []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, evk := range s.evaluation_keys {
+		if string(evk.id) == string(id) {
+			evk.cached = true
+		}
+	}
+}
+
+// ResendEvaluationKeys makes the subsequent requests of the session carry the evaluation keys
+// again, until the server confirms that it cached them. It is called when the server responded
+// that it doesn't hold the evaluation keys that a request referenced.
+func (s *SimpleRLWE_Session) ResendEvaluationKeys() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, evk := range s.evaluation_keys {
+		evk.cached = false
+	}
+}
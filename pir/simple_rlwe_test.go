@@ -1,12 +1,17 @@
 package pir
 
 import (
+	"context"
 	"math/rand"
 	"testing"
 	"time"
 
 	"github.com/plprobelab/zikade/pb"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/utils/structs"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestSimpleRLWEPIRQuery_UnmarshallRequestFromPB(t *testing.T) {
@@ -39,7 +44,7 @@ func TestPIR_Protocol_Simple_RLWE_ProcessRequestAndReturnResponse(t *testing.T)
 		db[i] = make([]byte, 20*256)
 	}
 
-	_, err = chosen_PIR_Protocol.ProcessRequestAndReturnResponse(pirRequest, db)
+	_, err = chosen_PIR_Protocol.ProcessRequestAndReturnResponse(context.Background(), pirRequest, db)
 	require.NoError(t, err)
 
 }
@@ -95,7 +100,7 @@ func TestPIR_ProcessRequestAndReturnResponse_Correctness(t *testing.T) {
 			}
 		}
 
-		response, err = server_PIR_Protocol.ProcessRequestAndReturnResponse(pirRequest, db)
+		response, err = server_PIR_Protocol.ProcessRequestAndReturnResponse(context.Background(), pirRequest, db)
 		require.NoError(t, err)
 
 	} // end server
@@ -141,7 +146,7 @@ func TestPIR_ProcessRequestAndReturnResponse_Correctness_LessThan256Rows(t *test
 			}
 		}
 
-		response, err = server_PIR_Protocol.ProcessRequestAndReturnResponse(pirRequest, db)
+		response, err = server_PIR_Protocol.ProcessRequestAndReturnResponse(context.Background(), pirRequest, db)
 		require.NoError(t, err)
 
 	} // end server
@@ -159,6 +164,177 @@ func TestPIR_ProcessRequestAndReturnResponse_Correctness_LessThan256Rows(t *test
 
 }
 
+func TestPIR_ProcessRequestOverEncodedDatabase_Correctness(t *testing.T) {
+	log2_number_of_rows := 4
+	mode := RLWE_Whispir_3_Keys
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	// server encodes the database once
+	db := make([][]byte, 1<<log2_number_of_rows)
+	db_element_size := 20 * 256
+	for i := range db {
+		db[i] = make([]byte, db_element_size)
+		for j := 0; j < db_element_size; j++ {
+			db[i][j] = byte(rand.New(seed).Intn(256))
+		}
+	}
+	encoded, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).EncodeDatabase(db)
+	require.NoError(t, err)
+	require.Equal(t, len(db), encoded.NumRows())
+
+	// and processes the requests of several clients over it
+	for _, query := range []int{3, 11} {
+		client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		err := client_PIR_Protocol.CreatePrivateKeyMaterial()
+		require.NoError(t, err)
+
+		pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(query)
+		require.NoError(t, err)
+
+		server_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		response, err := server_PIR_Protocol.ProcessRequestOverEncodedDatabase(context.Background(), pirRequest, encoded)
+		require.NoError(t, err)
+
+		response_bytes, err := client_PIR_Protocol.ProcessResponseToPlaintext(response)
+		require.NoError(t, err)
+		require.Equal(t, db[query], response_bytes[:db_element_size])
+	}
+}
+
+func TestPIR_ProcessRequestOverEncodedDatabase_worker_pool(t *testing.T) {
+	log2_number_of_rows := 4
+	mode := RLWE_Whispir_3_Keys
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	// the database spans several response ciphertexts and lacks rows at the end
+	db := randomDatabase(seed, 13, 20*256)
+	encoded, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).EncodeDatabase(db)
+	require.NoError(t, err)
+
+	workers, err := NewWorkerPool(context.Background(), 3)
+	require.NoError(t, err)
+	defer workers.Close()
+
+	for _, query := range []int{0, 7, 12} {
+		client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		require.NoError(t, client_PIR_Protocol.CreatePrivateKeyMaterial())
+
+		pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(query)
+		require.NoError(t, err)
+
+		server_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		server_PIR_Protocol.SetWorkerPool(workers)
+		response, err := server_PIR_Protocol.ProcessRequestOverEncodedDatabase(context.Background(), pirRequest, encoded)
+		require.NoError(t, err)
+
+		response_bytes, err := client_PIR_Protocol.ProcessResponseToPlaintext(response)
+		require.NoError(t, err)
+		require.Equal(t, db[query], response_bytes[:len(db[query])])
+	}
+
+	// a closed pool fails the evaluation
+	workers.Close()
+	client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+	require.NoError(t, client_PIR_Protocol.CreatePrivateKeyMaterial())
+	pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(0)
+	require.NoError(t, err)
+
+	server_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+	server_PIR_Protocol.SetWorkerPool(workers)
+	_, err = server_PIR_Protocol.ProcessRequestOverEncodedDatabase(context.Background(), pirRequest, encoded)
+	require.ErrorIs(t, err, ErrWorkerPoolClosed)
+}
+
+func TestPIR_UpdateEncodedDatabase_Correctness(t *testing.T) {
+	log2_number_of_rows := 4
+	mode := RLWE_Whispir_3_Keys
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	db := make([][]byte, 1<<log2_number_of_rows)
+	db_element_size := 20 * 256
+	for i := range db {
+		db[i] = make([]byte, db_element_size)
+		for j := 0; j < db_element_size; j++ {
+			db[i][j] = byte(rand.New(seed).Intn(256))
+		}
+	}
+	encoded, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).EncodeDatabase(db)
+	require.NoError(t, err)
+
+	// replace a row and only encode it again
+	changed := 5
+	updated_db := make([][]byte, len(db))
+	copy(updated_db, db)
+	updated_db[changed] = make([]byte, db_element_size)
+	for j := 0; j < db_element_size; j++ {
+		updated_db[changed][j] = byte(rand.New(seed).Intn(256))
+	}
+	updated, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).UpdateEncodedDatabase(encoded, updated_db, []int{changed})
+	require.NoError(t, err)
+
+	for _, query := range []int{changed, 9} {
+		client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		err := client_PIR_Protocol.CreatePrivateKeyMaterial()
+		require.NoError(t, err)
+
+		pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(query)
+		require.NoError(t, err)
+
+		server_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		response, err := server_PIR_Protocol.ProcessRequestOverEncodedDatabase(context.Background(), pirRequest, updated)
+		require.NoError(t, err)
+
+		response_bytes, err := client_PIR_Protocol.ProcessResponseToPlaintext(response)
+		require.NoError(t, err)
+		require.Equal(t, updated_db[query], response_bytes[:db_element_size])
+	}
+}
+
+func TestPIR_GenerateRequestFromQueries_Correctness(t *testing.T) {
+	log2_number_of_rows := 8
+	mode := RLWE_Whispir_3_Keys
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	// client requests a bucket and its neighbour in one request
+	client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+	queries := []int{41, 42, 200}
+	pirRequest, err := client_PIR_Protocol.GenerateRequestFromQueries(queries)
+	require.NoError(t, err)
+	require.Empty(t, pirRequest.GetEncryptedQuery())
+	require.Len(t, pirRequest.GetBatchEncryptedQueries(), len(queries))
+
+	// server
+	db := make([][]byte, 1<<log2_number_of_rows)
+	db_element_size := 20 * 256
+	for i := range db {
+		db[i] = make([]byte, db_element_size)
+		for j := 0; j < db_element_size; j++ {
+			db[i][j] = byte(rand.New(seed).Intn(256))
+		}
+	}
+	server_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+	response, err := server_PIR_Protocol.ProcessRequestAndReturnResponse(context.Background(), pirRequest, db)
+	require.NoError(t, err)
+
+	// client response processing
+	rows, err := client_PIR_Protocol.ProcessBatchResponseToPlaintexts(response)
+	require.NoError(t, err)
+	require.Len(t, rows, len(queries))
+	for i, query := range queries {
+		require.Equal(t, db[query], rows[i][:db_element_size])
+	}
+}
+
+func TestPIR_GenerateRequestFromQueries_too_many_rows(t *testing.T) {
+	client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(8, RLWE_Whispir_3_Keys)
+
+	_, err := client_PIR_Protocol.GenerateRequestFromQueries(nil)
+	require.Error(t, err)
+
+	_, err = client_PIR_Protocol.GenerateRequestFromQueries(make([]int, MaxBatchQueries+1))
+	require.Error(t, err)
+}
+
 func Benchmark_Key_Sizes(b *testing.B) {
 	log2_number_of_rows := 4
 	client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol(log2_number_of_rows)
@@ -189,7 +365,7 @@ func Benchmark_Key_Sizes(b *testing.B) {
 			}
 		}
 
-		response, err = server_PIR_Protocol.ProcessRequestAndReturnResponse(pirRequest, db)
+		response, err = server_PIR_Protocol.ProcessRequestAndReturnResponse(context.Background(), pirRequest, db)
 		require.NoError(b, err)
 
 	} // end server
@@ -214,3 +390,205 @@ func Benchmark_Possible_Eval_key_sizes(b *testing.B) {
 	}
 
 }
+
+func TestPIR_Session_ReusesEvaluationKeys(t *testing.T) {
+	log2_number_of_rows := 4
+	mode := RLWE_Whispir_3_Keys
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	db := make([][]byte, 1<<log2_number_of_rows)
+	db_element_size := 20 * 256
+	for i := range db {
+		db[i] = make([]byte, db_element_size)
+		for j := 0; j < db_element_size; j++ {
+			db[i][j] = byte(rand.New(seed).Intn(256))
+		}
+	}
+
+	session, err := NewSimpleRLWE_Session(mode)
+	require.NoError(t, err)
+	require.Equal(t, mode, session.Mode())
+
+	// the server plays the part of the evaluation key cache
+	var cachedKeys []byte
+	runRequest := func(query int, cache bool) *pb.PIR_Request {
+		client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_session(log2_number_of_rows, session)
+		pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(query)
+		require.NoError(t, err)
+		require.NotEmpty(t, pirRequest.GetEvaluationKeysId())
+
+		if keys := pirRequest.GetRLWEEvaluationKeys(); keys != nil {
+			cachedKeys = keys
+		}
+		sent := proto.Clone(pirRequest).(*pb.PIR_Request)
+		if pirRequest.GetSchemeDependent() == nil {
+			pirRequest.SchemeDependent = &pb.PIR_Request_RLWEEvaluationKeys{RLWEEvaluationKeys: cachedKeys}
+		}
+
+		server_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		response, err := server_PIR_Protocol.ProcessRequestAndReturnResponse(context.Background(), pirRequest, db)
+		require.NoError(t, err)
+		response.EvaluationKeysCached = cache
+
+		response_bytes, err := client_PIR_Protocol.ProcessResponseToPlaintext(response)
+		require.NoError(t, err)
+		require.Equal(t, db[query], response_bytes[:db_element_size])
+
+		return sent
+	}
+
+	// the keys are sent until the server confirms that it cached them
+	first := runRequest(3, false)
+	require.NotNil(t, first.GetRLWEEvaluationKeys())
+	second := runRequest(5, true)
+	require.NotNil(t, second.GetRLWEEvaluationKeys())
+	require.Equal(t, first.GetEvaluationKeysId(), second.GetEvaluationKeysId())
+
+	// then the requests only reference them by their id
+	third := runRequest(11, false)
+	require.Nil(t, third.GetSchemeDependent())
+	require.Equal(t, first.GetEvaluationKeysId(), third.GetEvaluationKeysId())
+
+	// until the server lost them
+	session.ResendEvaluationKeys()
+	fourth := runRequest(7, false)
+	require.NotNil(t, fourth.GetRLWEEvaluationKeys())
+	require.Equal(t, first.GetEvaluationKeysId(), fourth.GetEvaluationKeysId())
+}
+
+func TestPIR_Recursive_Correctness(t *testing.T) {
+	log2_number_of_rows := 8
+	mode := RLWE_Whispir_3_Keys
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	// the database lacks rows at the end, which are selected as empty rows
+	db := make([][]byte, 200)
+	db_element_size := 2 * 256
+	for i := range db {
+		db[i] = make([]byte, db_element_size)
+		for j := 0; j < db_element_size; j++ {
+			db[i][j] = byte(rand.New(seed).Intn(256))
+		}
+	}
+	encoded, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).EncodeDatabase(db)
+	require.NoError(t, err)
+
+	for _, num_dimensions := range []int{2, 3} {
+		for _, query := range []int{0, 77, 199, 250} {
+			client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_recursive(log2_number_of_rows, mode, num_dimensions)
+			require.NotNil(t, client_PIR_Protocol)
+
+			pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(query)
+			require.NoError(t, err)
+			require.EqualValues(t, num_dimensions, pirRequest.GetNumDimensions())
+
+			server_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+			response, err := server_PIR_Protocol.ProcessRequestOverEncodedDatabase(context.Background(), pirRequest, encoded)
+			require.NoError(t, err)
+
+			response_bytes, err := client_PIR_Protocol.ProcessResponseToPlaintext(response)
+			require.NoError(t, err)
+			if query < len(db) {
+				require.Equal(t, db[query], response_bytes[:db_element_size])
+			} else {
+				for _, b := range response_bytes {
+					require.Zero(t, b)
+				}
+			}
+		}
+	}
+}
+
+func TestPIR_Recursive_response_size(t *testing.T) {
+	log2_number_of_rows := 8
+	mode := RLWE_Whispir_3_Keys
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	encoded, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).EncodeDatabase(randomDatabase(seed, 1<<log2_number_of_rows, 256))
+	require.NoError(t, err)
+
+	num_response_cts := func(num_dimensions int) int {
+		client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_recursive(log2_number_of_rows, mode, num_dimensions)
+		require.NotNil(t, client_PIR_Protocol)
+		pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(7)
+		require.NoError(t, err)
+
+		response, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).ProcessRequestOverEncodedDatabase(context.Background(), pirRequest, encoded)
+		require.NoError(t, err)
+
+		var response_ciphertexts structs.Vector[rlwe.Ciphertext]
+		require.NoError(t, response_ciphertexts.UnmarshalBinary(response.GetCiphertexts()))
+		return len(response_ciphertexts)
+	}
+
+	// each dimension after the first decomposes the 2 polynomials of a ciphertext into digits of log t bits
+	one := num_response_cts(1)
+	assert.Equal(t, 8*one, num_response_cts(2))
+	assert.Equal(t, 8*8*one, num_response_cts(3))
+}
+
+func TestSimpleRLWE_EstimateCost_recursive(t *testing.T) {
+	log2_number_of_rows := 12
+	mode := RLWE_Whispir_3_Keys
+	server := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+
+	req := &pb.PIR_Request{Scheme: mode, Log2NumRows: int64(log2_number_of_rows)}
+	cost, err := server.EstimateCost(req, 1<<log2_number_of_rows, 256)
+	require.NoError(t, err)
+
+	// the queries of both dimensions are expanded into 2^6 indicator ciphertexts each, and the second
+	// dimension selects among 2^6 rows of the 8 plaintexts of a decomposed ciphertext
+	req.NumDimensions = 2
+	recursiveCost, err := server.EstimateCost(req, 1<<log2_number_of_rows, 256)
+	require.NoError(t, err)
+
+	N := int64(server.parameters.N())
+	q := int64(server.parameters.QCount())
+	p := int64(server.parameters.PCount())
+	key_switch := mulCost(2, N, q, q+p)
+	multiplication := mulCost(2, N, q)
+	assert.Equal(t, (64+64)*key_switch+(4096+64*8)*multiplication, recursiveCost)
+	assert.Less(t, recursiveCost, cost)
+
+	// requests that can't be arranged in their dimensions are refused
+	req.NumDimensions = MaxDimensions + 1
+	_, err = server.EstimateCost(req, 1<<log2_number_of_rows, 256)
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+func TestPIR_Recursive_invalid_dimensions(t *testing.T) {
+	require.Nil(t, NewSimpleRLWE_PIR_Protocol_recursive(8, RLWE_Whispir_3_Keys, MaxDimensions+1))
+	require.Nil(t, NewSimpleRLWE_PIR_Protocol_recursive(2, RLWE_Whispir_3_Keys, 3))
+	require.Nil(t, NewSimpleRLWE_PIR_Protocol_recursive(25, RLWE_Whispir_3_Keys, 2))
+}
+
+func TestPIR_ProcessRequestOverEncodedDatabase_cancelled(t *testing.T) {
+	log2_number_of_rows := 4
+	mode := RLWE_Whispir_3_Keys
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	db := randomDatabase(seed, 16, 256)
+	encoded, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).EncodeDatabase(db)
+	require.NoError(t, err)
+
+	client_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+	require.NoError(t, client_PIR_Protocol.CreatePrivateKeyMaterial())
+	pirRequest, err := client_PIR_Protocol.GenerateRequestFromQuery(3)
+	require.NoError(t, err)
+
+	workers, err := NewWorkerPool(context.Background(), 2)
+	require.NoError(t, err)
+	defer workers.Close()
+
+	// the evaluation stops once the client went away, with and without workers
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, pool := range []*WorkerPool{nil, workers} {
+		server_PIR_Protocol := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		if pool != nil {
+			server_PIR_Protocol.SetWorkerPool(pool)
+		}
+		_, err = server_PIR_Protocol.ProcessRequestOverEncodedDatabase(ctx, pirRequest, encoded)
+		require.ErrorIs(t, err, context.Canceled)
+	}
+}
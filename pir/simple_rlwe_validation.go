@@ -0,0 +1,276 @@
+package pir
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/ring"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+// ErrInvalidRequest is returned when a PIR request is malformed, e.g. because its encrypted query or its
+// evaluation keys don't have the shape that its parameters and its number of rows call for. RLWE requests
+// are validated before their ciphertexts and keys are unmarshalled, so that a malformed request can't make
+// the server allocate or compute more than a well-formed request of the same database.
+var ErrInvalidRequest = errors.New("invalid PIR request")
+
+// encodingShape describes the binary encodings of the ciphertexts or keys of a parameter set. Encodings of
+// the same shape only differ in the bytes of their coefficients, while their lengths, headers and metadata,
+// from which lattigo allocates while unmarshalling, are the same.
+type encodingShape struct {
+	// template is an encoding of the shape with all coefficients zero
+	template []byte
+
+	// coefficients are the [start, end) ranges of the coefficients in the encodings
+	coefficients [][2]int
+}
+
+// newEncodingShape returns the shape of the two encodings of the same object, once with all coefficients
+// zero and once with all bits of the coefficients set. The bytes in which they differ are the coefficients.
+func newEncodingShape(zero []byte, ones []byte) (*encodingShape, error) {
+	if len(zero) != len(ones) {
+		return nil, fmt.Errorf("encodings of the same shape differ in length, %d and %d bytes", len(zero), len(ones))
+	}
+
+	shape := &encodingShape{template: zero}
+	for i := 0; i < len(zero); {
+		if zero[i] == ones[i] {
+			i++
+			continue
+		}
+		start := i
+		for i < len(zero) && zero[i] != ones[i] {
+			i++
+		}
+		shape.coefficients = append(shape.coefficients, [2]int{start, i})
+	}
+	return shape, nil
+}
+
+// size returns the length of the encodings of the shape.
+func (shape *encodingShape) size() int {
+	return len(shape.template)
+}
+
+// matches reports whether p is an encoding of the shape.
+func (shape *encodingShape) matches(p []byte) bool {
+	if len(p) != len(shape.template) {
+		return false
+	}
+
+	offset := 0
+	for _, coefficients := range shape.coefficients {
+		if !bytes.Equal(p[offset:coefficients[0]], shape.template[offset:coefficients[0]]) {
+			return false
+		}
+		offset = coefficients[1]
+	}
+	return bytes.Equal(p[offset:], shape.template[offset:])
+}
+
+// rlweShapes holds the shapes of the query ciphertexts and of the Galois keys of a parameter set.
+type rlweShapes struct {
+	ciphertext *encodingShape
+
+	// galois_key is the shape of a Galois key without its leading Galois element
+	galois_key *encodingShape
+}
+
+// newRLWEShapes returns the shapes of the query ciphertexts and the Galois keys of the parameter set. The
+// ciphertext is encrypted like the queries of requests, so that its metadata matches theirs.
+func newRLWEShapes(set *RLWEParameterSet) (*rlweShapes, error) {
+	rlweStruct := &SimpleRLWE_PIR_Protocol{parameter_set: set}
+	if err := rlweStruct.generateParameters(); err != nil {
+		return nil, err
+	}
+	if err := rlweStruct.CreatePrivateKeyMaterial(); err != nil {
+		return nil, err
+	}
+
+	cts, err := rlweStruct.generateEncryptedQuery(0)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := shapeOf(&cts[0], cts[0].Value)
+	if err != nil {
+		return nil, fmt.Errorf("shape of ciphertexts of parameter set %q: %w", set.Name, err)
+	}
+
+	gk := rlwe.NewGaloisKey(rlweStruct.parameters)
+	var polys []ring.Poly
+	for _, row := range gk.Value {
+		for _, vector := range row {
+			for _, poly := range vector {
+				polys = append(polys, poly.Q, poly.P)
+			}
+		}
+	}
+	galois_key, err := shapeOf(gk, polys)
+	if err != nil {
+		return nil, fmt.Errorf("shape of Galois keys of parameter set %q: %w", set.Name, err)
+	}
+	galois_key.template = galois_key.template[8:]
+	for i := range galois_key.coefficients {
+		galois_key.coefficients[i][0] -= 8
+		galois_key.coefficients[i][1] -= 8
+	}
+
+	return &rlweShapes{
+		ciphertext: ciphertext,
+		galois_key: galois_key,
+	}, nil
+}
+
+// encodingShapes returns the shapes of the query ciphertexts and the Galois keys of the parameter set,
+// computing them on first use.
+func (set *RLWEParameterSet) encodingShapes() (*rlweShapes, error) {
+	set.shapesOnce.Do(func() {
+		set.shapes, set.shapesErr = newRLWEShapes(set)
+	})
+	return set.shapes, set.shapesErr
+}
+
+// shapeOf returns the shape of the encodings of the object, whose coefficients are those of the polys.
+// The coefficients of the polys are overwritten.
+func shapeOf(object interface{ MarshalBinary() ([]byte, error) }, polys []ring.Poly) (*encodingShape, error) {
+	encodings := make([][]byte, 2)
+	for i, coefficient := range []uint64{0, math.MaxUint64} {
+		for _, poly := range polys {
+			for _, row := range poly.Coeffs {
+				for k := range row {
+					row[k] = coefficient
+				}
+			}
+		}
+
+		var err error
+		encodings[i], err = object.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newEncodingShape(encodings[0], encodings[1])
+}
+
+// validateLog2NumRows checks that the request selects from as many rows as the database holds, rounded up
+// to a power of two. Requests may select from more rows, as long as a single query ciphertext selects from
+// all of them, in which case the rows beyond the database select its last row.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) validateLog2NumRows(request *pb.PIR_Request, num_db_rows int) error {
+	log2_num_db_rows := 0
+	if num_db_rows > 1 {
+		log2_num_db_rows = bits.Len(uint(num_db_rows - 1))
+	}
+
+	log2_num_rows := request.GetLog2NumRows()
+	if log2_num_rows < int64(log2_num_db_rows) || (log2_num_rows > int64(log2_num_db_rows) && log2_num_rows > int64(rlweStruct.parameters.LogN())) {
+		return fmt.Errorf("%w: request for 2^%d rows, the database holds %d rows", ErrInvalidRequest, log2_num_rows, num_db_rows)
+	}
+	return nil
+}
+
+// numQueryCiphertexts returns the number of ciphertexts that each encrypted query of a request consists of.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) numQueryCiphertexts() int {
+	if rlweStruct.isRecursive() {
+		return rlweStruct.num_dimensions
+	}
+	return 1 << rlweStruct.log2NumQueryCiphertexts()
+}
+
+// galoisElements returns the sorted Galois elements of the evaluation keys that the query expansion of the
+// mode needs, for query ciphertexts that select from 2^log2_bits_per_ct rows each.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) galoisElements(log2_bits_per_ct int) []uint64 {
+	var galEls []uint64
+	switch rlweStruct.mode {
+	case RLWE_All_Keys:
+		galEls = rlwe.GaloisElementsForExpand(rlweStruct.parameters, log2_bits_per_ct)
+	case RLWE_Whispir_3_Keys:
+		galEls = []uint64{3, 5, 1167}
+	case RLWE_Whispir_2_Keys:
+		galEls = []uint64{3, 1173}
+	}
+
+	sort.Slice(galEls, func(i, j int) bool { return galEls[i] < galEls[j] })
+	unique := galEls[:0]
+	for i, galEl := range galEls {
+		if i == 0 || galEl != galEls[i-1] {
+			unique = append(unique, galEl)
+		}
+	}
+	return unique
+}
+
+// validateEncryptedQuery checks that the encoded encrypted query consists of the number of query ciphertexts
+// that the request calls for, each of the shape of the parameter set.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) validateEncryptedQuery(shapes *rlweShapes, p []byte) error {
+	num_cts := rlweStruct.numQueryCiphertexts()
+	if len(p) < 8 || binary.LittleEndian.Uint64(p) != uint64(num_cts) || len(p) != 8+num_cts*shapes.ciphertext.size() {
+		return fmt.Errorf("%w: encrypted query of %d bytes, expected %d ciphertexts of %d bytes", ErrInvalidRequest, len(p), num_cts, shapes.ciphertext.size())
+	}
+
+	for i := 0; i < num_cts; i++ {
+		offset := 8 + i*shapes.ciphertext.size()
+		if !shapes.ciphertext.matches(p[offset : offset+shapes.ciphertext.size()]) {
+			return fmt.Errorf("%w: query ciphertext %d doesn't match parameter set %q", ErrInvalidRequest, i, rlweStruct.parameter_set.Name)
+		}
+	}
+	return nil
+}
+
+// evaluationKeysHeaderSize is the length of the header of encoded evaluation keys, the flags for the
+// relinearization key and the Galois keys, and the number of Galois keys.
+const evaluationKeysHeaderSize = 1 + 1 + 4
+
+// MaxEvaluationKeysSize returns the length of the largest encoded evaluation keys that a valid request with
+// the parameter set carries, over all modes that the parameter set supports.
+func (set *RLWEParameterSet) MaxEvaluationKeysSize() (int, error) {
+	shapes, err := set.encodingShapes()
+	if err != nil {
+		return 0, err
+	}
+
+	rlweStruct := &SimpleRLWE_PIR_Protocol{parameter_set: set}
+	if err := rlweStruct.generateParameters(); err != nil {
+		return 0, err
+	}
+
+	// a query ciphertext selects from at most 2^LogN rows, and its expansion needs more keys the more rows
+	// it selects from
+	num_keys := 0
+	for mode := range set.noise {
+		rlweStruct.mode = mode
+		if n := len(rlweStruct.galoisElements(rlweStruct.parameters.LogN())); n > num_keys {
+			num_keys = n
+		}
+	}
+	return evaluationKeysHeaderSize + num_keys*(8+8+shapes.galois_key.size()), nil
+}
+
+// validateEvaluationKeys checks that the encoded evaluation keys consist of exactly the Galois keys that the
+// query expansion needs, each of the shape of the parameter set, and no relinearization key.
+func (rlweStruct *SimpleRLWE_PIR_Protocol) validateEvaluationKeys(shapes *rlweShapes, p []byte) error {
+	galEls := rlweStruct.galoisElements(rlweStruct.log2BitsPerQueryCiphertext())
+
+	key_size := 8 + 8 + shapes.galois_key.size()
+	if len(p) != evaluationKeysHeaderSize+len(galEls)*key_size || p[0] != 0 || p[1] != 1 || binary.LittleEndian.Uint32(p[2:]) != uint32(len(galEls)) {
+		return fmt.Errorf("%w: evaluation keys of %d bytes, expected %d Galois keys of %d bytes", ErrInvalidRequest, len(p), len(galEls), key_size)
+	}
+
+	// the Galois keys are encoded in the order of their Galois elements, each preceded by its Galois element
+	for i, galEl := range galEls {
+		key := p[evaluationKeysHeaderSize+i*key_size : evaluationKeysHeaderSize+(i+1)*key_size]
+		if binary.LittleEndian.Uint64(key) != galEl || binary.LittleEndian.Uint64(key[8:]) != galEl {
+			return fmt.Errorf("%w: Galois key %d is not for Galois element %d", ErrInvalidRequest, i, galEl)
+		}
+		if !shapes.galois_key.matches(key[16:]) {
+			return fmt.Errorf("%w: Galois key for Galois element %d doesn't match parameter set %q", ErrInvalidRequest, galEl, rlweStruct.parameter_set.Name)
+		}
+	}
+	return nil
+}
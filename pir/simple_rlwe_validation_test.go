@@ -0,0 +1,141 @@
+package pir
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+func TestSimpleRLWE_validate_request(t *testing.T) {
+	log2_number_of_rows := 4
+	seed := rand.NewSource(time.Now().UnixNano())
+	db := randomDatabase(seed, 1<<log2_number_of_rows, 256)
+
+	shapes, err := rlweParameterSets[0].encodingShapes()
+	require.NoError(t, err)
+
+	for _, mode := range []string{RLWE_All_Keys, RLWE_Whispir_3_Keys, RLWE_Whispir_2_Keys} {
+		client := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		req, err := client.GenerateRequestFromQuery(3)
+		require.NoError(t, err)
+
+		// well-formed requests are processed
+		server := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+		res, err := server.ProcessRequestAndReturnResponse(context.Background(), req, db)
+		require.NoError(t, err, mode)
+		row, err := client.ProcessResponseToPlaintext(res)
+		require.NoError(t, err)
+		require.Equal(t, db[3], row[:len(db[3])])
+
+		query := req.GetEncryptedQuery()
+		keys := req.GetRLWEEvaluationKeys()
+		require.Len(t, query, 8+shapes.ciphertext.size())
+
+		for name, malform := range map[string]func(req *pb.PIR_Request){
+			"truncated query": func(req *pb.PIR_Request) {
+				req.EncryptedQuery = query[:len(query)-1]
+			},
+			"query with more ciphertexts than it holds": func(req *pb.PIR_Request) {
+				req.EncryptedQuery = binary.LittleEndian.AppendUint64(nil, 1<<40)
+				req.EncryptedQuery = append(req.EncryptedQuery, query[8:]...)
+			},
+			"query with an extra ciphertext": func(req *pb.PIR_Request) {
+				req.EncryptedQuery = binary.LittleEndian.AppendUint64(nil, 2)
+				req.EncryptedQuery = append(req.EncryptedQuery, query[8:]...)
+				req.EncryptedQuery = append(req.EncryptedQuery, query[8:]...)
+			},
+			"query with other metadata": func(req *pb.PIR_Request) {
+				req.EncryptedQuery = append([]byte{}, query...)
+				req.EncryptedQuery[8] ^= 0xff
+			},
+			"truncated evaluation keys": func(req *pb.PIR_Request) {
+				req.SchemeDependent = &pb.PIR_Request_RLWEEvaluationKeys{RLWEEvaluationKeys: keys[:len(keys)-1]}
+			},
+			"evaluation keys with more keys than they hold": func(req *pb.PIR_Request) {
+				malformed := append([]byte{}, keys...)
+				binary.LittleEndian.PutUint32(malformed[2:], 1<<30)
+				req.SchemeDependent = &pb.PIR_Request_RLWEEvaluationKeys{RLWEEvaluationKeys: malformed}
+			},
+			"evaluation keys with a relinearization key": func(req *pb.PIR_Request) {
+				malformed := append([]byte{}, keys...)
+				malformed[0] = 1
+				req.SchemeDependent = &pb.PIR_Request_RLWEEvaluationKeys{RLWEEvaluationKeys: malformed}
+			},
+			"evaluation key for another Galois element": func(req *pb.PIR_Request) {
+				malformed := append([]byte{}, keys...)
+				binary.LittleEndian.PutUint64(malformed[6:], 7)
+				binary.LittleEndian.PutUint64(malformed[14:], 7)
+				req.SchemeDependent = &pb.PIR_Request_RLWEEvaluationKeys{RLWEEvaluationKeys: malformed}
+			},
+			"no evaluation keys": func(req *pb.PIR_Request) {
+				req.SchemeDependent = nil
+			},
+			"Paillier keys": func(req *pb.PIR_Request) {
+				req.SchemeDependent = &pb.PIR_Request_Paillier_Public_Key{Paillier_Public_Key: &pb.Paillier_Public_Key{}}
+			},
+			"fewer rows than the database": func(req *pb.PIR_Request) {
+				req.Log2NumRows = int64(log2_number_of_rows - 1)
+			},
+			"more rows than a query ciphertext selects from": func(req *pb.PIR_Request) {
+				req.Log2NumRows = 20
+			},
+			"negative number of rows": func(req *pb.PIR_Request) {
+				req.Log2NumRows = -1
+			},
+			"batch of malformed queries": func(req *pb.PIR_Request) {
+				req.EncryptedQuery = nil
+				req.BatchEncryptedQueries = [][]byte{query, query[:len(query)-1]}
+			},
+			"batch of too many queries": func(req *pb.PIR_Request) {
+				req.EncryptedQuery = nil
+				req.BatchEncryptedQueries = make([][]byte, MaxBatchQueries+1)
+			},
+		} {
+			malformed := proto.Clone(req).(*pb.PIR_Request)
+			malform(malformed)
+
+			server := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode)
+			_, err := server.ProcessRequestAndReturnResponse(context.Background(), malformed, db)
+			assert.ErrorIs(t, err, ErrInvalidRequest, "%s: %s", mode, name)
+		}
+	}
+}
+
+func TestSimpleRLWE_validate_evaluation_keys_of_another_mode(t *testing.T) {
+	log2_number_of_rows := 4
+	seed := rand.NewSource(time.Now().UnixNano())
+	db := randomDatabase(seed, 1<<log2_number_of_rows, 256)
+
+	// the WhisPIR expansion needs other Galois keys than the expansion of all keys
+	req, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, RLWE_Whispir_3_Keys).GenerateRequestFromQuery(3)
+	require.NoError(t, err)
+	req.Scheme = RLWE_All_Keys
+
+	server := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, RLWE_All_Keys)
+	_, err = server.ProcessRequestAndReturnResponse(context.Background(), req, db)
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+func TestRLWEParameterSet_MaxEvaluationKeysSize(t *testing.T) {
+	set, err := LookupRLWEParameterSet(DefaultRLWEParameterSet)
+	require.NoError(t, err)
+	max_size, err := set.MaxEvaluationKeysSize()
+	require.NoError(t, err)
+
+	// the keys of requests for any number of rows and mode fit
+	for _, mode := range []string{RLWE_All_Keys, RLWE_Whispir_3_Keys, RLWE_Whispir_2_Keys} {
+		for _, log2_number_of_rows := range []int{0, 4, 12} {
+			req, err := NewSimpleRLWE_PIR_Protocol_mode(log2_number_of_rows, mode).GenerateRequestFromQuery(0)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(req.GetRLWEEvaluationKeys()), max_size, "mode %s, 2^%d rows", mode, log2_number_of_rows)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package pir
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+// DPF_TwoServer is the identifier of the [DPF_TwoServer_PIR_Protocol] scheme.
+const DPF_TwoServer = "DPF_TwoServer"
+
+// ErrEpochMismatch is returned when the two servers of a two-server scheme hold different epochs of
+// the database, or when a server holds another epoch than the one that the client agreed on.
+var ErrEpochMismatch = errors.New("PIR database epoch mismatch")
+
+// DPF_TwoServer_PIR_Protocol implements two-server PIR with a distributed point function (DPF). The
+// client splits the indicator vector of the requested row into two keys, which it sends to two servers
+// that hold the same database. Each server XORs the rows that the full domain evaluation of its key
+// selects, and the client XORs the two answers to recover the row. The keys are expanded with an
+// AES-based pseudorandom generator, so neither key reveals the requested row to a computationally
+// bounded server on its own, and the scheme is private as long as the two servers do not collude. Requests are about 17 bytes per bit of the row index, answers are as long as
+// a row, and the server only evaluates AES and XORs rows.
+//
+// The answers only combine to the requested row if both servers hold exactly the same rows. Each
+// server identifies its database with an epoch, which is a hash of its rows. The client agrees on the
+// epoch with both servers with a request from [DPF_TwoServer_PIR_Protocol.GenerateEpochRequest]
+// before it sends the query, and checks the epochs of the answers before combining them.
+type DPF_TwoServer_PIR_Protocol struct {
+	PIR_Protocol
+
+	log2_num_rows int
+
+	// client: the epoch that the client agreed on with both servers, if any
+	agreed_epoch []byte
+
+	// the key of the request, which is nil for requests for the epoch
+	key            *dpfKey
+	database_epoch []byte
+
+	// the answer to the query, and the epoch of the database that it was computed over
+	answer         []byte
+	response_epoch []byte
+}
+
+var (
+	_ TwoServerPIR_Protocol = (*DPF_TwoServer_PIR_Protocol)(nil)
+	_ DatabaseEncoder       = (*DPF_TwoServer_PIR_Protocol)(nil)
+	_ CostEstimator         = (*DPF_TwoServer_PIR_Protocol)(nil)
+)
+
+// NewDPF_TwoServer_PIR_Protocol returns a new instance of the two-server DPF scheme for a database of
+// 2^log2_num_rows rows.
+func NewDPF_TwoServer_PIR_Protocol(log2_num_rows int) *DPF_TwoServer_PIR_Protocol {
+	return &DPF_TwoServer_PIR_Protocol{
+		log2_num_rows: log2_num_rows,
+	}
+}
+
+// CreatePrivateKeyMaterial does nothing, as the scheme has no key material other than the DPF keys,
+// which are sampled for every query.
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) CreatePrivateKeyMaterial() error {
+	return nil
+}
+
+// GenerateEpochRequest generates a request for the epoch of the database, which is sent to both
+// servers. The responses are processed with [DPF_TwoServer_PIR_Protocol.AgreeOnEpoch].
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) GenerateEpochRequest() *pb.PIR_Request {
+	return &pb.PIR_Request{
+		Scheme:      DPF_TwoServer,
+		Log2NumRows: int64(dpfStruct.log2_num_rows),
+	}
+}
+
+// AgreeOnEpoch checks that both servers hold the same epoch of the database, and includes it in the
+// requests of subsequent queries, such that the servers reject them once their database changed.
+// It returns an error wrapping [ErrEpochMismatch] if the epochs differ.
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) AgreeOnEpoch(res0, res1 *pb.PIR_Response) error {
+	epoch0, epoch1 := res0.GetDatabaseEpoch(), res1.GetDatabaseEpoch()
+	if len(epoch0) == 0 || len(epoch1) == 0 {
+		return fmt.Errorf("response does not carry the epoch of the database")
+	}
+	if !bytes.Equal(epoch0, epoch1) {
+		return fmt.Errorf("%w: the servers hold epochs %x and %x", ErrEpochMismatch, epoch0, epoch1)
+	}
+
+	dpfStruct.agreed_epoch = epoch0
+	return nil
+}
+
+// GenerateRequestFromQuery returns an error, as the query has to be split between two servers with
+// [DPF_TwoServer_PIR_Protocol.GenerateRequestsFromQuery].
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) GenerateRequestFromQuery(requested_row int) (*pb.PIR_Request, error) {
+	return nil, fmt.Errorf("%s splits the query between two servers, generate both requests at once", DPF_TwoServer)
+}
+
+// GenerateRequestsFromQuery generates the two requests for the requested row, which must be sent to
+// two different servers.
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) GenerateRequestsFromQuery(requested_row int) (*pb.PIR_Request, *pb.PIR_Request, error) {
+	key0, key1, err := generateDPFKeys(requested_row, dpfStruct.log2_num_rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dpfStruct.database_epoch = dpfStruct.agreed_epoch
+
+	dpfStruct.key = key0
+	req0, err := dpfStruct.marshalRequestToPB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dpfStruct.key = key1
+	req1, err := dpfStruct.marshalRequestToPB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return req0, req1, nil
+}
+
+// ProcessResponseToPlaintext returns an error, as the row can only be recovered from the responses of
+// both servers with [DPF_TwoServer_PIR_Protocol.ProcessResponsesToPlaintext].
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) ProcessResponseToPlaintext(res *pb.PIR_Response) ([]byte, error) {
+	return nil, fmt.Errorf("%s needs the responses of both servers to recover the row", DPF_TwoServer)
+}
+
+// ProcessResponsesToPlaintext recovers the requested row from the responses of the two servers. It
+// returns an error wrapping [ErrEpochMismatch] if the responses were computed over different epochs of
+// the database, or over another epoch than the one that the client agreed on.
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) ProcessResponsesToPlaintext(res0, res1 *pb.PIR_Response) ([]byte, error) {
+	answers := make([][]byte, 2)
+	epochs := make([][]byte, 2)
+	for i, res := range []*pb.PIR_Response{res0, res1} {
+		err := dpfStruct.unmarshallResponseFromPB(res)
+		if err != nil {
+			return nil, err
+		}
+		answers[i], epochs[i] = dpfStruct.answer, dpfStruct.response_epoch
+	}
+
+	if !bytes.Equal(epochs[0], epochs[1]) {
+		return nil, fmt.Errorf("%w: the responses were computed over epochs %x and %x", ErrEpochMismatch, epochs[0], epochs[1])
+	}
+	if dpfStruct.agreed_epoch != nil && !bytes.Equal(epochs[0], dpfStruct.agreed_epoch) {
+		return nil, fmt.Errorf("%w: the responses were computed over epoch %x, expected %x", ErrEpochMismatch, epochs[0], dpfStruct.agreed_epoch)
+	}
+	if len(answers[0]) != len(answers[1]) {
+		return nil, fmt.Errorf("answers of %d and %d bytes do not match", len(answers[0]), len(answers[1]))
+	}
+
+	row := make([]byte, len(answers[0]))
+	for k := range row {
+		row[k] = answers[0][k] ^ answers[1][k]
+	}
+	return row, nil
+}
+
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) marshalRequestToPB() (*pb.PIR_Request, error) {
+	var query []byte
+	if dpfStruct.key != nil {
+		var err error
+		query, err = dpfStruct.key.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &pb.PIR_Request{
+		Scheme:         DPF_TwoServer,
+		Log2NumRows:    int64(dpfStruct.log2_num_rows),
+		EncryptedQuery: query,
+		DatabaseEpoch:  dpfStruct.database_epoch,
+	}, nil
+}
+
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) unmarshallRequestFromPB(req *pb.PIR_Request) error {
+	dpfStruct.log2_num_rows = int(req.GetLog2NumRows())
+	if dpfStruct.log2_num_rows < 0 || dpfStruct.log2_num_rows > dpfMaxLog2NumRows {
+		return fmt.Errorf("number of rows must be between 2^0 and 2^%d, got 2^%d", dpfMaxLog2NumRows, dpfStruct.log2_num_rows)
+	}
+
+	// a request without a query asks for the epoch
+	dpfStruct.key = nil
+	dpfStruct.database_epoch = req.GetDatabaseEpoch()
+	if len(req.GetEncryptedQuery()) == 0 {
+		return nil
+	}
+
+	key := &dpfKey{}
+	err := key.UnmarshalBinary(req.GetEncryptedQuery())
+	if err != nil {
+		return err
+	}
+	if key.log2_domain != dpfStruct.log2_num_rows {
+		return fmt.Errorf("DPF key over 2^%d indices does not match the 2^%d rows of the request", key.log2_domain, dpfStruct.log2_num_rows)
+	}
+	dpfStruct.key = key
+
+	return nil
+}
+
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) marshalResponseToPB() (*pb.PIR_Response, error) {
+	return &pb.PIR_Response{
+		Ciphertexts:   dpfStruct.answer,
+		DatabaseEpoch: dpfStruct.response_epoch,
+	}, nil
+}
+
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) unmarshallResponseFromPB(res *pb.PIR_Response) error {
+	if len(res.GetDatabaseEpoch()) == 0 {
+		return fmt.Errorf("response does not carry the epoch of the database")
+	}
+
+	dpfStruct.answer = res.GetCiphertexts()
+	dpfStruct.response_epoch = res.GetDatabaseEpoch()
+	return nil
+}
+
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) ProcessRequestAndReturnResponse(ctx context.Context, request *pb.PIR_Request, database [][]byte) (*pb.PIR_Response, error) {
+	encoded, err := dpfStruct.EncodeDatabase(database)
+	if err != nil {
+		return nil, err
+	}
+
+	return dpfStruct.ProcessRequestOverEncodedDatabase(ctx, request, encoded)
+}
+
+// EncodeDatabase computes the epoch of the database, which is a hash of its rows, such that two
+// servers that hold the same rows arrive at the same epoch. The rows must not be modified afterwards.
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) EncodeDatabase(database [][]byte) (EncodedDatabase, error) {
+	if len(database) == 0 {
+		return nil, fmt.Errorf("cannot encode an empty database")
+	}
+
+	digest := databaseDigest(database)
+	return &dpfEncodedDatabase{
+		rows:       database,
+		row_length: maxLengthDBRows(database),
+		epoch:      digest[:dpfEpochLength],
+	}, nil
+}
+
+// ProcessRequestOverEncodedDatabase answers the query of the request, or responds with just the epoch
+// of the database if the request doesn't carry a query. It returns an error wrapping
+// [ErrEpochMismatch] if the request carries an epoch other than the one of the database.
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) ProcessRequestOverEncodedDatabase(ctx context.Context, request *pb.PIR_Request, database EncodedDatabase) (*pb.PIR_Response, error) {
+	encoded, ok := database.(*dpfEncodedDatabase)
+	if !ok {
+		return nil, fmt.Errorf("database was not encoded for a DPF scheme, got %T", database)
+	}
+
+	if request.GetScheme() != DPF_TwoServer {
+		return nil, fmt.Errorf("%w: %q, expected %q", ErrUnsupportedScheme, request.GetScheme(), DPF_TwoServer)
+	}
+
+	err := dpfStruct.unmarshallRequestFromPB(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(encoded.rows) > 1<<dpfStruct.log2_num_rows {
+		return nil, fmt.Errorf("initialize this struct with log2_num_rows as greater than or equal to the log of the number of rows in the DB")
+	}
+
+	if len(dpfStruct.database_epoch) != 0 && !bytes.Equal(dpfStruct.database_epoch, encoded.epoch) {
+		return nil, fmt.Errorf("%w: the database is of epoch %x", ErrEpochMismatch, encoded.epoch)
+	}
+
+	dpfStruct.answer = nil
+	dpfStruct.response_epoch = encoded.epoch
+	if dpfStruct.key == nil {
+		return dpfStruct.marshalResponseToPB()
+	}
+
+	// rows that are missing at the end of the database are empty, so they don't change the answer
+	selected := dpfStruct.key.evaluateFullDomain()
+	answer := make([]byte, encoded.row_length)
+	for j, row := range encoded.rows {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if selected[j] == 0 {
+			continue
+		}
+		for k, b := range row {
+			answer[k] ^= b
+		}
+	}
+	dpfStruct.answer = answer
+
+	return dpfStruct.marshalResponseToPB()
+}
+
+// dpfEncodedDatabase is a database that was prepared by [DPF_TwoServer_PIR_Protocol.EncodeDatabase].
+// EstimateCost estimates the cost of processing the request over num_rows rows of at most row_size
+// bytes. The key is evaluated on each row, which takes about 16 word operations, and the selected rows
+// are added to the answer word by word.
+func (dpfStruct *DPF_TwoServer_PIR_Protocol) EstimateCost(request *pb.PIR_Request, num_rows int, row_size int) (int64, error) {
+	return mulCost(int64(num_rows), int64(row_size/8+16)), nil
+}
+
+type dpfEncodedDatabase struct {
+	rows       [][]byte
+	row_length int
+	epoch      []byte
+}
+
+func (db *dpfEncodedDatabase) NumRows() int {
+	return len(db.rows)
+}
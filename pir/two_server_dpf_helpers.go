@@ -0,0 +1,212 @@
+package pir
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+)
+
+const (
+	// dpfSeedLength is the length in bytes of the seeds of the DPF tree, for 128 bits of security.
+	dpfSeedLength = aes.BlockSize
+
+	// dpfCorrectionWordLength is the length in bytes of the correction word of a level of the tree,
+	// i.e. the seed correction followed by a byte with the two control bit corrections.
+	dpfCorrectionWordLength = dpfSeedLength + 1
+
+	// dpfEpochLength is the length in bytes of the identifier of an epoch of the database.
+	dpfEpochLength = 16
+
+	// dpfMaxLog2NumRows bounds the domain of the point functions, such that the full domain
+	// evaluation of a key fits in memory.
+	dpfMaxLog2NumRows = 24
+)
+
+type dpfSeed [dpfSeedLength]byte
+
+// dpfKey is the key of one of the two servers for a distributed point function over the domain
+// of 2^log2_domain indices, in the construction of Boyle, Gilboa and Ishai (CCS '16). The outputs
+// of the two keys XOR to one at the index of the point and to zero everywhere else.
+type dpfKey struct {
+	log2_domain int
+	seed        dpfSeed
+	control     byte
+
+	// one correction word for each level of the tree
+	seed_corrections    []dpfSeed
+	control_corrections [][2]byte // left and right
+}
+
+// dpfPRG is the length-doubling PRG of the DPF tree, which is built from AES with a fixed key in
+// the Matyas-Meyer-Oseas mode.
+var dpfPRG = func() cipher.Block {
+	key := sha256.Sum256([]byte("zikade DPF PRG"))
+	block, err := aes.NewCipher(key[:aes.BlockSize])
+	if err != nil {
+		panic(err)
+	}
+	return block
+}()
+
+// dpfExpand expands the seed of a node into the seeds and control bits of its two children.
+func dpfExpand(seed *dpfSeed) (left, right dpfSeed, left_control, right_control byte) {
+	for i, child := range []*dpfSeed{&left, &right} {
+		in := *seed
+		in[0] ^= byte(i) // the least significant bit of a seed is always cleared
+		dpfPRG.Encrypt(child[:], in[:])
+		for k := range child {
+			child[k] ^= in[k]
+		}
+	}
+
+	left_control, right_control = left[0]&1, right[0]&1
+	left[0] &^= 1
+	right[0] &^= 1
+	return left, right, left_control, right_control
+}
+
+// generateDPFKeys returns the keys of the two servers for the point function over the domain of
+// 2^log2_domain indices, whose output is one at the index point.
+func generateDPFKeys(point int, log2_domain int) (*dpfKey, *dpfKey, error) {
+	if log2_domain < 0 || log2_domain > dpfMaxLog2NumRows {
+		return nil, nil, fmt.Errorf("domain must be between 2^0 and 2^%d indices, got 2^%d", dpfMaxLog2NumRows, log2_domain)
+	}
+	if point < 0 || point >= 1<<log2_domain {
+		return nil, nil, fmt.Errorf("point %d is out of range of 2^%d indices", point, log2_domain)
+	}
+
+	var seeds [2]dpfSeed
+	for b := range seeds {
+		if _, err := rand.Read(seeds[b][:]); err != nil {
+			return nil, nil, fmt.Errorf("sample DPF seed: %w", err)
+		}
+		seeds[b][0] &^= 1
+	}
+	controls := [2]byte{0, 1}
+
+	keys := [2]*dpfKey{}
+	for b := range keys {
+		keys[b] = &dpfKey{
+			log2_domain:         log2_domain,
+			seed:                seeds[b],
+			control:             controls[b],
+			seed_corrections:    make([]dpfSeed, log2_domain),
+			control_corrections: make([][2]byte, log2_domain),
+		}
+	}
+
+	// walk down the path to the point, with the most significant bit of the point selecting the
+	// child of the root
+	for level := 0; level < log2_domain; level++ {
+		bit := byte(point>>(log2_domain-1-level)) & 1
+
+		var children [2][2]dpfSeed
+		var child_controls [2][2]byte
+		for b := range seeds {
+			children[b][0], children[b][1], child_controls[b][0], child_controls[b][1] = dpfExpand(&seeds[b])
+		}
+
+		// the seeds of the child off the path are corrected to be equal, such that the outputs
+		// of all leaves below it cancel out
+		var seed_correction dpfSeed
+		for k := range seed_correction {
+			seed_correction[k] = children[0][1-bit][k] ^ children[1][1-bit][k]
+		}
+		control_correction := [2]byte{
+			child_controls[0][0] ^ child_controls[1][0] ^ bit ^ 1,
+			child_controls[0][1] ^ child_controls[1][1] ^ bit,
+		}
+
+		for b := range seeds {
+			seeds[b] = children[b][bit]
+			if controls[b] == 1 {
+				for k := range seeds[b] {
+					seeds[b][k] ^= seed_correction[k]
+				}
+			}
+			controls[b] = child_controls[b][bit] ^ controls[b]&control_correction[bit]
+
+			keys[b].seed_corrections[level] = seed_correction
+			keys[b].control_corrections[level] = control_correction
+		}
+	}
+
+	return keys[0], keys[1], nil
+}
+
+// evaluateFullDomain returns the output of the key at each index of the domain.
+func (key *dpfKey) evaluateFullDomain() []byte {
+	seeds := []dpfSeed{key.seed}
+	controls := []byte{key.control}
+
+	for level := 0; level < key.log2_domain; level++ {
+		next_seeds := make([]dpfSeed, 2*len(seeds))
+		next_controls := make([]byte, 2*len(controls))
+		for j := range seeds {
+			left, right, left_control, right_control := dpfExpand(&seeds[j])
+			if controls[j] == 1 {
+				for k := range left {
+					left[k] ^= key.seed_corrections[level][k]
+					right[k] ^= key.seed_corrections[level][k]
+				}
+				left_control ^= key.control_corrections[level][0]
+				right_control ^= key.control_corrections[level][1]
+			}
+			next_seeds[2*j], next_seeds[2*j+1] = left, right
+			next_controls[2*j], next_controls[2*j+1] = left_control, right_control
+		}
+		seeds, controls = next_seeds, next_controls
+	}
+
+	return controls
+}
+
+// MarshalBinary encodes the key as the log of the domain, the seed and the control bit of the root,
+// and the correction words of the levels of the tree.
+func (key *dpfKey) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 2+dpfSeedLength+key.log2_domain*dpfCorrectionWordLength)
+	b = append(b, byte(key.log2_domain))
+	b = append(b, key.seed[:]...)
+	b = append(b, key.control)
+	for level := range key.seed_corrections {
+		b = append(b, key.seed_corrections[level][:]...)
+		b = append(b, key.control_corrections[level][0]|key.control_corrections[level][1]<<1)
+	}
+	return b, nil
+}
+
+func (key *dpfKey) UnmarshalBinary(b []byte) error {
+	if len(b) < 2+dpfSeedLength {
+		return fmt.Errorf("DPF key of %d bytes is too short", len(b))
+	}
+
+	log2_domain := int(b[0])
+	if log2_domain > dpfMaxLog2NumRows {
+		return fmt.Errorf("domain must be between 2^0 and 2^%d indices, got 2^%d", dpfMaxLog2NumRows, log2_domain)
+	}
+	if len(b) != 2+dpfSeedLength+log2_domain*dpfCorrectionWordLength {
+		return fmt.Errorf("DPF key of %d bytes does not match a domain of 2^%d indices", len(b), log2_domain)
+	}
+	if b[1]&1 != 0 || b[1+dpfSeedLength] > 1 {
+		return fmt.Errorf("malformed DPF key")
+	}
+
+	key.log2_domain = log2_domain
+	copy(key.seed[:], b[1:])
+	key.control = b[1+dpfSeedLength]
+	key.seed_corrections = make([]dpfSeed, log2_domain)
+	key.control_corrections = make([][2]byte, log2_domain)
+
+	b = b[2+dpfSeedLength:]
+	for level := 0; level < log2_domain; level++ {
+		word := b[level*dpfCorrectionWordLength : (level+1)*dpfCorrectionWordLength]
+		if word[0]&1 != 0 || word[dpfSeedLength] > 3 {
+			return fmt.Errorf("malformed DPF key")
+		}
+		copy(key.seed_corrections[level][:], word)
+		key.control_corrections[level] = [2]byte{word[dpfSeedLength] & 1, word[dpfSeedLength] >> 1}
+	}
+	return nil
+}
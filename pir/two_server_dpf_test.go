@@ -0,0 +1,123 @@
+package pir
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+func TestDPF_evaluateFullDomain(t *testing.T) {
+	for _, log2_domain := range []int{0, 1, 5} {
+		for point := 0; point < 1<<log2_domain; point++ {
+			key0, key1, err := generateDPFKeys(point, log2_domain)
+			require.NoError(t, err)
+
+			// the keys survive a roundtrip through their encoding
+			for _, key := range []*dpfKey{key0, key1} {
+				b, err := key.MarshalBinary()
+				require.NoError(t, err)
+				require.Len(t, b, 2+dpfSeedLength+log2_domain*dpfCorrectionWordLength)
+
+				decoded := &dpfKey{}
+				require.NoError(t, decoded.UnmarshalBinary(b))
+				require.Equal(t, key, decoded)
+			}
+
+			outputs0, outputs1 := key0.evaluateFullDomain(), key1.evaluateFullDomain()
+			require.Len(t, outputs0, 1<<log2_domain)
+			for j := range outputs0 {
+				if j == point {
+					require.Equal(t, byte(1), outputs0[j]^outputs1[j])
+				} else {
+					require.Equal(t, byte(0), outputs0[j]^outputs1[j])
+				}
+			}
+		}
+	}
+
+	_, _, err := generateDPFKeys(4, 2)
+	require.Error(t, err)
+	require.Error(t, (&dpfKey{}).UnmarshalBinary(make([]byte, 2+dpfSeedLength+dpfCorrectionWordLength-1)))
+}
+
+func TestPIR_DPF_TwoServer_Correctness(t *testing.T) {
+	log2_number_of_rows := 6
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	// the database lacks rows at the end, which are retrieved as empty rows
+	db := randomDatabase(seed, 50, 300)
+	client_PIR_Protocol := NewDPF_TwoServer_PIR_Protocol(log2_number_of_rows)
+
+	// the client agrees on the epoch with both servers
+	epochRequest := client_PIR_Protocol.GenerateEpochRequest()
+	res0, err := NewDPF_TwoServer_PIR_Protocol(log2_number_of_rows).ProcessRequestAndReturnResponse(context.Background(), epochRequest, db)
+	require.NoError(t, err)
+	res1, err := NewDPF_TwoServer_PIR_Protocol(log2_number_of_rows).ProcessRequestAndReturnResponse(context.Background(), epochRequest, db)
+	require.NoError(t, err)
+	require.Empty(t, res0.GetCiphertexts())
+	require.NoError(t, client_PIR_Protocol.AgreeOnEpoch(res0, res1))
+
+	for _, query := range []int{0, 17, 49, 63} {
+		req0, req1, err := client_PIR_Protocol.GenerateRequestsFromQuery(query)
+		require.NoError(t, err)
+		require.NotEqual(t, req0.GetEncryptedQuery(), req1.GetEncryptedQuery())
+
+		res0, err := NewDPF_TwoServer_PIR_Protocol(log2_number_of_rows).ProcessRequestAndReturnResponse(context.Background(), req0, db)
+		require.NoError(t, err)
+		res1, err := NewDPF_TwoServer_PIR_Protocol(log2_number_of_rows).ProcessRequestAndReturnResponse(context.Background(), req1, db)
+		require.NoError(t, err)
+
+		response_bytes, err := client_PIR_Protocol.ProcessResponsesToPlaintext(res0, res1)
+		require.NoError(t, err)
+		if query < len(db) {
+			require.Equal(t, db[query], response_bytes)
+		} else {
+			require.Equal(t, make([]byte, len(response_bytes)), response_bytes)
+		}
+	}
+
+	_, err = client_PIR_Protocol.GenerateRequestFromQuery(0)
+	require.Error(t, err)
+}
+
+func TestPIR_DPF_TwoServer_epoch_mismatch(t *testing.T) {
+	log2_number_of_rows := 4
+	seed := rand.NewSource(time.Now().UnixNano())
+
+	db := randomDatabase(seed, 16, 64)
+	otherDB := make([][]byte, len(db))
+	copy(otherDB, db)
+	otherDB[3] = randomDatabase(seed, 1, 64)[0]
+
+	server := NewDPF_TwoServer_PIR_Protocol(log2_number_of_rows)
+	client_PIR_Protocol := NewDPF_TwoServer_PIR_Protocol(log2_number_of_rows)
+
+	// the servers disagree on the epoch
+	res0, err := server.ProcessRequestAndReturnResponse(context.Background(), client_PIR_Protocol.GenerateEpochRequest(), db)
+	require.NoError(t, err)
+	res1, err := server.ProcessRequestAndReturnResponse(context.Background(), client_PIR_Protocol.GenerateEpochRequest(), otherDB)
+	require.NoError(t, err)
+	require.ErrorIs(t, client_PIR_Protocol.AgreeOnEpoch(res0, res1), ErrEpochMismatch)
+
+	// without an agreed epoch, the client still detects answers over different epochs
+	req0, req1, err := client_PIR_Protocol.GenerateRequestsFromQuery(3)
+	require.NoError(t, err)
+	res0, err = server.ProcessRequestAndReturnResponse(context.Background(), req0, db)
+	require.NoError(t, err)
+	res1, err = server.ProcessRequestAndReturnResponse(context.Background(), req1, otherDB)
+	require.NoError(t, err)
+	_, err = client_PIR_Protocol.ProcessResponsesToPlaintext(res0, res1)
+	require.ErrorIs(t, err, ErrEpochMismatch)
+
+	// a server rejects requests for an epoch that it doesn't hold
+	require.NoError(t, client_PIR_Protocol.AgreeOnEpoch(res0, &pb.PIR_Response{DatabaseEpoch: res0.GetDatabaseEpoch()}))
+	req0, _, err = client_PIR_Protocol.GenerateRequestsFromQuery(3)
+	require.NoError(t, err)
+	_, err = server.ProcessRequestAndReturnResponse(context.Background(), req0, otherDB)
+	require.ErrorIs(t, err, ErrEpochMismatch)
+}
@@ -0,0 +1,117 @@
+package pir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrWorkerPoolClosed is returned when the [WorkerPool] that a request is evaluated with is closed
+// before the evaluation finished.
+var ErrWorkerPoolClosed = errors.New("PIR worker pool closed")
+
+// WorkerPool bounds the number of goroutines that PIR_Protocols evaluate requests with. A single pool
+// is shared by all requests that a server processes, so that the number of goroutines doesn't grow with
+// the number of concurrent requests. It is safe for concurrent use.
+type WorkerPool struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// slots holds a token for each running worker
+	slots chan struct{}
+}
+
+// NewWorkerPool returns a pool of at most size concurrent workers. The pool is closed when ctx is
+// cancelled or [WorkerPool.Close] is called.
+func NewWorkerPool(ctx context.Context, size int) (*WorkerPool, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("worker pool size must be positive, got %d", size)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &WorkerPool{
+		ctx:    ctx,
+		cancel: cancel,
+		slots:  make(chan struct{}, size),
+	}, nil
+}
+
+// Size returns the largest number of concurrent workers of the pool.
+func (p *WorkerPool) Size() int {
+	return cap(p.slots)
+}
+
+// Close closes the pool. Running calls of [WorkerPool.Run] don't start further tasks and return
+// [ErrWorkerPoolClosed].
+func (p *WorkerPool) Close() {
+	p.cancel()
+}
+
+// Run calls task for each index in [0, n) on the workers of the pool and waits for the calls to return.
+// Tasks wait for a free worker before they are started. If a task returns an error, no further tasks are
+// started and the first error is returned. If ctx is done before all tasks were called, no further tasks
+// are called either and the error of ctx is returned.
+func (p *WorkerPool) Run(ctx context.Context, n int, task func(i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// the pool stops the tasks of all running calls when it is closed
+		select {
+		case <-p.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+
+		// skipped is set if a task was started after ctx was done, without calling it
+		skipped atomic.Bool
+	)
+
+	started := 0
+loop:
+	for ; started < n; started++ {
+		select {
+		case <-ctx.Done():
+			break loop
+		case p.slots <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-p.slots
+				wg.Done()
+			}()
+
+			if ctx.Err() != nil {
+				skipped.Store(true)
+				return
+			}
+			if err := task(i); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(started)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if p.ctx.Err() != nil {
+		return ErrWorkerPoolClosed
+	}
+	if started < n || skipped.Load() {
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package pir
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPool_Run(t *testing.T) {
+	workers, err := NewWorkerPool(context.Background(), 3)
+	require.NoError(t, err)
+	defer workers.Close()
+	require.Equal(t, 3, workers.Size())
+
+	var running, maxRunning, calls atomic.Int32
+	done := make([]bool, 20)
+	err = workers.Run(context.Background(), len(done), func(i int) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+		done[i] = true
+		calls.Add(1)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, len(done), calls.Load())
+	assert.LessOrEqual(t, maxRunning.Load(), int32(3))
+	for i := range done {
+		assert.True(t, done[i], "task %d", i)
+	}
+
+	require.NoError(t, workers.Run(context.Background(), 0, func(i int) error { return nil }))
+
+	_, err = NewWorkerPool(context.Background(), 0)
+	assert.Error(t, err)
+}
+
+func TestWorkerPool_Run_error(t *testing.T) {
+	workers, err := NewWorkerPool(context.Background(), 1)
+	require.NoError(t, err)
+	defer workers.Close()
+
+	// the tasks after the failed one aren't started
+	errTask := errors.New("task failed")
+	var calls atomic.Int32
+	err = workers.Run(context.Background(), 10, func(i int) error {
+		calls.Add(1)
+		if i == 2 {
+			return errTask
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, errTask)
+	assert.Less(t, calls.Load(), int32(10))
+}
+
+func TestWorkerPool_Close(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	workers, err := NewWorkerPool(ctx, 1)
+	require.NoError(t, err)
+
+	// cancelling the context of the pool stops running evaluations
+	err = workers.Run(context.Background(), 10, func(i int) error {
+		if i == 0 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrWorkerPoolClosed)
+
+	err = workers.Run(context.Background(), 1, func(i int) error { return nil })
+	assert.ErrorIs(t, err, ErrWorkerPoolClosed)
+}
+
+func TestWorkerPool_Run_cancelled(t *testing.T) {
+	workers, err := NewWorkerPool(context.Background(), 1)
+	require.NoError(t, err)
+	defer workers.Close()
+
+	// cancelling the context of a call stops that call, but not the pool
+	ctx, cancel := context.WithCancel(context.Background())
+	err = workers.Run(ctx, 10, func(i int) error {
+		if i == 0 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	require.NoError(t, workers.Run(context.Background(), 1, func(i int) error { return nil }))
+
+	// a call whose context is already done calls no task, even if it starts some
+	for i := 0; i < 10; i++ {
+		err = workers.Run(ctx, 1, func(i int) error {
+			t.Fatal("task called after the context was done")
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+}
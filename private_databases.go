@@ -0,0 +1,148 @@
+package zikade
+
+import (
+	"context"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/plprobelab/zikade/internal/coord"
+	"github.com/plprobelab/zikade/kadt"
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/private_routing"
+)
+
+// rtDatabaseCache caches the PIR databases of the normalized routing table
+// joined with the peer store, which private requests for closer peers are
+// processed over. The normalized routing table only depends on the querying
+// peer through the common prefix length (CPL) of its key and our key, so the
+// databases are cached by that CPL. The normalized routing table also leaves
+// out the querying peer itself, so a database that is shared between peers
+// with the same CPL may contain the querying peer or leave out another peer of
+// its bucket. Both are harmless to the querying peer. Databases with the signed
+// peer records of the peers are cached apart from databases without them.
+//
+// All cached databases are invalidated when a peer is added to or removed
+// from the routing table, and when the addresses of a peer in the routing
+// table may have changed in the peer store. If peers are backfilled from the
+// peer store, they are also invalidated when the addresses of a peer that may
+// be backfilled may have changed.
+type rtDatabaseCache struct {
+	mu sync.Mutex
+
+	// gen is incremented on every invalidation, so that databases that were
+	// constructed from a routing table before the invalidation aren't cached.
+	gen uint64
+
+	dbs map[rtDatabaseKey]*private_routing.Database
+}
+
+// rtDatabaseKey identifies a database of the normalized routing table in the
+// rtDatabaseCache.
+type rtDatabaseKey struct {
+	cpl    int
+	signed bool
+}
+
+var _ coord.RoutingNotifier = (*rtDatabaseCache)(nil)
+
+func newRTDatabaseCache() *rtDatabaseCache {
+	return &rtDatabaseCache{
+		dbs: make(map[rtDatabaseKey]*private_routing.Database),
+	}
+}
+
+// get returns the cached database for the given key or nil if there is none.
+// It also returns the generation of the cache, which must be passed to put
+// along with the database that was constructed on a cache miss.
+func (c *rtDatabaseCache) get(key rtDatabaseKey) (*private_routing.Database, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.dbs[key], c.gen
+}
+
+// put caches the database for the given key, unless the cache was invalidated
+// since the generation was returned by get.
+func (c *rtDatabaseCache) put(key rtDatabaseKey, gen uint64, db *private_routing.Database) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	c.dbs[key] = db
+}
+
+// invalidate drops all cached databases.
+func (c *rtDatabaseCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.dbs = make(map[rtDatabaseKey]*private_routing.Database)
+}
+
+// Notify invalidates the cache when the routing table was updated.
+func (c *rtDatabaseCache) Notify(ctx context.Context, ev coord.RoutingNotification) {
+	switch ev.(type) {
+	case *coord.EventRoutingUpdated, *coord.EventRoutingRemoved:
+		c.invalidate()
+	}
+}
+
+// runPIRWithCachedKeys resolves the evaluation keys of the private request of
+// the remote peer with the evaluation key cache and then runs the request
+// with run. If the request references evaluation keys that aren't cached, the
+// returned response carries an UNKNOWN_EVALUATION_KEYS error instead. Keys
+// that the request carries are only cached once run processed it without
+// error, so that invalid keys never enter the cache.
+//
+// The context that run is called with streams the ciphertexts of the given
+// response while they are computed, if the client accepts streamed responses,
+// see streamCiphertexts. The header of the streamed part already tells the
+// client whether the keys will be cached; if run fails after the part was
+// started, the handler fails and the client never sees the response.
+func (d *DHT) runPIRWithCachedKeys(ctx context.Context, remote peer.ID, response pb.PIR_Chunk_Response, req *pb.PIR_Request, run func(ctx context.Context, req *pb.PIR_Request) (*pb.PIR_Response, error)) (*pb.PIR_Response, error) {
+	resolved, errResponse := d.pirKeys.ResolveRequest(remote.String(), req)
+	if errResponse != nil {
+		return errResponse, nil
+	}
+
+	cacheable := !resolved && d.pirKeys.Cacheable(req)
+	res, err := run(streamCiphertexts(ctx, response, &pb.PIR_Response{EvaluationKeysCached: cacheable}), req)
+	if err != nil {
+		return nil, err
+	}
+	if cacheable && res.GetError() == nil {
+		res.EvaluationKeysCached = d.pirKeys.Add(remote.String(), req)
+	}
+
+	return res, nil
+}
+
+// normalizedRTDatabase returns the PIR database of the normalized routing
+// table joined with the peer store for the querying peer. If signed is set,
+// the peers of the buckets carry their signed peer records. See
+// [DHT.NormalizeRTJoinedWithPeerStore] and [rtDatabaseCache].
+func (d *DHT) normalizedRTDatabase(queryingPeerKadId kadt.Key, signed bool) (*private_routing.Database, error) {
+	key := rtDatabaseKey{
+		cpl:    kadt.PeerID(d.host.ID()).Key().CommonPrefixLength(queryingPeerKadId),
+		signed: signed,
+	}
+
+	db, gen := d.rtDatabases.get(key)
+	if db != nil {
+		return db, nil
+	}
+
+	buckets, err := d.normalizeRTJoinedWithPeerStore(queryingPeerKadId, signed)
+	if err != nil {
+		return nil, err
+	}
+
+	db = private_routing.NewDatabase(buckets)
+	d.rtDatabases.put(key, gen, db)
+
+	return db, nil
+}
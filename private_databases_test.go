@@ -0,0 +1,129 @@
+package zikade
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/internal/coord"
+	"github.com/plprobelab/zikade/internal/kadtest"
+	"github.com/plprobelab/zikade/kadt"
+)
+
+func TestDHT_normalizedRTDatabase_cached_by_cpl(t *testing.T) {
+	d := newTestDHT(t)
+	peers := fillRoutingTable(t, d, 250)
+
+	self := kadt.PeerID(d.host.ID()).Key()
+	first := kadt.PeerID(peers[0]).Key()
+
+	db, err := d.normalizedRTDatabase(first, false)
+	require.NoError(t, err)
+
+	// the database is reused for all peers with the same common prefix length
+	for _, p := range peers[1:] {
+		key := kadt.PeerID(p).Key()
+		other, err := d.normalizedRTDatabase(key, false)
+		require.NoError(t, err)
+
+		if self.CommonPrefixLength(key) == self.CommonPrefixLength(first) {
+			require.Same(t, db, other)
+		} else {
+			require.NotSame(t, db, other)
+		}
+	}
+
+	// databases with signed peer records are cached separately
+	signed, err := d.normalizedRTDatabase(first, true)
+	require.NoError(t, err)
+	require.NotSame(t, db, signed)
+
+	again, err := d.normalizedRTDatabase(first, true)
+	require.NoError(t, err)
+	require.Same(t, signed, again)
+}
+
+func TestDHT_normalizedRTDatabase_invalidated_on_routing_update(t *testing.T) {
+	ctx := context.Background()
+
+	d := newTestDHT(t)
+	peers := fillRoutingTable(t, d, 250)
+	key := kadt.PeerID(peers[0]).Key()
+
+	db, err := d.normalizedRTDatabase(key, false)
+	require.NoError(t, err)
+
+	d.rtDatabases.Notify(ctx, &coord.EventRoutingUpdated{NodeID: kadt.PeerID(newPeerID(t))})
+	updated, err := d.normalizedRTDatabase(key, false)
+	require.NoError(t, err)
+	require.NotSame(t, db, updated)
+
+	d.rtDatabases.Notify(ctx, &coord.EventRoutingRemoved{NodeID: kadt.PeerID(peers[1])})
+	removed, err := d.normalizedRTDatabase(key, false)
+	require.NoError(t, err)
+	require.NotSame(t, updated, removed)
+
+	// databases constructed before an invalidation aren't cached
+	_, gen := d.rtDatabases.get(rtDatabaseKey{})
+	d.rtDatabases.invalidate()
+	d.rtDatabases.put(rtDatabaseKey{}, gen, db)
+	stale, _ := d.rtDatabases.get(rtDatabaseKey{})
+	require.Nil(t, stale)
+}
+
+func TestDHT_normalizedRTDatabase_invalidated_on_identify_of_backfill_candidates(t *testing.T) {
+	d := newTestDHT(t)
+	peers := fillRoutingTable(t, d, 250)
+	key := kadt.PeerID(peers[0]).Key()
+	pstore := d.host.Peerstore()
+
+	db, err := d.normalizedRTDatabase(key, false)
+	require.NoError(t, err)
+
+	// identify of peers that are never backfilled leaves the cache intact
+	nonDHT := newPeerID(t)
+	pstore.AddAddr(nonDHT, ma.StringCast("/ip4/1.2.3.4/tcp/4001"), time.Hour)
+	d.onEvtPeerIdentificationCompleted(event.EvtPeerIdentificationCompleted{Peer: nonDHT})
+
+	private := newPeerID(t)
+	pstore.AddAddr(private, ma.StringCast("/ip4/127.0.1.1/tcp/4001"), time.Hour)
+	require.NoError(t, pstore.AddProtocols(private, d.cfg.ProtocolID))
+	d.onEvtPeerIdentificationCompleted(event.EvtPeerIdentificationCompleted{Peer: private})
+
+	cached, err := d.normalizedRTDatabase(key, false)
+	require.NoError(t, err)
+	require.Same(t, db, cached)
+
+	// identify of a backfill candidate invalidates the cache
+	candidate := newPeerID(t)
+	pstore.AddAddr(candidate, ma.StringCast("/ip4/1.2.3.4/tcp/4002"), time.Hour)
+	require.NoError(t, pstore.AddProtocols(candidate, d.cfg.ProtocolID))
+	d.onEvtPeerIdentificationCompleted(event.EvtPeerIdentificationCompleted{Peer: candidate})
+
+	updated, err := d.normalizedRTDatabase(key, false)
+	require.NoError(t, err)
+	require.NotSame(t, db, updated)
+}
+
+func TestDHT_normalizedRTDatabase_invalidated_with_routing_notifier(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+
+	// the topology replaces the routing notifier of the coordinator
+	top := NewTopology(t)
+	d1 := top.AddServer(nil)
+	d2 := top.AddServer(nil)
+
+	key := kadt.PeerID(d2.host.ID()).Key()
+	db, err := d1.normalizedRTDatabase(key, false)
+	require.NoError(t, err)
+
+	top.Connect(ctx, d1, d2)
+
+	updated, err := d1.normalizedRTDatabase(key, false)
+	require.NoError(t, err)
+	require.NotSame(t, db, updated)
+}
@@ -0,0 +1,147 @@
+package private_routing
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"sync"
+
+	"github.com/plprobelab/zikade/pir"
+)
+
+// Database holds the rows of a database that PIR requests are processed over. The rows are
+// encoded once for each scheme of the requests that are processed over the Database, by the
+// PIR_Protocols that implement [pir.DatabaseEncoder], so that a Database can be reused across
+// requests. A Database must not be modified after it was constructed, use [Database.Update]
+// instead. It is safe for concurrent use.
+type Database struct {
+	rows [][]byte
+
+	mu      sync.Mutex
+	encoded map[string]pir.EncodedDatabase
+
+	// base is the Database that this Database was updated from, and changed holds the
+	// indices of the rows that differ from it. They are used to update the encodings of
+	// base instead of encoding all rows again.
+	base    *Database
+	changed []int
+}
+
+// NewDatabase returns a [Database] with the given rows.
+func NewDatabase(rows [][]byte) *Database {
+	return &Database{
+		rows:    rows,
+		encoded: make(map[string]pir.EncodedDatabase),
+	}
+}
+
+// Rows returns the rows of the database.
+func (db *Database) Rows() [][]byte {
+	return db.rows
+}
+
+// rowSize returns the length of the longest row, which the rows are padded to when they are encoded.
+func (db *Database) rowSize() int {
+	size := 0
+	for _, row := range db.rows {
+		if len(row) > size {
+			size = len(row)
+		}
+	}
+	return size
+}
+
+// log2NumRows returns the base-2 logarithm of the number of rows, rounded up.
+func (db *Database) log2NumRows() int {
+	if len(db.rows) <= 1 {
+		return 0
+	}
+	return bits.Len(uint(len(db.rows) - 1))
+}
+
+// encode returns the rows encoded by the encoder for the given scheme, encoding them only if
+// they haven't been encoded for the scheme before. Schemes whose requests choose a parameter
+// set are identified along with the parameter set, as the rows are encoded for each of them.
+func (db *Database) encode(scheme string, encoder pir.DatabaseEncoder) (pir.EncodedDatabase, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if encoded, ok := db.encoded[scheme]; ok {
+		return encoded, nil
+	}
+
+	var (
+		encoded pir.EncodedDatabase
+		err     error
+	)
+	if previous, ok := db.baseEncoding(scheme); ok {
+		if incremental, ok := encoder.(pir.IncrementalDatabaseEncoder); ok {
+			encoded, err = incremental.UpdateEncodedDatabase(previous, db.rows, db.changed)
+		} else {
+			encoded, err = encoder.EncodeDatabase(db.rows)
+		}
+	} else {
+		encoded, err = encoder.EncodeDatabase(db.rows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode database for PIR scheme %q: %w", scheme, err)
+	}
+	db.encoded[scheme] = encoded
+
+	return encoded, nil
+}
+
+// baseEncoding returns the encoding of the base of the database for the given scheme, if
+// there is one.
+func (db *Database) baseEncoding(scheme string) (pir.EncodedDatabase, bool) {
+	if db.base == nil {
+		return nil, false
+	}
+
+	db.base.mu.Lock()
+	defer db.base.mu.Unlock()
+
+	encoded, ok := db.base.encoded[scheme]
+	return encoded, ok
+}
+
+// Update returns a new [Database] in which the rows at the given indices are replaced.
+// The indices must be in range of the rows of the database. The rows of the returned
+// Database are encoded lazily, like those of any Database. Encoders that implement
+// [pir.IncrementalDatabaseEncoder] then only encode the replaced rows again, if this
+// Database was encoded for the same scheme before.
+func (db *Database) Update(rows map[int][]byte) *Database {
+	updated := NewDatabase(make([][]byte, len(db.rows)))
+	copy(updated.rows, db.rows)
+
+	changed := make(map[int]struct{}, len(rows))
+	for i, row := range rows {
+		updated.rows[i] = row
+		changed[i] = struct{}{}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(db.encoded) == 0 {
+		// db was never encoded, so the encodings of its base are updated
+		// with the rows that changed since then instead.
+		updated.base = db.base
+		for _, i := range db.changed {
+			changed[i] = struct{}{}
+		}
+	} else {
+		updated.base = db
+	}
+
+	// db is superseded by updated, so it won't be updated from its base anymore
+	db.base, db.changed = nil, nil
+
+	updated.changed = make([]int, 0, len(changed))
+	for i := range changed {
+		updated.changed = append(updated.changed, i)
+	}
+	sort.Ints(updated.changed)
+
+	return updated
+}
@@ -0,0 +1,155 @@
+package private_routing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/pir"
+)
+
+// recordingEncoder is a [pir.IncrementalDatabaseEncoder] that records which rows it encoded.
+type recordingEncoder struct {
+	encoded [][]int
+}
+
+type recordingEncodedDatabase [][]byte
+
+func (db recordingEncodedDatabase) NumRows() int { return len(db) }
+
+func (e *recordingEncoder) EncodeDatabase(database [][]byte) (pir.EncodedDatabase, error) {
+	rows := make([]int, len(database))
+	for i := range rows {
+		rows[i] = i
+	}
+	e.encoded = append(e.encoded, rows)
+	return recordingEncodedDatabase(database), nil
+}
+
+func (e *recordingEncoder) UpdateEncodedDatabase(encoded pir.EncodedDatabase, database [][]byte, changedRows []int) (pir.EncodedDatabase, error) {
+	e.encoded = append(e.encoded, changedRows)
+	return recordingEncodedDatabase(database), nil
+}
+
+func (e *recordingEncoder) ProcessRequestOverEncodedDatabase(ctx context.Context, request *pb.PIR_Request, database pir.EncodedDatabase) (*pb.PIR_Response, error) {
+	return &pb.PIR_Response{}, nil
+}
+
+func TestDatabase_Update(t *testing.T) {
+	e := &recordingEncoder{}
+	db := NewDatabase([][]byte{{0}, {1}, {2}, {3}})
+
+	_, err := db.encode("scheme", e)
+	require.NoError(t, err)
+	require.Equal(t, [][]int{{0, 1, 2, 3}}, e.encoded)
+
+	// encoding again for the same scheme reuses the encoding
+	_, err = db.encode("scheme", e)
+	require.NoError(t, err)
+	require.Len(t, e.encoded, 1)
+
+	// only the changed rows are encoded again, including those of updates that were never encoded
+	updated := db.Update(map[int][]byte{1: {4}}).Update(map[int][]byte{3: {5}})
+	require.Equal(t, [][]byte{{0}, {4}, {2}, {5}}, updated.Rows())
+	require.Equal(t, [][]byte{{0}, {1}, {2}, {3}}, db.Rows())
+
+	encoded, err := updated.encode("scheme", e)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 3}, e.encoded[1])
+	require.Equal(t, recordingEncodedDatabase(updated.Rows()), encoded)
+
+	// a scheme that the base wasn't encoded for is encoded completely
+	_, err = updated.encode("other", e)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2, 3}, e.encoded[2])
+}
+
+func TestRunPIR_stale_hint(t *testing.T) {
+	schemes := pir.NewRegistry()
+	schemes.Register(pir.LWE_SimplePIR, func(log2_num_rows int) pir.PIR_Protocol {
+		return pir.NewSimpleLWE_PIR_Protocol(log2_num_rows)
+	})
+
+	db := NewDatabase([][]byte{{0}, {1}, {2}, {3}})
+	client := pir.NewSimpleLWE_PIR_Protocol(db.log2NumRows())
+	hintResponse, err := RunPIRforCloserPeersDatabase(context.Background(), schemes, client.GenerateHintRequest(), db)
+	require.NoError(t, err)
+	require.NoError(t, client.ProcessHintResponse(hintResponse))
+
+	req, err := client.GenerateRequestFromQuery(1)
+	require.NoError(t, err)
+
+	// the hint is stale once the database changed
+	res, err := RunPIRforCloserPeersDatabase(context.Background(), schemes, req, db.Update(map[int][]byte{1: {4}}))
+	require.NoError(t, err)
+	require.Equal(t, pb.PIR_Error_STALE_HINT, res.GetError().GetCode())
+}
+
+func TestRunPIR_budget_exceeded(t *testing.T) {
+	schemes := pir.NewDefaultRegistry()
+	schemes.Register(pir.DPF_TwoServer, func(log2_num_rows int) pir.PIR_Protocol {
+		return pir.NewDPF_TwoServer_PIR_Protocol(log2_num_rows)
+	})
+
+	db := NewDatabase([][]byte{{0}, {1}, {2}, {3}})
+	client := pir.NewDPF_TwoServer_PIR_Protocol(db.log2NumRows())
+	require.NoError(t, client.CreatePrivateKeyMaterial())
+	req, _, err := client.GenerateRequestsFromQuery(1)
+	require.NoError(t, err)
+
+	// the request is refused before it is processed
+	res, err := RunPIRforCloserPeersDatabase(context.Background(), schemes.WithRequestBudget(1), req, db)
+	require.NoError(t, err)
+	require.Equal(t, pb.PIR_Error_BUDGET_EXCEEDED, res.GetError().GetCode())
+	require.ErrorIs(t, responseError(res), pir.ErrBudgetExceeded)
+
+	res, err = RunPIRforCloserPeersDatabase(context.Background(), schemes.WithRequestBudget(1<<20), req, db)
+	require.NoError(t, err)
+	require.Nil(t, res.GetError())
+}
+
+func TestRunPIR_parameter_sets(t *testing.T) {
+	db := NewDatabase([][]byte{{0}, {1}, {2}, {3}})
+	set, err := pir.LookupRLWEParameterSet("N12_QP109_T65537")
+	require.NoError(t, err)
+
+	// the database is encoded for the parameter set of each request
+	for _, client := range []*pir.SimpleRLWE_PIR_Protocol{
+		pir.NewSimpleRLWE_PIR_Protocol_mode(db.log2NumRows(), pir.RLWE_All_Keys),
+		pir.NewSimpleRLWE_PIR_Protocol_parameters(db.log2NumRows(), pir.RLWE_All_Keys, set),
+	} {
+		req, err := client.GenerateRequestFromQuery(2)
+		require.NoError(t, err)
+		res, err := RunPIRforCloserPeersDatabase(context.Background(), pir.NewDefaultRegistry(), req, db)
+		require.NoError(t, err)
+		row, err := client.ProcessResponseToPlaintext(res)
+		require.NoError(t, err)
+		require.Equal(t, byte(2), row[0])
+	}
+	require.Len(t, db.encoded, 2)
+
+	client := pir.NewSimpleRLWE_PIR_Protocol_mode(db.log2NumRows(), pir.RLWE_All_Keys)
+	req, err := client.GenerateRequestFromQuery(2)
+	require.NoError(t, err)
+	req.ParameterSet = "N11_QP54_T257"
+	res, err := RunPIRforCloserPeersDatabase(context.Background(), pir.NewDefaultRegistry(), req, db)
+	require.NoError(t, err)
+	require.Equal(t, pb.PIR_Error_UNSUPPORTED_PARAMETER_SET, res.GetError().GetCode())
+	require.ErrorIs(t, responseError(res), pir.ErrUnsupportedParameterSet)
+}
+
+func TestRunPIR_invalid_request(t *testing.T) {
+	db := NewDatabase([][]byte{{0}, {1}, {2}, {3}})
+	client := pir.NewSimpleRLWE_PIR_Protocol_mode(db.log2NumRows(), pir.RLWE_All_Keys)
+	req, err := client.GenerateRequestFromQuery(2)
+	require.NoError(t, err)
+
+	// a truncated query is refused before it is unmarshalled
+	req.EncryptedQuery = req.EncryptedQuery[:len(req.EncryptedQuery)/2]
+	res, err := RunPIRforCloserPeersDatabase(context.Background(), pir.NewDefaultRegistry(), req, db)
+	require.NoError(t, err)
+	require.Equal(t, pb.PIR_Error_INVALID_REQUEST, res.GetError().GetCode())
+	require.ErrorIs(t, responseError(res), pir.ErrInvalidRequest)
+}
@@ -0,0 +1,125 @@
+package private_routing
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/pir"
+)
+
+// EvaluationKeyCache caches the evaluation keys that clients send with their PIR requests, such
+// that subsequent requests of a client only need to reference the keys by their ID. The keys of
+// different clients are kept apart by a scope, such as the peer ID of the client. Per scope, the
+// cache holds the keys of a single ID for each scheme, parameter set and number of rows, which
+// replace the keys that the client sent before. The cache holds a bounded number of keys, evicting
+// the least recently used ones, and drops keys once they were cached for longer than the
+// configured TTL. It is safe for concurrent use.
+type EvaluationKeyCache struct {
+	clk   clock.Clock
+	ttl   time.Duration
+	cache *lru.Cache[string, cachedEvaluationKeys]
+}
+
+// cachedEvaluationKeys holds the marshalled evaluation keys of a request along with their ID.
+type cachedEvaluationKeys struct {
+	id     []byte
+	keys   []byte
+	expiry time.Time
+}
+
+// NewEvaluationKeyCache returns an [EvaluationKeyCache] that holds the keys of at most size requests
+// for the duration of ttl.
+func NewEvaluationKeyCache(size int, ttl time.Duration, clk clock.Clock) (*EvaluationKeyCache, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("evaluation key cache ttl must be positive, got %s", ttl)
+	}
+
+	cache, err := lru.New[string, cachedEvaluationKeys](size)
+	if err != nil {
+		return nil, fmt.Errorf("new evaluation key cache: %w", err)
+	}
+
+	return &EvaluationKeyCache{
+		clk:   clk,
+		ttl:   ttl,
+		cache: cache,
+	}, nil
+}
+
+// cacheKey returns the key that the evaluation keys of the request of the client with the given
+// scope are cached under.
+func cacheKey(scope string, req *pb.PIR_Request) string {
+	return fmt.Sprintf("%s/%s/%s/%d", scope, req.GetScheme(), req.GetParameterSet(), req.GetLog2NumRows())
+}
+
+// ResolveRequest resolves the evaluation keys of a request of the client with the given scope. If
+// the request only references its evaluation keys by their ID, they are set on the request from the
+// cache and resolved is true. If they aren't cached, ResolveRequest returns a response with an
+// UNKNOWN_EVALUATION_KEYS error for the client instead. Requests that carry their keys or have no ID
+// are left as they are. ResolveRequest doesn't cache any keys, see [EvaluationKeyCache.Add].
+func (c *EvaluationKeyCache) ResolveRequest(scope string, req *pb.PIR_Request) (resolved bool, errResponse *pb.PIR_Response) {
+	id := req.GetEvaluationKeysId()
+	if len(id) == 0 || req.GetSchemeDependent() != nil {
+		return false, nil
+	}
+
+	if c != nil {
+		key := cacheKey(scope, req)
+		if cached, found := c.cache.Get(key); found && bytes.Equal(cached.id, id) && c.clk.Now().Before(cached.expiry) {
+			req.SchemeDependent = &pb.PIR_Request_RLWEEvaluationKeys{
+				RLWEEvaluationKeys: cached.keys,
+			}
+			return true, nil
+		} else if found && !c.clk.Now().Before(cached.expiry) {
+			c.cache.Remove(key)
+		}
+	}
+
+	return false, &pb.PIR_Response{
+		Error: &pb.PIR_Error{
+			Code:    pb.PIR_Error_UNKNOWN_EVALUATION_KEYS,
+			Message: "evaluation keys of the request are not cached",
+		},
+	}
+}
+
+// Add caches the evaluation keys that a request of the client with the given scope carries along
+// with their ID, replacing the keys that the client sent before for the same scheme, parameter set
+// and number of rows. It must only be called once the request was processed successfully, such that
+// only valid keys are cached. Add reports whether the keys were cached, see
+// [EvaluationKeyCache.Cacheable].
+func (c *EvaluationKeyCache) Add(scope string, req *pb.PIR_Request) bool {
+	if !c.Cacheable(req) {
+		return false
+	}
+
+	c.cache.Add(cacheKey(scope, req), cachedEvaluationKeys{
+		id:     req.GetEvaluationKeysId(),
+		keys:   req.GetRLWEEvaluationKeys(),
+		expiry: c.clk.Now().Add(c.ttl),
+	})
+	return true
+}
+
+// Cacheable reports whether [EvaluationKeyCache.Add] caches the evaluation keys of the request, so
+// that a server can tell the client before it finished processing the request. Only keys that the
+// request carries along with their ID are cached, and keys larger than those of any valid request
+// with the parameter set are not. A nil cache doesn't cache any keys.
+func (c *EvaluationKeyCache) Cacheable(req *pb.PIR_Request) bool {
+	id, keys := req.GetEvaluationKeysId(), req.GetRLWEEvaluationKeys()
+	if c == nil || len(id) == 0 || keys == nil {
+		return false
+	}
+
+	set, err := pir.LookupRLWEParameterSet(req.GetParameterSet())
+	if err != nil {
+		return false
+	}
+	max_size, err := set.MaxEvaluationKeysSize()
+	return err == nil && len(keys) <= max_size
+}
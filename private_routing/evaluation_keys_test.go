@@ -0,0 +1,163 @@
+package private_routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/pir"
+)
+
+func requestWithKeys(id string, keys []byte) *pb.PIR_Request {
+	req := &pb.PIR_Request{
+		Scheme:           pir.RLWE_Whispir_3_Keys,
+		EvaluationKeysId: []byte(id),
+	}
+	if keys != nil {
+		req.SchemeDependent = &pb.PIR_Request_RLWEEvaluationKeys{RLWEEvaluationKeys: keys}
+	}
+	return req
+}
+
+func TestEvaluationKeyCache_ResolveRequest(t *testing.T) {
+	clk := clock.NewMock()
+	c, err := NewEvaluationKeyCache(2, time.Minute, clk)
+	require.NoError(t, err)
+
+	// keys sent with a request are left as they are
+	resolved, errResponse := c.ResolveRequest("alice", requestWithKeys("id", []byte("keys")))
+	require.False(t, resolved)
+	require.Nil(t, errResponse)
+
+	// and aren't cached before the request was processed
+	_, errResponse = c.ResolveRequest("alice", requestWithKeys("id", nil))
+	require.Equal(t, pb.PIR_Error_UNKNOWN_EVALUATION_KEYS, errResponse.GetError().GetCode())
+
+	require.True(t, c.Add("alice", requestWithKeys("id", []byte("keys"))))
+
+	// so that subsequent requests of the client can reference them
+	req := requestWithKeys("id", nil)
+	resolved, errResponse = c.ResolveRequest("alice", req)
+	require.True(t, resolved)
+	require.Nil(t, errResponse)
+	require.Equal(t, []byte("keys"), req.GetRLWEEvaluationKeys())
+
+	// but not those of other clients
+	resolved, errResponse = c.ResolveRequest("bob", requestWithKeys("id", nil))
+	require.False(t, resolved)
+	require.Equal(t, pb.PIR_Error_UNKNOWN_EVALUATION_KEYS, errResponse.GetError().GetCode())
+
+	// requests without an id are left as they are
+	req = &pb.PIR_Request{Scheme: pir.RLWE_Whispir_3_Keys}
+	resolved, errResponse = c.ResolveRequest("alice", req)
+	require.False(t, resolved)
+	require.Nil(t, errResponse)
+	require.Nil(t, req.GetSchemeDependent())
+}
+
+func TestEvaluationKeyCache_Add_replaces(t *testing.T) {
+	clk := clock.NewMock()
+	c, err := NewEvaluationKeyCache(8, time.Minute, clk)
+	require.NoError(t, err)
+
+	require.True(t, c.Add("alice", requestWithKeys("old", []byte("old keys"))))
+	require.True(t, c.Add("alice", requestWithKeys("new", []byte("new keys"))))
+
+	// a client has a single live id per scheme, parameter set and number of rows
+	require.Equal(t, 1, c.cache.Len())
+
+	_, errResponse := c.ResolveRequest("alice", requestWithKeys("old", nil))
+	require.Equal(t, pb.PIR_Error_UNKNOWN_EVALUATION_KEYS, errResponse.GetError().GetCode())
+
+	req := requestWithKeys("new", nil)
+	_, errResponse = c.ResolveRequest("alice", req)
+	require.Nil(t, errResponse)
+	require.Equal(t, []byte("new keys"), req.GetRLWEEvaluationKeys())
+
+	// keys for databases of another number of rows are cached alongside
+	req = requestWithKeys("other", []byte("other keys"))
+	req.Log2NumRows = 4
+	require.True(t, c.Add("alice", req))
+	require.Equal(t, 2, c.cache.Len())
+}
+
+func TestEvaluationKeyCache_Add_invalid(t *testing.T) {
+	clk := clock.NewMock()
+	c, err := NewEvaluationKeyCache(8, time.Minute, clk)
+	require.NoError(t, err)
+
+	set, err := pir.LookupRLWEParameterSet(pir.DefaultRLWEParameterSet)
+	require.NoError(t, err)
+	max_size, err := set.MaxEvaluationKeysSize()
+	require.NoError(t, err)
+
+	// keys larger than those of any valid request aren't cached
+	require.True(t, c.Cacheable(requestWithKeys("id", make([]byte, max_size))))
+	require.False(t, c.Cacheable(requestWithKeys("id", make([]byte, max_size+1))))
+	require.False(t, c.Add("alice", requestWithKeys("id", make([]byte, max_size+1))))
+
+	// nor are the keys of unknown parameter sets
+	req := requestWithKeys("id", []byte("keys"))
+	req.ParameterSet = "unknown"
+	require.False(t, c.Add("alice", req))
+
+	// or requests without keys or an id
+	require.False(t, c.Add("alice", requestWithKeys("id", nil)))
+	require.False(t, c.Add("alice", requestWithKeys("", []byte("keys"))))
+
+	require.Equal(t, 0, c.cache.Len())
+}
+
+func TestEvaluationKeyCache_ResolveRequest_expired(t *testing.T) {
+	clk := clock.NewMock()
+	c, err := NewEvaluationKeyCache(2, time.Minute, clk)
+	require.NoError(t, err)
+
+	require.True(t, c.Add("alice", requestWithKeys("id", []byte("keys"))))
+
+	clk.Add(time.Minute)
+
+	req := requestWithKeys("id", nil)
+	_, errResponse := c.ResolveRequest("alice", req)
+	require.Equal(t, pb.PIR_Error_UNKNOWN_EVALUATION_KEYS, errResponse.GetError().GetCode())
+	require.Nil(t, req.GetSchemeDependent())
+}
+
+func TestEvaluationKeyCache_ResolveRequest_evicted(t *testing.T) {
+	clk := clock.NewMock()
+	c, err := NewEvaluationKeyCache(1, time.Minute, clk)
+	require.NoError(t, err)
+
+	c.Add("alice", requestWithKeys("id", []byte("keys")))
+	c.Add("bob", requestWithKeys("id", []byte("keys")))
+
+	_, errResponse := c.ResolveRequest("alice", requestWithKeys("id", nil))
+	require.Equal(t, pb.PIR_Error_UNKNOWN_EVALUATION_KEYS, errResponse.GetError().GetCode())
+
+	_, errResponse = c.ResolveRequest("bob", requestWithKeys("id", nil))
+	require.Nil(t, errResponse)
+}
+
+func TestEvaluationKeyCache_nil_cache(t *testing.T) {
+	var c *EvaluationKeyCache
+
+	// keys sent with the request are used, but not cached
+	resolved, errResponse := c.ResolveRequest("alice", requestWithKeys("id", []byte("keys")))
+	require.False(t, resolved)
+	require.Nil(t, errResponse)
+	require.False(t, c.Add("alice", requestWithKeys("id", []byte("keys"))))
+
+	_, errResponse = c.ResolveRequest("alice", requestWithKeys("id", nil))
+	require.Equal(t, pb.PIR_Error_UNKNOWN_EVALUATION_KEYS, errResponse.GetError().GetCode())
+}
+
+func TestNewEvaluationKeyCache_invalid(t *testing.T) {
+	_, err := NewEvaluationKeyCache(0, time.Minute, clock.New())
+	require.Error(t, err)
+
+	_, err = NewEvaluationKeyCache(1, 0, clock.New())
+	require.Error(t, err)
+}
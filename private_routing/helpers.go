@@ -3,11 +3,19 @@ package private_routing
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/plprobelab/zikade/pb"
 	"google.golang.org/protobuf/proto"
 )
 
+// RowLengthPrefixSize is the size in bytes of the length that a marshalled PB is prefixed
+// with in a row of a PIR database.
+const RowLengthPrefixSize = 8
+
+// ErrRowOverflow is returned when a marshalled PB doesn't fit into a row of a fixed size.
+var ErrRowOverflow = errors.New("marshalled PB exceeds the row size")
+
 func UnmarshallPlaintextToPB(paddedMarshalledBucket []byte) (*pb.Message, error) {
 	marshalledBucket, err := unpadMarshalledPBWithLength(paddedMarshalledBucket)
 	if err != nil {
@@ -33,6 +41,29 @@ func MarshallPBToPlaintext(mesg *pb.Message) ([]byte, error) {
 	return padded, nil
 }
 
+// MarshallPBToFixedSizePlaintext is like [MarshallPBToPlaintext], but pads the row with zeros
+// to rowSize bytes, so that all rows of a database have the same size. If the marshalled PB
+// doesn't fit into the row, the returned error wraps [ErrRowOverflow].
+func MarshallPBToFixedSizePlaintext(mesg *pb.Message, rowSize int) ([]byte, error) {
+	if !FitsInRow(mesg, rowSize) {
+		return nil, fmt.Errorf("%w: %d bytes, row size %d", ErrRowOverflow, RowLengthPrefixSize+proto.Size(mesg), rowSize)
+	}
+
+	padded, err := MarshallPBToPlaintext(mesg)
+	if err != nil {
+		return nil, err
+	}
+
+	row := make([]byte, rowSize)
+	copy(row, padded)
+	return row, nil
+}
+
+// FitsInRow returns true if the PB fits into a row of rowSize bytes once it is marshalled.
+func FitsInRow(mesg *pb.Message, rowSize int) bool {
+	return RowLengthPrefixSize+proto.Size(mesg) <= rowSize
+}
+
 func padMarshalledPBWithLength(marshalledPB []byte) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	var lenMarshalledRTEntries = uint64(len(marshalledPB))
@@ -45,6 +76,9 @@ func padMarshalledPBWithLength(marshalledPB []byte) ([]byte, error) {
 }
 
 func unpadMarshalledPBWithLength(paddedMarshalledBucket []byte) ([]byte, error) {
+	if len(paddedMarshalledBucket) < 8 {
+		return nil, fmt.Errorf("padded marshalled PB is shorter than its length prefix")
+	}
 	buf := bytes.NewReader(paddedMarshalledBucket[0:8])
 	var lenMarshalledRTEntries uint64
 	err := binary.Read(buf, binary.LittleEndian, &lenMarshalledRTEntries)
@@ -53,6 +87,9 @@ func unpadMarshalledPBWithLength(paddedMarshalledBucket []byte) ([]byte, error)
 		return nil, err
 	}
 	fmt.Printf("marshalled bucket length %d\n", lenMarshalledRTEntries)
+	if lenMarshalledRTEntries > uint64(len(paddedMarshalledBucket)-8) {
+		return nil, fmt.Errorf("length of the marshalled PB %d exceeds the padded length %d", lenMarshalledRTEntries, len(paddedMarshalledBucket)-8)
+	}
 
 	return paddedMarshalledBucket[8 : 8+lenMarshalledRTEntries], nil
 }
@@ -0,0 +1,65 @@
+package private_routing
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+// ErrInvalidPeerRecord is returned when a peer retrieved with PIR carries a signed peer record that fails
+// verification, which means that the server forged or tampered with the peer.
+var ErrInvalidPeerRecord = errors.New("invalid signed peer record")
+
+// VerifyPeerRecords verifies the signed peer records of the peers, which the server includes in the buckets of its
+// routing table if the request asked for signed_peer_records. It returns the peers with the addresses from their
+// signed records, so that the client only dials addresses that the peers signed themselves. Peers without a signed
+// record are dropped, as the server may not hold records for all of its peers. If any record fails verification,
+// or was signed by another peer than the one it is attached to, the whole response is rejected with an error
+// wrapping [ErrInvalidPeerRecord].
+func VerifyPeerRecords(peers []*pb.Message_Peer) ([]*pb.Message_Peer, error) {
+	verified := make([]*pb.Message_Peer, 0, len(peers))
+	for _, p := range peers {
+		if len(p.GetSignedRecord()) == 0 {
+			continue
+		}
+
+		id, err := peer.IDFromBytes(p.GetId())
+		if err != nil {
+			return nil, fmt.Errorf("%w: peer id: %w", ErrInvalidPeerRecord, err)
+		}
+
+		envelope, rec, err := record.ConsumeEnvelope(p.GetSignedRecord(), peer.PeerRecordEnvelopeDomain)
+		if err != nil {
+			return nil, fmt.Errorf("%w: peer %s: %w", ErrInvalidPeerRecord, id, err)
+		}
+		peerRecord, ok := rec.(*peer.PeerRecord)
+		if !ok {
+			return nil, fmt.Errorf("%w: peer %s: unexpected record type %T", ErrInvalidPeerRecord, id, rec)
+		}
+
+		// the envelope must be signed with the key of the peer that the record is about
+		signer, err := peer.IDFromPublicKey(envelope.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: peer %s: signer: %w", ErrInvalidPeerRecord, id, err)
+		}
+		if signer != id || peerRecord.PeerID != id {
+			return nil, fmt.Errorf("%w: record of peer %s attached to peer %s", ErrInvalidPeerRecord, peerRecord.PeerID, id)
+		}
+
+		addrs := make([][]byte, len(peerRecord.Addrs))
+		for i, addr := range peerRecord.Addrs {
+			addrs[i] = addr.Bytes()
+		}
+		verified = append(verified, &pb.Message_Peer{
+			Id:           p.GetId(),
+			Addrs:        addrs,
+			Connection:   p.GetConnection(),
+			SignedRecord: p.GetSignedRecord(),
+		})
+	}
+	return verified, nil
+}
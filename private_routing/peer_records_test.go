@@ -0,0 +1,84 @@
+package private_routing
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+func newSignedPeer(t *testing.T, addr string) (*pb.Message_Peer, crypto.PrivKey) {
+	priv, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	id, err := peer.IDFromPublicKey(pub)
+	require.NoError(t, err)
+
+	a, err := ma.NewMultiaddr(addr)
+	require.NoError(t, err)
+	envelope, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: id, Addrs: []ma.Multiaddr{a}}), priv)
+	require.NoError(t, err)
+	signedRecord, err := envelope.Marshal()
+	require.NoError(t, err)
+
+	return &pb.Message_Peer{
+		Id:           []byte(id),
+		Addrs:        [][]byte{a.Bytes()},
+		SignedRecord: signedRecord,
+	}, priv
+}
+
+func TestVerifyPeerRecords(t *testing.T) {
+	valid, _ := newSignedPeer(t, "/ip4/127.0.0.1/tcp/4001")
+	unsigned, _ := newSignedPeer(t, "/ip4/127.0.0.2/tcp/4001")
+	unsigned.SignedRecord = nil
+
+	// the addresses are taken from the record, not from the unauthenticated addrs of the peer
+	rewritten, _ := newSignedPeer(t, "/ip4/127.0.0.3/tcp/4001")
+	signedAddrs := rewritten.Addrs
+	rewritten.Addrs = [][]byte{ma.StringCast("/ip4/10.0.0.1/tcp/4001").Bytes()}
+
+	verified, err := VerifyPeerRecords([]*pb.Message_Peer{valid, unsigned, rewritten})
+	require.NoError(t, err)
+	require.Len(t, verified, 2)
+	assert.Equal(t, valid.Id, verified[0].Id)
+	assert.Equal(t, valid.Addrs, verified[0].Addrs)
+	assert.Equal(t, rewritten.Id, verified[1].Id)
+	assert.Equal(t, signedAddrs, verified[1].Addrs)
+}
+
+func TestVerifyPeerRecords_invalid(t *testing.T) {
+	tampered, _ := newSignedPeer(t, "/ip4/127.0.0.1/tcp/4001")
+	tampered.SignedRecord[len(tampered.SignedRecord)-1] ^= 1
+
+	// the record of another peer is attached to the peer
+	other, _ := newSignedPeer(t, "/ip4/127.0.0.2/tcp/4001")
+	mismatched, _ := newSignedPeer(t, "/ip4/127.0.0.3/tcp/4001")
+	mismatched.SignedRecord = other.SignedRecord
+
+	// the record is about the peer, but signed by another key
+	forged, _ := newSignedPeer(t, "/ip4/127.0.0.4/tcp/4001")
+	_, otherPriv := newSignedPeer(t, "/ip4/127.0.0.5/tcp/4001")
+	id, err := peer.IDFromBytes(forged.Id)
+	require.NoError(t, err)
+	envelope, err := record.Seal(&peer.PeerRecord{PeerID: id, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/10.0.0.1/tcp/4001")}, Seq: 1}, otherPriv)
+	require.NoError(t, err)
+	forged.SignedRecord, err = envelope.Marshal()
+	require.NoError(t, err)
+
+	for name, p := range map[string]*pb.Message_Peer{
+		"tampered":   tampered,
+		"mismatched": mismatched,
+		"forged":     forged,
+	} {
+		valid, _ := newSignedPeer(t, "/ip4/127.0.0.6/tcp/4001")
+		_, err := VerifyPeerRecords([]*pb.Message_Peer{valid, p})
+		assert.ErrorIs(t, err, ErrInvalidPeerRecord, name)
+	}
+}
@@ -1,17 +1,81 @@
 package private_routing
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/ipfs/go-cid"
 	"github.com/plprobelab/zikade/kadt"
 	"github.com/plprobelab/zikade/pb"
 	"github.com/plprobelab/zikade/pir"
 )
 
+// PeerRoutingLog2NumRows is the log2 of the number of rows of the normalized routing table that PIR requests for
+// closer peers are processed over, which holds a row for each common prefix length of 256 bit keys.
+const PeerRoutingLog2NumRows = 8
+
+// ErrServerBusy is returned when the server refused to process a request because it is overloaded. The
+// request may be sent to another server instead.
+var ErrServerBusy = errors.New("PIR server busy")
+
 type PirClient struct {
 	protocol pir.PIR_Protocol
+
+	// session is set if the client reuses the key material of a session
+	session *pir.SimpleRLWE_Session
+}
+
+// ResponseError is returned by [PirClient.ProcessResponse] if the server could not process
+// the request and responded with an error instead of ciphertexts.
+type ResponseError struct {
+	Code             pb.PIR_Error_Code
+	Message          string
+	SupportedSchemes []string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Code == pb.PIR_Error_UNSUPPORTED_SCHEME {
+		return fmt.Sprintf("PIR request rejected by server: %s (supported schemes: %v)", e.Message, e.SupportedSchemes)
+	}
+	return fmt.Sprintf("PIR request rejected by server: %s: %s", e.Code, e.Message)
+}
+
+// Unwrap allows checking a ResponseError for its code with errors.Is, e.g. for an
+// UNSUPPORTED_SCHEME code with errors.Is(err, pir.ErrUnsupportedScheme).
+func (e *ResponseError) Unwrap() error {
+	switch e.Code {
+	case pb.PIR_Error_UNSUPPORTED_SCHEME:
+		return pir.ErrUnsupportedScheme
+	case pb.PIR_Error_UNKNOWN_EVALUATION_KEYS:
+		return pir.ErrUnknownEvaluationKeys
+	case pb.PIR_Error_STALE_HINT:
+		return pir.ErrStaleHint
+	case pb.PIR_Error_EPOCH_MISMATCH:
+		return pir.ErrEpochMismatch
+	case pb.PIR_Error_BUDGET_EXCEEDED:
+		return pir.ErrBudgetExceeded
+	case pb.PIR_Error_BUSY:
+		return ErrServerBusy
+	case pb.PIR_Error_UNSUPPORTED_PARAMETER_SET:
+		return pir.ErrUnsupportedParameterSet
+	case pb.PIR_Error_INVALID_REQUEST:
+		return pir.ErrInvalidRequest
+	case pb.PIR_Error_TABLE_LENGTH_MISMATCH:
+		return ErrKeywordTableLength
+	default:
+		return nil
+	}
 }
 
 func (client *PirClient) ProcessResponse(closerPeersResponse *pb.PIR_Response) (*pb.Message, error) {
+	if err := responseError(closerPeersResponse); err != nil {
+		if err.Code == pb.PIR_Error_UNKNOWN_EVALUATION_KEYS && client.session != nil {
+			// the server evicted the keys of the session, send them with the next request
+			client.session.ResendEvaluationKeys()
+		}
+		return nil, err
+	}
+
 	plaintext, err := client.protocol.ProcessResponseToPlaintext(closerPeersResponse)
 	if err != nil {
 		return nil, err
@@ -25,22 +89,63 @@ func (client *PirClient) ProcessResponse(closerPeersResponse *pb.PIR_Response) (
 	return UnmarshallPlaintextToPB(plaintext)
 }
 
+// responseError returns the error that the server responded with instead of ciphertexts, if any.
+func responseError(res *pb.PIR_Response) *ResponseError {
+	pirErr := res.GetError()
+	if pirErr == nil {
+		return nil
+	}
+	return &ResponseError{
+		Code:             pirErr.GetCode(),
+		Message:          pirErr.GetMessage(),
+		SupportedSchemes: pirErr.GetSupportedSchemes(),
+	}
+}
+
+// newRLWEProtocol returns the protocol that a client generates requests of the mode with, over a database of
+// 2^log2_num_rows rows of at most row_size bytes. The parameter set of the requests is chosen from the shape of the
+// database with [pir.SelectRLWEParameterSet] and named in the requests. If no parameter set suits the database,
+// the requests are generated with [pir.DefaultRLWEParameterSet].
+func newRLWEProtocol(log2_num_rows int, mode string, row_size int) *pir.SimpleRLWE_PIR_Protocol {
+	set, err := pir.SelectRLWEParameterSet(mode, log2_num_rows, row_size)
+	if err != nil {
+		return pir.NewSimpleRLWE_PIR_Protocol_mode(log2_num_rows, mode)
+	}
+	return pir.NewSimpleRLWE_PIR_Protocol_parameters(log2_num_rows, mode, set)
+}
+
 type PirClientPeerRouting struct {
 	PirClient
 }
 
+// NewPirClientPeerRouting returns a client for the closer peers in a normalized routing table whose buckets take at
+// most row_size bytes, see [newRLWEProtocol].
 // TODO: Can pass a choice to the two constructors to choose which PIR algorithm e.g. RLWE or Paillier
-func NewPirClientPeerRouting(mode string) *PirClientPeerRouting {
+func NewPirClientPeerRouting(mode string, row_size int) *PirClientPeerRouting {
+	return &PirClientPeerRouting{
+		PirClient: PirClient{
+			protocol: newRLWEProtocol(PeerRoutingLog2NumRows, mode, row_size),
+		},
+	}
+}
+
+// NewPirClientPeerRoutingWithSession returns a client whose requests reuse the key material of the
+// session. The session must only be used for requests to a single server, see [pir.SimpleRLWE_Session].
+func NewPirClientPeerRoutingWithSession(session *pir.SimpleRLWE_Session) *PirClientPeerRouting {
 	return &PirClientPeerRouting{
 		PirClient: PirClient{
-			protocol: pir.NewSimpleRLWE_PIR_Protocol_mode(8, mode),
+			protocol: pir.NewSimpleRLWE_PIR_Protocol_session(PeerRoutingLog2NumRows, session),
+			session:  session,
 		},
 	}
 }
+
 func (client *PirClientPeerRouting) GenerateRequest(targetKey kadt.Key, serverKey kadt.Key) (*pb.PIR_Request, error) {
-	err := client.PirClient.protocol.CreatePrivateKeyMaterial()
-	if err != nil {
-		return nil, err
+	if client.session == nil {
+		err := client.PirClient.protocol.CreatePrivateKeyMaterial()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	cpl := uint64(targetKey.CommonPrefixLength(serverKey))
@@ -49,42 +154,295 @@ func (client *PirClientPeerRouting) GenerateRequest(targetKey kadt.Key, serverKe
 	return client.PirClient.protocol.GenerateRequestFromQuery(int(cpl))
 }
 
+// ProcessVerifiedResponse processes a response to a request that asked for signed_peer_records and returns the
+// closer peers that carry valid signed peer records, see [VerifyPeerRecords].
+func (client *PirClientPeerRouting) ProcessVerifiedResponse(closerPeersResponse *pb.PIR_Response) (*pb.Message, error) {
+	msg, err := client.ProcessResponse(closerPeersResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	closerPeers, err := VerifyPeerRecords(msg.GetCloserPeers())
+	if err != nil {
+		return nil, err
+	}
+	msg.CloserPeers = closerPeers
+
+	return msg, nil
+}
+
 type PirClientProviderRouting struct {
 	PirClient
 
 	log2_num_buckets int
 }
 
-func NewPirClientProviderRouting(log2_num_buckets int, mode string) *PirClientProviderRouting {
+// NewPirClientProviderRouting returns a client for the buckets of provider records in a database of
+// 2^log2_num_buckets rows of row_size bytes, see [newRLWEProtocol].
+func NewPirClientProviderRouting(log2_num_buckets int, mode string, row_size int) *PirClientProviderRouting {
+	return &PirClientProviderRouting{
+		log2_num_buckets: log2_num_buckets,
+		PirClient: PirClient{
+			protocol: newRLWEProtocol(log2_num_buckets, mode, row_size),
+		},
+	}
+}
+
+// NewPirClientProviderRoutingRecursive returns a client whose requests arrange the database of provider records
+// as a hypercube with num_dimensions dimensions, see [pir.NewSimpleRLWE_PIR_Protocol_recursive]. It suits long
+// bucket indices, for which the query of a one-dimensional request would take many ciphertexts.
+func NewPirClientProviderRoutingRecursive(log2_num_buckets int, mode string, num_dimensions int) *PirClientProviderRouting {
 	return &PirClientProviderRouting{
 		log2_num_buckets: log2_num_buckets,
 		PirClient: PirClient{
-			protocol: pir.NewSimpleRLWE_PIR_Protocol_mode(log2_num_buckets, mode), //NewSimpleRLWE_PIR_Protocol(log2_num_buckets),
+			protocol: pir.NewSimpleRLWE_PIR_Protocol_recursive(log2_num_buckets, mode, num_dimensions),
 		},
 	}
 }
 
-// TODO: Fix this implementation to use the fileCID
+// NewPirClientProviderRoutingWithSession returns a client whose requests reuse the key material of the
+// session. The session must only be used for requests to a single server, see [pir.SimpleRLWE_Session].
+func NewPirClientProviderRoutingWithSession(log2_num_buckets int, session *pir.SimpleRLWE_Session) *PirClientProviderRouting {
+	return &PirClientProviderRouting{
+		log2_num_buckets: log2_num_buckets,
+		PirClient: PirClient{
+			protocol: pir.NewSimpleRLWE_PIR_Protocol_session(log2_num_buckets, session),
+			session:  session,
+		},
+	}
+}
+
+// NewPirClientProviderRoutingRecursiveWithSession is like [NewPirClientProviderRoutingRecursive], but its requests
+// reuse the key material of the session, see [NewPirClientProviderRoutingWithSession].
+func NewPirClientProviderRoutingRecursiveWithSession(log2_num_buckets int, session *pir.SimpleRLWE_Session, num_dimensions int) *PirClientProviderRouting {
+	return &PirClientProviderRouting{
+		log2_num_buckets: log2_num_buckets,
+		PirClient: PirClient{
+			protocol: pir.NewSimpleRLWE_PIR_Protocol_session_recursive(log2_num_buckets, session, num_dimensions),
+			session:  session,
+		},
+	}
+}
+
+// GenerateRequest generates a PIR request for the bucket of provider records that fileCID is placed in.
+// The bucket index is derived from the multihash of fileCID with [ProviderBucketIndex].
 func (client *PirClientProviderRouting) GenerateRequest(fileCID cid.Cid) (*pb.PIR_Request, error) {
-	err := client.PirClient.protocol.CreatePrivateKeyMaterial()
-	if err != nil {
-		return nil, err
+	if client.session == nil {
+		err := client.PirClient.protocol.CreatePrivateKeyMaterial()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// M=2^m number of records
 	// we set bucket size B = 2^b = 256 records in total i.e. overhead of 2^b - 1
 	// number of buckets = 2^n = 2^m / (2^b) = 2^(m-b)
 	// or 2^b = 2^(m-n)
-	// can access the length of the hash by fileCID.Prefix().MhLength
-	//cidHashed := fileCID.Hash()
-	//bucketIndexStr := cidHashed[2 : client.log2_num_buckets+2].HexString() // skipping first two bytes for hash function code, length
-	//// TODO: Check base here.
-	//
-	//bucketIndex, err := strconv.ParseInt(bucketIndexStr, 16, 64)
-	//if err != nil {
-	//	return nil, err
-	//}
-	//// fmt.Printf("%T, %v\n", bucketIndex, bucketIndex)
-	bucketIndex := 0
-	return client.PirClient.protocol.GenerateRequestFromQuery(int(bucketIndex))
+	bucketIndex, err := ProviderBucketIndex(fileCID.Hash(), client.log2_num_buckets)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.PirClient.protocol.GenerateRequestFromQuery(bucketIndex)
+}
+
+// PirClientRecordRouting retrieves the bucket of records, such as IPNS or public key records, that the routing
+// key of a record is placed in, see [RecordBucketIndex]. The bucket holds the records of all keys that share it,
+// see [pb.Message.BucketRecord].
+type PirClientRecordRouting struct {
+	PirClient
+
+	log2_num_buckets int
+}
+
+// NewPirClientRecordRouting returns a client for the buckets of records in a database of 2^log2_num_buckets rows of
+// row_size bytes, see [newRLWEProtocol].
+func NewPirClientRecordRouting(log2_num_buckets int, mode string, row_size int) *PirClientRecordRouting {
+	return &PirClientRecordRouting{
+		log2_num_buckets: log2_num_buckets,
+		PirClient: PirClient{
+			protocol: newRLWEProtocol(log2_num_buckets, mode, row_size),
+		},
+	}
+}
+
+// NewPirClientRecordRoutingWithSession returns a client whose requests reuse the key material of the
+// session. The session must only be used for requests to a single server, see [pir.SimpleRLWE_Session].
+func NewPirClientRecordRoutingWithSession(log2_num_buckets int, session *pir.SimpleRLWE_Session) *PirClientRecordRouting {
+	return &PirClientRecordRouting{
+		log2_num_buckets: log2_num_buckets,
+		PirClient: PirClient{
+			protocol: pir.NewSimpleRLWE_PIR_Protocol_session(log2_num_buckets, session),
+			session:  session,
+		},
+	}
+}
+
+// GenerateRequest generates a PIR request for the bucket of records that the record with the routing key
+// is placed in. The bucket index is derived from the key with [RecordBucketIndex].
+func (client *PirClientRecordRouting) GenerateRequest(key []byte) (*pb.PIR_Request, error) {
+	if client.session == nil {
+		err := client.PirClient.protocol.CreatePrivateKeyMaterial()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bucketIndex, err := RecordBucketIndex(key, client.log2_num_buckets)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.PirClient.protocol.GenerateRequestFromQuery(bucketIndex)
+}
+
+// TwoServerPirClientProviderRouting retrieves buckets of provider records from two servers with
+// [pir.DPF_TwoServer]. The two requests of a query must be sent to two different servers, which hold
+// the same provider records, such as the closest peers to a CID that the records are replicated to.
+// The bucket stays private as long as the two servers do not collude.
+type TwoServerPirClientProviderRouting struct {
+	protocol *pir.DPF_TwoServer_PIR_Protocol
+
+	log2_num_buckets int
+}
+
+func NewTwoServerPirClientProviderRouting(log2_num_buckets int) *TwoServerPirClientProviderRouting {
+	return &TwoServerPirClientProviderRouting{
+		log2_num_buckets: log2_num_buckets,
+		protocol:         pir.NewDPF_TwoServer_PIR_Protocol(log2_num_buckets),
+	}
+}
+
+// GenerateEpochRequest generates a request for the epoch of the provider records, which is sent to both
+// servers before the query. The responses are processed with [TwoServerPirClientProviderRouting.AgreeOnEpoch].
+func (client *TwoServerPirClientProviderRouting) GenerateEpochRequest() *pb.PIR_Request {
+	return client.protocol.GenerateEpochRequest()
+}
+
+// AgreeOnEpoch checks that both servers hold the same provider records, such that their answers to the
+// query can be combined. It returns an error wrapping [pir.ErrEpochMismatch] if they don't.
+func (client *TwoServerPirClientProviderRouting) AgreeOnEpoch(res0, res1 *pb.PIR_Response) error {
+	for _, res := range []*pb.PIR_Response{res0, res1} {
+		if err := responseError(res); err != nil {
+			return err
+		}
+	}
+	return client.protocol.AgreeOnEpoch(res0, res1)
+}
+
+// GenerateRequests generates the two requests for the bucket of provider records that fileCID is placed in.
+// The bucket index is derived from the multihash of fileCID with [ProviderBucketIndex].
+func (client *TwoServerPirClientProviderRouting) GenerateRequests(fileCID cid.Cid) (*pb.PIR_Request, *pb.PIR_Request, error) {
+	bucketIndex, err := ProviderBucketIndex(fileCID.Hash(), client.log2_num_buckets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client.protocol.GenerateRequestsFromQuery(bucketIndex)
+}
+
+// ProcessResponses combines the responses of the two servers into the bucket of provider records.
+func (client *TwoServerPirClientProviderRouting) ProcessResponses(res0, res1 *pb.PIR_Response) (*pb.Message, error) {
+	for _, res := range []*pb.PIR_Response{res0, res1} {
+		if err := responseError(res); err != nil {
+			return nil, err
+		}
+	}
+
+	plaintext, err := client.protocol.ProcessResponsesToPlaintext(res0, res1)
+	if err != nil {
+		return nil, err
+	}
+
+	return UnmarshallPlaintextToPB(plaintext)
+}
+
+// PirClientProviderKeywordRouting retrieves the provider records of a CID with keyword PIR. The server places the
+// provider records of each CID into a slot of a cuckoo table, see [NewKeywordTable], and the client retrieves all
+// slots that the records of its CID may be placed in with a single batch request. Unlike with
+// [PirClientProviderRouting], the client only learns the provider records of its CID, as the records in the other
+// slots are sealed with keys derived from their CIDs, and the size of the response doesn't depend on the number of
+// CIDs that the server holds records for.
+type PirClientProviderKeywordRouting struct {
+	protocol pir.BatchPIR_Protocol
+
+	// session is set if the client reuses the key material of a session
+	session *pir.SimpleRLWE_Session
+
+	log2_num_slots int
+
+	// key is the multihash of the CID of the last request
+	key []byte
+}
+
+// NewPirClientProviderKeywordRouting returns a client for a keyword table of 2^log2_num_slots slots of row_size
+// bytes, see [newRLWEProtocol].
+func NewPirClientProviderKeywordRouting(log2_num_slots int, mode string, row_size int) *PirClientProviderKeywordRouting {
+	return &PirClientProviderKeywordRouting{
+		log2_num_slots: log2_num_slots,
+		protocol:       newRLWEProtocol(log2_num_slots, mode, row_size),
+	}
+}
+
+// NewPirClientProviderKeywordRoutingWithSession returns a client whose requests reuse the key material of the
+// session. The session must only be used for requests to a single server, see [pir.SimpleRLWE_Session].
+func NewPirClientProviderKeywordRoutingWithSession(log2_num_slots int, session *pir.SimpleRLWE_Session) *PirClientProviderKeywordRouting {
+	return &PirClientProviderKeywordRouting{
+		log2_num_slots: log2_num_slots,
+		protocol:       pir.NewSimpleRLWE_PIR_Protocol_session(log2_num_slots, session),
+		session:        session,
+	}
+}
+
+// GenerateRequest generates a batch PIR request for the slots of the cuckoo table that the provider records of
+// fileCID may be placed in, which are derived from the multihash of fileCID with [ProviderKeywordSlots].
+func (client *PirClientProviderKeywordRouting) GenerateRequest(fileCID cid.Cid) (*pb.PIR_Request, error) {
+	slots, err := ProviderKeywordSlots(fileCID.Hash(), client.log2_num_slots)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := client.protocol.GenerateRequestFromQueries(slots)
+	if err != nil {
+		return nil, err
+	}
+	client.key = fileCID.Hash()
+
+	return req, nil
+}
+
+// ProcessResponse returns a message whose buckets hold the provider records of the CID of the request, or no
+// buckets if the server doesn't hold any records for it. It doesn't look into the stash of the table, see
+// [PirClientProviderKeywordRouting.ProcessResponseWithStash].
+func (client *PirClientProviderKeywordRouting) ProcessResponse(res *pb.PIR_Response) (*pb.Message, error) {
+	return client.ProcessResponseWithStash(res, nil)
+}
+
+// ProcessResponseWithStash is like [PirClientProviderKeywordRouting.ProcessResponse], but also looks for the
+// provider records of the CID of the request in the stash of the table that the server sent with its response.
+func (client *PirClientProviderKeywordRouting) ProcessResponseWithStash(res *pb.PIR_Response, stash [][]byte) (*pb.Message, error) {
+	if err := responseError(res); err != nil {
+		if err.Code == pb.PIR_Error_UNKNOWN_EVALUATION_KEYS && client.session != nil {
+			// the server evicted the keys of the session, send them with the next request
+			client.session.ResendEvaluationKeys()
+		}
+		return nil, err
+	}
+
+	slots, err := client.protocol.ProcessBatchResponseToPlaintexts(res)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, slot := range append(slots, stash...) {
+		msg, found, err := openKeywordSlot(client.key, slot)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return msg, nil
+		}
+	}
+
+	return &pb.Message{}, nil
 }
@@ -0,0 +1,51 @@
+package private_routing
+
+import (
+	"context"
+	"testing"
+
+	recpb "github.com/libp2p/go-libp2p-record/pb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/pir"
+)
+
+func TestPirClientRecordRouting_parameter_set(t *testing.T) {
+	// rows of two response ciphertexts with the default parameter set fit
+	// into a single one with a larger plaintext modulus
+	log2_num_buckets, row_size := 4, 8192
+	want, err := pir.SelectRLWEParameterSet(pir.RLWE_All_Keys, log2_num_buckets, row_size)
+	require.NoError(t, err)
+	require.NotEqual(t, pir.DefaultRLWEParameterSet, want.Name)
+
+	key := []byte("/ipns/some-name")
+	bucket, err := RecordBucketIndex(key, log2_num_buckets)
+	require.NoError(t, err)
+
+	rows := make([][]byte, 1<<log2_num_buckets)
+	for i := range rows {
+		var records []*recpb.Record
+		if i == bucket {
+			records = []*recpb.Record{{Key: key, Value: []byte("value")}}
+		}
+		rows[i], err = MarshallPBToFixedSizePlaintext(&pb.Message{BucketRecords: records}, row_size)
+		require.NoError(t, err)
+	}
+
+	client := NewPirClientRecordRouting(log2_num_buckets, pir.RLWE_All_Keys, row_size)
+	req, err := client.GenerateRequest(key)
+	require.NoError(t, err)
+
+	// the request names the parameter set, which the server encodes the database with
+	assert.Equal(t, want.Name, req.GetParameterSet())
+
+	res, err := RunPIRforCloserPeersDatabase(context.Background(), pir.NewDefaultRegistry(), req, NewDatabase(rows))
+	require.NoError(t, err)
+
+	msg, err := client.ProcessResponse(res)
+	require.NoError(t, err)
+	require.Len(t, msg.GetBucketRecords(), 1)
+	assert.Equal(t, []byte("value"), msg.GetBucketRecords()[0].GetValue())
+}
@@ -1,6 +1,8 @@
 package private_routing
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/plprobelab/zikade/pir"
@@ -8,22 +10,114 @@ import (
 	"github.com/plprobelab/zikade/pb"
 )
 
-func RunPIRforCloserPeersRecords(req *pb.PIR_Request, ModifiedRT [][]byte) (*pb.PIR_Response, error) {
-	simpleRLWEPIR := pir.NewSimpleRLWE_PIR_Protocol_mode(int(len(ModifiedRT)), pir.RLWE_Whispir_3_Keys) // NewSimpleRLWE_PIR_Protocol(int(len(ModifiedRT)))
-	response, err := simpleRLWEPIR.ProcessRequestAndReturnResponse(req, ModifiedRT)
+func RunPIRforCloserPeersRecords(ctx context.Context, schemes *pir.Registry, req *pb.PIR_Request, ModifiedRT [][]byte) (*pb.PIR_Response, error) {
+	return runPIR(ctx, schemes, req, NewDatabase(ModifiedRT))
+}
+
+// RunPIRforCloserPeersDatabase is like [RunPIRforCloserPeersRecords], but processes the request over
+// a [Database], which keeps the encoded rows for other requests of the same scheme.
+func RunPIRforCloserPeersDatabase(ctx context.Context, schemes *pir.Registry, req *pb.PIR_Request, modifiedRT *Database) (*pb.PIR_Response, error) {
+	return runPIR(ctx, schemes, req, modifiedRT)
+}
+
+func RunPIRforProviderPeersRecords(ctx context.Context, schemes *pir.Registry, req *pb.PIR_Request, mapCIDBucketToProviderPeers [][]byte) (*pb.PIR_Response, error) {
+	response, err := runPIR(ctx, schemes, req, NewDatabase(mapCIDBucketToProviderPeers))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error in PIR: %v", err)
 	}
-
 	return response, nil
 }
 
-func RunPIRforProviderPeersRecords(req *pb.PIR_Request, mapCIDBucketToProviderPeers [][]byte) (*pb.PIR_Response, error) {
-
-	simpleRLWEPIR := pir.NewSimpleRLWE_PIR_Protocol_mode(len(mapCIDBucketToProviderPeers), pir.RLWE_Whispir_3_Keys)
-	response, err := simpleRLWEPIR.ProcessRequestAndReturnResponse(req, mapCIDBucketToProviderPeers)
+// RunPIRforProviderPeersDatabase is like [RunPIRforProviderPeersRecords], but processes the request over
+// a [Database], which keeps the encoded rows for other requests of the same scheme.
+func RunPIRforProviderPeersDatabase(ctx context.Context, schemes *pir.Registry, req *pb.PIR_Request, mapCIDBucketToProviderPeers *Database) (*pb.PIR_Response, error) {
+	response, err := runPIR(ctx, schemes, req, mapCIDBucketToProviderPeers)
 	if err != nil {
 		return nil, fmt.Errorf("error in PIR: %v", err)
 	}
 	return response, nil
 }
+
+// RunPIRforRecordsDatabase processes the request over the database of records of a namespace, whose rows
+// hold the buckets of records that are placed by [RecordBucketIndex].
+func RunPIRforRecordsDatabase(ctx context.Context, schemes *pir.Registry, req *pb.PIR_Request, records *Database) (*pb.PIR_Response, error) {
+	response, err := runPIR(ctx, schemes, req, records)
+	if err != nil {
+		return nil, fmt.Errorf("error in PIR: %w", err)
+	}
+	return response, nil
+}
+
+// runPIR processes the request over the database with the PIR_Protocol that is registered
+// for the scheme of the request. If the scheme isn't supported, the returned response
+// carries an UNSUPPORTED_SCHEME error for the client instead of ciphertexts. Likewise, a
+// request that was generated with a stale hint is answered with a STALE_HINT error, a
+// request for another epoch of the database with an EPOCH_MISMATCH error, and a request
+// for an unknown parameter set with an UNSUPPORTED_PARAMETER_SET error. Malformed requests
+// are answered with an INVALID_REQUEST error without being processed. Requests whose
+// estimated cost exceeds the budget of the registry are refused with a BUDGET_EXCEEDED
+// error before they are processed, and the evaluation stops once ctx is done.
+// PIR_Protocols that implement [pir.DatabaseEncoder] process the request over the rows of
+// the database that were encoded for the scheme, and its parameter set if any.
+func runPIR(ctx context.Context, schemes *pir.Registry, req *pb.PIR_Request, database *Database) (*pb.PIR_Response, error) {
+	protocol, err := schemes.ProtocolForRequest(req, database.log2NumRows())
+	if errors.Is(err, pir.ErrUnsupportedScheme) {
+		return &pb.PIR_Response{
+			Error: &pb.PIR_Error{
+				Code:             pb.PIR_Error_UNSUPPORTED_SCHEME,
+				Message:          err.Error(),
+				SupportedSchemes: schemes.Schemes(),
+			},
+		}, nil
+	} else if errors.Is(err, pir.ErrUnsupportedParameterSet) {
+		return errorResponse(pb.PIR_Error_UNSUPPORTED_PARAMETER_SET, err), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = schemes.CheckBudget(protocol, req, len(database.Rows()), database.rowSize())
+	if errors.Is(err, pir.ErrBudgetExceeded) {
+		return errorResponse(pb.PIR_Error_BUDGET_EXCEEDED, err), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	encoder, ok := protocol.(pir.DatabaseEncoder)
+	if !ok {
+		return protocol.ProcessRequestAndReturnResponse(ctx, req, database.Rows())
+	}
+
+	// the rows are encoded with the parameters of the parameter set of the request
+	encoding := req.GetScheme()
+	if parameterized, ok := protocol.(pir.ParameterizedPIR_Protocol); ok {
+		encoding += "/" + parameterized.ParameterSet()
+	}
+	encoded, err := database.encode(encoding, encoder)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := encoder.ProcessRequestOverEncodedDatabase(ctx, req, encoded)
+	switch {
+	case errors.Is(err, pir.ErrStaleHint):
+		return errorResponse(pb.PIR_Error_STALE_HINT, err), nil
+	case errors.Is(err, pir.ErrEpochMismatch):
+		return errorResponse(pb.PIR_Error_EPOCH_MISMATCH, err), nil
+	case errors.Is(err, pir.ErrUnsupportedParameterSet):
+		return errorResponse(pb.PIR_Error_UNSUPPORTED_PARAMETER_SET, err), nil
+	case errors.Is(err, pir.ErrInvalidRequest):
+		return errorResponse(pb.PIR_Error_INVALID_REQUEST, err), nil
+	default:
+		return res, err
+	}
+}
+
+// errorResponse returns a response that carries the error for the client instead of ciphertexts.
+func errorResponse(code pb.PIR_Error_Code, err error) *pb.PIR_Response {
+	return &pb.PIR_Response{
+		Error: &pb.PIR_Error{
+			Code:    code,
+			Message: err.Error(),
+		},
+	}
+}
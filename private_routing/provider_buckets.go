@@ -0,0 +1,54 @@
+package private_routing
+
+import (
+	"fmt"
+
+	mh "github.com/multiformats/go-multihash"
+)
+
+const (
+	// ProviderBucketIndexLength is the length of a bucket index in bits, in the database of
+	// provider records that PIR requests for provider peers are run over. The client and the
+	// server must agree on it, as it determines the number of rows of the database.
+	ProviderBucketIndexLength = 8
+
+	// MaxProviderBucketIndexLength is the largest bucket index length, in bits, that
+	// [ProviderBucketIndex] supports.
+	MaxProviderBucketIndexLength = 30
+
+	// ProviderBucketIndexVersion is the version of the derivation of bucket indices implemented
+	// by [ProviderBucketIndex]. It must be incremented whenever the derivation changes, as a
+	// client and a server that place a CID into different buckets can't find each other's records.
+	ProviderBucketIndexVersion uint32 = 1
+)
+
+// ProviderBucketIndex returns the index of the bucket that the provider records for the given
+// multihash are placed in, in a database of 2^bucketIndexLength buckets. The index consists of
+// the first bucketIndexLength bits of the digest of the multihash, i.e., the varint encoded hash
+// function code and digest length that prefix the digest are skipped.
+func ProviderBucketIndex(key mh.Multihash, bucketIndexLength int) (int, error) {
+	if bucketIndexLength < 1 || bucketIndexLength > MaxProviderBucketIndexLength {
+		return 0, fmt.Errorf("bucket index length must be between 1 and %d bits, got %d", MaxProviderBucketIndexLength, bucketIndexLength)
+	}
+
+	decoded, err := mh.Decode(key)
+	if err != nil {
+		return 0, fmt.Errorf("decode multihash: %w", err)
+	}
+
+	if len(decoded.Digest)*8 < bucketIndexLength {
+		return 0, fmt.Errorf("digest of %d bytes is shorter than the bucket index length of %d bits", len(decoded.Digest), bucketIndexLength)
+	}
+
+	return bucketIndex(decoded.Digest, bucketIndexLength), nil
+}
+
+// bucketIndex returns the first bucketIndexLength bits of the digest as a bucket index.
+func bucketIndex(digest []byte, bucketIndexLength int) int {
+	index := 0
+	for i := 0; i < bucketIndexLength; i++ {
+		bit := (digest[i/8] >> (7 - i%8)) & 1
+		index = index<<1 | int(bit)
+	}
+	return index
+}
@@ -0,0 +1,61 @@
+package private_routing
+
+import (
+	"testing"
+
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderBucketIndex(t *testing.T) {
+	digest := []byte{0b10110010, 0b01011100, 0xff, 0xff}
+	key, err := mh.Encode(digest, mh.SHA2_256)
+	require.NoError(t, err)
+
+	tests := []struct {
+		bits int
+		want int
+	}{
+		{bits: 1, want: 0b1},
+		{bits: 3, want: 0b101},
+		{bits: 8, want: 0b10110010},
+		{bits: 13, want: 0b1011001001011},
+		{bits: 16, want: 0b1011001001011100},
+	}
+
+	for _, tt := range tests {
+		got, err := ProviderBucketIndex(key, tt.bits)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "bits: %d", tt.bits)
+	}
+}
+
+func TestProviderBucketIndex_skips_varint_prefix(t *testing.T) {
+	// the code of blake2b-256 is encoded as a multi-byte varint
+	digest := make([]byte, 32)
+	digest[0] = 0xab
+	key, err := mh.Encode(digest, mh.BLAKE2B_MIN+31)
+	require.NoError(t, err)
+
+	got, err := ProviderBucketIndex(key, 8)
+	require.NoError(t, err)
+	assert.Equal(t, 0xab, got)
+}
+
+func TestProviderBucketIndex_invalid(t *testing.T) {
+	key, err := mh.Encode([]byte{0x01}, mh.IDENTITY)
+	require.NoError(t, err)
+
+	_, err = ProviderBucketIndex(key, 9)
+	assert.Error(t, err)
+
+	_, err = ProviderBucketIndex(key, 0)
+	assert.Error(t, err)
+
+	_, err = ProviderBucketIndex(key, MaxProviderBucketIndexLength+1)
+	assert.Error(t, err)
+
+	_, err = ProviderBucketIndex(mh.Multihash{0x12}, 8)
+	assert.Error(t, err)
+}
@@ -0,0 +1,443 @@
+package private_routing
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	mh "github.com/multiformats/go-multihash"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+const (
+	// ProviderKeywordTableLength is the log of the number of slots of the smallest cuckoo table of provider records
+	// that keyword PIR requests for provider peers are run over. The client and the server must agree on the length
+	// of the table, as it determines the number of rows of the database. Servers that hold the records of more
+	// multihashes than fit into the smallest table use a larger one, see [ProviderKeywordTableLengthFor], and
+	// advertise its length in their responses. Clients send their requests for tables of this length until the
+	// server advertised another one. Each slot holds the records of a single multihash and a keyword request
+	// retrieves [ProviderKeywordNumHashes] slots, so the smallest table has as many rows as the database of buckets,
+	// which holds the records of many multihashes per row, to keep the cost of a keyword request close to that of a
+	// bucket request.
+	ProviderKeywordTableLength = ProviderBucketIndexLength
+
+	// MaxProviderKeywordTableLength is the log of the number of slots of the largest cuckoo table, which bounds the
+	// cost of keyword requests. Clients don't send requests for larger tables. Servers that hold the records of more
+	// multihashes than fit into the largest table leave the records of the remaining multihashes out of it.
+	MaxProviderKeywordTableLength = 16
+
+	// ProviderKeywordSlotsPerEntry is the number of slots of a cuckoo table per entry that it is sized for, i.e.,
+	// the inverse of its maximum load. Insertions into cuckoo tables with three hash functions start to fail at
+	// loads of about 90%.
+	ProviderKeywordSlotsPerEntry = 2
+
+	// ProviderKeywordStashSize is the number of entries that the stash of a cuckoo table of provider records holds
+	// at most. Entries that don't find a slot in the table are kept in the stash, which is sent along with every
+	// keyword response.
+	ProviderKeywordStashSize = 8
+
+	// ProviderKeywordNumHashes is the number of hash functions of the cuckoo table, i.e., the number of slots that
+	// the provider records of a multihash may be placed in, which a keyword request retrieves.
+	ProviderKeywordNumHashes = 3
+
+	// ProviderKeywordTableVersion is the version of the layout of the cuckoo table implemented by
+	// [ProviderKeywordSlots] and [KeywordTable]. It must be incremented whenever the layout changes.
+	ProviderKeywordTableVersion uint32 = 1
+
+	// KeywordSlotOverhead is the number of bytes of a slot of a keyword table that don't hold the marshalled
+	// entry, i.e., its tag and nonce.
+	KeywordSlotOverhead = keywordTagLength + keywordNonceLength
+
+	keywordTagLength   = 16
+	keywordNonceLength = aes.BlockSize
+
+	// maxCuckooKicks bounds the number of entries that the insertion of an entry evicts from their slots.
+	maxCuckooKicks = 500
+)
+
+// ErrKeywordTableLength is returned for keyword responses of servers whose cuckoo table has another length than
+// the one that the request was generated for. The server advertises the length of its table in the response, so
+// that the request can be generated again for it.
+var ErrKeywordTableLength = errors.New("keyword table length mismatch")
+
+// ProviderKeywordTableLengthFor returns the log of the number of slots of the cuckoo table that the provider records
+// of numEntries multihashes are placed in. It is the smallest length from [ProviderKeywordTableLength] to
+// [MaxProviderKeywordTableLength] with at least [ProviderKeywordSlotsPerEntry] slots per entry.
+func ProviderKeywordTableLengthFor(numEntries int) int {
+	length := ProviderKeywordTableLength
+	for length < MaxProviderKeywordTableLength && 1<<length < ProviderKeywordSlotsPerEntry*numEntries {
+		length++
+	}
+	return length
+}
+
+// ProviderKeywordSlots returns the indices of the slots that the provider records of the given multihash may be
+// placed in, in a cuckoo table of 2^log2NumSlots slots. The indices are derived from hashes of the whole multihash,
+// so that, unlike with [ProviderBucketIndex], the server can't tell the keys of a slot apart by their prefix.
+// Indices may repeat.
+func ProviderKeywordSlots(key mh.Multihash, log2NumSlots int) ([]int, error) {
+	if log2NumSlots < 1 || log2NumSlots > MaxProviderBucketIndexLength {
+		return nil, fmt.Errorf("log of the number of slots must be between 1 and %d, got %d", MaxProviderBucketIndexLength, log2NumSlots)
+	}
+
+	slots := make([]int, ProviderKeywordNumHashes)
+	for i := range slots {
+		digest := keywordHash("slot", []byte{byte(i)}, key)
+		slots[i] = int(binary.BigEndian.Uint32(digest[:4]) >> (32 - log2NumSlots))
+	}
+	return slots, nil
+}
+
+// KeywordEntry is an entry of a keyword table, which is found by its key.
+type KeywordEntry struct {
+	Key     mh.Multihash
+	Message *pb.Message
+}
+
+// KeywordTable is a cuckoo table with 2^log2NumSlots slots of slotSize bytes, which form the rows of the database
+// that keyword PIR requests are run over, and a stash. Each entry is placed in one of the slots returned by
+// [ProviderKeywordSlots] for its key, sealed with a key derived from the key of the entry. So a client that
+// retrieves a slot only learns the entry in it if it knows the key of the entry. Empty slots are all zeros.
+//
+// Entries that don't find a slot, because all of their slots are taken, are kept in the stash, which holds up to
+// stashSize sealed entries and is sent to clients in full. Entries that don't find a place in the stash either are
+// left out of the table, until the removal of other entries makes room for them.
+//
+// The table is maintained incrementally. [KeywordTable.Put] and [KeywordTable.Remove] only change the slots that
+// entries are moved between, and [KeywordTable.Changed] returns the rows of these slots. A KeywordTable is not safe
+// for concurrent use.
+type KeywordTable struct {
+	log2NumSlots int
+	slotSize     int
+	stashSize    int
+
+	// slots holds the entry of each slot of the table, or nil if the slot is empty
+	slots []*keywordSlot
+
+	// stash holds the entries that didn't find a slot, in the order they were stashed
+	stash []*keywordSlot
+
+	// entries holds all entries of the table by their key, including the stashed and left out ones
+	entries map[string]*keywordSlot
+
+	// changed holds the indices of the slots whose rows changed since the last call to Changed or Rows
+	changed map[int]struct{}
+}
+
+// keywordSlot is an entry of a [KeywordTable] together with its sealed slot.
+type keywordSlot struct {
+	key mh.Multihash
+	row []byte
+
+	// slots are the indices of the slots that the entry may be placed in
+	slots []int
+
+	// index is the index of the slot that holds the entry, or one of the placements below
+	index int
+}
+
+const (
+	keywordStashed = -1
+	keywordLeftOut = -2
+)
+
+// NewKeywordTable returns an empty cuckoo table with 2^log2NumSlots slots of slotSize bytes and a stash of up to
+// stashSize entries.
+func NewKeywordTable(log2NumSlots int, slotSize int, stashSize int) (*KeywordTable, error) {
+	if log2NumSlots < 1 || log2NumSlots > MaxProviderBucketIndexLength {
+		return nil, fmt.Errorf("log of the number of slots must be between 1 and %d, got %d", MaxProviderBucketIndexLength, log2NumSlots)
+	}
+	if slotSize <= KeywordSlotOverhead {
+		return nil, fmt.Errorf("slot size of %d bytes doesn't exceed the overhead of %d bytes", slotSize, KeywordSlotOverhead)
+	}
+	if stashSize < 0 {
+		return nil, fmt.Errorf("stash size must not be negative, got %d", stashSize)
+	}
+
+	return &KeywordTable{
+		log2NumSlots: log2NumSlots,
+		slotSize:     slotSize,
+		stashSize:    stashSize,
+		slots:        make([]*keywordSlot, 1<<log2NumSlots),
+		entries:      make(map[string]*keywordSlot),
+		changed:      make(map[int]struct{}),
+	}, nil
+}
+
+// Log2NumSlots returns the log of the number of slots of the table.
+func (t *KeywordTable) Log2NumSlots() int {
+	return t.log2NumSlots
+}
+
+// Len returns the number of entries of the table, including the stashed and left out ones.
+func (t *KeywordTable) Len() int {
+	return len(t.entries)
+}
+
+// LeftOut returns the number of entries that neither found a slot nor a place in the stash.
+func (t *KeywordTable) LeftOut() int {
+	count := 0
+	for _, s := range t.entries {
+		if s.index == keywordLeftOut {
+			count++
+		}
+	}
+	return count
+}
+
+// Put adds the entry to the table, or replaces the entry with the same key. It returns an error if the entry
+// doesn't fit into a slot.
+func (t *KeywordTable) Put(entry KeywordEntry) error {
+	row, err := sealKeywordSlot(entry, t.slotSize)
+	if err != nil {
+		return err
+	}
+
+	if s, found := t.entries[string(entry.Key)]; found {
+		s.row = row
+		if s.index >= 0 {
+			t.changed[s.index] = struct{}{}
+		}
+		return nil
+	}
+
+	slots, err := ProviderKeywordSlots(entry.Key, t.log2NumSlots)
+	if err != nil {
+		return err
+	}
+
+	s := &keywordSlot{key: entry.Key, row: row, slots: slots}
+	t.entries[string(entry.Key)] = s
+	t.insert(s)
+
+	return nil
+}
+
+// Remove removes the entry with the given key from the table, if it holds one. The stashed and left out entries
+// are inserted again, as they may find a slot now.
+func (t *KeywordTable) Remove(key mh.Multihash) {
+	s, found := t.entries[string(key)]
+	if !found {
+		return
+	}
+	delete(t.entries, string(key))
+
+	switch {
+	case s.index >= 0:
+		t.slots[s.index] = nil
+		t.changed[s.index] = struct{}{}
+	case s.index == keywordStashed:
+		for i, stashed := range t.stash {
+			if stashed == s {
+				t.stash = append(t.stash[:i], t.stash[i+1:]...)
+				break
+			}
+		}
+	}
+
+	// insert the stashed entries first, then the left out ones ordered by key
+	pending := t.stash
+	var left []*keywordSlot
+	for _, e := range t.entries {
+		if e.index == keywordLeftOut {
+			left = append(left, e)
+		}
+	}
+	sort.Slice(left, func(i, j int) bool {
+		return bytes.Compare(left[i].key, left[j].key) < 0
+	})
+
+	t.stash = nil
+	for _, e := range append(pending, left...) {
+		t.insert(e)
+	}
+}
+
+// insert places the entry into one of its slots, evicting the entries of the slots until an entry finds a free
+// slot, taking turns with the hash functions. The entry that is evicted last is stashed, or left out if the stash
+// is full.
+func (t *KeywordTable) insert(s *keywordSlot) {
+	current := s
+	for kick := 0; ; kick++ {
+		if kick == maxCuckooKicks {
+			break
+		}
+
+		free := -1
+		for _, slot := range current.slots {
+			if t.slots[slot] == nil {
+				free = slot
+				break
+			}
+		}
+		if free >= 0 {
+			t.place(current, free)
+			return
+		}
+
+		slot := current.slots[kick%len(current.slots)]
+		evicted := t.slots[slot]
+		t.place(current, slot)
+		current = evicted
+	}
+
+	if len(t.stash) < t.stashSize {
+		current.index = keywordStashed
+		t.stash = append(t.stash, current)
+	} else {
+		current.index = keywordLeftOut
+	}
+}
+
+// place puts the entry into the slot with the given index.
+func (t *KeywordTable) place(s *keywordSlot, index int) {
+	t.slots[index] = s
+	s.index = index
+	t.changed[index] = struct{}{}
+}
+
+// Rows returns the rows of all slots of the table and resets the slots that changed.
+func (t *KeywordTable) Rows() [][]byte {
+	rows := make([][]byte, len(t.slots))
+	for i := range t.slots {
+		rows[i] = t.row(i)
+	}
+	t.changed = make(map[int]struct{})
+	return rows
+}
+
+// Changed returns the rows of the slots that changed since the last call to Changed or [KeywordTable.Rows], by
+// the index of their slot.
+func (t *KeywordTable) Changed() map[int][]byte {
+	rows := make(map[int][]byte, len(t.changed))
+	for i := range t.changed {
+		rows[i] = t.row(i)
+	}
+	t.changed = make(map[int]struct{})
+	return rows
+}
+
+// row returns the row of the slot with the given index.
+func (t *KeywordTable) row(index int) []byte {
+	if t.slots[index] == nil {
+		return make([]byte, t.slotSize)
+	}
+	return t.slots[index].row
+}
+
+// Stash returns the sealed entries of the stash.
+func (t *KeywordTable) Stash() [][]byte {
+	stash := make([][]byte, len(t.stash))
+	for i, s := range t.stash {
+		stash[i] = s.row
+	}
+	return stash
+}
+
+// KeywordDatabase is the database of the slots of a [KeywordTable], together with the length and the stash of the
+// table, which are sent along with the responses to keyword requests.
+type KeywordDatabase struct {
+	*Database
+
+	// Log2NumSlots is the log of the number of slots of the table.
+	Log2NumSlots int
+
+	// Stash holds the sealed entries of the stash of the table.
+	Stash [][]byte
+}
+
+// sealKeywordSlot returns the slot that holds the entry. It consists of the tag of the key of the entry, the nonce
+// and the marshalled entry, which is encrypted with AES-CTR under a key derived from the key of the entry. The nonce
+// is derived from the key and the marshalled entry, so that a slot stays the same as long as its entry does, and
+// authenticates the entry.
+func sealKeywordSlot(entry KeywordEntry, slotSize int) ([]byte, error) {
+	plaintext, err := MarshallPBToFixedSizePlaintext(entry.Message, slotSize-KeywordSlotOverhead)
+	if err != nil {
+		return nil, err
+	}
+	marshalled, err := unpadMarshalledPBWithLength(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := keywordHash("tag", entry.Key)
+	nonce := keywordHash("nonce", entry.Key, marshalled)
+
+	slot := make([]byte, 0, slotSize)
+	slot = append(slot, tag[:keywordTagLength]...)
+	slot = append(slot, nonce[:keywordNonceLength]...)
+	slot = append(slot, plaintext...)
+
+	stream, err := keywordStream(entry.Key, slot[keywordTagLength:KeywordSlotOverhead])
+	if err != nil {
+		return nil, err
+	}
+	stream.XORKeyStream(slot[KeywordSlotOverhead:], slot[KeywordSlotOverhead:])
+
+	return slot, nil
+}
+
+// openKeywordSlot returns the entry in the slot, if the slot holds the entry of the given key.
+func openKeywordSlot(key mh.Multihash, slot []byte) (*pb.Message, bool, error) {
+	tag := keywordHash("tag", key)
+	if len(slot) <= KeywordSlotOverhead || !bytes.Equal(slot[:keywordTagLength], tag[:keywordTagLength]) {
+		return nil, false, nil
+	}
+
+	nonce := slot[keywordTagLength:KeywordSlotOverhead]
+	stream, err := keywordStream(key, nonce)
+	if err != nil {
+		return nil, false, err
+	}
+	plaintext := make([]byte, len(slot)-KeywordSlotOverhead)
+	stream.XORKeyStream(plaintext, slot[KeywordSlotOverhead:])
+
+	marshalled, err := unpadMarshalledPBWithLength(plaintext)
+	if err != nil {
+		return nil, false, fmt.Errorf("open keyword slot: %w", err)
+	}
+	expected := keywordHash("nonce", key, marshalled)
+	if !bytes.Equal(nonce, expected[:keywordNonceLength]) {
+		return nil, false, fmt.Errorf("keyword slot of the key failed authentication")
+	}
+
+	msg := &pb.Message{}
+	if err := proto.Unmarshal(marshalled, msg); err != nil {
+		return nil, false, fmt.Errorf("unmarshal keyword slot: %w", err)
+	}
+	return msg, true, nil
+}
+
+// keywordStream returns the AES-CTR keystream of the slot of the key with the given nonce.
+func keywordStream(key mh.Multihash, nonce []byte) (cipher.Stream, error) {
+	encryptionKey := keywordHash("key", key)
+	block, err := aes.NewCipher(encryptionKey[:])
+	if err != nil {
+		return nil, fmt.Errorf("keyword slot cipher: %w", err)
+	}
+	return cipher.NewCTR(block, nonce), nil
+}
+
+// keywordHash returns the SHA-256 digest of the inputs, prefixed with a label that separates the hashes of the
+// keyword table from each other. The inputs are prefixed with their length.
+func keywordHash(label string, inputs ...[]byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte("zikade keyword PIR v1 " + label))
+	length := make([]byte, 8)
+	for _, input := range inputs {
+		binary.LittleEndian.PutUint64(length, uint64(len(input)))
+		h.Write(length)
+		h.Write(input)
+	}
+
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+	return digest
+}
@@ -0,0 +1,243 @@
+package private_routing
+
+import (
+	"strconv"
+	"testing"
+
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/pb"
+)
+
+func newKeywordEntry(t *testing.T, i int) KeywordEntry {
+	key, err := mh.Sum([]byte("keyword-"+strconv.Itoa(i)), mh.SHA2_256, -1)
+	require.NoError(t, err)
+
+	return KeywordEntry{
+		Key: key,
+		Message: &pb.Message{Buckets: []*pb.Message_CIDToProviderMap{{
+			Cid:           key,
+			ProviderPeers: []*pb.Message_Peer{{Id: []byte("provider-" + strconv.Itoa(i))}},
+		}}},
+	}
+}
+
+func TestProviderKeywordSlots(t *testing.T) {
+	key, err := mh.Sum([]byte("keyword"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+
+	slots, err := ProviderKeywordSlots(key, 6)
+	require.NoError(t, err)
+	require.Len(t, slots, ProviderKeywordNumHashes)
+	for _, slot := range slots {
+		assert.Less(t, slot, 1<<6)
+	}
+
+	again, err := ProviderKeywordSlots(key, 6)
+	require.NoError(t, err)
+	assert.Equal(t, slots, again)
+
+	_, err = ProviderKeywordSlots(key, 0)
+	assert.Error(t, err)
+}
+
+func TestProviderKeywordTableLengthFor(t *testing.T) {
+	assert.Equal(t, ProviderKeywordTableLength, ProviderKeywordTableLengthFor(0))
+	assert.Equal(t, ProviderKeywordTableLength, ProviderKeywordTableLengthFor(1<<ProviderKeywordTableLength/ProviderKeywordSlotsPerEntry))
+	assert.Equal(t, ProviderKeywordTableLength+1, ProviderKeywordTableLengthFor(1<<ProviderKeywordTableLength/ProviderKeywordSlotsPerEntry+1))
+	assert.Equal(t, MaxProviderKeywordTableLength, ProviderKeywordTableLengthFor(1<<MaxProviderKeywordTableLength))
+}
+
+// newKeywordTable returns a table with the given entries.
+func newKeywordTable(t *testing.T, entries []KeywordEntry, log2NumSlots int, slotSize int, stashSize int) *KeywordTable {
+	table, err := NewKeywordTable(log2NumSlots, slotSize, stashSize)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NoError(t, table.Put(entry))
+	}
+	return table
+}
+
+// findKeywordEntry returns the entry of the key in the slots of the key or in the stash of the table.
+func findKeywordEntry(t *testing.T, table *KeywordTable, rows [][]byte, key mh.Multihash) (*pb.Message, bool) {
+	slots, err := ProviderKeywordSlots(key, table.Log2NumSlots())
+	require.NoError(t, err)
+
+	candidates := table.Stash()
+	for _, slot := range slots {
+		candidates = append(candidates, rows[slot])
+	}
+	for _, candidate := range candidates {
+		msg, ok, err := openKeywordSlot(key, candidate)
+		require.NoError(t, err)
+		if ok {
+			return msg, true
+		}
+	}
+	return nil, false
+}
+
+func TestNewKeywordTable(t *testing.T) {
+	log2NumSlots := 6
+	slotSize := 256
+
+	entries := make([]KeywordEntry, 40)
+	for i := range entries {
+		entries[i] = newKeywordEntry(t, i)
+	}
+
+	table := newKeywordTable(t, entries, log2NumSlots, slotSize, 0)
+	require.Equal(t, len(entries), table.Len())
+	require.Zero(t, table.LeftOut())
+
+	// an entry that doesn't fit into a slot is rejected
+	oversized := newKeywordEntry(t, len(entries))
+	oversized.Message.Buckets[0].ProviderPeers[0].Addrs = [][]byte{make([]byte, slotSize)}
+	assert.ErrorIs(t, table.Put(oversized), ErrRowOverflow)
+	assert.Equal(t, len(entries), table.Len())
+
+	rows := table.Rows()
+	require.Len(t, rows, 1<<log2NumSlots)
+
+	empty := 0
+	for _, row := range rows {
+		require.Len(t, row, slotSize)
+		if assert.ObjectsAreEqual(make([]byte, slotSize), row) {
+			empty++
+		}
+	}
+	assert.Equal(t, len(rows)-len(entries), empty)
+
+	// each entry is found in exactly one of its slots, and only with its own key
+	for i, entry := range entries {
+		slots, err := ProviderKeywordSlots(entry.Key, log2NumSlots)
+		require.NoError(t, err)
+
+		found := map[int]struct{}{}
+		for _, slot := range slots {
+			msg, ok, err := openKeywordSlot(entry.Key, rows[slot])
+			require.NoError(t, err)
+			if !ok {
+				continue
+			}
+			found[slot] = struct{}{}
+			assert.Equal(t, entry.Message.Buckets[0].GetCid(), msg.Buckets[0].GetCid())
+			assert.Equal(t, entry.Message.Buckets[0].GetProviderPeers()[0].GetId(), msg.Buckets[0].GetProviderPeers()[0].GetId())
+
+			_, ok, err = openKeywordSlot(entries[(i+1)%len(entries)].Key, rows[slot])
+			require.NoError(t, err)
+			assert.False(t, ok)
+		}
+		assert.Len(t, found, 1, "entry %d", i)
+	}
+
+	// a tampered slot fails authentication
+	slots, err := ProviderKeywordSlots(entries[0].Key, log2NumSlots)
+	require.NoError(t, err)
+	for _, slot := range slots {
+		if _, ok, _ := openKeywordSlot(entries[0].Key, rows[slot]); ok {
+			rows[slot][KeywordSlotOverhead+RowLengthPrefixSize] ^= 1
+			_, _, err = openKeywordSlot(entries[0].Key, rows[slot])
+			assert.Error(t, err)
+		}
+	}
+
+	_, err = NewKeywordTable(log2NumSlots, KeywordSlotOverhead, 0)
+	assert.Error(t, err)
+}
+
+func TestKeywordTable_incremental(t *testing.T) {
+	log2NumSlots := 6
+	slotSize := 256
+
+	entries := make([]KeywordEntry, 20)
+	for i := range entries {
+		entries[i] = newKeywordEntry(t, i)
+	}
+
+	table := newKeywordTable(t, entries, log2NumSlots, slotSize, 0)
+	rows := table.Rows()
+	assert.Empty(t, table.Changed())
+
+	// replacing an entry only changes its slot
+	replaced := newKeywordEntry(t, 0)
+	replaced.Message.Buckets[0].ProviderPeers[0].Id = []byte("another provider")
+	require.NoError(t, table.Put(replaced))
+
+	changed := table.Changed()
+	require.Len(t, changed, 1)
+	for i, row := range changed {
+		rows[i] = row
+	}
+	msg, found := findKeywordEntry(t, table, rows, replaced.Key)
+	require.True(t, found)
+	assert.Equal(t, []byte("another provider"), msg.Buckets[0].GetProviderPeers()[0].GetId())
+
+	// removing an entry clears its slot
+	table.Remove(entries[1].Key)
+	changed = table.Changed()
+	require.Len(t, changed, 1)
+	for i, row := range changed {
+		assert.Equal(t, make([]byte, slotSize), row)
+		rows[i] = row
+	}
+	_, found = findKeywordEntry(t, table, rows, entries[1].Key)
+	assert.False(t, found)
+	assert.Equal(t, len(entries)-1, table.Len())
+
+	// the other entries are still found in the updated rows
+	for _, entry := range entries[2:] {
+		_, found := findKeywordEntry(t, table, rows, entry.Key)
+		assert.True(t, found)
+	}
+}
+
+func TestKeywordTable_overflow(t *testing.T) {
+	log2NumSlots := 3
+	stashSize := 2
+
+	entries := make([]KeywordEntry, 1<<log2NumSlots+stashSize+2)
+	for i := range entries {
+		entries[i] = newKeywordEntry(t, i)
+	}
+
+	// the entries that don't find a slot are stashed, until the stash is full
+	table := newKeywordTable(t, entries, log2NumSlots, 256, stashSize)
+	require.Len(t, table.Stash(), stashSize)
+	require.Equal(t, len(entries), table.Len())
+	require.Equal(t, len(entries)-1<<log2NumSlots-stashSize, table.LeftOut())
+
+	rows := table.Rows()
+	var missing []KeywordEntry
+	for _, entry := range entries {
+		if _, found := findKeywordEntry(t, table, rows, entry.Key); !found {
+			missing = append(missing, entry)
+		}
+	}
+	require.Len(t, missing, table.LeftOut())
+
+	// removing the stashed entries makes room for the left out ones
+	var stashed []KeywordEntry
+	for _, entry := range entries {
+		for _, slot := range table.Stash() {
+			if _, ok, _ := openKeywordSlot(entry.Key, slot); ok {
+				stashed = append(stashed, entry)
+			}
+		}
+	}
+	require.Len(t, stashed, stashSize)
+	for _, entry := range stashed {
+		table.Remove(entry.Key)
+	}
+	require.Zero(t, table.LeftOut())
+
+	for i, row := range table.Changed() {
+		rows[i] = row
+	}
+	for _, entry := range missing {
+		_, found := findKeywordEntry(t, table, rows, entry.Key)
+		assert.True(t, found)
+	}
+}
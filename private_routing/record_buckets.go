@@ -0,0 +1,35 @@
+package private_routing
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+const (
+	// RecordBucketIndexLength is the length of a bucket index in bits, in the databases of records,
+	// such as IPNS and public key records, that PIR requests for records are run over. The client and
+	// the server must agree on it, as it determines the number of rows of the database.
+	RecordBucketIndexLength = 8
+
+	// MaxRecordBucketIndexLength is the largest bucket index length, in bits, that [RecordBucketIndex]
+	// supports.
+	MaxRecordBucketIndexLength = 30
+
+	// RecordBucketIndexVersion is the version of the derivation of bucket indices implemented by
+	// [RecordBucketIndex]. It must be incremented whenever the derivation changes, like
+	// [ProviderBucketIndexVersion].
+	RecordBucketIndexVersion uint32 = 1
+)
+
+// RecordBucketIndex returns the index of the bucket that the record with the given routing key, of the
+// form /$namespace/$binary_id, is placed in, in a database of 2^bucketIndexLength buckets. The index
+// consists of the first bucketIndexLength bits of the SHA-256 hash of the key, which is also the
+// Kademlia key of the record.
+func RecordBucketIndex(key []byte, bucketIndexLength int) (int, error) {
+	if bucketIndexLength < 1 || bucketIndexLength > MaxRecordBucketIndexLength {
+		return 0, fmt.Errorf("bucket index length must be between 1 and %d bits, got %d", MaxRecordBucketIndexLength, bucketIndexLength)
+	}
+
+	digest := sha256.Sum256(key)
+	return bucketIndex(digest[:], bucketIndexLength), nil
+}
@@ -0,0 +1,33 @@
+package private_routing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/plprobelab/zikade/kadt"
+)
+
+func TestRecordBucketIndex(t *testing.T) {
+	key := []byte("/ipns/some-name")
+
+	// the bucket index is the prefix of the Kademlia key of the record
+	kadKey := kadt.NewKey(key)
+	for _, bits := range []int{1, 8, 13, MaxRecordBucketIndexLength} {
+		got, err := RecordBucketIndex(key, bits)
+		require.NoError(t, err)
+
+		want := 0
+		for i := 0; i < bits; i++ {
+			want = want<<1 | int(kadKey.Bit(i))
+		}
+		assert.Equal(t, want, got, "bits: %d", bits)
+	}
+
+	_, err := RecordBucketIndex(key, 0)
+	assert.Error(t, err)
+
+	_, err = RecordBucketIndex(key, MaxRecordBucketIndexLength+1)
+	assert.Error(t, err)
+}
@@ -41,7 +41,18 @@ type router struct {
 
 var _ coordt.Router[kadt.Key, kadt.PeerID, *pb.Message] = (*router)(nil)
 
-func (r *router) SendMessage(ctx context.Context, to kadt.PeerID, req *pb.Message) (resp *pb.Message, err error) {
+var _ coordt.ResponseRecorder[kadt.Key, kadt.PeerID, *pb.Message] = (*router)(nil)
+
+var _ coordt.PartialResponseRouter[kadt.Key, kadt.PeerID, *pb.Message] = (*router)(nil)
+
+func (r *router) SendMessage(ctx context.Context, to kadt.PeerID, req *pb.Message) (*pb.Message, error) {
+	return r.SendMessageInParts(ctx, to, req, nil)
+}
+
+// SendMessageInParts is like SendMessage, but hands each PIR response of a
+// streamed response to onPart as soon as it was received, see
+// readStreamedResponse.
+func (r *router) SendMessageInParts(ctx context.Context, to kadt.PeerID, req *pb.Message, onPart func(part *pb.Message)) (resp *pb.Message, err error) {
 	spanOpts := []trace.SpanStartOption{
 		trace.WithAttributes(tele.AttrMessageType(req.GetType().String())),
 		trace.WithAttributes(tele.AttrPeerID(to.String())),
@@ -109,15 +120,41 @@ func (r *router) SendMessage(ctx context.Context, to kadt.PeerID, req *pb.Messag
 		r.tele.SentRequestErrors.Add(ctx, 1)
 		return nil, err
 	}
-	r.tele.OutboundRequestLatency.Record(ctx, float64(r.clk.Since(start))/float64(time.Millisecond))
 
-	for _, info := range protoResp.CloserPeersAddrInfos() {
-		_ = r.addToPeerStore(ctx, info, time.Hour) // TODO: replace hard coded time.Hour with config
+	if protoResp.GetStreamedResponse() {
+		if !req.GetAcceptStreamedResponse() {
+			r.tele.SentRequestErrors.Add(ctx, 1)
+			return nil, fmt.Errorf("unrequested streamed response")
+		}
+		if err = readStreamedResponse(reader, &protoResp, onPart); err != nil {
+			r.tele.SentRequestErrors.Add(ctx, 1)
+			return nil, fmt.Errorf("read streamed response: %w", err)
+		}
+	} else if protoResp.GetResponseChunks() > 0 {
+		if !req.GetAcceptChunkedResponse() {
+			r.tele.SentRequestErrors.Add(ctx, 1)
+			return nil, fmt.Errorf("unrequested chunked response")
+		}
+		if err = readChunkedResponse(reader, &protoResp); err != nil {
+			r.tele.SentRequestErrors.Add(ctx, 1)
+			return nil, fmt.Errorf("read chunked response: %w", err)
+		}
 	}
+	r.tele.OutboundRequestLatency.Record(ctx, float64(r.clk.Since(start))/float64(time.Millisecond))
+
+	r.RecordResponse(ctx, to, &protoResp)
 
 	return &protoResp, err
 }
 
+// RecordResponse adds the addresses of the closer peers contained in resp to the peerstore. It is called for every
+// response read by SendMessage and again by the coordinator once a private response has been decrypted.
+func (r *router) RecordResponse(ctx context.Context, from kadt.PeerID, resp *pb.Message) {
+	for _, info := range resp.CloserPeersAddrInfos() {
+		_ = r.addToPeerStore(ctx, info, time.Hour) // TODO: replace hard coded time.Hour with config
+	}
+}
+
 func (r *router) GetClosestNodes(ctx context.Context, to kadt.PeerID, target kadt.Key) ([]kadt.PeerID, error) {
 	req := &pb.Message{
 		Type: pb.Message_FIND_NODE,
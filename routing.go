@@ -26,6 +26,16 @@ import (
 
 var _ routing.Routing = (*DHT)(nil)
 
+// privatePeerAddrTTL is the time for which the addresses of a peer that
+// [DHT.FindPeerPrivately] found in a decrypted bucket are kept in the peer
+// store, like the addresses of the closer peers of other responses.
+const privatePeerAddrTTL = time.Hour
+
+// FindPeerPrivately is like [DHT.FindPeer], but looks up the peer with
+// PRIVATE_FIND_NODE requests, which don't reveal the peer to the nodes that
+// are visited. The lookup stops as soon as the peer is found with addresses in
+// the decrypted bucket of a node, or is visited itself. The addresses from the
+// bucket are returned and added to the peer store.
 func (d *DHT) FindPeerPrivately(ctx context.Context, id peer.ID) (peer.AddrInfo, error) {
 	ctx, span := d.tele.Tracer.Start(ctx, "DHT.FindPeerPrivately")
 	defer span.End()
@@ -43,32 +53,51 @@ func (d *DHT) FindPeerPrivately(ctx context.Context, id peer.ID) (peer.AddrInfo,
 		// we're not connected or were recently connected
 	}
 
-	var foundPeer peer.ID
+	var found peer.AddrInfo
 
 	callback := func(ctx context.Context, visited kadt.PeerID, msg *pb.Message, stats coordt.QueryStats) error {
-		// TODO: Process PIR response here
 		if peer.ID(visited) == id {
-			foundPeer = peer.ID(visited)
+			found = d.host.Peerstore().PeerInfo(id)
+			return coordt.ErrSkipRemaining
+		}
+
+		// The decrypted bucket holds the addresses of its peers, which the
+		// visited node joined with its peer store obliviously to the target.
+		for _, p := range msg.GetCloserPeers() {
+			if peer.ID(p.GetId()) != id {
+				continue
+			}
+
+			addrs := p.Addresses()
+			if len(addrs) == 0 {
+				continue
+			}
+
+			found = peer.AddrInfo{ID: id, Addrs: addrs}
+			d.host.Peerstore().AddAddrs(id, addrs, privatePeerAddrTTL)
 			return coordt.ErrSkipRemaining
 		}
+
 		return nil
 	}
 
-	// TODO: The PIRRequest will be different for each node.
-	//  QueryPrivate generates a PIR request from this plaintext one.
-	plaintextRequest := pb.Message{Key: kadt.PeerID(id).Key().MsgKey()}
+	// The key of this message is never sent to other nodes. QueryPrivate
+	// generates a different PIR request for each node from it.
+	plaintextRequest := pb.Message{
+		Type: pb.Message_PRIVATE_FIND_NODE,
+		Key:  kadt.PeerID(id).Key().MsgKey(),
+	}
 
 	_, _, err := d.kad.QueryPrivate(ctx, &plaintextRequest, callback, 20)
 	if err != nil {
 		return peer.AddrInfo{}, fmt.Errorf("failed to run query: %w", err)
 	}
 
-	if foundPeer == "" {
+	if found.ID == "" {
 		return peer.AddrInfo{}, fmt.Errorf("peer record not found")
 	}
 
-	// This just extracts the multiaddress from foundPeer
-	return d.host.Peerstore().PeerInfo(foundPeer), nil
+	return found, nil
 }
 
 func (d *DHT) FindPeer(ctx context.Context, id peer.ID) (peer.AddrInfo, error) {
@@ -150,14 +179,21 @@ func (d *DHT) Provide(ctx context.Context, c cid.Cid, brdcst bool) error {
 		},
 	}
 
-	// finally, find the closest peers to the target key.
+	// finally, find the closest peers to the target key. Private lookups don't
+	// reveal the CID to the peers that are visited along the way.
+	if d.cfg.Privacy == PrivacyOptPrivate {
+		return d.kad.BroadcastRecordPrivate(ctx, msg)
+	}
 	return d.kad.BroadcastRecord(ctx, msg)
 }
 
 func (d *DHT) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
 	peerOut := make(chan peer.AddrInfo)
-	// TODO: Replace this with d.findProvidersAsyncRoutinePrivate
-	go d.findProvidersAsyncRoutine(ctx, c, count, peerOut)
+	if d.cfg.Privacy == PrivacyOptPrivate {
+		go d.findProvidersAsyncRoutinePrivate(ctx, c, count, peerOut)
+	} else {
+		go d.findProvidersAsyncRoutine(ctx, c, count, peerOut)
+	}
 	return peerOut
 }
 
@@ -212,17 +248,17 @@ func (d *DHT) findProvidersAsyncRoutinePrivate(ctx context.Context, c cid.Cid, c
 		}
 	}
 
-	// Craft message to send to other peers
+	// The key of this message is never sent to other peers. QueryPrivate
+	// generates a different PIR request for each peer from it.
 	msg := &pb.Message{
-		Type: pb.Message_GET_PROVIDERS,
+		Type: pb.Message_PRIVATE_GET_PROVIDERS,
 		Key:  c.Hash(),
 	}
 
-	// handle node response
+	// handle decrypted node response
 	callback := func(ctx context.Context, id kadt.PeerID, resp *pb.Message, stats coordt.QueryStats) error {
-		// TODO: Process PIR Response from resp here
-		// loop through all providers that the remote peer returned
-		for _, provider := range resp.ProviderAddrInfos() {
+		// loop through all providers for our CID in the bucket that the remote peer returned
+		for _, provider := range resp.BucketProviderAddrInfos(c.Hash()) {
 
 			// if we had already sent that peer on the channel -> do nothing
 			if _, found := providers[provider.ID]; found {
@@ -470,6 +506,11 @@ func (d *DHT) SearchValue(ctx context.Context, keyStr string, options ...routing
 		return nil, routing.ErrNotSupported
 	}
 
+	search := d.searchValueRoutine
+	if d.cfg.Privacy == PrivacyOptPrivate {
+		search = d.searchValueRoutinePrivate
+	}
+
 	val, err := b.Fetch(ctx, path)
 	if err != nil {
 		if !errors.Is(err, ds.ErrNotFound) {
@@ -481,7 +522,7 @@ func (d *DHT) SearchValue(ctx context.Context, keyStr string, options ...routing
 		}
 
 		out := make(chan []byte)
-		go d.searchValueRoutine(ctx, b, ns, path, rOpt, out)
+		go search(ctx, b, ns, path, rOpt, out)
 		return out, nil
 	}
 
@@ -500,7 +541,7 @@ func (d *DHT) SearchValue(ctx context.Context, keyStr string, options ...routing
 	out := make(chan []byte)
 	go func() {
 		out <- rec.GetValue()
-		d.searchValueRoutine(ctx, b, ns, path, rOpt, out)
+		search(ctx, b, ns, path, rOpt, out)
 	}()
 
 	return out, nil
@@ -604,6 +645,78 @@ func (d *DHT) searchValueRoutine(ctx context.Context, backend Backend, ns string
 	}()
 }
 
+// searchValueRoutinePrivate is like searchValueRoutine, but retrieves the
+// records with PRIVATE_GET_VALUE lookups, which don't reveal the key to the
+// peers that are contacted. Peers that hold stale records aren't updated, as
+// sending them the best record would reveal the key.
+func (d *DHT) searchValueRoutinePrivate(ctx context.Context, backend Backend, ns string, path string, ropt *routing.Options, out chan<- []byte) {
+	_, span := d.tele.Tracer.Start(ctx, "DHT.searchValueRoutinePrivate")
+	defer span.End()
+	defer close(out)
+
+	routingKey := []byte(newRoutingKey(ns, path))
+
+	// The key of this message is never sent to other peers. QueryPrivate
+	// generates a different PIR request for each peer from it.
+	req := &pb.Message{
+		Type: pb.Message_PRIVATE_GET_VALUE,
+		Key:  routingKey,
+	}
+
+	// The currently known best value for /$ns/$path
+	var best []byte
+
+	// The peers that returned the best value
+	quorumPeers := map[kadt.PeerID]struct{}{}
+
+	// The quorum that we require for terminating the query.
+	quorum := d.getQuorum(ropt)
+
+	// handle decrypted node response
+	fn := func(ctx context.Context, id kadt.PeerID, resp *pb.Message, stats coordt.QueryStats) error {
+		// the bucket that the remote peer returned holds the records of all
+		// keys that share it with our key
+		rec := resp.BucketRecord(routingKey)
+		if rec == nil {
+			return nil
+		}
+
+		idx, _ := backend.Validate(ctx, path, best, rec.GetValue())
+		switch idx {
+		case 0: // "best" is still the best value
+			if bytes.Equal(best, rec.GetValue()) {
+				quorumPeers[id] = struct{}{}
+			}
+
+		case 1: // rec.GetValue() is better than our current "best"
+			quorumPeers = map[kadt.PeerID]struct{}{}
+			quorumPeers[id] = struct{}{}
+
+			// submit the new value to the user
+			best = rec.GetValue()
+			out <- best
+		case -1: // "best" and rec.GetValue() are both invalid
+			return nil
+
+		default:
+			d.log.Warn("unexpected validate index", slog.Int("idx", idx))
+		}
+
+		// Check if we have reached the quorum
+		if len(quorumPeers) == quorum {
+			return coordt.ErrSkipRemaining
+		}
+
+		return nil
+	}
+
+	_, _, err := d.kad.QueryPrivate(ctx, req, fn, d.cfg.BucketSize)
+	if err != nil {
+		d.warnErr(err, "Private search value query failed")
+		return
+	}
+}
+
 // quorumOptionKey is a struct that is used as a routing options key to pass
 // the desired quorum value into, e.g., SearchValue or GetValue.
 type quorumOptionKey struct{}
@@ -119,6 +119,57 @@ func TestDHT_FindPeer_already_connected(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestDHT_FindPeerPrivately_happy_path(t *testing.T) {
+	ctx := kadtest.CtxLong(t)
+
+	top := NewTopology(t)
+	d1 := top.AddServer(nil)
+	d2 := top.AddServer(nil)
+	d3 := top.AddServer(nil)
+	d4 := top.AddServer(nil)
+	top.ConnectChain(ctx, d1, d2, d3, d4)
+
+	addrInfo, err := d1.FindPeerPrivately(ctx, d4.host.ID())
+	require.NoError(t, err)
+	assert.Equal(t, d4.host.ID(), addrInfo.ID)
+	assert.NotEmpty(t, addrInfo.Addrs)
+}
+
+func TestDHT_FindPeerPrivately_addresses_from_bucket(t *testing.T) {
+	ctx := kadtest.CtxLong(t)
+
+	top := NewTopology(t)
+	d1 := top.AddServer(nil)
+	d2 := top.AddServer(nil)
+	top.Connect(ctx, d1, d2)
+
+	// the target is only known to d2 and can't be visited itself
+	target := fillRoutingTable(t, d2, 1)[0]
+	require.Empty(t, d1.host.Peerstore().Addrs(target))
+
+	addrInfo, err := d1.FindPeerPrivately(ctx, target)
+	require.NoError(t, err)
+	assert.Equal(t, target, addrInfo.ID)
+	assert.Equal(t, d2.host.Peerstore().Addrs(target), addrInfo.Addrs)
+
+	// the addresses from the decrypted bucket are added to the peer store
+	assert.ElementsMatch(t, addrInfo.Addrs, d1.host.Peerstore().Addrs(target))
+}
+
+func TestDHT_FindPeerPrivately_not_found(t *testing.T) {
+	ctx := kadtest.CtxLong(t)
+
+	top := NewTopology(t)
+	d1 := top.AddServer(nil)
+	d2 := top.AddServer(nil)
+	d3 := top.AddServer(nil)
+	d4 := top.AddServer(nil)
+	top.ConnectChain(ctx, d1, d2, d3)
+
+	_, err := d1.FindPeerPrivately(ctx, d4.host.ID())
+	assert.Error(t, err)
+}
+
 func TestDHT_PutValue_happy_path(t *testing.T) {
 	// TIMING: this test is based on timeouts - so might become flaky!
 	ctx := kadtest.CtxShort(t)
@@ -215,6 +266,30 @@ func TestGetValueOnePeer(t *testing.T) {
 	require.Equal(t, v, val)
 }
 
+func TestGetValueOnePeer_privately(t *testing.T) {
+	ctx := kadtest.CtxLong(t)
+
+	cfg := DefaultConfig()
+	cfg.Privacy = PrivacyOptPrivate
+
+	top := NewTopology(t)
+	local := top.AddServer(cfg)
+	remote := top.AddServer(nil)
+
+	// store the value on the remote DHT, next to a value for another key
+	key, v := makePkKeyValue(t)
+	require.NoError(t, remote.putValueLocal(ctx, key, v))
+	otherKey, otherV := makePkKeyValue(t)
+	require.NoError(t, remote.putValueLocal(ctx, otherKey, otherV))
+
+	top.Connect(ctx, local, remote)
+
+	// ask the local DHT to find the value without revealing the key
+	val, err := local.GetValue(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, v, val)
+}
+
 func TestDHT_Provide_no_providers_backend_registered(t *testing.T) {
 	ctx := kadtest.CtxShort(t)
 	d := newTestDHT(t)
@@ -283,6 +358,48 @@ func TestDHT_Provide_fails_if_routing_table_is_empty(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDHT_Provide_privately(t *testing.T) {
+	ctx := kadtest.CtxLong(t)
+
+	cfg := DefaultConfig()
+	cfg.Privacy = PrivacyOptPrivate
+
+	top := NewTopology(t)
+	d1 := top.AddServer(cfg)
+	d2 := top.AddServer(nil)
+	d3 := top.AddServer(nil)
+
+	top.ConnectChain(ctx, d1, d2, d3)
+
+	c := NewRandomContent(t)
+	err := d1.Provide(ctx, c, true)
+	require.NoError(t, err)
+
+	deadline, hasDeadline := ctx.Deadline()
+	if !hasDeadline {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+
+	// the closest peers were found with private lookups and hold the
+	// provider record. Storing the record is asynchronous, see
+	// TestDHT_PutValue_happy_path.
+	for _, d := range []*DHT{d2, d3} {
+		be, err := typedBackend[*ProvidersBackend](d, namespaceProviders)
+		require.NoError(t, err)
+
+		assert.EventuallyWithT(t, func(t *assert.CollectT) {
+			val, err := be.Fetch(ctx, string(c.Hash()))
+			if !assert.NoError(t, err) {
+				return
+			}
+			ps, ok := val.(*providerSet)
+			if assert.True(t, ok) && assert.Len(t, ps.providers, 1) {
+				assert.Equal(t, d1.host.ID(), ps.providers[0].ID)
+			}
+		}, time.Until(deadline), 10*time.Millisecond)
+	}
+}
+
 func TestDHT_FindProvidersAsync_empty_routing_table(t *testing.T) {
 	ctx := kadtest.CtxShort(t)
 	d := newTestDHT(t)
@@ -382,6 +499,38 @@ func TestDHT_FindProvidersAsync_queries_other_peers(t *testing.T) {
 	kadtest.AssertClosed(t, ctx, out)
 }
 
+func TestDHT_FindProvidersAsync_queries_other_peers_privately(t *testing.T) {
+	ctx := kadtest.CtxLong(t)
+
+	c := NewRandomContent(t)
+
+	cfg := DefaultConfig()
+	cfg.Privacy = PrivacyOptPrivate
+
+	top := NewTopology(t)
+	d1 := top.AddServer(cfg)
+	d2 := top.AddServer(nil)
+	d3 := top.AddServer(nil)
+
+	top.ConnectChain(ctx, d1, d2, d3)
+
+	provider := peer.AddrInfo{ID: newPeerID(t)}
+	_, err := d3.backends[namespaceProviders].Store(ctx, string(c.Hash()), provider)
+	require.NoError(t, err)
+
+	// a provider for another CID is never returned
+	other := peer.AddrInfo{ID: newPeerID(t)}
+	_, err = d2.backends[namespaceProviders].Store(ctx, string(NewRandomContent(t).Hash()), other)
+	require.NoError(t, err)
+
+	out := d1.FindProvidersAsync(ctx, c, 1)
+
+	val := kadtest.ReadItem(t, ctx, out)
+	assert.Equal(t, provider.ID, val.ID)
+
+	kadtest.AssertClosed(t, ctx, out)
+}
+
 func TestDHT_FindProvidersAsync_respects_cancelled_context_for_local_query(t *testing.T) {
 	// Test strategy:
 	// We let d know about providersCount providers for the CID c
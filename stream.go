@@ -138,7 +138,21 @@ func (d *DHT) handleNewStream(ctx context.Context, s network.Stream) error {
 
 		// 3. handle the message and gather response
 		slogger.LogAttrs(ctx, slog.LevelDebug, "handling message")
-		resp, err := d.handleMsg(ctx, s.Conn().RemotePeer(), req)
+		handlerCtx, cancel := d.handlerContext(ctx, s)
+
+		// the PIR responses of private requests are streamed as soon as they
+		// were computed, if the remote peer can read streamed responses
+		var rs *responseStream
+		if req.GetAcceptStreamedResponse() && d.cfg.PIRResponseChunkSize > 0 {
+			if rs, err = newResponseStream(s, req, d.cfg.PIRResponseChunkSize); err != nil {
+				cancel()
+				return err
+			}
+			handlerCtx = withResponseStream(handlerCtx, rs)
+		}
+
+		resp, err := d.handleMsg(handlerCtx, s.Conn().RemotePeer(), req)
+		cancel()
 		if err != nil {
 			slogger.LogAttrs(ctx, slog.LevelDebug, "error handling message", slog.Duration("time", d.cfg.Clock.Since(startTime)), slog.String("error", err.Error()))
 			d.tele.ReceivedMessageErrors.Add(ctx, 1, mattrs)
@@ -151,8 +165,18 @@ func (d *DHT) handleNewStream(ctx context.Context, s network.Stream) error {
 			continue
 		}
 
-		// 4. sent remote peer our response
-		err = d.streamWriteMsg(ctx, slogger, s, resp)
+		// 4. sent remote peer our response. If its PIR responses were
+		// streamed, only the trailer is left to send. Otherwise, it's sent in
+		// chunks if it doesn't fit into a single chunk and the remote peer can
+		// read chunked responses.
+		switch {
+		case rs != nil && rs.started():
+			err = d.streamFinishStreamedMsg(ctx, slogger, rs, resp)
+		case req.GetAcceptChunkedResponse() && d.cfg.PIRResponseChunkSize > 0 && proto.Size(resp) > d.cfg.PIRResponseChunkSize:
+			err = d.streamWriteChunkedMsg(ctx, slogger, s, resp)
+		default:
+			err = d.streamWriteMsg(ctx, slogger, s, resp)
+		}
 		if err != nil {
 			return err
 		}
@@ -164,6 +188,75 @@ func (d *DHT) handleNewStream(ctx context.Context, s network.Stream) error {
 	}
 }
 
+// handlerContext returns the context that a request read from the stream is
+// handled with. It is cancelled once the stream was idle for too long, after
+// which the response can't be written anymore, or once the connection of the
+// stream was closed, so that expensive requests like PIR requests aren't
+// processed further for a remote peer that went away.
+func (d *DHT) handlerContext(ctx context.Context, s network.Stream) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.TimeoutStreamIdle)
+
+	remove := d.connCancels.add(s.Conn(), cancel)
+	if s.Conn().IsClosed() {
+		cancel()
+	}
+
+	return ctx, func() {
+		remove()
+		cancel()
+	}
+}
+
+// connCancels cancels the contexts that requests are handled with once the
+// connection they were received on was closed. It is registered once as a
+// notifiee with the network of the host instead of once per request.
+type connCancels struct {
+	mu      sync.Mutex
+	next    uint64
+	cancels map[network.Conn]map[uint64]context.CancelFunc
+}
+
+// add registers cancel to be called once conn was closed. The returned
+// function deregisters it again.
+func (c *connCancels) add(conn network.Conn, cancel context.CancelFunc) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancels == nil {
+		c.cancels = map[network.Conn]map[uint64]context.CancelFunc{}
+	}
+	if c.cancels[conn] == nil {
+		c.cancels[conn] = map[uint64]context.CancelFunc{}
+	}
+
+	id := c.next
+	c.next++
+	c.cancels[conn][id] = cancel
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		delete(c.cancels[conn], id)
+		if len(c.cancels[conn]) == 0 {
+			delete(c.cancels, conn)
+		}
+	}
+}
+
+// disconnected is the [network.NotifyBundle.DisconnectedF] of the DHT. It
+// cancels all contexts that were registered for the closed connection.
+func (c *connCancels) disconnected(_ network.Network, conn network.Conn) {
+	c.mu.Lock()
+	cancels := c.cancels[conn]
+	delete(c.cancels, conn)
+	c.mu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
 // streamReadMsg reads a message from the given msgio.Reader and returns the
 // corresponding bytes. If an error occurs it, logs it, and updates the metrics.
 // If the bytes are empty and the error is nil, the remote peer returned
@@ -232,14 +325,64 @@ func (d *DHT) handleMsg(ctx context.Context, remote peer.ID, req *pb.Message) (*
 		return d.handleAddProvider(ctx, remote, req)
 	case pb.Message_GET_PROVIDERS:
 		return d.handleGetProviders(ctx, remote, req)
+	case pb.Message_PRIVATE_FIND_NODE, pb.Message_PRIVATE_GET_PROVIDERS, pb.Message_PRIVATE_GET_VALUE:
+		return d.handlePrivateMsg(ctx, remote, req)
+
+	default:
+		return nil, fmt.Errorf("can't handle received message: %s", req.GetType().String())
+	}
+}
+
+// handlePrivateMsg handles the private message from the given remote peer if
+// the admission control of the DHT admits it. Otherwise, the remote peer is
+// told that this DHT is busy, so that it can send its request to another peer.
+func (d *DHT) handlePrivateMsg(ctx context.Context, remote peer.ID, req *pb.Message) (*pb.Message, error) {
+	release, reason, ok := d.pirAdmission.admit(remote)
+	if !ok {
+		d.tele.PIRRejectedRequests.Add(ctx, 1, metric.WithAttributeSet(tele.FromContext(ctx, tele.AttrRejectReason(reason))))
+		return busyResponse(req, fmt.Errorf("private request refused: %s limit exceeded", reason)), nil
+	}
+	defer release()
+
+	mattrs := metric.WithAttributeSet(tele.FromContext(ctx))
+	d.tele.PIRInFlightRequests.Add(ctx, 1, mattrs)
+	defer d.tele.PIRInFlightRequests.Add(ctx, -1, mattrs)
+
+	switch req.GetType() {
 	case pb.Message_PRIVATE_FIND_NODE:
 		return d.handlePrivateFindPeer(ctx, remote, req)
-	case pb.Message_PRIVATE_GET_PROVIDERS:
+	case pb.Message_PRIVATE_GET_VALUE:
+		return d.handlePrivateGetValue(ctx, remote, req)
+	default:
 		return d.handlePrivateGetProviderRecords(ctx, remote, req)
+	}
+}
 
-	default:
-		return nil, fmt.Errorf("can't handle received message: %s", req.GetType().String())
+// busyResponse returns the response to a private request that this DHT
+// refused to process because it is overloaded. The PIR responses carry a BUSY
+// error instead of ciphertexts.
+func busyResponse(req *pb.Message, err error) *pb.Message {
+	busy := func() *pb.PIR_Response {
+		return &pb.PIR_Response{
+			Error: &pb.PIR_Error{
+				Code:    pb.PIR_Error_BUSY,
+				Message: err.Error(),
+			},
+		}
 	}
+
+	resp := &pb.Message{
+		Type:                req.GetType(),
+		PIR_Message_ID:      req.GetPIR_Message_ID(),
+		CloserPeersResponse: busy(),
+	}
+	switch req.GetType() {
+	case pb.Message_PRIVATE_GET_PROVIDERS:
+		resp.ProviderPeersResponse = busy()
+	case pb.Message_PRIVATE_GET_VALUE:
+		resp.RecordResponse = busy()
+	}
+	return resp
 }
 
 // streamWriteMsg sends the given message over the stream and handles traces
@@ -258,6 +401,39 @@ func (d *DHT) streamWriteMsg(ctx context.Context, slogger *slog.Logger, s networ
 	return nil
 }
 
+// streamWriteChunkedMsg sends the given message over the stream with the
+// ciphertexts of its PIR responses in chunks of at most
+// [Config.PIRResponseChunkSize] bytes, see writeChunkedMsg.
+func (d *DHT) streamWriteChunkedMsg(ctx context.Context, slogger *slog.Logger, s network.Stream, msg *pb.Message) error {
+	ctx, span := d.tele.Tracer.Start(ctx, "DHT.streamWriteChunkedMsg")
+	defer span.End()
+
+	if err := writeChunkedMsg(s, msg, d.cfg.PIRResponseChunkSize); err != nil {
+		slogger.LogAttrs(ctx, slog.LevelDebug, "error writing chunked response", slog.String("err", err.Error()))
+		mattrs := metric.WithAttributeSet(tele.FromContext(ctx))
+		d.tele.ReceivedMessageErrors.Add(ctx, 1, mattrs)
+		return err
+	}
+
+	return nil
+}
+
+// streamFinishStreamedMsg ends the streamed response with the trailer of the
+// given message, see responseStream.
+func (d *DHT) streamFinishStreamedMsg(ctx context.Context, slogger *slog.Logger, rs *responseStream, msg *pb.Message) error {
+	ctx, span := d.tele.Tracer.Start(ctx, "DHT.streamFinishStreamedMsg")
+	defer span.End()
+
+	if err := rs.finish(msg); err != nil {
+		slogger.LogAttrs(ctx, slog.LevelDebug, "error writing streamed response", slog.String("err", err.Error()))
+		mattrs := metric.WithAttributeSet(tele.FromContext(ctx))
+		d.tele.ReceivedMessageErrors.Add(ctx, 1, mattrs)
+		return err
+	}
+
+	return nil
+}
+
 // The Protobuf writer performs multiple small writes when writing a message.
 // We need to buffer those writes, to make sure that we're not sending a new
 // packet for every single write.
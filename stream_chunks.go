@@ -0,0 +1,525 @@
+package zikade
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/libp2p/go-msgio"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/pir"
+)
+
+const (
+	// MaxPIRResponseChunkSize is the largest number of ciphertext bytes that a
+	// single chunk of a chunked response may carry. It leaves room for the
+	// framing of the chunk under the message size limit of the stream.
+	MaxPIRResponseChunkSize = 1 << 20
+
+	// maxChunkedResponseSize bounds the total number of ciphertext bytes of a
+	// chunked response that a client reads, so that a server can't make the
+	// client buffer an unbounded response.
+	maxChunkedResponseSize = 64 << 20
+
+	// maxResponseChunks bounds the number of chunks of a chunked response.
+	maxResponseChunks = maxChunkedResponseSize / 1024
+)
+
+// responsePart is a ciphertext field of a PIR response of a chunked response.
+type responsePart struct {
+	response pb.PIR_Chunk_Response
+	field    pb.PIR_Chunk_Field
+	index    uint32
+	data     []byte
+}
+
+// takeResponseParts removes the ciphertext fields from the PIR responses of
+// the message and returns them. Batch ciphertexts are replaced with empty
+// ciphertexts, so that the message still tells the client how many there are.
+func takeResponseParts(msg *pb.Message) []responsePart {
+	var parts []responsePart
+	for _, response := range []pb.PIR_Chunk_Response{pb.PIR_Chunk_CLOSER_PEERS, pb.PIR_Chunk_PROVIDER_PEERS, pb.PIR_Chunk_RECORD} {
+		if res := pirResponse(msg, response); res != nil {
+			parts = append(parts, takeCiphertexts(response, res)...)
+		}
+	}
+	return parts
+}
+
+// takeCiphertexts removes the ciphertext fields from the PIR response and
+// returns them, like takeResponseParts.
+func takeCiphertexts(response pb.PIR_Chunk_Response, res *pb.PIR_Response) []responsePart {
+	var parts []responsePart
+	if len(res.Ciphertexts) > 0 {
+		parts = append(parts, responsePart{response: response, field: pb.PIR_Chunk_CIPHERTEXTS, data: res.Ciphertexts})
+		res.Ciphertexts = nil
+	}
+	for j, ciphertexts := range res.BatchCiphertexts {
+		if len(ciphertexts) > 0 {
+			parts = append(parts, responsePart{response: response, field: pb.PIR_Chunk_BATCH_CIPHERTEXTS, index: uint32(j), data: ciphertexts})
+			res.BatchCiphertexts[j] = nil
+		}
+	}
+	if hint := res.GetLweHint(); len(hint.GetHint()) > 0 {
+		parts = append(parts, responsePart{response: response, field: pb.PIR_Chunk_LWE_HINT, data: hint.Hint})
+		hint.Hint = nil
+	}
+	return parts
+}
+
+// pirResponse returns the PIR response of the message that chunks of the
+// given response belong to.
+func pirResponse(msg *pb.Message, response pb.PIR_Chunk_Response) *pb.PIR_Response {
+	switch response {
+	case pb.PIR_Chunk_CLOSER_PEERS:
+		return msg.GetCloserPeersResponse()
+	case pb.PIR_Chunk_PROVIDER_PEERS:
+		return msg.GetProviderPeersResponse()
+	case pb.PIR_Chunk_RECORD:
+		return msg.GetRecordResponse()
+	default:
+		return nil
+	}
+}
+
+// setPIRResponse sets the PIR response of the message that chunks of the
+// given response belong to.
+func setPIRResponse(msg *pb.Message, response pb.PIR_Chunk_Response, res *pb.PIR_Response) error {
+	switch response {
+	case pb.PIR_Chunk_CLOSER_PEERS:
+		msg.CloserPeersResponse = res
+	case pb.PIR_Chunk_PROVIDER_PEERS:
+		msg.ProviderPeersResponse = res
+	case pb.PIR_Chunk_RECORD:
+		msg.RecordResponse = res
+	default:
+		return fmt.Errorf("unknown response %s", response)
+	}
+	return nil
+}
+
+// writeChunks writes the chunks of the ciphertexts of the parts, each with
+// at most chunkSize bytes, and flushes each chunk to the stream on its own.
+func writeChunks(bw *bufferedDelimitedWriter, parts []responsePart, chunkSize int) error {
+	for _, part := range parts {
+		for offset := 0; offset < len(part.data); offset += chunkSize {
+			end := offset + chunkSize
+			if end > len(part.data) {
+				end = len(part.data)
+			}
+
+			chunk := &pb.PIR_Chunk{
+				Response: part.response,
+				Field:    part.field,
+				Index:    part.index,
+				Data:     part.data[offset:end],
+			}
+			if err := bw.WriteMsg(chunk); err != nil {
+				return err
+			}
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeChunkedMsg writes the message with the ciphertexts of its PIR responses
+// moved into chunks of at most chunkSize bytes, which follow the message on the
+// stream. Each chunk is flushed to the stream on its own, so that the client
+// can read the first chunks while later ones are still being written. Unlike a
+// streamed response, see responseStream, it's written once all PIR responses
+// were computed. The message is modified.
+func writeChunkedMsg(w io.Writer, msg *pb.Message, chunkSize int) error {
+	if chunkSize <= 0 || chunkSize > MaxPIRResponseChunkSize {
+		return fmt.Errorf("chunk size must be between 1 and %d bytes, got %d", MaxPIRResponseChunkSize, chunkSize)
+	}
+
+	parts := takeResponseParts(msg)
+	numChunks := 0
+	for _, part := range parts {
+		numChunks += (len(part.data) + chunkSize - 1) / chunkSize
+	}
+	msg.ResponseChunks = uint32(numChunks)
+
+	bw := writerPool.Get().(*bufferedDelimitedWriter)
+	bw.Reset(w)
+	defer func() {
+		bw.Reset(nil)
+		writerPool.Put(bw)
+	}()
+
+	if err := bw.WriteMsg(msg); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	return writeChunks(bw, parts, chunkSize)
+}
+
+// readChunkedResponse reads the chunks that follow a chunked response from
+// the reader and appends their ciphertexts to the PIR responses of the
+// message. It rejects chunks that exceed [MaxPIRResponseChunkSize] and
+// responses that exceed maxChunkedResponseSize in total.
+func readChunkedResponse(r msgio.Reader, msg *pb.Message) error {
+	numChunks := msg.GetResponseChunks()
+	if numChunks > maxResponseChunks {
+		return fmt.Errorf("chunked response has %d chunks, at most %d are supported", numChunks, maxResponseChunks)
+	}
+
+	total := 0
+	for i := uint32(0); i < numChunks; i++ {
+		data, err := r.ReadMsg()
+		if err != nil {
+			return fmt.Errorf("read chunk %d of %d: %w", i, numChunks, err)
+		}
+
+		chunk := &pb.PIR_Chunk{}
+		err = proto.Unmarshal(data, chunk)
+		r.ReleaseMsg(data)
+		if err != nil {
+			return fmt.Errorf("unmarshal chunk %d of %d: %w", i, numChunks, err)
+		}
+
+		if len(chunk.GetData()) == 0 || len(chunk.GetData()) > MaxPIRResponseChunkSize {
+			return fmt.Errorf("chunk of %d bytes, must be between 1 and %d bytes", len(chunk.GetData()), MaxPIRResponseChunkSize)
+		}
+		total += len(chunk.GetData())
+		if total > maxChunkedResponseSize {
+			return fmt.Errorf("chunked response exceeds %d bytes", maxChunkedResponseSize)
+		}
+
+		if err := appendChunk(msg, chunk); err != nil {
+			return err
+		}
+	}
+
+	msg.ResponseChunks = 0
+	return nil
+}
+
+// appendChunk appends the data of the chunk to the field of the PIR response
+// of the message that the chunk belongs to.
+func appendChunk(msg *pb.Message, chunk *pb.PIR_Chunk) error {
+	res := pirResponse(msg, chunk.GetResponse())
+	if res == nil {
+		return fmt.Errorf("chunk for %s response, which the message doesn't hold", chunk.GetResponse())
+	}
+
+	switch chunk.GetField() {
+	case pb.PIR_Chunk_CIPHERTEXTS:
+		res.Ciphertexts = append(res.Ciphertexts, chunk.GetData()...)
+	case pb.PIR_Chunk_BATCH_CIPHERTEXTS:
+		if int(chunk.GetIndex()) >= len(res.BatchCiphertexts) {
+			return fmt.Errorf("chunk for batch ciphertexts %d of %d", chunk.GetIndex(), len(res.BatchCiphertexts))
+		}
+		res.BatchCiphertexts[chunk.GetIndex()] = append(res.BatchCiphertexts[chunk.GetIndex()], chunk.GetData()...)
+	case pb.PIR_Chunk_LWE_HINT:
+		if res.GetLweHint() == nil {
+			return fmt.Errorf("chunk for the hint of a response without hint")
+		}
+		res.LweHint.Hint = append(res.LweHint.Hint, chunk.GetData()...)
+	default:
+		return fmt.Errorf("chunk for unknown field %s", chunk.GetField())
+	}
+
+	return nil
+}
+
+// responseStream writes the streamed response to a request of a client that
+// accepts streamed responses. The PIR responses of the response are written
+// with writePart as soon as the handler computed them, so that the client can
+// process the first PIR responses while the later ones are still being
+// computed. Each PIR response is written as a chunk with its header, i.e., the
+// PIR response without its ciphertexts, followed by chunks of its ciphertexts
+// of at most chunkSize bytes. The ciphertexts of a PIR response may also be
+// written with a partWriter while they are computed, see streamCiphertexts.
+// The first part is preceded by a message that announces the streamed
+// response, and finish ends the response with a trailer of the fields that
+// weren't streamed.
+type responseStream struct {
+	w         io.Writer
+	chunkSize int
+
+	// header is the message that is written before the first part
+	header *pb.Message
+
+	// streamed holds the responses that were written with writePart or a
+	// partWriter
+	streamed []pb.PIR_Chunk_Response
+
+	// openHeader is the header of the last streamed response, if a partWriter
+	// started its part and writePart didn't finish it yet
+	openHeader *pb.PIR_Response
+}
+
+// responseStreamKey is the key of the responseStream in the context that a
+// request is handled with.
+type responseStreamKey struct{}
+
+// newResponseStream returns a responseStream that writes the response to req
+// to w.
+func newResponseStream(w io.Writer, req *pb.Message, chunkSize int) (*responseStream, error) {
+	if chunkSize <= 0 || chunkSize > MaxPIRResponseChunkSize {
+		return nil, fmt.Errorf("chunk size must be between 1 and %d bytes, got %d", MaxPIRResponseChunkSize, chunkSize)
+	}
+
+	return &responseStream{
+		w:         w,
+		chunkSize: chunkSize,
+		header: &pb.Message{
+			Type:             req.GetType(),
+			PIR_Message_ID:   req.GetPIR_Message_ID(),
+			StreamedResponse: true,
+		},
+	}, nil
+}
+
+// withResponseStream returns a context that handlers write the PIR responses
+// of the response to the request that is handled with it to, see
+// streamPIRResponse.
+func withResponseStream(ctx context.Context, rs *responseStream) context.Context {
+	return context.WithValue(ctx, responseStreamKey{}, rs)
+}
+
+// streamPIRResponse writes the PIR response as a part of the streamed
+// response to the request that is handled with ctx, if the client accepts
+// streamed responses. The ciphertexts of the response are removed, and the
+// response is left out of the trailer of the streamed response.
+func streamPIRResponse(ctx context.Context, response pb.PIR_Chunk_Response, res *pb.PIR_Response) error {
+	rs, ok := ctx.Value(responseStreamKey{}).(*responseStream)
+	if !ok {
+		return nil
+	}
+	return rs.writePart(response, res)
+}
+
+// streamCiphertexts returns a context that makes the PIR response that is
+// computed with it write its ciphertexts as a part of the streamed response to
+// the request that is handled with ctx while they are computed, if the client
+// accepts streamed responses, so that the server doesn't hold all ciphertexts
+// of a large response in memory. The part is started with the header, which
+// must hold the fields of the computed response other than its ciphertexts.
+func streamCiphertexts(ctx context.Context, response pb.PIR_Chunk_Response, header *pb.PIR_Response) context.Context {
+	rs, ok := ctx.Value(responseStreamKey{}).(*responseStream)
+	if !ok {
+		return ctx
+	}
+	return pir.WithResponseWriter(ctx, &partWriter{rs: rs, response: response, header: header})
+}
+
+// started returns whether a part of the response was written.
+func (rs *responseStream) started() bool {
+	return len(rs.streamed) > 0
+}
+
+// isOpen returns whether a partWriter started the part of the response,
+// which writePart didn't finish yet.
+func (rs *responseStream) isOpen(response pb.PIR_Chunk_Response) bool {
+	return rs.openHeader != nil && rs.streamed[len(rs.streamed)-1] == response
+}
+
+// startPart writes the header of the PIR response as the start of the next
+// part, preceded by the message that announces the streamed response if it is
+// the first part.
+func (rs *responseStream) startPart(bw *bufferedDelimitedWriter, response pb.PIR_Chunk_Response, header *pb.PIR_Response) error {
+	if rs.openHeader != nil {
+		return fmt.Errorf("%s response is still being streamed", rs.streamed[len(rs.streamed)-1])
+	}
+	for _, streamed := range rs.streamed {
+		if streamed == response {
+			return fmt.Errorf("%s response was already streamed", response)
+		}
+	}
+
+	if !rs.started() {
+		if err := bw.WriteMsg(rs.header); err != nil {
+			return err
+		}
+	}
+	rs.streamed = append(rs.streamed, response)
+
+	if err := bw.WriteMsg(&pb.PIR_Chunk{Response: response, Header: header}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writePart writes the PIR response as the next part of the response. If a
+// partWriter already started the part, only the remaining ciphertexts of the
+// response are written, and the response must not differ from the header that
+// the part was started with in its other fields.
+func (rs *responseStream) writePart(response pb.PIR_Chunk_Response, res *pb.PIR_Response) error {
+	bw := writerPool.Get().(*bufferedDelimitedWriter)
+	bw.Reset(rs.w)
+	defer func() {
+		bw.Reset(nil)
+		writerPool.Put(bw)
+	}()
+
+	parts := takeCiphertexts(response, res)
+	if rs.isOpen(response) {
+		header := rs.openHeader
+		rs.openHeader = nil
+		if !proto.Equal(res, header) {
+			return fmt.Errorf("%s response differs from the header that was streamed", response)
+		}
+	} else if err := rs.startPart(bw, response, res); err != nil {
+		return err
+	}
+
+	return writeChunks(bw, parts, rs.chunkSize)
+}
+
+// partWriter writes the ciphertexts of a PIR response as a part of the
+// streamed response while the response is computed, see
+// [pir.WithResponseWriter]. The part is started with the header once the
+// first ciphertexts are written, and finished by writePart with the computed
+// response.
+type partWriter struct {
+	rs       *responseStream
+	response pb.PIR_Chunk_Response
+	header   *pb.PIR_Response
+}
+
+var _ pir.ResponseWriter = (*partWriter)(nil)
+
+// WriteCiphertexts writes the ciphertexts in chunks of the part, which it
+// starts with the header first if it wasn't started yet.
+func (pw *partWriter) WriteCiphertexts(p []byte) error {
+	bw := writerPool.Get().(*bufferedDelimitedWriter)
+	bw.Reset(pw.rs.w)
+	defer func() {
+		bw.Reset(nil)
+		writerPool.Put(bw)
+	}()
+
+	if !pw.rs.isOpen(pw.response) {
+		if err := pw.rs.startPart(bw, pw.response, pw.header); err != nil {
+			return err
+		}
+		pw.rs.openHeader = pw.header
+	}
+
+	return writeChunks(bw, []responsePart{{response: pw.response, field: pb.PIR_Chunk_CIPHERTEXTS, data: p}}, pw.rs.chunkSize)
+}
+
+// finish ends the response with a trailer that holds the fields of msg other
+// than the PIR responses that were streamed. The message is modified.
+func (rs *responseStream) finish(msg *pb.Message) error {
+	if rs.openHeader != nil {
+		return fmt.Errorf("%s response is still being streamed", rs.streamed[len(rs.streamed)-1])
+	}
+	for _, response := range rs.streamed {
+		if err := setPIRResponse(msg, response, nil); err != nil {
+			return err
+		}
+	}
+
+	bw := writerPool.Get().(*bufferedDelimitedWriter)
+	bw.Reset(rs.w)
+	defer func() {
+		bw.Reset(nil)
+		writerPool.Put(bw)
+	}()
+
+	if err := bw.WriteMsg(&pb.PIR_Chunk{Trailer: msg}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// readStreamedResponse reads the parts and the trailer of a streamed response
+// from the reader into the message, which announced the streamed response.
+// Once all chunks of a PIR response were read, onPart is called with a message
+// that only holds this PIR response, if onPart is non-nil, so that the client
+// can process it while the next parts are still being received. Like
+// readChunkedResponse, it rejects chunks that exceed [MaxPIRResponseChunkSize]
+// and responses that exceed maxChunkedResponseSize in total.
+func readStreamedResponse(r msgio.Reader, msg *pb.Message, onPart func(part *pb.Message)) error {
+	var (
+		total    int
+		part     *pb.Message
+		response pb.PIR_Chunk_Response
+		streamed = map[pb.PIR_Chunk_Response]bool{}
+	)
+
+	// hand the part that was read last to onPart
+	finishPart := func() {
+		if part != nil && onPart != nil {
+			onPart(part)
+		}
+		part = nil
+	}
+
+	for i := 0; i < maxResponseChunks; i++ {
+		data, err := r.ReadMsg()
+		if err != nil {
+			return fmt.Errorf("read chunk %d: %w", i, err)
+		}
+
+		chunk := &pb.PIR_Chunk{}
+		err = proto.Unmarshal(data, chunk)
+		r.ReleaseMsg(data)
+		if err != nil {
+			return fmt.Errorf("unmarshal chunk %d: %w", i, err)
+		}
+
+		switch {
+		case chunk.GetTrailer() != nil:
+			finishPart()
+
+			trailer := chunk.GetTrailer()
+			for response := range streamed {
+				if pirResponse(trailer, response) != nil {
+					return fmt.Errorf("trailer holds the streamed %s response", response)
+				}
+			}
+			proto.Merge(msg, trailer)
+			msg.StreamedResponse = false
+			return nil
+
+		case chunk.GetHeader() != nil:
+			finishPart()
+
+			response = chunk.GetResponse()
+			if streamed[response] {
+				return fmt.Errorf("%s response was streamed twice", response)
+			}
+			streamed[response] = true
+
+			if err := setPIRResponse(msg, response, chunk.GetHeader()); err != nil {
+				return err
+			}
+			part = &pb.Message{Type: msg.GetType(), PIR_Message_ID: msg.GetPIR_Message_ID()}
+			if err := setPIRResponse(part, response, chunk.GetHeader()); err != nil {
+				return err
+			}
+
+		default:
+			if part == nil || chunk.GetResponse() != response {
+				return fmt.Errorf("chunk for %s response outside of its part", chunk.GetResponse())
+			}
+
+			if len(chunk.GetData()) == 0 || len(chunk.GetData()) > MaxPIRResponseChunkSize {
+				return fmt.Errorf("chunk of %d bytes, must be between 1 and %d bytes", len(chunk.GetData()), MaxPIRResponseChunkSize)
+			}
+			total += len(chunk.GetData())
+			if total > maxChunkedResponseSize {
+				return fmt.Errorf("streamed response exceeds %d bytes", maxChunkedResponseSize)
+			}
+
+			if err := appendChunk(msg, chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return fmt.Errorf("streamed response has more than %d chunks", maxResponseChunks)
+}
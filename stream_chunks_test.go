@@ -0,0 +1,259 @@
+package zikade
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-msgio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/pir"
+)
+
+// readTestChunkedMsg reads a message and the chunks that follow it from buf.
+func readTestChunkedMsg(t *testing.T, buf *bytes.Buffer) (*pb.Message, error) {
+	t.Helper()
+
+	reader := msgio.NewVarintReaderSize(buf, network.MessageSizeMax)
+	data, err := reader.ReadMsg()
+	require.NoError(t, err)
+
+	msg := &pb.Message{}
+	require.NoError(t, proto.Unmarshal(data, msg))
+
+	return msg, readChunkedResponse(reader, msg)
+}
+
+func TestWriteChunkedMsg(t *testing.T) {
+	ciphertexts := bytes.Repeat([]byte{1, 2, 3}, 1000)
+	batch := [][]byte{bytes.Repeat([]byte{4}, 2500), bytes.Repeat([]byte{5}, 10)}
+	hint := bytes.Repeat([]byte{6, 7}, 1500)
+
+	newMsg := func() *pb.Message {
+		return &pb.Message{
+			Type:                pb.Message_PRIVATE_GET_PROVIDERS,
+			PIR_Message_ID:      1234,
+			CloserPeersResponse: &pb.PIR_Response{Ciphertexts: bytes.Clone(ciphertexts), LweHint: &pb.LWE_Hint{Epoch: []byte("epoch"), Hint: bytes.Clone(hint)}},
+			ProviderPeersResponse: &pb.PIR_Response{
+				BatchCiphertexts: [][]byte{bytes.Clone(batch[0]), bytes.Clone(batch[1])},
+			},
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeChunkedMsg(&buf, newMsg(), 1024))
+
+	msg, err := readTestChunkedMsg(t, &buf)
+	require.NoError(t, err)
+	assert.Zero(t, buf.Len())
+	assert.True(t, proto.Equal(newMsg(), msg))
+
+	// a stream that ends before the last chunk fails
+	require.NoError(t, writeChunkedMsg(&buf, newMsg(), 1024))
+	buf.Truncate(buf.Len() - 1)
+	_, err = readTestChunkedMsg(t, &buf)
+	assert.Error(t, err)
+
+	assert.Error(t, writeChunkedMsg(&buf, newMsg(), 0))
+	assert.Error(t, writeChunkedMsg(&buf, newMsg(), MaxPIRResponseChunkSize+1))
+}
+
+func TestReadChunkedResponse_invalid(t *testing.T) {
+	tests := map[string]struct {
+		msg    *pb.Message
+		chunks []*pb.PIR_Chunk
+	}{
+		"too many chunks": {
+			msg: &pb.Message{CloserPeersResponse: &pb.PIR_Response{}, ResponseChunks: maxResponseChunks + 1},
+		},
+		"missing chunks": {
+			msg:    &pb.Message{CloserPeersResponse: &pb.PIR_Response{}, ResponseChunks: 2},
+			chunks: []*pb.PIR_Chunk{{Data: []byte{1}}},
+		},
+		"empty chunk": {
+			msg:    &pb.Message{CloserPeersResponse: &pb.PIR_Response{}, ResponseChunks: 1},
+			chunks: []*pb.PIR_Chunk{{}},
+		},
+		"oversized chunk": {
+			msg:    &pb.Message{CloserPeersResponse: &pb.PIR_Response{}, ResponseChunks: 1},
+			chunks: []*pb.PIR_Chunk{{Data: make([]byte, MaxPIRResponseChunkSize+1)}},
+		},
+		"missing response": {
+			msg:    &pb.Message{CloserPeersResponse: &pb.PIR_Response{}, ResponseChunks: 1},
+			chunks: []*pb.PIR_Chunk{{Response: pb.PIR_Chunk_PROVIDER_PEERS, Data: []byte{1}}},
+		},
+		"batch index out of range": {
+			msg:    &pb.Message{CloserPeersResponse: &pb.PIR_Response{BatchCiphertexts: [][]byte{nil}}, ResponseChunks: 1},
+			chunks: []*pb.PIR_Chunk{{Field: pb.PIR_Chunk_BATCH_CIPHERTEXTS, Index: 1, Data: []byte{1}}},
+		},
+		"missing hint": {
+			msg:    &pb.Message{CloserPeersResponse: &pb.PIR_Response{}, ResponseChunks: 1},
+			chunks: []*pb.PIR_Chunk{{Field: pb.PIR_Chunk_LWE_HINT, Data: []byte{1}}},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := msgio.NewVarintWriter(&buf)
+			for _, chunk := range tt.chunks {
+				data, err := proto.Marshal(chunk)
+				require.NoError(t, err)
+				require.NoError(t, w.WriteMsg(data))
+			}
+
+			reader := msgio.NewVarintReaderSize(&buf, network.MessageSizeMax)
+			assert.Error(t, readChunkedResponse(reader, tt.msg))
+		})
+	}
+}
+
+func TestResponseStream(t *testing.T) {
+	closerPeers := &pb.PIR_Response{Ciphertexts: bytes.Repeat([]byte{1, 2, 3}, 1000), EvaluationKeysCached: true}
+	providerPeers := &pb.PIR_Response{BatchCiphertexts: [][]byte{bytes.Repeat([]byte{4}, 2500), bytes.Repeat([]byte{5}, 10)}}
+
+	expected := &pb.Message{
+		Type:                       pb.Message_PRIVATE_GET_PROVIDERS,
+		PIR_Message_ID:             1234,
+		CloserPeersResponse:        proto.Clone(closerPeers).(*pb.PIR_Response),
+		ProviderPeersResponse:      proto.Clone(providerPeers).(*pb.PIR_Response),
+		ProviderKeywordTableLength: 9,
+	}
+
+	var buf bytes.Buffer
+	req := &pb.Message{Type: pb.Message_PRIVATE_GET_PROVIDERS, PIR_Message_ID: 1234, AcceptStreamedResponse: true}
+	rs, err := newResponseStream(&buf, req, 1024)
+	require.NoError(t, err)
+	ctx := withResponseStream(context.Background(), rs)
+
+	// the PIR responses are written as soon as they are streamed
+	require.NoError(t, streamPIRResponse(ctx, pb.PIR_Chunk_CLOSER_PEERS, closerPeers))
+	require.True(t, rs.started())
+	written := buf.Len()
+	require.Greater(t, written, len(expected.CloserPeersResponse.Ciphertexts))
+
+	require.NoError(t, streamPIRResponse(ctx, pb.PIR_Chunk_PROVIDER_PEERS, providerPeers))
+	assert.Error(t, streamPIRResponse(ctx, pb.PIR_Chunk_PROVIDER_PEERS, providerPeers))
+	require.NoError(t, rs.finish(&pb.Message{
+		Type:                       pb.Message_PRIVATE_GET_PROVIDERS,
+		PIR_Message_ID:             1234,
+		CloserPeersResponse:        closerPeers,
+		ProviderPeersResponse:      providerPeers,
+		ProviderKeywordTableLength: 9,
+	}))
+
+	reader := msgio.NewVarintReaderSize(&buf, network.MessageSizeMax)
+	data, err := reader.ReadMsg()
+	require.NoError(t, err)
+	msg := &pb.Message{}
+	require.NoError(t, proto.Unmarshal(data, msg))
+	require.True(t, msg.GetStreamedResponse())
+
+	// each part is handed over once it was read completely, in the order it was streamed
+	var parts []*pb.Message
+	require.NoError(t, readStreamedResponse(reader, msg, func(part *pb.Message) {
+		parts = append(parts, part)
+	}))
+	assert.Zero(t, buf.Len())
+	assert.True(t, proto.Equal(expected, msg))
+
+	require.Len(t, parts, 2)
+	assert.True(t, proto.Equal(expected.CloserPeersResponse, parts[0].GetCloserPeersResponse()))
+	assert.Nil(t, parts[0].GetProviderPeersResponse())
+	assert.True(t, proto.Equal(expected.ProviderPeersResponse, parts[1].GetProviderPeersResponse()))
+	assert.Equal(t, expected.PIR_Message_ID, parts[1].GetPIR_Message_ID())
+
+	// without a response stream in the context, nothing is streamed
+	assert.NoError(t, streamPIRResponse(context.Background(), pb.PIR_Chunk_CLOSER_PEERS, closerPeers))
+
+	_, err = newResponseStream(&buf, req, 0)
+	assert.Error(t, err)
+}
+
+func TestResponseStream_streamCiphertexts(t *testing.T) {
+	ciphertexts := [][]byte{bytes.Repeat([]byte{1}, 1500), bytes.Repeat([]byte{2}, 700), bytes.Repeat([]byte{3}, 10)}
+	header := &pb.PIR_Response{EvaluationKeysCached: true}
+
+	var buf bytes.Buffer
+	req := &pb.Message{Type: pb.Message_PRIVATE_FIND_NODE, PIR_Message_ID: 1234, AcceptStreamedResponse: true}
+	rs, err := newResponseStream(&buf, req, 1024)
+	require.NoError(t, err)
+	ctx := withResponseStream(context.Background(), rs)
+
+	// the ciphertexts are written as soon as the protocol hands them over
+	var w pir.ResponseWriter = &partWriter{rs: rs, response: pb.PIR_Chunk_CLOSER_PEERS, header: header}
+	written := 0
+	for _, ct := range ciphertexts {
+		require.NoError(t, w.WriteCiphertexts(ct))
+		require.Greater(t, buf.Len(), written+len(ct))
+		written = buf.Len()
+	}
+
+	// the part is only finished with the computed response, which must match the header
+	assert.Error(t, rs.finish(&pb.Message{}))
+	assert.Error(t, streamPIRResponse(ctx, pb.PIR_Chunk_RECORD, &pb.PIR_Response{}))
+	assert.Error(t, streamPIRResponse(ctx, pb.PIR_Chunk_CLOSER_PEERS, &pb.PIR_Response{}))
+
+	rs, err = newResponseStream(&buf, req, 1024)
+	require.NoError(t, err)
+	buf.Reset()
+	ctx = withResponseStream(context.Background(), rs)
+	w = &partWriter{rs: rs, response: pb.PIR_Chunk_CLOSER_PEERS, header: header}
+	for _, ct := range ciphertexts[:2] {
+		require.NoError(t, w.WriteCiphertexts(ct))
+	}
+	require.NoError(t, streamPIRResponse(ctx, pb.PIR_Chunk_CLOSER_PEERS, &pb.PIR_Response{Ciphertexts: ciphertexts[2], EvaluationKeysCached: true}))
+	require.NoError(t, rs.finish(&pb.Message{Type: pb.Message_PRIVATE_FIND_NODE, PIR_Message_ID: 1234}))
+
+	reader := msgio.NewVarintReaderSize(&buf, network.MessageSizeMax)
+	data, err := reader.ReadMsg()
+	require.NoError(t, err)
+	msg := &pb.Message{}
+	require.NoError(t, proto.Unmarshal(data, msg))
+	require.NoError(t, readStreamedResponse(reader, msg, func(*pb.Message) {}))
+	assert.Zero(t, buf.Len())
+	assert.True(t, proto.Equal(&pb.PIR_Response{Ciphertexts: bytes.Join(ciphertexts, nil), EvaluationKeysCached: true}, msg.GetCloserPeersResponse()))
+
+	// without a response stream in the context, the protocol returns its ciphertexts
+	assert.Equal(t, context.Background(), streamCiphertexts(context.Background(), pb.PIR_Chunk_CLOSER_PEERS, header))
+}
+
+func TestReadStreamedResponse_invalid(t *testing.T) {
+	header := func(response pb.PIR_Chunk_Response) *pb.PIR_Chunk {
+		return &pb.PIR_Chunk{Response: response, Header: &pb.PIR_Response{}}
+	}
+	trailer := &pb.PIR_Chunk{Trailer: &pb.Message{}}
+
+	tests := map[string][]*pb.PIR_Chunk{
+		"missing trailer":         {header(pb.PIR_Chunk_CLOSER_PEERS), {Data: []byte{1}}},
+		"chunk before header":     {{Data: []byte{1}}, trailer},
+		"chunk of another part":   {header(pb.PIR_Chunk_CLOSER_PEERS), {Response: pb.PIR_Chunk_RECORD, Data: []byte{1}}, trailer},
+		"empty chunk":             {header(pb.PIR_Chunk_CLOSER_PEERS), {}, trailer},
+		"oversized chunk":         {header(pb.PIR_Chunk_CLOSER_PEERS), {Data: make([]byte, MaxPIRResponseChunkSize+1)}, trailer},
+		"response streamed twice": {header(pb.PIR_Chunk_CLOSER_PEERS), header(pb.PIR_Chunk_CLOSER_PEERS), trailer},
+		"trailer with streamed response": {
+			header(pb.PIR_Chunk_CLOSER_PEERS),
+			{Trailer: &pb.Message{CloserPeersResponse: &pb.PIR_Response{}}},
+		},
+	}
+
+	for name, chunks := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := msgio.NewVarintWriter(&buf)
+			for _, chunk := range chunks {
+				data, err := proto.Marshal(chunk)
+				require.NoError(t, err)
+				require.NoError(t, w.WriteMsg(data))
+			}
+
+			reader := msgio.NewVarintReaderSize(&buf, network.MessageSizeMax)
+			assert.Error(t, readStreamedResponse(reader, &pb.Message{StreamedResponse: true}, nil))
+		})
+	}
+}
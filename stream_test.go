@@ -16,7 +16,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/plprobelab/zikade/internal/kadtest"
+	"github.com/plprobelab/zikade/kadt"
 	"github.com/plprobelab/zikade/pb"
+	"github.com/plprobelab/zikade/pir"
+	"github.com/plprobelab/zikade/private_routing"
 )
 
 type testReadWriter struct {
@@ -113,6 +117,73 @@ func TestDHT_handleStream_find_node(t *testing.T) {
 	assert.NoError(t, s.Close())
 }
 
+func TestDHT_handleStream_private_find_node_chunked(t *testing.T) {
+	ctx := context.Background()
+	client, serverDHT := newPeerPair(t)
+	serverDHT.cfg.PIRResponseChunkSize = 4096
+
+	tests := map[string]struct {
+		acceptChunked  bool
+		acceptStreamed bool
+	}{
+		"single message": {},
+		"chunked":        {acceptChunked: true},
+		"streamed":       {acceptChunked: true, acceptStreamed: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := client.NewStream(ctx, serverDHT.host.ID(), serverDHT.cfg.ProtocolID)
+			require.NoError(t, err)
+
+			trw := newTestReadWriter(s)
+
+			pirClient := private_routing.NewPirClientPeerRouting(pir.RLWE_Whispir_3_Keys, serverDHT.cfg.PIRRowSize)
+			closerPeersRequest, err := pirClient.GenerateRequest(kadt.PeerID(client.ID()).Key(), kadt.PeerID(serverDHT.host.ID()).Key())
+			require.NoError(t, err)
+
+			err = trw.WriteMsg(&pb.Message{
+				Type:                   pb.Message_PRIVATE_FIND_NODE,
+				PIR_Message_ID:         1234,
+				CloserPeersRequest:     closerPeersRequest,
+				AcceptChunkedResponse:  tt.acceptChunked,
+				AcceptStreamedResponse: tt.acceptStreamed,
+			})
+			require.NoError(t, err)
+
+			resp, err := trw.ReadMsg()
+			require.NoError(t, err)
+
+			// the response is only chunked or streamed if the client accepts it
+			switch {
+			case tt.acceptStreamed:
+				require.True(t, resp.StreamedResponse)
+				require.Nil(t, resp.CloserPeersResponse)
+
+				var parts []*pb.Message
+				require.NoError(t, readStreamedResponse(trw.r, resp, func(part *pb.Message) {
+					parts = append(parts, part)
+				}))
+				require.Len(t, parts, 1)
+				assert.Equal(t, int64(1234), resp.PIR_Message_ID)
+			case tt.acceptChunked:
+				require.NotZero(t, resp.ResponseChunks)
+				require.Empty(t, resp.CloserPeersResponse.Ciphertexts)
+				require.NoError(t, readChunkedResponse(trw.r, resp))
+			default:
+				require.Zero(t, resp.ResponseChunks)
+				require.False(t, resp.StreamedResponse)
+			}
+
+			msg, err := pirClient.ProcessResponse(resp.CloserPeersResponse)
+			require.NoError(t, err)
+			assert.NotEmpty(t, msg.CloserPeers)
+
+			assert.NoError(t, s.Close())
+		})
+	}
+}
+
 func TestDHT_handleStream_unknown_message_type(t *testing.T) {
 	ctx := context.Background()
 	client, serverDHT := newPeerPair(t)
@@ -213,3 +284,48 @@ func TestDHT_handleStream_graceful_close(t *testing.T) {
 
 	runtime.Gosched()
 }
+
+func TestDHT_handlerContext_cancelled_on_disconnect(t *testing.T) {
+	ctx := kadtest.CtxShort(t)
+	client, serverDHT := newPeerPair(t)
+
+	// the handler context is derived from the stream on the side of the server
+	streams := make(chan network.Stream, 1)
+	serverDHT.host.SetStreamHandler("/test/handler-context", func(s network.Stream) {
+		streams <- s
+	})
+
+	cs, err := client.NewStream(ctx, serverDHT.host.ID(), "/test/handler-context")
+	require.NoError(t, err)
+	_, err = cs.Write([]byte{0})
+	require.NoError(t, err)
+
+	var s network.Stream
+	select {
+	case s = <-streams:
+	case <-ctx.Done():
+		t.Fatal("stream not accepted")
+	}
+
+	// contexts of requests on the same connection share the single notifiee
+	handlerCtx1, cancel1 := serverDHT.handlerContext(ctx, s)
+	handlerCtx2, cancel2 := serverDHT.handlerContext(ctx, s)
+	defer cancel2()
+
+	// a finished request is deregistered again
+	cancel1()
+	require.ErrorIs(t, handlerCtx1.Err(), context.Canceled)
+	require.NoError(t, handlerCtx2.Err())
+
+	require.NoError(t, client.Network().ClosePeer(serverDHT.host.ID()))
+
+	select {
+	case <-handlerCtx2.Done():
+	case <-ctx.Done():
+		t.Fatal("handler context not cancelled after disconnect")
+	}
+
+	serverDHT.connCancels.mu.Lock()
+	defer serverDHT.connCancels.mu.Unlock()
+	require.Empty(t, serverDHT.connCancels.cancels)
+}
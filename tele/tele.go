@@ -99,6 +99,11 @@ func AttrKey(val string) attribute.KeyValue {
 	return attribute.String("key", val)
 }
 
+// AttrRejectReason records the limit for which a private request was refused
+func AttrRejectReason(val string) attribute.KeyValue {
+	return attribute.String("reason", val)
+}
+
 // AttrInEvent creates an attribute that records the type of an event
 func AttrInEvent(t any) attribute.KeyValue {
 	return attribute.String(AttrKeyInEvent, fmt.Sprintf("%T", t))
@@ -31,6 +31,8 @@ type Telemetry struct {
 	SentBytes              metric.Int64Histogram
 	LRUCache               metric.Int64Counter
 	NetworkSize            metric.Int64Counter
+	PIRRejectedRequests    metric.Int64Counter
+	PIRInFlightRequests    metric.Int64UpDownCounter
 }
 
 // NewWithGlobalProviders uses the global meter and tracer providers from
@@ -123,5 +125,15 @@ func NewTelemetry(meterProvider metric.MeterProvider, tracerProvider trace.Trace
 		return nil, fmt.Errorf("network_size counter: %w", err)
 	}
 
+	t.PIRRejectedRequests, err = meter.Int64Counter("pir_rejected_requests", metric.WithDescription("Total number of private requests refused by admission control per reason"))
+	if err != nil {
+		return nil, fmt.Errorf("pir_rejected_requests counter: %w", err)
+	}
+
+	t.PIRInFlightRequests, err = meter.Int64UpDownCounter("pir_in_flight_requests", metric.WithDescription("Number of private requests that are processed"))
+	if err != nil {
+		return nil, fmt.Errorf("pir_in_flight_requests counter: %w", err)
+	}
+
 	return t, nil
 }